@@ -0,0 +1,66 @@
+// Package apitoken은 API 토큰을 만들고 저장할 해시를 계산한다. 서버와 pkgadmin이 같은
+// 형식의 토큰을 쓰도록 함께 쓴다.
+package apitoken
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const (
+	ScopePublish = "publish"
+	ScopeRead    = "read"
+	ScopeAdmin   = "admin"
+)
+
+const prefix = "pkg_"
+
+var validScopes = []string{ScopePublish, ScopeRead, ScopeAdmin}
+
+func Generate() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return prefix + hex.EncodeToString(b), nil
+}
+
+// Hash는 저장할 토큰의 해시다. 데이터베이스에는 토큰 원문이 아니라 해시만 저장한다.
+func Hash(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// ParseScopes는 쉼표로 구분한 스코프 목록을 나눈다.
+func ParseScopes(s string) []string {
+	scopes := []string{}
+	for _, scope := range strings.Split(s, ",") {
+		scope = strings.TrimSpace(scope)
+		if len(scope) != 0 {
+			scopes = append(scopes, scope)
+		}
+	}
+	return scopes
+}
+
+func ValidateScopes(scopes []string) error {
+	if len(scopes) == 0 {
+		return errors.New("at least one scope is required")
+	}
+	for _, scope := range scopes {
+		valid := false
+		for _, v := range validScopes {
+			if scope == v {
+				valid = true
+			}
+		}
+		if !valid {
+			return fmt.Errorf("invalid scope: %s", scope)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,48 @@
+package apitoken
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestGenerate(t *testing.T) {
+	token1, err := Generate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	token2, err := Generate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(token1, prefix) || token1 == token2 {
+		t.Fatalf("Expected unique tokens with prefix %s, Got: %s, %s", prefix, token1, token2)
+	}
+	if Hash(token1) == token1 || len(Hash(token1)) != 64 {
+		t.Fatalf("Expected sha256 hex hash, Got: %s", Hash(token1))
+	}
+	if Hash(token1) != Hash(token1) {
+		t.Fatal("Expected hash to be deterministic")
+	}
+}
+
+func TestValidateScopes(t *testing.T) {
+	testConfigs := []struct {
+		scopes string
+		valid  bool
+	}{
+		{scopes: "read", valid: true},
+		{scopes: "publish, read", valid: true},
+		{scopes: "admin", valid: true},
+		{scopes: "", valid: false},
+		{scopes: "read,delete", valid: false},
+	}
+	for _, tc := range testConfigs {
+		err := ValidateScopes(ParseScopes(tc.scopes))
+		if tc.valid && err != nil {
+			t.Errorf("%q: Expected nil error, Got: %v", tc.scopes, err)
+		}
+		if !tc.valid && err == nil {
+			t.Errorf("%q: Expected error, Got: nil", tc.scopes)
+		}
+	}
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/PaulOh5/pkg-server-2/apitoken"
+	"github.com/PaulOh5/pkg-server-2/store"
+)
+
+const (
+	scopePublish = apitoken.ScopePublish
+	scopeRead    = apitoken.ScopeRead
+	scopeAdmin   = apitoken.ScopeAdmin
+)
+
+var errInvalidToken = errors.New("Invalid or revoked token")
+
+type authContextKey struct{}
+type authContextValue struct {
+	userId  int
+	tokenId int
+	scopes  []string
+}
+
+// admin 스코프는 다른 모든 스코프를 포함한다.
+func (a authContextValue) hasScope(scope string) bool {
+	for _, s := range a.scopes {
+		if s == scope || s == scopeAdmin {
+			return true
+		}
+	}
+	return false
+}
+
+// requestToken은 Bearer 토큰을 읽는다. go 명령은 .netrc의 자격 증명을 Basic 인증으로만
+// 보내므로 Basic 인증이면 비밀번호를 토큰으로 쓰고 사용자 이름은 무시한다.
+func requestToken(r *http.Request) (string, bool) {
+	if _, password, ok := r.BasicAuth(); ok {
+		return password, len(password) != 0
+	}
+	header := r.Header.Get("Authorization")
+	scheme, token, found := strings.Cut(header, " ")
+	if !found || !strings.EqualFold(scheme, "Bearer") {
+		return "", false
+	}
+	token = strings.TrimSpace(token)
+	return token, len(token) != 0
+}
+
+func unauthorized(w http.ResponseWriter, message string) {
+	w.Header().Set("WWW-Authenticate", `Bearer realm="pkg-server"`)
+	http.Error(w, message, http.StatusUnauthorized)
+}
+
+// authMiddleware는 Authorization 헤더의 토큰을 사용자로 바꿔 요청 컨텍스트에 넣는다.
+// 토큰이 없는 요청은 그대로 통과시키고, 권한 검사는 핸들러의 requireScope가 한다.
+func authMiddleware(h http.Handler, config appConfig) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if len(r.Header.Get("Authorization")) == 0 {
+			h.ServeHTTP(w, r)
+			return
+		}
+		token, ok := requestToken(r)
+		if !ok {
+			unauthorized(w, "Invalid Authorization header")
+			return
+		}
+		ctx, err := authenticate(r.Context(), config, token)
+		if errors.Is(err, errInvalidToken) {
+			unauthorized(w, err.Error())
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		h.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// authenticate는 토큰의 사용자와 스코프를 담은 컨텍스트를 반환한다.
+func authenticate(ctx context.Context, config appConfig, token string) (context.Context, error) {
+	t, err := config.packageStore.TokenByHash(ctx, apitoken.Hash(token))
+	if errors.Is(err, store.ErrNotFound) || (err == nil && len(t.Revoked) != 0) {
+		return ctx, errInvalidToken
+	}
+	if err != nil {
+		return ctx, err
+	}
+	if err := config.packageStore.TouchToken(ctx, t.Id); err != nil {
+		config.logger.Printf("Failed to update token last_used: %v\n", err)
+	}
+	c := authContextValue{userId: t.UserId, tokenId: t.Id, scopes: t.Scopes}
+	return context.WithValue(ctx, authContextKey{}, c), nil
+}
+
+func getAuth(r *http.Request) (authContextValue, bool) {
+	return authFromContext(r.Context())
+}
+
+func authFromContext(ctx context.Context) (authContextValue, bool) {
+	a, ok := ctx.Value(authContextKey{}).(authContextValue)
+	return a, ok
+}
+
+func requireScope(w http.ResponseWriter, r *http.Request, scope string) (authContextValue, bool) {
+	a, ok := getAuth(r)
+	if !ok {
+		unauthorized(w, "Authentication required")
+		return a, false
+	}
+	if !a.hasScope(scope) {
+		http.Error(w, fmt.Sprintf("Token is missing the %s scope", scope), http.StatusForbidden)
+		return a, false
+	}
+	return a, true
+}
+
+// ensureBootstrapToken은 첫 관리자 토큰을 만들기 위해 BOOTSTRAP_ADMIN_TOKEN을 등록한다.
+// 빈 SQLite나 메모리 저장소처럼 사용자가 없으면 관리자 사용자를 만든다.
+func ensureBootstrapToken(config appConfig, token string, userId int) error {
+	ctx := context.Background()
+	_, err := config.packageStore.TokenByHash(ctx, apitoken.Hash(token))
+	if err == nil {
+		return nil
+	}
+	if !errors.Is(err, store.ErrNotFound) {
+		return err
+	}
+	exists, err := config.packageStore.UserExists(ctx, userId)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		userId, err = config.packageStore.AddUser(ctx, "admin")
+		if err != nil {
+			return err
+		}
+		config.logger.Printf("Created bootstrap admin user %d\n", userId)
+	}
+	_, err = config.packageStore.AddToken(
+		ctx,
+		store.Token{UserId: userId, Name: "bootstrap", Scopes: []string{scopeAdmin}},
+		apitoken.Hash(token),
+	)
+	return err
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/PaulOh5/pkg-server-2/apitoken"
+	"github.com/PaulOh5/pkg-server-2/store"
+)
+
+func TestRequireScope(t *testing.T) {
+	testConfigs := []struct {
+		auth   *authContextValue
+		scope  string
+		status int
+	}{
+		{auth: nil, scope: scopeRead, status: http.StatusUnauthorized},
+		{auth: &authContextValue{userId: 1, scopes: []string{scopeRead}}, scope: scopePublish, status: http.StatusForbidden},
+		{auth: &authContextValue{userId: 1, scopes: []string{scopeRead}}, scope: scopeRead, status: http.StatusOK},
+		{auth: &authContextValue{userId: 1, scopes: []string{scopeAdmin}}, scope: scopePublish, status: http.StatusOK},
+	}
+	for _, tc := range testConfigs {
+		r := httptest.NewRequest("GET", "/api/packages", nil)
+		if tc.auth != nil {
+			r = r.WithContext(context.WithValue(r.Context(), authContextKey{}, *tc.auth))
+		}
+		w := httptest.NewRecorder()
+		a, ok := requireScope(w, r, tc.scope)
+		if ok != (tc.status == http.StatusOK) {
+			t.Fatalf("Expected ok=%v, Got: %v", tc.status == http.StatusOK, ok)
+		}
+		if ok && a.userId != tc.auth.userId {
+			t.Errorf("Expected user %d, Got: %d", tc.auth.userId, a.userId)
+		}
+		if !ok && w.Code != tc.status {
+			t.Errorf("Expected status %d, Got: %d", tc.status, w.Code)
+		}
+	}
+}
+
+func TestAuthMiddlewareRejectsMalformedHeader(t *testing.T) {
+	h := authMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := getAuth(r); ok {
+			t.Error("Expected anonymous request")
+		}
+		w.WriteHeader(http.StatusOK)
+	}), appConfig{})
+
+	r := httptest.NewRequest("GET", "/api/packages", nil)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected anonymous request to pass through, Got: %d", w.Code)
+	}
+
+	r.Header.Set("Authorization", "Token dXNlcjpwYXNz")
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status 401, Got: %d", w.Code)
+	}
+}
+
+func TestAuthMiddlewareBasicAuth(t *testing.T) {
+	config := appConfig{
+		logger:       log.New(io.Discard, "", 0),
+		packageStore: store.NewMemoryStore(),
+	}
+	_, err := config.packageStore.AddToken(
+		context.Background(),
+		store.Token{UserId: 7, Name: "netrc", Scopes: []string{scopeRead}},
+		apitoken.Hash("test-token"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := authMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if a, ok := getAuth(r); !ok || a.userId != 7 {
+			t.Errorf("Expected user 7, Got: %#v", a)
+		}
+		w.WriteHeader(http.StatusOK)
+	}), config)
+
+	testConfigs := []struct {
+		password string
+		status   int
+	}{
+		{password: "test-token", status: http.StatusOK},
+		{password: "wrong-token", status: http.StatusUnauthorized},
+	}
+	for _, tc := range testConfigs {
+		r := httptest.NewRequest("GET", "/go/example.com/mod/@v/list", nil)
+		r.SetBasicAuth("anyone", tc.password)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if w.Code != tc.status {
+			t.Errorf("Expected status %d, Got: %d", tc.status, w.Code)
+		}
+	}
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/PaulOh5/pkg-server-2/semver"
+	"github.com/PaulOh5/pkg-server-2/store"
+)
+
+const (
+	defaultPackageCacheSize = 1000
+	// pkgadmin처럼 다른 프로세스가 바꾼 버전은 캐시를 비우지 못하므로 이 시간까지만 믿는다.
+	defaultPackageCacheAge = time.Minute
+
+	// 질의 결과와 범위로 고른 버전은 바뀔 수 있으므로 매번 ETag로 다시 확인하게 한다
+	cacheControlRevalidate = "private, no-cache"
+	// 정확한 버전의 객체는 관리자가 지우고 다시 게시하지 않는 한 바뀌지 않는다
+	cacheControlImmutable = "private, max-age=31536000, immutable"
+)
+
+type packageCacheEntry struct {
+	key     packageName
+	pkgs    []store.Package
+	fetched time.Time
+}
+
+// packageCache는 소유자와 이름별 버전 목록을 최근에 쓴 순서로 size개까지 담는 LRU 캐시다.
+// 게시, 회수, 삭제는 해당 패키지를 캐시에서 지운다.
+type packageCache struct {
+	mu      sync.Mutex
+	size    int
+	maxAge  time.Duration
+	order   *list.List
+	entries map[packageName]*list.Element
+	// generation은 invalidate마다 늘어난다. 조회하는 동안 바뀌었으면 결과를 담지 않는다.
+	generation uint64
+	now        func() time.Time
+}
+
+func newPackageCache(size int, maxAge time.Duration) *packageCache {
+	return &packageCache{
+		size:    size,
+		maxAge:  maxAge,
+		order:   list.New(),
+		entries: map[packageName]*list.Element{},
+		now:     time.Now,
+	}
+}
+
+func (c *packageCache) get(key packageName) ([]store.Package, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	entry := e.Value.(*packageCacheEntry)
+	if c.now().Sub(entry.fetched) > c.maxAge {
+		c.order.Remove(e)
+		delete(c.entries, key)
+		return nil, false
+	}
+	c.order.MoveToFront(e)
+	return entry.pkgs, true
+}
+
+func (c *packageCache) put(key packageName, pkgs []store.Package, generation uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if generation != c.generation {
+		return
+	}
+	if e, ok := c.entries[key]; ok {
+		c.order.Remove(e)
+	}
+	c.entries[key] = c.order.PushFront(&packageCacheEntry{key: key, pkgs: pkgs, fetched: c.now()})
+	for c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*packageCacheEntry).key)
+	}
+}
+
+// versions는 패키지의 모든 버전을 회수된 버전을 포함해 우선순위 순서로 반환한다.
+// c가 nil이면 매번 저장소에서 읽는다.
+func (c *packageCache) versions(
+	ctx context.Context, packageStore store.PackageStore, ownerId int, name string,
+) ([]store.Package, error) {
+	q := store.QueryParams{OwnerId: ownerId, Name: name}
+	if c == nil {
+		return packageStore.QueryPackages(ctx, q)
+	}
+	key := packageName{ownerId, name}
+	if pkgs, ok := c.get(key); ok {
+		return slices.Clone(pkgs), nil
+	}
+	c.mu.Lock()
+	generation := c.generation
+	c.mu.Unlock()
+	pkgs, err := packageStore.QueryPackages(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+	c.put(key, pkgs, generation)
+	return slices.Clone(pkgs), nil
+}
+
+// invalidate는 c가 nil이면 아무것도 하지 않는다.
+func (c *packageCache) invalidate(ownerId int, name string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.generation++
+	key := packageName{ownerId, name}
+	if e, ok := c.entries[key]; ok {
+		c.order.Remove(e)
+		delete(c.entries, key)
+	}
+}
+
+// exactVersion은 저장소의 Version 조건처럼 버전 목록에서 version과 키가 같은 버전을 찾는다.
+func exactVersion(pkgs []store.Package, version string) []store.Package {
+	v, err := semver.Parse(version)
+	if err != nil {
+		return nil
+	}
+	for _, p := range pkgs {
+		if pv, err := semver.Parse(p.Version); err == nil && pv.Key() == v.Key() {
+			return []store.Package{p}
+		}
+	}
+	return nil
+}
+
+// storeTime은 저장소의 시각을 읽는다. 비어 있거나 읽을 수 없으면 0을 반환한다.
+func storeTime(s string) time.Time {
+	t, _ := time.Parse(store.TimeFormat, s)
+	return t
+}
+
+// packageModified는 ownerId와 name의 패키지를 마지막으로 게시, 회수, 삭제한 시각을 Last-Modified로
+// 쓸 수 있으면 반환하고 아니면 0을 반환한다. 시각은 초 단위이고 캐시는 maxAge 동안 예전 버전 목록을 주므로,
+// 그보다 최근에 바뀌었으면 같은 Last-Modified로 다른 응답을 보냈을 수 있다.
+func packageModified(ctx context.Context, config appConfig, ownerId int, name string) (time.Time, error) {
+	s, err := config.packageStore.PackagesModified(ctx, ownerId, name)
+	if err != nil {
+		return time.Time{}, err
+	}
+	settle := time.Second
+	if config.packages != nil {
+		settle += config.packages.maxAge
+	}
+	modified := storeTime(s)
+	if time.Since(modified) < settle {
+		return time.Time{}, nil
+	}
+	return modified, nil
+}
+
+func contentETag(data []byte) string {
+	sum := sha256.Sum256(data)
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// packageETag는 객체의 체크섬으로 만든다. 체크섬이 없는 예전 패키지는 객체 키와 게시 시각을 쓴다.
+func packageETag(p store.Package) string {
+	if len(p.Sha256) != 0 {
+		return `"sha256-` + p.Sha256 + `"`
+	}
+	return contentETag([]byte(p.ObjectStoreId + "\n" + p.Created))
+}
+
+func etagMatches(header, etag string) bool {
+	for _, v := range strings.Split(header, ",") {
+		v = strings.TrimSpace(v)
+		// If-None-Match는 약한 비교를 쓴다
+		if v == "*" || strings.TrimPrefix(v, "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+	return false
+}
+
+// checkNotModified는 ETag, Last-Modified, Cache-Control 헤더를 설정하고 조건부 요청의
+// 조건을 만족하면 304를 보낸 뒤 true를 반환한다. RFC 9110처럼 If-None-Match가 있으면
+// If-Modified-Since는 보지 않는다.
+func checkNotModified(
+	w http.ResponseWriter, r *http.Request,
+	etag string, modified time.Time, cacheControl string,
+) bool {
+	h := w.Header()
+	h.Set("ETag", etag)
+	h.Set("Cache-Control", cacheControl)
+	if !modified.IsZero() {
+		h.Set("Last-Modified", modified.UTC().Format(http.TimeFormat))
+	}
+	if r.Method != "GET" && r.Method != "HEAD" {
+		return false
+	}
+	if inm := r.Header.Get("If-None-Match"); len(inm) != 0 {
+		if !etagMatches(inm, etag) {
+			return false
+		}
+	} else {
+		ims, err := http.ParseTime(r.Header.Get("If-Modified-Since"))
+		// Last-Modified는 초 단위까지만 보낸다
+		if err != nil || modified.IsZero() || modified.Truncate(time.Second).After(ims) {
+			return false
+		}
+	}
+	w.WriteHeader(http.StatusNotModified)
+	return true
+}
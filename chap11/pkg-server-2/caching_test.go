@@ -0,0 +1,227 @@
+package main
+
+import (
+	"context"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/PaulOh5/pkg-server-2/apitoken"
+	"github.com/PaulOh5/pkg-server-2/store"
+	"gocloud.dev/blob/fileblob"
+)
+
+// countingStore는 QueryPackages 호출 수를 센다.
+type countingStore struct {
+	store.PackageStore
+	queries int
+}
+
+func (s *countingStore) QueryPackages(ctx context.Context, q store.QueryParams) ([]store.Package, error) {
+	s.queries++
+	return s.PackageStore.QueryPackages(ctx, q)
+}
+
+func TestPackageCache(t *testing.T) {
+	ctx := context.Background()
+	s := &countingStore{PackageStore: store.NewMemoryStore()}
+	for _, name := range []string{"a", "b", "c"} {
+		if err := s.AddPackage(ctx, store.Package{OwnerId: 1, Name: name, Version: "1.0.0", ObjectStoreId: name}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	now := time.Now()
+	c := newPackageCache(2, time.Minute)
+	c.now = func() time.Time { return now }
+
+	testConfigs := []struct {
+		name    string
+		queries int
+		before  func()
+	}{
+		{name: "a", queries: 1},
+		{name: "a", queries: 1},
+		{name: "b", queries: 2},
+		// c를 담으면서 가장 오래 쓰지 않은 a를 내보낸다
+		{name: "c", queries: 3},
+		{name: "a", queries: 4},
+		{name: "c", queries: 4},
+		{name: "c", queries: 5, before: func() { c.invalidate(1, "c") }},
+		{name: "c", queries: 6, before: func() { now = now.Add(2 * time.Minute) }},
+	}
+	for i, tc := range testConfigs {
+		if tc.before != nil {
+			tc.before()
+		}
+		pkgs, err := c.versions(ctx, s, 1, tc.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(pkgs) != 1 || pkgs[0].Name != tc.name {
+			t.Errorf("%d: Expected %s, Got: %#v", i, tc.name, pkgs)
+		}
+		if s.queries != tc.queries {
+			t.Errorf("%d: Expected %d queries, Got: %d", i, tc.queries, s.queries)
+		}
+	}
+
+	// 조회하는 동안 비운 결과는 담지 않는다
+	generation := c.generation
+	c.invalidate(1, "b")
+	c.put(packageName{1, "b"}, nil, generation)
+	if _, ok := c.get(packageName{1, "b"}); ok {
+		t.Error("Expected stale result not to be cached")
+	}
+}
+
+func TestConditionalRequests(t *testing.T) {
+	packageBucket, err := fileblob.OpenBucket(t.TempDir(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer packageBucket.Close()
+
+	config := appConfig{
+		logger:        log.New(io.Discard, "", 0),
+		packageBucket: packageBucket,
+		packageStore:  store.NewMemoryStore(),
+		// Last-Modified는 캐시의 maxAge와 1초가 지나야 보내므로 짧게 둔다
+		packages: newPackageCache(defaultPackageCacheSize, 100*time.Millisecond),
+	}
+	ctx := context.Background()
+	token := "test-token"
+	_, err = config.packageStore.AddToken(
+		ctx,
+		store.Token{UserId: 1, Name: "test", Scopes: []string{scopePublish, scopeRead}},
+		apitoken.Hash(token),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mux := http.NewServeMux()
+	setupHandlers(mux, config)
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	publish := func(version string) {
+		req, err := newUploadRequest(
+			ts.URL+"/api/packages", token,
+			map[string]string{"name": "pkg", "version": version}, "pkg.tar.gz", []byte("data-"+version),
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("Expected publish to succeed, Got: %d", resp.StatusCode)
+		}
+	}
+	do := func(method, path string, headers map[string]string) *http.Response {
+		req, err := http.NewRequest(method, ts.URL+path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp
+	}
+
+	publish("1.0.0")
+	query := "/api/packages?owner_id=1&name=pkg&version=latest"
+	// 방금 바뀐 패키지는 같은 초에 다시 바뀔 수 있으므로 Last-Modified를 보내지 않는다
+	if resp := do("GET", query, nil); len(resp.Header.Get("Last-Modified")) != 0 {
+		t.Errorf("Expected no Last-Modified right after publish, Got: %v", resp.Header)
+	}
+	settle := 1200 * time.Millisecond
+	time.Sleep(settle)
+	resp := do("GET", query, nil)
+	etag := resp.Header.Get("ETag")
+	if resp.StatusCode != http.StatusOK || len(etag) == 0 || len(resp.Header.Get("Last-Modified")) == 0 {
+		t.Fatalf("Expected 200 with ETag and Last-Modified, Got: %d %v", resp.StatusCode, resp.Header)
+	}
+	if resp.Header.Get("Cache-Control") != cacheControlRevalidate {
+		t.Errorf("Expected Cache-Control %s, Got: %s", cacheControlRevalidate, resp.Header.Get("Cache-Control"))
+	}
+	download := "/api/packages/download?owner_id=1&name=pkg&version=1.0.0&download=true"
+	dl := do("GET", download, nil)
+	if dl.Header.Get("Cache-Control") != cacheControlImmutable {
+		t.Errorf("Expected Cache-Control %s, Got: %s", cacheControlImmutable, dl.Header.Get("Cache-Control"))
+	}
+
+	testConfigs := []struct {
+		name    string
+		path    string
+		headers map[string]string
+		before  func()
+		status  int
+	}{
+		{name: "same etag", path: query, headers: map[string]string{"If-None-Match": etag}, status: http.StatusNotModified},
+		{name: "etag list", path: query, headers: map[string]string{"If-None-Match": `"other", W/` + etag}, status: http.StatusNotModified},
+		{name: "other etag", path: query, headers: map[string]string{"If-None-Match": `"other"`}, status: http.StatusOK},
+		{
+			name: "not modified since", path: query, status: http.StatusNotModified,
+			headers: map[string]string{"If-Modified-Since": resp.Header.Get("Last-Modified")},
+		},
+		{
+			name: "modified since", path: query, status: http.StatusOK,
+			headers: map[string]string{"If-Modified-Since": time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat)},
+		},
+		{name: "download etag", path: download, headers: map[string]string{"If-None-Match": dl.Header.Get("ETag")}, status: http.StatusNotModified},
+		// 게시와 회수는 캐시를 비우므로 latest의 결과가 바로 바뀐다
+		{name: "published", path: query, headers: map[string]string{"If-None-Match": etag}, before: func() { publish("1.1.0") }, status: http.StatusOK},
+		{
+			name: "yanked", path: query, headers: map[string]string{"If-None-Match": etag}, status: http.StatusNotModified,
+			before: func() {
+				if resp := do("DELETE", "/api/packages?owner_id=1&name=pkg&version=1.1.0", nil); resp.StatusCode != http.StatusNoContent {
+					t.Fatalf("Expected yank to succeed, Got: %d", resp.StatusCode)
+				}
+			},
+		},
+	}
+	for _, tc := range testConfigs {
+		if tc.before != nil {
+			tc.before()
+		}
+		resp := do("GET", tc.path, tc.headers)
+		if resp.StatusCode != tc.status {
+			t.Errorf("%s: Expected %d, Got: %d", tc.name, tc.status, resp.StatusCode)
+		}
+	}
+
+	// 가장 높은 버전을 회수하면 latest가 더 낮은 버전으로 바뀌므로 예전 If-Modified-Since에 304를 보내지 않는다
+	publish("2.0.0")
+	time.Sleep(settle)
+	latest := "/api/packages/download?owner_id=1&name=pkg&version=latest&download=true"
+	lastModified := map[string]string{}
+	for _, path := range []string{query, latest} {
+		lastModified[path] = do("GET", path, nil).Header.Get("Last-Modified")
+		ims := map[string]string{"If-Modified-Since": lastModified[path]}
+		if resp := do("GET", path, ims); len(lastModified[path]) == 0 || resp.StatusCode != http.StatusNotModified {
+			t.Fatalf("%s: Expected 304 before yank, Got: %d %q", path, resp.StatusCode, lastModified[path])
+		}
+	}
+	if resp := do("DELETE", "/api/packages?owner_id=1&name=pkg&version=2.0.0", nil); resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("Expected yank to succeed, Got: %d", resp.StatusCode)
+	}
+	for _, path := range []string{query, latest} {
+		resp := do("GET", path, map[string]string{"If-Modified-Since": lastModified[path]})
+		if resp.StatusCode != http.StatusOK {
+			t.Errorf("%s: Expected 200 after yank, Got: %d", path, resp.StatusCode)
+		}
+	}
+}
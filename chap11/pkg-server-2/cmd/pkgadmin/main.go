@@ -0,0 +1,144 @@
+// pkgadmin은 패키지 서버 운영자용 명령이다. 서버와 같은 설정으로 저장소와 버킷을 열어
+// 데이터베이스를 직접 고치지 않고 사용자, 토큰, 패키지를 관리한다.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/PaulOh5/pkg-server-2/settings"
+	"github.com/PaulOh5/pkg-server-2/store"
+	"gocloud.dev/blob"
+)
+
+var errInvalidSubCommand = errors.New("invalid sub-command specified")
+
+const usage = `Usage: pkgadmin <command> [options]
+
+Commands:
+  user add|list          manage users
+  token create|list|revoke
+                         manage API tokens
+  package list|yank      list and yank package versions
+  verify                 check every object_store_id against the bucket
+  reindex                rewrite the search index from the stored metadata
+  usage                  export a usage report
+
+Run pkgadmin <command> -h for the options of a command.
+The store and the bucket are configured like the server: options before the
+command, environment variables and the file given with -config.`
+
+type adminConfig struct {
+	packageStore store.PackageStore
+	// packageBucket은 버킷이 필요한 명령에서만 연다.
+	packageBucket *blob.Bucket
+}
+
+func printUsage(w io.Writer) {
+	fmt.Fprintln(w, usage)
+}
+
+// newFlagSet은 오류를 반환하고 사용법을 w에 쓰는 하위 명령의 FlagSet을 만든다.
+func newFlagSet(w io.Writer, name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(w)
+	return fs
+}
+
+func handleCommand(ctx context.Context, w io.Writer, config adminConfig, args []string) error {
+	if len(args) < 1 {
+		return errInvalidSubCommand
+	}
+	switch args[0] {
+	case "user":
+		return handleUser(ctx, w, config, args[1:])
+	case "token":
+		return handleToken(ctx, w, config, args[1:])
+	case "package":
+		return handlePackage(ctx, w, config, args[1:])
+	case "verify":
+		return handleVerify(ctx, w, config, args[1:])
+	case "reindex":
+		return handleReindex(ctx, w, config, args[1:])
+	case "usage":
+		return handleUsage(ctx, w, config, args[1:])
+	}
+	return errInvalidSubCommand
+}
+
+// checkSchema는 서버와 마찬가지로 오래된 스키마에서는 실행하지 않는다.
+func checkSchema(ctx context.Context, packageStore store.PackageStore) error {
+	m, ok := packageStore.(store.Migrator)
+	if !ok {
+		return nil
+	}
+	status, err := m.MigrationStatus(ctx)
+	if err != nil {
+		return err
+	}
+	if n := store.Pending(status); n != 0 {
+		return fmt.Errorf(
+			"%w: %d pending migrations, run: pkg-server-2 migrate up",
+			store.ErrSchemaOutdated, n,
+		)
+	}
+	return nil
+}
+
+// run은 명령 앞의 플래그로 서버와 같은 설정을 읽는다. 예를 들어
+// pkgadmin -config server.json user list.
+func run(ctx context.Context, w io.Writer, args []string) error {
+	fs := newFlagSet(w, "pkgadmin")
+	loader := settings.NewLoader(fs)
+	fs.Usage = func() {
+		printUsage(w)
+		fmt.Fprintln(w)
+		fmt.Fprintln(w, "Options:")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	args = fs.Args()
+	if len(args) == 0 {
+		return errInvalidSubCommand
+	}
+	cfg, err := loader.Load(settings.Defaults(), os.Getenv)
+	if err != nil {
+		return fmt.Errorf("invalid configuration:\n%w", err)
+	}
+	packageStore, err := cfg.OpenStore()
+	if err != nil {
+		return err
+	}
+	defer packageStore.Close()
+	if err := checkSchema(ctx, packageStore); err != nil {
+		return err
+	}
+	config := adminConfig{packageStore: packageStore}
+	if args[0] == "verify" {
+		config.packageBucket, err = cfg.OpenBucket(ctx)
+		if err != nil {
+			return err
+		}
+		defer config.packageBucket.Close()
+	}
+	return handleCommand(ctx, w, config, args)
+}
+
+func main() {
+	err := run(context.Background(), os.Stdout, os.Args[1:])
+	// -h로 출력한 사용법은 오류가 아니다
+	if err == nil || errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	fmt.Fprintln(os.Stderr, err)
+	if errors.Is(err, errInvalidSubCommand) {
+		printUsage(os.Stderr)
+	}
+	os.Exit(1)
+}
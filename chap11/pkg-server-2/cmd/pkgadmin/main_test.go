@@ -0,0 +1,158 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/PaulOh5/pkg-server-2/apitoken"
+	"github.com/PaulOh5/pkg-server-2/digest"
+	"github.com/PaulOh5/pkg-server-2/store"
+	"gocloud.dev/blob/fileblob"
+)
+
+func TestHandleCommand(t *testing.T) {
+	packageBucket, err := fileblob.OpenBucket(t.TempDir(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer packageBucket.Close()
+	config := adminConfig{packageStore: store.NewMemoryStore(), packageBucket: packageBucket}
+	ctx := context.Background()
+
+	testConfigs := []struct {
+		args   []string
+		output string
+		err    error
+	}{
+		{args: []string{}, err: errInvalidSubCommand},
+		{args: []string{"users"}, err: errInvalidSubCommand},
+		{args: []string{"user", "add", "-name", "alice"}, output: "Created user 1 (alice)\n"},
+		{args: []string{"user", "add", "-name", "bob"}, output: "Created user 2 (bob)\n"},
+		{args: []string{"user", "add"}, err: errors.New("-name is required")},
+		{args: []string{"user", "list"}, output: "ID  USERNAME\n1   alice\n2   bob\n"},
+		{args: []string{"token", "create", "-user", "3", "-name", "ci", "-scopes", "read"}, err: errors.New("no such user: 3")},
+		{args: []string{"token", "create", "-user", "1", "-name", "ci", "-scopes", "read,delete"}, err: errors.New("invalid scope: delete")},
+		{args: []string{"token", "revoke", "-id", "1"}, err: errors.New("no active token: 1")},
+		{args: []string{"package", "yank", "-owner", "1", "-name", "pkg", "-version", "1.0.0"}, err: errors.New("no package found: 1/pkg@1.0.0")},
+		{args: []string{"usage", "-format", "xml"}, err: errors.New("unknown format: xml")},
+	}
+	byteBuf := new(bytes.Buffer)
+	for _, tc := range testConfigs {
+		err := handleCommand(ctx, byteBuf, config, tc.args)
+		if tc.err == nil && err != nil {
+			t.Fatalf("%v: Expected nil error, Got: %v", tc.args, err)
+		}
+		if tc.err != nil && (err == nil || err.Error() != tc.err.Error()) {
+			t.Fatalf("%v: Expected error %v, Got: %v", tc.args, tc.err, err)
+		}
+		if len(tc.output) != 0 && byteBuf.String() != tc.output {
+			t.Errorf("%v: Expected output %q, Got: %q", tc.args, tc.output, byteBuf.String())
+		}
+		byteBuf.Reset()
+	}
+
+	// 만든 토큰으로 서버에 인증할 수 있다
+	if err := handleCommand(ctx, byteBuf, config, []string{"token", "create", "-user", "1", "-name", "ci", "-scopes", "read, publish"}); err != nil {
+		t.Fatal(err)
+	}
+	secret := strings.TrimSpace(strings.TrimPrefix(byteBuf.String(), "Created token 1 for user 1: "))
+	token, err := config.packageStore.TokenByHash(ctx, apitoken.Hash(secret))
+	if err != nil || token.UserId != 1 || strings.Join(token.Scopes, ",") != "read,publish" {
+		t.Fatalf("Expected token for user 1, Got: %#v, %v", token, err)
+	}
+	byteBuf.Reset()
+	if err := handleCommand(ctx, byteBuf, config, []string{"token", "revoke", "-id", "1"}); err != nil {
+		t.Fatal(err)
+	}
+	if token, err := config.packageStore.TokenByHash(ctx, apitoken.Hash(secret)); err != nil || len(token.Revoked) == 0 {
+		t.Errorf("Expected token to be revoked, Got: %#v, %v", token, err)
+	}
+
+	data := map[string][]byte{"1.0.0": []byte("one"), "1.1.0": []byte("one-one"), "2.0.0": []byte("two")}
+	for version, content := range data {
+		d, size, err := digest.Compute(bytes.NewReader(content))
+		if err != nil {
+			t.Fatal(err)
+		}
+		p := store.Package{
+			OwnerId: 1, Name: "pkg", Version: version, ObjectStoreId: "1/pkg-" + version,
+			Sha256: d.Sha256, Sha512: d.Sha512, Size: size,
+		}
+		if err := config.packageStore.AddPackage(ctx, p); err != nil {
+			t.Fatal(err)
+		}
+		if err := config.packageStore.PutMetadata(ctx, store.Metadata{OwnerId: 1, Name: "pkg", Version: version, Description: "a package"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for version, content := range map[string][]byte{"1.0.0": data["1.0.0"], "1.1.0": []byte("corrupt")} {
+		if err := packageBucket.WriteAll(ctx, "1/pkg-"+version, content, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	byteBuf.Reset()
+	if err := handleCommand(ctx, byteBuf, config, []string{"package", "yank", "-owner", "1", "-name", "pkg", "-version", "2.0.0"}); err != nil {
+		t.Fatal(err)
+	}
+	byteBuf.Reset()
+	if err := handleCommand(ctx, byteBuf, config, []string{"package", "list", "-owner", "1"}); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(byteBuf.String()), "\n")
+	// 날짜와 시각이 따로 나뉘므로 회수된 버전만 8개 필드다
+	if len(lines) != 4 || len(strings.Fields(lines[1])) != 6 ||
+		!strings.HasPrefix(lines[3], "1      pkg   2.0.0") || len(strings.Fields(lines[3])) != 8 {
+		t.Errorf("Expected three versions with 2.0.0 yanked, Got: %q", byteBuf.String())
+	}
+
+	byteBuf.Reset()
+	err = handleCommand(ctx, byteBuf, config, []string{"verify"})
+	if !errors.Is(err, errVerifyFailed) {
+		t.Errorf("Expected error %v, Got: %v", errVerifyFailed, err)
+	}
+	expected := "1/pkg@1.1.0 1/pkg-1.1.0: checksum mismatch\n" +
+		"1/pkg@2.0.0 1/pkg-2.0.0: object is missing\n" +
+		"Verified 3 versions, 2 failed\n"
+	if byteBuf.String() != expected {
+		t.Errorf("Expected output %q, Got: %q", expected, byteBuf.String())
+	}
+
+	byteBuf.Reset()
+	if err := handleCommand(ctx, byteBuf, config, []string{"reindex"}); err != nil {
+		t.Fatal(err)
+	}
+	if byteBuf.String() != "Reindexed 3 of 3 versions\n" {
+		t.Errorf("Unexpected output: %q", byteBuf.String())
+	}
+
+	if err := config.packageStore.SetOwnerLimits(ctx, store.Limits{OwnerId: 2, MaxStorage: 100}); err != nil {
+		t.Fatal(err)
+	}
+	byteBuf.Reset()
+	if err := handleCommand(ctx, byteBuf, config, []string{"usage"}); err != nil {
+		t.Fatal(err)
+	}
+	expected = "owner_id,username,versions,stored_bytes,publishes,max_storage,max_package_size,publishes_per_hour\n" +
+		"1,alice,3,13,3,0,0,0\n" +
+		"2,bob,0,0,0,100,0,0\n"
+	if byteBuf.String() != expected {
+		t.Errorf("Expected output %q, Got: %q", expected, byteBuf.String())
+	}
+	byteBuf.Reset()
+	if err := handleCommand(ctx, byteBuf, config, []string{"usage", "-format", "json"}); err != nil {
+		t.Fatal(err)
+	}
+	records := []usageRecord{}
+	if err := json.Unmarshal(byteBuf.Bytes(), &records); err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 2 || records[0].Username != "alice" || records[0].Limits != nil ||
+		records[1].Limits == nil || records[1].Limits.MaxStorage != 100 {
+		t.Errorf("Unexpected report: %#v", records)
+	}
+}
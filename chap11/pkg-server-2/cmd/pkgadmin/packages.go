@@ -0,0 +1,157 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"text/tabwriter"
+
+	"github.com/PaulOh5/pkg-server-2/digest"
+	"github.com/PaulOh5/pkg-server-2/store"
+	"gocloud.dev/gcerrors"
+)
+
+const packageUsage = "usage: pkgadmin package list [-owner id] [-name name] [-prefix prefix]|yank -owner id -name name -version version"
+
+var errVerifyFailed = errors.New("verification failed")
+
+// allPackages는 회수된 버전을 포함해 게시된 모든 버전을 반환한다.
+func allPackages(ctx context.Context, packageStore store.PackageStore) ([]store.Package, error) {
+	return packageStore.QueryPackages(ctx, store.QueryParams{OwnerId: -1})
+}
+
+// handlePackage의 yank는 서버와 달리 웹훅을 보내지 않는다.
+func handlePackage(ctx context.Context, w io.Writer, config adminConfig, args []string) error {
+	if len(args) == 0 {
+		return errors.New(packageUsage)
+	}
+	fs := newFlagSet(w, "package "+args[0])
+	q := store.QueryParams{}
+	fs.IntVar(&q.OwnerId, "owner", -1, "owner ID, -1 lists every owner")
+	fs.StringVar(&q.Name, "name", "", "package name")
+	fs.StringVar(&q.NamePrefix, "prefix", "", "package name prefix")
+	fs.StringVar(&q.Version, "version", "", "exact version")
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+
+	switch args[0] {
+	case "list":
+		pkgs, err := config.packageStore.QueryPackages(ctx, q)
+		if err != nil {
+			return err
+		}
+		tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "OWNER\tNAME\tVERSION\tSIZE\tCREATED\tYANKED")
+		for _, p := range pkgs {
+			fmt.Fprintf(tw, "%d\t%s\t%s\t%d\t%s\t%s\n", p.OwnerId, p.Name, p.Version, p.Size, p.Created, p.Yanked)
+		}
+		return tw.Flush()
+	case "yank":
+		if q.OwnerId == -1 || len(q.Name) == 0 || len(q.Version) == 0 {
+			return errors.New("-owner, -name and -version are required")
+		}
+		err := config.packageStore.YankPackage(ctx, q.OwnerId, q.Name, q.Version)
+		if errors.Is(err, store.ErrNotFound) {
+			return fmt.Errorf("no package found: %d/%s@%s", q.OwnerId, q.Name, q.Version)
+		}
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "Yanked %d/%s@%s\n", q.OwnerId, q.Name, q.Version)
+		return nil
+	}
+	return errors.New(packageUsage)
+}
+
+// verifyPackage는 버전의 객체가 버킷에 있는지, 기록된 크기와 체크섬이 맞는지 확인한다.
+// 크기나 체크섬을 기록하기 전에 게시한 버전은 있는 것만 비교한다.
+func verifyPackage(ctx context.Context, config adminConfig, p store.Package, checksums bool) (string, error) {
+	attrs, err := config.packageBucket.Attributes(ctx, p.ObjectStoreId)
+	if gcerrors.Code(err) == gcerrors.NotFound {
+		return "object is missing", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	if p.Size != 0 && attrs.Size != p.Size {
+		return fmt.Sprintf("object is %d bytes, expected %d", attrs.Size, p.Size), nil
+	}
+	expected := digest.Digests{Sha256: p.Sha256, Sha512: p.Sha512}
+	if !checksums || expected.IsEmpty() {
+		return "", nil
+	}
+	actual, _, err := digest.Object(ctx, config.packageBucket, p.ObjectStoreId)
+	if err != nil {
+		return "", err
+	}
+	// 한쪽 체크섬만 기록된 버전도 있다
+	if len(expected.Sha256) == 0 {
+		actual.Sha256 = ""
+	}
+	if len(expected.Sha512) == 0 {
+		actual.Sha512 = ""
+	}
+	if !expected.Equal(actual) {
+		return "checksum mismatch", nil
+	}
+	return "", nil
+}
+
+func handleVerify(ctx context.Context, w io.Writer, config adminConfig, args []string) error {
+	fs := newFlagSet(w, "verify")
+	checksums := fs.Bool("checksums", true, "read every object and compare the recorded checksums")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	pkgs, err := allPackages(ctx, config.packageStore)
+	if err != nil {
+		return err
+	}
+	failed := 0
+	for _, p := range pkgs {
+		problem, err := verifyPackage(ctx, config, p, *checksums)
+		if err != nil {
+			return fmt.Errorf("%s: %w", p.ObjectStoreId, err)
+		}
+		if len(problem) != 0 {
+			failed++
+			fmt.Fprintf(w, "%d/%s@%s %s: %s\n", p.OwnerId, p.Name, p.Version, p.ObjectStoreId, problem)
+		}
+	}
+	fmt.Fprintf(w, "Verified %d versions, %d failed\n", len(pkgs), failed)
+	if failed != 0 {
+		return fmt.Errorf("%w: %d versions", errVerifyFailed, failed)
+	}
+	return nil
+}
+
+// handleReindex는 저장된 메타데이터를 다시 써서 검색 색인을 새로 만든다. 색인 방식이 바뀐
+// 뒤나 색인이 메타데이터와 어긋났을 때 쓴다.
+func handleReindex(ctx context.Context, w io.Writer, config adminConfig, args []string) error {
+	fs := newFlagSet(w, "reindex")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	pkgs, err := allPackages(ctx, config.packageStore)
+	if err != nil {
+		return err
+	}
+	reindexed := 0
+	for _, p := range pkgs {
+		m, err := config.packageStore.Metadata(ctx, p.OwnerId, p.Name, p.Version)
+		if errors.Is(err, store.ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if err := config.packageStore.PutMetadata(ctx, m); err != nil {
+			return fmt.Errorf("%d/%s@%s: %w", p.OwnerId, p.Name, p.Version, err)
+		}
+		reindexed++
+	}
+	fmt.Fprintf(w, "Reindexed %d of %d versions\n", reindexed, len(pkgs))
+	return nil
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/PaulOh5/pkg-server-2/store"
+)
+
+// usageRecord는 사용량 보고서의 한 줄이다. Limits는 관리자가 따로 정한 한도이고 없으면
+// 서버 기본값을 쓴다.
+type usageRecord struct {
+	store.Usage
+	Username string        `json:"username"`
+	Limits   *store.Limits `json:"limits,omitempty"`
+}
+
+var usageColumns = []string{
+	"owner_id", "username", "versions", "stored_bytes", "publishes",
+	"max_storage", "max_package_size", "publishes_per_hour",
+}
+
+func (u usageRecord) csvRow() []string {
+	limits := store.Limits{}
+	if u.Limits != nil {
+		limits = *u.Limits
+	}
+	return []string{
+		strconv.Itoa(u.OwnerId), u.Username, strconv.Itoa(u.Versions),
+		strconv.FormatInt(u.StoredBytes, 10), strconv.Itoa(u.Publishes),
+		strconv.FormatInt(limits.MaxStorage, 10), strconv.FormatInt(limits.MaxPackageSize, 10),
+		strconv.Itoa(limits.PublishesPerHour),
+	}
+}
+
+func usageReport(ctx context.Context, packageStore store.PackageStore, since string) ([]usageRecord, error) {
+	users, err := packageStore.Users(ctx)
+	if err != nil {
+		return nil, err
+	}
+	records := []usageRecord{}
+	for _, user := range users {
+		u, err := packageStore.Usage(ctx, user.Id, since)
+		if err != nil {
+			return nil, err
+		}
+		r := usageRecord{Usage: u, Username: user.Username}
+		l, err := packageStore.OwnerLimits(ctx, user.Id)
+		switch {
+		case err == nil:
+			r.Limits = &l
+		case !errors.Is(err, store.ErrNotFound):
+			return nil, err
+		}
+		records = append(records, r)
+	}
+	return records, nil
+}
+
+// handleUsage는 모든 사용자의 사용량을 CSV나 JSON으로 내보낸다. publishes는 -since 동안
+// 게시한 버전의 수다.
+func handleUsage(ctx context.Context, w io.Writer, config adminConfig, args []string) error {
+	fs := newFlagSet(w, "usage")
+	format := fs.String("format", "csv", "report format: csv or json")
+	since := fs.Duration("since", 30*24*time.Hour, "count publishes in this period")
+	output := fs.String("o", "", "write the report to this file instead of standard output")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *format != "csv" && *format != "json" {
+		return fmt.Errorf("unknown format: %s", *format)
+	}
+	records, err := usageReport(
+		ctx, config.packageStore, time.Now().Add(-*since).UTC().Format(store.TimeFormat),
+	)
+	if err != nil {
+		return err
+	}
+
+	out := w
+	if len(*output) != 0 {
+		f, err := os.Create(*output)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		out = f
+	}
+	if *format == "json" {
+		enc := json.NewEncoder(out)
+		enc.SetIndent("", "  ")
+		return enc.Encode(records)
+	}
+	cw := csv.NewWriter(out)
+	cw.Write(usageColumns)
+	for _, r := range records {
+		cw.Write(r.csvRow())
+	}
+	cw.Flush()
+	return cw.Error()
+}
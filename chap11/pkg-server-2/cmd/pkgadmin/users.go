@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/PaulOh5/pkg-server-2/apitoken"
+	"github.com/PaulOh5/pkg-server-2/store"
+)
+
+const (
+	userUsage  = "usage: pkgadmin user add -name username|list"
+	tokenUsage = "usage: pkgadmin token create -user id -name name -scopes read,publish|list -user id|revoke -id id"
+)
+
+func handleUser(ctx context.Context, w io.Writer, config adminConfig, args []string) error {
+	if len(args) == 0 {
+		return errors.New(userUsage)
+	}
+	fs := newFlagSet(w, "user "+args[0])
+	name := fs.String("name", "", "username of the new user")
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+
+	switch args[0] {
+	case "add":
+		if len(*name) == 0 {
+			return errors.New("-name is required")
+		}
+		id, err := config.packageStore.AddUser(ctx, *name)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "Created user %d (%s)\n", id, *name)
+		return nil
+	case "list":
+		users, err := config.packageStore.Users(ctx)
+		if err != nil {
+			return err
+		}
+		tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "ID\tUSERNAME")
+		for _, u := range users {
+			fmt.Fprintf(tw, "%d\t%s\n", u.Id, u.Username)
+		}
+		return tw.Flush()
+	}
+	return errors.New(userUsage)
+}
+
+func handleToken(ctx context.Context, w io.Writer, config adminConfig, args []string) error {
+	if len(args) == 0 {
+		return errors.New(tokenUsage)
+	}
+	fs := newFlagSet(w, "token "+args[0])
+	userId := fs.Int("user", 0, "ID of the user who owns the token")
+	name := fs.String("name", "", "name of the new token")
+	scopes := fs.String("scopes", "", "comma separated scopes of the new token: read, publish, admin")
+	id := fs.Int("id", 0, "ID of the token to revoke")
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+
+	switch args[0] {
+	case "create":
+		if len(*name) == 0 {
+			return errors.New("-name is required")
+		}
+		t := store.Token{UserId: *userId, Name: *name, Scopes: apitoken.ParseScopes(*scopes)}
+		if err := apitoken.ValidateScopes(t.Scopes); err != nil {
+			return err
+		}
+		exists, err := config.packageStore.UserExists(ctx, t.UserId)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			return fmt.Errorf("no such user: %d", t.UserId)
+		}
+		secret, err := apitoken.Generate()
+		if err != nil {
+			return err
+		}
+		t.Id, err = config.packageStore.AddToken(ctx, t, apitoken.Hash(secret))
+		if err != nil {
+			return err
+		}
+		// 토큰 원문은 저장하지 않으므로 지금만 보여줄 수 있다
+		fmt.Fprintf(w, "Created token %d for user %d: %s\n", t.Id, t.UserId, secret)
+		return nil
+	case "list":
+		tokens, err := config.packageStore.Tokens(ctx, *userId)
+		if err != nil {
+			return err
+		}
+		tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "ID\tNAME\tSCOPES\tCREATED\tLAST USED\tREVOKED")
+		for _, t := range tokens {
+			fmt.Fprintf(
+				tw, "%d\t%s\t%s\t%s\t%s\t%s\n",
+				t.Id, t.Name, strings.Join(t.Scopes, ","), t.Created, t.LastUsed, t.Revoked,
+			)
+		}
+		return tw.Flush()
+	case "revoke":
+		revoked, err := config.packageStore.RevokeToken(ctx, *id, -1)
+		if err != nil {
+			return err
+		}
+		if !revoked {
+			return fmt.Errorf("no active token: %d", *id)
+		}
+		fmt.Fprintf(w, "Revoked token %d\n", *id)
+		return nil
+	}
+	return errors.New(tokenUsage)
+}
@@ -0,0 +1,343 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/PaulOh5/pkg-server-2/semver"
+	"github.com/PaulOh5/pkg-server-2/store"
+)
+
+const (
+	maxDependencies = 100
+	// maxDependencyDepth보다 깊은 트리는 풀지 않는다.
+	maxDependencyDepth = 100
+)
+
+var (
+	errDependencyCycle      = errors.New("dependency cycle")
+	errUnresolvedDependency = errors.New("unresolved dependency")
+	errDependencyTooDeep    = errors.New("dependency tree is too deep")
+)
+
+// parseDependencyName은 매니페스트의 의존성 이름을 소유자 ID와 이름으로 나눈다. 숫자로만
+// 된 첫 경로 요소는 소유자 ID다. 소유자 ID가 없으면 0을 반환한다.
+func parseDependencyName(s string) (int, string, error) {
+	owner, name := 0, s
+	if i := strings.Index(s, "/"); i > 0 {
+		if id, err := strconv.Atoi(s[:i]); err == nil {
+			owner, name = id, s[i+1:]
+		}
+	}
+	if owner < 0 || len(name) == 0 || strings.TrimSpace(name) != name {
+		return 0, "", badRequest("invalid dependency name %q", s)
+	}
+	return owner, name, nil
+}
+
+// dependencyList는 normalize를 통과한 의존성 맵을 저장할 목록으로 바꾼다.
+func dependencyList(owner int, deps map[string]string) []store.Dependency {
+	list := []store.Dependency{}
+	for s, constraint := range deps {
+		depOwner, name, err := parseDependencyName(s)
+		if err != nil {
+			continue
+		}
+		if depOwner == 0 {
+			depOwner = owner
+		}
+		list = append(list, store.Dependency{OwnerId: depOwner, Name: name, Constraint: constraint})
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].OwnerId != list[j].OwnerId {
+			return list[i].OwnerId < list[j].OwnerId
+		}
+		return list[i].Name < list[j].Name
+	})
+	return list
+}
+
+func packageLabel(ownerId int, name, version string) string {
+	return fmt.Sprintf("%d/%s@%s", ownerId, name, version)
+}
+
+type packageName struct {
+	ownerId int
+	name    string
+}
+
+// dependencyResolver는 의존성마다 제약을 만족하는 가장 높은 버전을 골라 트리를 만든다.
+// 같은 버전은 한 번만 펼치고 이후에는 Deduped로 표시한다.
+type dependencyResolver struct {
+	config appConfig
+	// pending은 게시하려는 버전의 메타데이터다. 아직 저장소에 없으므로 조회 결과에 더한다.
+	pending  *store.Metadata
+	versions map[packageName][]store.Package
+	expanded map[string]bool
+}
+
+func newDependencyResolver(config appConfig, pending *store.Metadata) *dependencyResolver {
+	return &dependencyResolver{
+		config:   config,
+		pending:  pending,
+		versions: map[packageName][]store.Package{},
+		expanded: map[string]bool{},
+	}
+}
+
+func (r *dependencyResolver) isPending(ownerId int, name, version string) bool {
+	return r.pending != nil && r.pending.OwnerId == ownerId && r.pending.Name == name && r.pending.Version == version
+}
+
+// packageVersions는 패키지의 게시된 버전을 우선순위 순서로 반환한다.
+func (r *dependencyResolver) packageVersions(ctx context.Context, ownerId int, name string) ([]store.Package, error) {
+	key := packageName{ownerId, name}
+	if pkgs, ok := r.versions[key]; ok {
+		return pkgs, nil
+	}
+	pkgs, err := r.config.packages.versions(ctx, r.config.packageStore, ownerId, name)
+	if err != nil {
+		return nil, err
+	}
+	if r.pending != nil && r.pending.OwnerId == ownerId && r.pending.Name == name {
+		pkgs = append(pkgs, store.Package{OwnerId: ownerId, Name: name, Version: r.pending.Version})
+		sort.SliceStable(pkgs, func(i, j int) bool {
+			vi, _ := semver.Parse(pkgs[i].Version)
+			vj, _ := semver.Parse(pkgs[j].Version)
+			return vi.Compare(vj) < 0
+		})
+	}
+	r.versions[key] = pkgs
+	return pkgs, nil
+}
+
+func (r *dependencyResolver) dependencies(ctx context.Context, p store.Package) ([]store.Dependency, error) {
+	if r.isPending(p.OwnerId, p.Name, p.Version) {
+		return r.pending.Dependencies, nil
+	}
+	m, err := r.config.packageStore.Metadata(ctx, p.OwnerId, p.Name, p.Version)
+	if errors.Is(err, store.ErrNotFound) {
+		return nil, nil
+	}
+	return m.Dependencies, err
+}
+
+// resolve는 제약을 만족하는 가장 높은 버전을 고른다. 정확한 버전은 회수되었어도 고른다.
+func (r *dependencyResolver) resolve(ctx context.Context, d store.Dependency) (store.Package, bool, error) {
+	spec, err := parseVersionSpec(d.Constraint)
+	if err != nil {
+		return store.Package{}, false, nil
+	}
+	pkgs, err := r.packageVersions(ctx, d.OwnerId, d.Name)
+	if err != nil {
+		return store.Package{}, false, err
+	}
+	if len(spec.exact) != 0 {
+		for _, p := range pkgs {
+			if p.Version == spec.exact {
+				return p, true, nil
+			}
+		}
+		return store.Package{}, false, nil
+	}
+	pkgs = filterVersions(pkgs, spec)
+	if len(pkgs) == 0 {
+		return store.Package{}, false, nil
+	}
+	return pkgs[len(pkgs)-1], true, nil
+}
+
+// walk는 p의 의존성을 node 아래에 채운다. path는 루트에서 p까지의 버전이다.
+func (r *dependencyResolver) walk(ctx context.Context, node *dependencyNode, p store.Package, path []string) error {
+	path = append(path, packageLabel(p.OwnerId, p.Name, p.Version))
+	if len(path) > maxDependencyDepth {
+		return fmt.Errorf("%w: more than %d levels", errDependencyTooDeep, maxDependencyDepth)
+	}
+	r.expanded[path[len(path)-1]] = true
+	deps, err := r.dependencies(ctx, p)
+	if err != nil {
+		return err
+	}
+	for _, d := range deps {
+		child := dependencyNode{
+			OwnerId:      d.OwnerId,
+			Name:         d.Name,
+			Constraint:   d.Constraint,
+			Dependencies: []dependencyNode{},
+		}
+		resolved, ok, err := r.resolve(ctx, d)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			child.Unresolved = true
+			node.Dependencies = append(node.Dependencies, child)
+			continue
+		}
+		child.Version = resolved.Version
+		label := packageLabel(resolved.OwnerId, resolved.Name, resolved.Version)
+		for i, l := range path {
+			if l == label {
+				cycle := append(append([]string{}, path[i:]...), label)
+				return fmt.Errorf("%w: %s", errDependencyCycle, strings.Join(cycle, " -> "))
+			}
+		}
+		// 이미 펼친 버전은 경로에 없으므로 그 아래에서 사이클이 생기지 않는다
+		if r.expanded[label] {
+			child.Deduped = true
+		} else if err := r.walk(ctx, &child, resolved, path); err != nil {
+			return err
+		}
+		node.Dependencies = append(node.Dependencies, child)
+	}
+	return nil
+}
+
+// resolveDependencies는 p의 의존성 트리를 만든다. 사이클이 있으면 경로와 함께
+// errDependencyCycle을 반환한다.
+func resolveDependencies(ctx context.Context, config appConfig, p store.Package, pending *store.Metadata) (dependencyNode, error) {
+	root := dependencyNode{
+		OwnerId:      p.OwnerId,
+		Name:         p.Name,
+		Version:      p.Version,
+		Dependencies: []dependencyNode{},
+	}
+	err := newDependencyResolver(config, pending).walk(ctx, &root, p, nil)
+	return root, err
+}
+
+// checkDependencies는 게시하려는 버전의 의존성을 확인한다. 직접 의존하는 패키지는 제약을
+// 만족하는 버전이 있어야 하고, 이 버전을 게시해서 사이클이 생기면 안 된다.
+func checkDependencies(ctx context.Context, config appConfig, m store.Metadata) error {
+	if len(m.Dependencies) == 0 {
+		return nil
+	}
+	p := store.Package{OwnerId: m.OwnerId, Name: m.Name, Version: m.Version}
+	root, err := resolveDependencies(ctx, config, p, &m)
+	if err != nil {
+		return err
+	}
+	for _, d := range root.Dependencies {
+		if d.Unresolved {
+			return fmt.Errorf(
+				"%w: no version of %d/%s matches %q",
+				errUnresolvedDependency, d.OwnerId, d.Name, d.Constraint,
+			)
+		}
+	}
+	return nil
+}
+
+// dependencyStatus는 의존성 트리를 풀 수 없는 오류의 응답 코드다.
+func dependencyStatus(err error) int {
+	if errors.Is(err, errDependencyCycle) || errors.Is(err, errDependencyTooDeep) {
+		return http.StatusConflict
+	}
+	return http.StatusInternalServerError
+}
+
+// packageDependenciesHandler는 버전의 의존성을 지금 게시된 버전으로 풀어 트리로 보여준다.
+func packageDependenciesHandler(
+	w http.ResponseWriter,
+	r *http.Request,
+	config appConfig,
+) {
+	if r.Method != "GET" {
+		http.Error(w, "Invalid Method", http.StatusMethodNotAllowed)
+		return
+	}
+	if _, ok := requireScope(w, r, scopeRead); !ok {
+		return
+	}
+	pkg, ok := findPackage(w, r, config)
+	if !ok {
+		return
+	}
+	root, err := resolveDependencies(r.Context(), config, pkg, nil)
+	if err != nil {
+		http.Error(w, err.Error(), dependencyStatus(err))
+		return
+	}
+	writeJSON(w, http.StatusOK, root)
+}
+
+// packageDependentsHandler는 패키지에 의존하는 버전을 보여준다. 정확한 version을 주면
+// 제약이 그 버전과 일치하는 버전만 남긴다.
+func packageDependentsHandler(
+	w http.ResponseWriter,
+	r *http.Request,
+	config appConfig,
+) {
+	if r.Method != "GET" {
+		http.Error(w, "Invalid Method", http.StatusMethodNotAllowed)
+		return
+	}
+	if _, ok := requireScope(w, r, scopeRead); !ok {
+		return
+	}
+	q, spec, err := parseQuery(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if q.OwnerId == -1 || len(q.Name) == 0 {
+		http.Error(w, "Must specify package owner and name", http.StatusBadRequest)
+		return
+	}
+	if !spec.isEmpty() && len(spec.exact) == 0 {
+		http.Error(w, "version must be an exact version", http.StatusBadRequest)
+		return
+	}
+	dependents, err := config.packageStore.Dependents(r.Context(), q.OwnerId, q.Name)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if len(spec.exact) != 0 {
+		dependents, err = dependentsOf(r.Context(), config, q, dependents)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+	writeJSON(w, http.StatusOK, dependents)
+}
+
+// dependentsOf는 제약이 q.Version을 허용하는 의존 버전만 남긴다. latest는 지금 가장 높은
+// 버전일 때만 허용한다.
+func dependentsOf(ctx context.Context, config appConfig, q store.QueryParams, dependents []store.Dependent) ([]store.Dependent, error) {
+	v, err := semver.Parse(q.Version)
+	if err != nil {
+		return nil, err
+	}
+	resolver := newDependencyResolver(config, nil)
+	result := []store.Dependent{}
+	for _, d := range dependents {
+		spec, err := parseVersionSpec(d.Constraint)
+		if err != nil {
+			continue
+		}
+		allowed := false
+		switch {
+		case len(spec.exact) != 0:
+			allowed = spec.exact == q.Version
+		case spec.latest:
+			p, ok, err := resolver.resolve(ctx, store.Dependency{OwnerId: q.OwnerId, Name: q.Name, Constraint: d.Constraint})
+			if err != nil {
+				return nil, err
+			}
+			allowed = ok && p.Version == q.Version
+		default:
+			allowed = spec.constraint.Check(v)
+		}
+		if allowed {
+			result = append(result, d)
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/PaulOh5/pkg-server-2/apitoken"
+	"github.com/PaulOh5/pkg-server-2/store"
+)
+
+func TestParseDependencyName(t *testing.T) {
+	testConfigs := []struct {
+		input string
+		owner int
+		name  string
+		err   bool
+	}{
+		{input: "lib", name: "lib"},
+		{input: "2/lib", owner: 2, name: "lib"},
+		{input: "example.com/mod", name: "example.com/mod"},
+		{input: "3/example.com/mod", owner: 3, name: "example.com/mod"},
+		{input: "", err: true},
+		{input: "2/", err: true},
+		{input: "-1/lib", err: true},
+		{input: " lib", err: true},
+	}
+	for _, tc := range testConfigs {
+		owner, name, err := parseDependencyName(tc.input)
+		if (err != nil) != tc.err {
+			t.Errorf("%q: Expected error: %v, Got: %v", tc.input, tc.err, err)
+			continue
+		}
+		if owner != tc.owner || name != tc.name {
+			t.Errorf("%q: Expected %d/%s, Got: %d/%s", tc.input, tc.owner, tc.name, owner, name)
+		}
+	}
+}
+
+func TestDependencies(t *testing.T) {
+	packageBucket, err := getTestBucket(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer packageBucket.Close()
+
+	config := appConfig{
+		logger:        log.New(io.Discard, "", 0),
+		packageBucket: packageBucket,
+		packageStore:  store.NewMemoryStore(),
+	}
+	ctx := context.Background()
+	tokens := map[string]int{"owner": 1, "other": 2}
+	for token, userId := range tokens {
+		_, err := config.packageStore.AddToken(
+			ctx,
+			store.Token{UserId: userId, Name: token, Scopes: []string{scopePublish, scopeRead}},
+			apitoken.Hash(token),
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	mux := http.NewServeMux()
+	setupHandlers(mux, config)
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	publish := func(token, name, version, deps string) (int, string) {
+		fields := map[string]string{"name": name, "version": version}
+		if len(deps) != 0 {
+			fields["dependencies"] = deps
+		}
+		req, err := newUploadRequest(ts.URL+"/api/packages", token, fields, "pkg.tar.gz", []byte(name+version))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, string(body)
+	}
+	get := func(path string, v interface{}) int {
+		req, err := http.NewRequest("GET", ts.URL+path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer owner")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode == http.StatusOK {
+			if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return resp.StatusCode
+	}
+
+	for _, p := range []struct{ token, name, version, deps string }{
+		{token: "owner", name: "lib", version: "1.0.0"},
+		{token: "owner", name: "lib", version: "1.1.0"},
+		{token: "other", name: "util", version: "0.1.0", deps: `{"1/lib": "1.0.0"}`},
+		{token: "owner", name: "app", version: "1.0.0", deps: `{"lib": "^1.0.0", "2/util": "latest"}`},
+	} {
+		if status, body := publish(p.token, p.name, p.version, p.deps); status != http.StatusOK {
+			t.Fatalf("%s@%s: Expected status 200, Got: %d %s", p.name, p.version, status, body)
+		}
+	}
+
+	testConfigs := []struct {
+		name   string
+		deps   string
+		status int
+		body   string
+	}{
+		{name: "invalid json", deps: `["lib"]`, status: http.StatusBadRequest, body: "JSON object"},
+		{name: "invalid constraint", deps: `{"lib": "not-a-version"}`, status: http.StatusBadRequest, body: "invalid version constraint"},
+		{name: "unresolved", deps: `{"lib": "^2.0.0"}`, status: http.StatusBadRequest, body: `no version of 1/lib matches "^2.0.0"`},
+		{name: "missing package", deps: `{"2/lib": "*"}`, status: http.StatusBadRequest, body: "no version of 2/lib"},
+		{name: "self", deps: `{"cli": "latest"}`, status: http.StatusBadRequest, body: "1/cli@1.0.0 -> 1/cli@1.0.0"},
+	}
+	for _, tc := range testConfigs {
+		status, body := publish("owner", "cli", "1.0.0", tc.deps)
+		if status != tc.status || !strings.Contains(body, tc.body) {
+			t.Errorf("%s: Expected %d %q, Got: %d %q", tc.name, tc.status, tc.body, status, body)
+		}
+	}
+	// lib 1.2.0이 app에 의존하면 app의 ^1.0.0이 lib 1.2.0으로 풀려 사이클이 된다
+	status, body := publish("owner", "lib", "1.2.0", `{"app": "^1.0.0"}`)
+	if status != http.StatusBadRequest || !strings.Contains(body, "dependency cycle: 1/lib@1.2.0 -> 1/app@1.0.0 -> 1/lib@1.2.0") {
+		t.Errorf("Expected dependency cycle, Got: %d %q", status, body)
+	}
+
+	tree := dependencyNode{}
+	if status := get("/api/packages/dependencies?owner_id=1&name=app&version=1.0.0", &tree); status != http.StatusOK {
+		t.Fatalf("Expected status 200, Got: %d", status)
+	}
+	expected := dependencyNode{
+		OwnerId: 1, Name: "app", Version: "1.0.0",
+		Dependencies: []dependencyNode{
+			{OwnerId: 1, Name: "lib", Version: "1.1.0", Constraint: "^1.0.0", Dependencies: []dependencyNode{}},
+			{OwnerId: 2, Name: "util", Version: "0.1.0", Constraint: "latest", Dependencies: []dependencyNode{
+				{OwnerId: 1, Name: "lib", Version: "1.0.0", Constraint: "1.0.0", Dependencies: []dependencyNode{}},
+			}},
+		},
+	}
+	if !reflect.DeepEqual(tree, expected) {
+		t.Errorf("Expected %#v, Got: %#v", expected, tree)
+	}
+
+	dependents := []store.Dependent{}
+	if status := get("/api/packages/dependents?owner_id=1&name=lib", &dependents); status != http.StatusOK {
+		t.Fatalf("Expected status 200, Got: %d", status)
+	}
+	if len(dependents) != 2 || dependents[0].Name != "app" || dependents[1].Name != "util" {
+		t.Errorf("Unexpected dependents: %#v", dependents)
+	}
+	if get("/api/packages/dependents?owner_id=1&name=lib&version=1.1.0", &dependents); len(dependents) != 1 || dependents[0].Name != "app" {
+		t.Errorf("Expected only app to allow lib 1.1.0, Got: %#v", dependents)
+	}
+	if status := get("/api/packages/dependents?owner_id=1&name=lib&version=^1.0.0", &dependents); status != http.StatusBadRequest {
+		t.Errorf("Expected status 400, Got: %d", status)
+	}
+
+	// 검사할 때는 없던 사이클도 회수로 해석이 바뀌면 생길 수 있다
+	if status, body := publish("owner", "lib", "1.0.1", `{"app": "^1.0.0"}`); status != http.StatusOK {
+		t.Fatalf("Expected status 200, Got: %d %s", status, body)
+	}
+	req, err := http.NewRequest("DELETE", ts.URL+"/api/packages?owner_id=1&name=lib&version=1.1.0", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Authorization", "Bearer owner")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("Expected status 204, Got: %d", resp.StatusCode)
+	}
+	if status := get("/api/packages/dependencies?owner_id=1&name=app&version=1.0.0", &tree); status != http.StatusConflict {
+		t.Errorf("Expected status 409, Got: %d", status)
+	}
+}
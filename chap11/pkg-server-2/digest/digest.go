@@ -0,0 +1,108 @@
+// Package digest는 패키지 내용의 SHA-256, SHA-512 체크섬을 계산한다.
+package digest
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"hash"
+	"io"
+	"strings"
+
+	"gocloud.dev/blob"
+)
+
+// Digests는 16진수 소문자로 인코딩한 체크섬이다.
+type Digests struct {
+	Sha256 string `json:"sha256"`
+	Sha512 string `json:"sha512"`
+}
+
+// Hasher는 쓰인 바이트의 체크섬을 한 번에 계산한다. io.MultiWriter와 함께 써서
+// 업로드를 스트리밍하면서 체크섬을 구한다.
+type Hasher struct {
+	h256 hash.Hash
+	h512 hash.Hash
+	n    int64
+}
+
+func NewHasher() *Hasher {
+	return &Hasher{h256: sha256.New(), h512: sha512.New()}
+}
+
+func (h *Hasher) Write(p []byte) (int, error) {
+	h.h256.Write(p)
+	h.h512.Write(p)
+	h.n += int64(len(p))
+	return len(p), nil
+}
+
+func (h *Hasher) Size() int64 {
+	return h.n
+}
+
+func (h *Hasher) Digests() Digests {
+	return Digests{
+		Sha256: hex.EncodeToString(h.h256.Sum(nil)),
+		Sha512: hex.EncodeToString(h.h512.Sum(nil)),
+	}
+}
+
+func Compute(r io.Reader) (Digests, int64, error) {
+	h := NewHasher()
+	_, err := io.Copy(h, r)
+	return h.Digests(), h.n, err
+}
+
+// Object는 버킷에 저장된 객체를 다시 읽어 체크섬을 계산한다.
+func Object(ctx context.Context, bucket *blob.Bucket, key string) (Digests, int64, error) {
+	r, err := bucket.NewReader(ctx, key, nil)
+	if err != nil {
+		return Digests{}, 0, err
+	}
+	defer r.Close()
+	return Compute(r)
+}
+
+func (d Digests) IsEmpty() bool {
+	return len(d.Sha256) == 0 && len(d.Sha512) == 0
+}
+
+// Equal은 대소문자를 구분하지 않고 비교한다.
+func (d Digests) Equal(o Digests) bool {
+	return strings.EqualFold(d.Sha256, o.Sha256) && strings.EqualFold(d.Sha512, o.Sha512)
+}
+
+// ReprDigest는 RFC 9530 Repr-Digest 헤더 값을 반환한다.
+func (d Digests) ReprDigest() string {
+	return joinFields(d, func(alg, value string) string {
+		return alg + "=:" + value + ":"
+	})
+}
+
+// Digest는 RFC 3230 Digest 헤더 값을 반환한다. 아직 Repr-Digest를 모르는 클라이언트를 위한 것이다.
+func (d Digests) Digest() string {
+	return joinFields(d, func(alg, value string) string {
+		return strings.ToUpper(alg) + "=" + value
+	})
+}
+
+func joinFields(d Digests, format func(alg, value string) string) string {
+	fields := []string{}
+	for _, f := range []struct {
+		alg string
+		hex string
+	}{
+		{alg: "sha-256", hex: d.Sha256},
+		{alg: "sha-512", hex: d.Sha512},
+	} {
+		b, err := hex.DecodeString(f.hex)
+		if err != nil || len(b) == 0 {
+			continue
+		}
+		fields = append(fields, format(f.alg, base64.StdEncoding.EncodeToString(b)))
+	}
+	return strings.Join(fields, ", ")
+}
@@ -0,0 +1,43 @@
+package digest
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestHasher(t *testing.T) {
+	var buf bytes.Buffer
+	h := NewHasher()
+	n, err := io.Copy(io.MultiWriter(&buf, h), strings.NewReader("abc"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 3 || h.Size() != 3 || buf.String() != "abc" {
+		t.Fatalf("Expected 3 bytes to be copied, Got: %d, %d, %q", n, h.Size(), buf.String())
+	}
+	d := h.Digests()
+	expected := Digests{
+		Sha256: "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad",
+		Sha512: "ddaf35a193617abacc417349ae20413112e6fa4e89a97ea20a9eeee64b55d39a" +
+			"2192992a274fc1a836ba3c23a3feebbd454d4423643ce80e2a9ac94fa54ca49f",
+	}
+	if d != expected {
+		t.Fatalf("Expected %v, Got: %v", expected, d)
+	}
+	if !d.Equal(Digests{Sha256: strings.ToUpper(d.Sha256), Sha512: d.Sha512}) {
+		t.Error("Expected digests to compare case-insensitively")
+	}
+
+	repr := d.ReprDigest()
+	if !strings.HasPrefix(repr, "sha-256=:ungWv48Bz+pBQUDeXa4iI7ADYaOWF3qctBD/YfIAFa0=:, sha-512=:") {
+		t.Errorf("Unexpected Repr-Digest: %s", repr)
+	}
+	if !strings.HasPrefix(d.Digest(), "SHA-256=ungWv48Bz+pBQUDeXa4iI7ADYaOWF3qctBD/YfIAFa0=, SHA-512=") {
+		t.Errorf("Unexpected Digest: %s", d.Digest())
+	}
+	if (Digests{}).ReprDigest() != "" {
+		t.Error("Expected empty header value for empty digests")
+	}
+}
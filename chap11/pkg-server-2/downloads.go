@@ -0,0 +1,244 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/PaulOh5/pkg-server-2/semver"
+	"github.com/PaulOh5/pkg-server-2/store"
+)
+
+const (
+	defaultDownloadFlushInterval = 10 * time.Second
+	defaultStatsDays             = 30
+	maxStatsDays                 = 365
+	defaultTopLimit              = 10
+	maxTopLimit                  = 100
+)
+
+type downloadKey struct {
+	ownerId int
+	name    string
+	version string
+	day     string
+}
+
+// downloadCounter는 다운로드 수를 메모리에 모았다가 flush할 때 한 번에 저장소에 쓴다.
+// 다운로드 요청은 잠금 하나만 잡고 바로 돌아가므로 데이터베이스 쓰기를 기다리지 않는다.
+// 아직 flush하지 않은 수는 통계 API에 보이지 않는다.
+type downloadCounter struct {
+	mu     sync.Mutex
+	counts map[downloadKey]int64
+	store  store.PackageStore
+	now    func() time.Time
+}
+
+func newDownloadCounter(s store.PackageStore) *downloadCounter {
+	return &downloadCounter{
+		counts: map[downloadKey]int64{},
+		store:  s,
+		now:    time.Now,
+	}
+}
+
+// Add는 c가 nil이면 아무것도 하지 않는다.
+func (c *downloadCounter) Add(p store.Package) {
+	if c == nil {
+		return
+	}
+	day := c.now().UTC().Format(store.DayFormat)
+	c.mu.Lock()
+	c.counts[downloadKey{p.OwnerId, p.Name, p.Version, day}]++
+	c.mu.Unlock()
+}
+
+// Flush는 모은 수를 저장소에 쓴다. 쓰지 못한 수는 다음 Flush에서 다시 쓴다.
+func (c *downloadCounter) Flush(ctx context.Context) error {
+	if c == nil {
+		return nil
+	}
+	c.mu.Lock()
+	pending := c.counts
+	c.counts = map[downloadKey]int64{}
+	c.mu.Unlock()
+	if len(pending) == 0 {
+		return nil
+	}
+
+	counts := []store.DownloadCount{}
+	for k, n := range pending {
+		counts = append(counts, store.DownloadCount{
+			OwnerId: k.ownerId, Name: k.name, Version: k.version, Day: k.day, Count: n,
+		})
+	}
+	err := c.store.AddDownloads(ctx, counts)
+	if err != nil {
+		c.mu.Lock()
+		for k, n := range pending {
+			c.counts[k] += n
+		}
+		c.mu.Unlock()
+	}
+	return err
+}
+
+// runDownloadFlush는 interval마다 다운로드 수를 저장소에 쓰고, ctx가 끝나면 남은 수를 마지막으로 쓴다.
+func runDownloadFlush(ctx context.Context, config appConfig, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			if err := config.downloads.Flush(context.Background()); err != nil {
+				config.logger.Printf("Failed to flush download counts: %v\n", err)
+			}
+			return
+		case <-ticker.C:
+		}
+		if err := config.downloads.Flush(ctx); err != nil {
+			config.logger.Printf("Failed to flush download counts: %v\n", err)
+		}
+	}
+}
+
+// parseDays는 days 파라미터를 읽어 통계를 시작할 날짜를 반환한다.
+func parseDays(r *http.Request, now time.Time) (int, string, error) {
+	days := defaultStatsDays
+	if d := r.URL.Query().Get("days"); len(d) != 0 {
+		var err error
+		days, err = strconv.Atoi(d)
+		if err != nil || days <= 0 {
+			return 0, "", errors.New("invalid days")
+		}
+		if days > maxStatsDays {
+			days = maxStatsDays
+		}
+	}
+	since := now.UTC().AddDate(0, 0, 1-days).Format(store.DayFormat)
+	return days, since, nil
+}
+
+// packageStatsHandler는 패키지의 전체 다운로드 수, 버전별 다운로드 수와
+// 최근 days일의 날짜별 다운로드 수를 반환한다. 다운로드가 없는 날은 0으로 채운다.
+func packageStatsHandler(
+	w http.ResponseWriter,
+	r *http.Request,
+	config appConfig,
+) {
+	if r.Method != "GET" {
+		http.Error(w, "Invalid Method", http.StatusMethodNotAllowed)
+		return
+	}
+	if _, ok := requireScope(w, r, scopeRead); !ok {
+		return
+	}
+	q, _, err := parseQuery(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if q.OwnerId == -1 || len(q.Name) == 0 {
+		http.Error(w, "Must specify package owner and name", http.StatusBadRequest)
+		return
+	}
+	now := time.Now()
+	days, since, err := parseDays(r, now)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	counts, err := config.packageStore.DownloadStats(r.Context(), q.OwnerId, q.Name, "")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	resp := pkgStatsResponse{
+		OwnerId:  q.OwnerId,
+		Name:     q.Name,
+		Versions: []versionDownloads{},
+		Daily:    []dailyDownloads{},
+	}
+	byVersion := map[string]int64{}
+	byDay := map[string]int64{}
+	for _, c := range counts {
+		resp.Total += c.Count
+		byVersion[c.Version] += c.Count
+		if c.Day >= since {
+			byDay[c.Day] += c.Count
+		}
+	}
+	for version, n := range byVersion {
+		resp.Versions = append(resp.Versions, versionDownloads{Version: version, Downloads: n})
+	}
+	sortVersionDownloads(resp.Versions)
+	start, _ := time.Parse(store.DayFormat, since)
+	for i := 0; i < days; i++ {
+		day := start.AddDate(0, 0, i).Format(store.DayFormat)
+		resp.Daily = append(resp.Daily, dailyDownloads{Day: day, Downloads: byDay[day]})
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// sortVersionDownloads는 버전을 우선순위가 높은 것부터 정렬한다.
+func sortVersionDownloads(versions []versionDownloads) {
+	parsed := make([]semver.Version, len(versions))
+	for i, v := range versions {
+		parsed[i], _ = semver.Parse(v.Version)
+	}
+	sort.Sort(byPrecedence{versions, parsed})
+}
+
+type byPrecedence struct {
+	versions []versionDownloads
+	parsed   []semver.Version
+}
+
+func (b byPrecedence) Len() int           { return len(b.versions) }
+func (b byPrecedence) Less(i, j int) bool { return b.parsed[i].Compare(b.parsed[j]) > 0 }
+func (b byPrecedence) Swap(i, j int) {
+	b.versions[i], b.versions[j] = b.versions[j], b.versions[i]
+	b.parsed[i], b.parsed[j] = b.parsed[j], b.parsed[i]
+}
+
+// topDownloadsHandler는 관리자에게 최근 days일 동안 다운로드가 많은 패키지를 보여준다.
+func topDownloadsHandler(
+	w http.ResponseWriter,
+	r *http.Request,
+	config appConfig,
+) {
+	if r.Method != "GET" {
+		http.Error(w, "Invalid Method", http.StatusMethodNotAllowed)
+		return
+	}
+	if _, ok := requireScope(w, r, scopeAdmin); !ok {
+		return
+	}
+	_, since, err := parseDays(r, time.Now())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	limit := defaultTopLimit
+	if l := r.URL.Query().Get("limit"); len(l) != 0 {
+		limit, err = strconv.Atoi(l)
+		if err != nil || limit <= 0 {
+			http.Error(w, "invalid limit", http.StatusBadRequest)
+			return
+		}
+		if limit > maxTopLimit {
+			limit = maxTopLimit
+		}
+	}
+	top, err := config.packageStore.TopDownloads(r.Context(), since, limit)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, topDownloadsResponse{Since: since, Packages: top})
+}
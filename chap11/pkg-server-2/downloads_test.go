@@ -0,0 +1,237 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/PaulOh5/pkg-server-2/apitoken"
+	"github.com/PaulOh5/pkg-server-2/store"
+)
+
+type failingDownloadStore struct {
+	store.PackageStore
+	fail bool
+}
+
+func (s *failingDownloadStore) AddDownloads(ctx context.Context, counts []store.DownloadCount) error {
+	if s.fail {
+		return errors.New("unavailable")
+	}
+	return s.PackageStore.AddDownloads(ctx, counts)
+}
+
+func TestDownloadCounterFlush(t *testing.T) {
+	ctx := context.Background()
+	s := &failingDownloadStore{PackageStore: store.NewMemoryStore(), fail: true}
+	c := newDownloadCounter(s)
+	day := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	c.now = func() time.Time { return day }
+
+	pkg := store.Package{OwnerId: 1, Name: "pkg", Version: "1.0.0"}
+	c.Add(pkg)
+	c.Add(pkg)
+	// 저장에 실패한 수는 버리지 않고 다음 Flush에서 다시 쓴다
+	if err := c.Flush(ctx); err == nil {
+		t.Fatal("Expected flush to fail")
+	}
+	c.Add(pkg)
+	s.fail = false
+	if err := c.Flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	counts, err := s.DownloadStats(ctx, 1, "pkg", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(counts) != 1 || counts[0].Count != 3 || counts[0].Day != "2024-05-01" {
+		t.Fatalf("Expected 3 downloads on 2024-05-01, Got: %#v", counts)
+	}
+
+	var nilCounter *downloadCounter
+	nilCounter.Add(pkg)
+	if err := nilCounter.Flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRunDownloadFlush(t *testing.T) {
+	s := store.NewMemoryStore()
+	config := appConfig{
+		logger:       log.New(io.Discard, "", 0),
+		packageStore: s,
+		downloads:    newDownloadCounter(s),
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		runDownloadFlush(ctx, config, time.Hour)
+		close(done)
+	}()
+
+	// 주기가 오기 전에 종료해도 남은 수를 기록한다
+	config.downloads.Add(store.Package{OwnerId: 1, Name: "pkg", Version: "1.0.0"})
+	cancel()
+	<-done
+	counts, err := s.DownloadStats(context.Background(), 1, "pkg", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(counts) != 1 || counts[0].Count != 1 {
+		t.Fatalf("Expected 1 download after shutdown, Got: %#v", counts)
+	}
+}
+
+func TestDownloadStats(t *testing.T) {
+	packageBucket, err := getTestBucket(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer packageBucket.Close()
+
+	packageStore := store.NewMemoryStore()
+	config := appConfig{
+		logger:        log.New(io.Discard, "", 0),
+		packageBucket: packageBucket,
+		packageStore:  packageStore,
+		downloads:     newDownloadCounter(packageStore),
+	}
+	ctx := context.Background()
+	for _, version := range []string{"1.0.0", "1.10.0", "1.2.0"} {
+		id := "1/pkg-" + version
+		err := packageStore.AddPackage(ctx, store.Package{
+			OwnerId: 1, Name: "pkg", Version: version, ObjectStoreId: id,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := packageBucket.WriteAll(ctx, id, []byte(version), nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tokens := map[string][]string{
+		"reader": {scopeRead},
+		"admin":  {scopeAdmin},
+	}
+	for name, scopes := range tokens {
+		_, err := packageStore.AddToken(ctx, store.Token{UserId: 1, Name: name, Scopes: scopes}, apitoken.Hash(name))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	mux := http.NewServeMux()
+	setupHandlers(mux, config)
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	client := &http.Client{
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	get := func(path, token string) *http.Response {
+		req, err := http.NewRequest("GET", ts.URL+path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+
+	// 직접 내려받기와 서명된 URL로 보내는 경우 모두 센다
+	downloads := []string{
+		"/api/packages/download?owner_id=1&name=pkg&version=1.0.0&download=true",
+		"/api/packages/download?owner_id=1&name=pkg&version=1.0.0",
+		"/api/packages/download?owner_id=1&name=pkg&version=latest&download=true",
+		"/api/packages/download?owner_id=1&name=pkg&version=2.0.0&download=true",
+	}
+	for _, path := range downloads {
+		resp := get(path, "reader")
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+	}
+	if err := config.downloads.Flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+	// 예전 날짜의 다운로드는 합계와 버전별 수에는 들어가지만 날짜별 수에서는 빠진다
+	err = packageStore.AddDownloads(ctx, []store.DownloadCount{
+		{OwnerId: 1, Name: "pkg", Version: "1.2.0", Day: "2000-01-01", Count: 5},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testConfigs := []struct {
+		path   string
+		token  string
+		status int
+	}{
+		{path: "/api/packages/stats?owner_id=1", token: "reader", status: http.StatusBadRequest},
+		{path: "/api/packages/stats?owner_id=1&name=pkg&days=0", token: "reader", status: http.StatusBadRequest},
+		{path: "/api/admin/stats/top", token: "reader", status: http.StatusForbidden},
+		{path: "/api/admin/stats/top?limit=x", token: "admin", status: http.StatusBadRequest},
+	}
+	for _, tc := range testConfigs {
+		resp := get(tc.path, tc.token)
+		resp.Body.Close()
+		if resp.StatusCode != tc.status {
+			t.Errorf("%s: Expected status %d, Got: %d", tc.path, tc.status, resp.StatusCode)
+		}
+	}
+
+	resp := get("/api/packages/stats?owner_id=1&name=pkg&days=7", "reader")
+	stats := pkgStatsResponse{}
+	err = json.NewDecoder(resp.Body).Decode(&stats)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Total != 8 {
+		t.Errorf("Expected 8 downloads, Got: %d", stats.Total)
+	}
+	expectedVersions := []versionDownloads{{"1.10.0", 1}, {"1.2.0", 5}, {"1.0.0", 2}}
+	if len(stats.Versions) != len(expectedVersions) {
+		t.Fatalf("Expected versions %v, Got: %v", expectedVersions, stats.Versions)
+	}
+	for i, v := range expectedVersions {
+		if stats.Versions[i] != v {
+			t.Errorf("Expected versions %v, Got: %v", expectedVersions, stats.Versions)
+			break
+		}
+	}
+	today := time.Now().UTC().Format(store.DayFormat)
+	if len(stats.Daily) != 7 || stats.Daily[6].Day != today || stats.Daily[6].Downloads != 3 {
+		t.Fatalf("Expected 7 days ending today with 3 downloads, Got: %v", stats.Daily)
+	}
+	for _, d := range stats.Daily[:6] {
+		if d.Downloads != 0 {
+			t.Errorf("Expected no downloads on %s, Got: %d", d.Day, d.Downloads)
+		}
+	}
+
+	resp = get("/api/admin/stats/top?days=1", "admin")
+	top := topDownloadsResponse{}
+	err = json.NewDecoder(resp.Body).Decode(&top)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if top.Since != today || len(top.Packages) != 1 || top.Packages[0].Count != 3 {
+		t.Fatalf("Unexpected top downloads: %#v", top)
+	}
+}
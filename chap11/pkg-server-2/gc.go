@@ -0,0 +1,164 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/PaulOh5/pkg-server-2/store"
+	"gocloud.dev/gcerrors"
+)
+
+type gcReport struct {
+	Started string `json:"started"`
+	// Removed는 행이 삭제되어 버킷에서 지운 객체다.
+	Removed []string `json:"removed"`
+	// Unreferenced는 어떤 행도 참조하지 않는 객체다. 업로드 중인 객체일 수도 있으므로
+	// 지우지 않고 보고만 한다.
+	Unreferenced []string `json:"unreferenced"`
+	// AbortedPublishes는 게시 도중 멈춰 정리한 임시 객체다.
+	AbortedPublishes []string `json:"aborted_publishes"`
+	Errors           []string `json:"errors,omitempty"`
+}
+
+// collectGarbage는 멈춘 게시를 정리하고, 삭제 기록이 있는 객체를 버킷에서 지우고
+// 참조되지 않는 객체를 보고한다. 삭제하고 1초가 지나 같은 키로 다시 게시된 객체는 수정 시각이
+// 삭제 시각보다 늦으므로 지우지 않는다.
+func collectGarbage(ctx context.Context, config appConfig) (gcReport, error) {
+	report := gcReport{
+		Started:      time.Now().UTC().Format(time.RFC3339),
+		Removed:      []string{},
+		Unreferenced: []string{},
+	}
+
+	staleAge := config.stalePublishAge
+	if staleAge <= 0 {
+		staleAge = defaultStalePublishAge
+	}
+	aborted, err := reconcilePublishes(ctx, config, staleAge)
+	report.AbortedPublishes = aborted
+	if err != nil {
+		return report, err
+	}
+
+	refs, err := config.packageStore.ReferencedObjects(ctx)
+	if err != nil {
+		return report, err
+	}
+	referenced := map[string]bool{}
+	for _, id := range refs {
+		referenced[id] = true
+	}
+
+	deleted, err := config.packageStore.DeletedObjects(ctx)
+	if err != nil {
+		return report, err
+	}
+	pending := map[string]bool{}
+	for _, o := range deleted {
+		removed, err := removeDeletedObject(ctx, config, o, referenced[o.ObjectStoreId])
+		if err != nil {
+			report.Errors = append(report.Errors, o.ObjectStoreId+": "+err.Error())
+			pending[o.ObjectStoreId] = true
+			continue
+		}
+		if removed {
+			report.Removed = append(report.Removed, o.ObjectStoreId)
+		}
+	}
+
+	iter := config.packageBucket.List(nil)
+	for {
+		obj, err := iter.Next(ctx)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return report, err
+		}
+		if obj.IsDir || referenced[obj.Key] || pending[obj.Key] {
+			continue
+		}
+		report.Unreferenced = append(report.Unreferenced, obj.Key)
+	}
+	sort.Strings(report.Unreferenced)
+	return report, nil
+}
+
+func removeDeletedObject(
+	ctx context.Context, config appConfig, o store.DeletedObject, referenced bool,
+) (bool, error) {
+	if referenced {
+		return false, config.packageStore.PurgeDeletedObject(ctx, o.ObjectStoreId)
+	}
+	deletedAt, err := time.Parse(store.TimeFormat, o.Deleted)
+	if err != nil {
+		return false, err
+	}
+
+	removed := false
+	attrs, err := config.packageBucket.Attributes(ctx, o.ObjectStoreId)
+	switch {
+	case gcerrors.Code(err) == gcerrors.NotFound:
+	case err != nil:
+		return false, err
+	case attrs.ModTime.After(deletedAt.Add(time.Second)):
+		// 삭제한 뒤에 다시 쓰인 객체일 수 있으므로 지우지 않는다. 참조되지 않으면 다음 GC가 보고한다.
+		// 삭제 시각은 초 단위로 잘려 저장되므로 같은 초에 쓰인 객체는 삭제 전에 쓰인 것으로 본다
+	default:
+		err = config.packageBucket.Delete(ctx, o.ObjectStoreId)
+		if err != nil && gcerrors.Code(err) != gcerrors.NotFound {
+			return false, err
+		}
+		removed = true
+	}
+	return removed, config.packageStore.PurgeDeletedObject(ctx, o.ObjectStoreId)
+}
+
+// runGC는 interval마다 GC를 실행하고 결과를 로그로 남긴다.
+func runGC(ctx context.Context, config appConfig, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		report, err := collectGarbage(ctx, config)
+		if err != nil {
+			config.logger.Printf("GC failed: %v\n", err)
+			continue
+		}
+		config.logger.Printf(
+			"GC removed %d objects, %d unreferenced objects, %d aborted publishes, %d errors\n",
+			len(report.Removed), len(report.Unreferenced), len(report.AbortedPublishes), len(report.Errors),
+		)
+		for _, key := range report.Unreferenced {
+			config.logger.Printf("GC: unreferenced object %s\n", key)
+		}
+	}
+}
+
+// gcHandler는 관리자가 GC를 바로 실행하고 결과를 받을 수 있게 한다.
+func gcHandler(
+	w http.ResponseWriter,
+	r *http.Request,
+	config appConfig,
+) {
+	if r.Method != "POST" {
+		http.Error(w, "Invalid Method", http.StatusMethodNotAllowed)
+		return
+	}
+	if _, ok := requireScope(w, r, scopeAdmin); !ok {
+		return
+	}
+	report, err := collectGarbage(r.Context(), config)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, report)
+}
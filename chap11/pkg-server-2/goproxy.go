@@ -0,0 +1,348 @@
+package main
+
+import (
+	"archive/zip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/PaulOh5/pkg-server-2/semver"
+	"github.com/PaulOh5/pkg-server-2/store"
+	"golang.org/x/mod/modfile"
+	"golang.org/x/mod/module"
+	modzip "golang.org/x/mod/zip"
+)
+
+// goProxyPrefix 아래에서 GOPROXY 프로토콜을 제공한다. GOPROXY=https://서버/go 로 쓴다.
+const goProxyPrefix = "/go/"
+
+var errModuleOwned = errors.New("Module path belongs to another owner")
+
+// moduleRequest는 GOPROXY 요청 경로를 풀어 쓴 것이다. kind는 list, latest, info, mod, zip 중 하나다.
+type moduleRequest struct {
+	path    string
+	version string
+	kind    string
+}
+
+// parseModuleRequest는 $module/@v/list, $module/@v/$version.{info,mod,zip},
+// $module/@latest 형식의 경로를 읽는다. 모듈 경로와 버전의 대문자는 !소문자로 인코딩되어 있다.
+func parseModuleRequest(p string) (moduleRequest, error) {
+	req := moduleRequest{}
+	var escapedPath, file string
+	if strings.HasSuffix(p, "/@latest") {
+		escapedPath = strings.TrimSuffix(p, "/@latest")
+		req.kind = "latest"
+	} else {
+		i := strings.Index(p, "/@v/")
+		if i == -1 {
+			return req, fmt.Errorf("invalid module proxy path: %s", p)
+		}
+		escapedPath, file = p[:i], p[i+len("/@v/"):]
+	}
+	var err error
+	req.path, err = module.UnescapePath(escapedPath)
+	if err != nil {
+		return req, err
+	}
+	if len(req.kind) != 0 {
+		return req, nil
+	}
+	if file == "list" {
+		req.kind = "list"
+		return req, nil
+	}
+	for _, ext := range []string{".info", ".mod", ".zip"} {
+		if escapedVersion, ok := strings.CutSuffix(file, ext); ok {
+			req.kind = ext[1:]
+			req.version, err = module.UnescapeVersion(escapedVersion)
+			return req, err
+		}
+	}
+	return req, fmt.Errorf("invalid module proxy path: %s", p)
+}
+
+// moduleVersions는 모듈 경로로 게시된 버전을 우선순위 순서로 반환한다. 모듈 경로는
+// 처음 게시한 소유자만 쓸 수 있으므로 소유자 ID 없이 찾는다. 예전에 여러 소유자가 같은
+// 이름으로 게시했다면 가장 먼저 게시한 소유자의 버전만 쓴다.
+func moduleVersions(ctx context.Context, config appConfig, path string) ([]store.Package, error) {
+	pkgs, err := config.packageStore.QueryPackages(ctx, store.QueryParams{OwnerId: -1, Name: path})
+	if err != nil || len(pkgs) == 0 {
+		return pkgs, err
+	}
+	first := pkgs[0]
+	for _, p := range pkgs {
+		if p.Created < first.Created {
+			first = p
+		}
+	}
+	versions := []store.Package{}
+	for _, p := range pkgs {
+		if p.OwnerId == first.OwnerId {
+			versions = append(versions, p)
+		}
+	}
+	return versions, nil
+}
+
+// findModuleVersion은 정식 형식의 Go 버전(v1.2.3)과 같은 버전을 찾는다. 회수된 버전도 찾는다.
+func findModuleVersion(pkgs []store.Package, version string) (store.Package, bool) {
+	if module.CanonicalVersion(version) != version {
+		return store.Package{}, false
+	}
+	for _, p := range pkgs {
+		if "v"+p.Version == version {
+			return p, true
+		}
+	}
+	return store.Package{}, false
+}
+
+func goProxyHandler(
+	w http.ResponseWriter,
+	r *http.Request,
+	config appConfig,
+) {
+	req, err := parseModuleRequest(strings.TrimPrefix(r.URL.Path, goProxyPrefix))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	switch r.Method {
+	case "PUT":
+		moduleUploadHandler(w, r, config, req)
+		return
+	case "GET", "HEAD":
+	default:
+		http.Error(w, "Invalid Method", http.StatusMethodNotAllowed)
+		return
+	}
+	// go 명령은 http GOPROXY에는 자격 증명을 보내지 않으므로 익명 읽기를 따로 허용한다
+	if !config.anonymousModuleReads {
+		if _, ok := requireScope(w, r, scopeRead); !ok {
+			return
+		}
+	}
+
+	pkgs, err := moduleVersions(r.Context(), config, req.path)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if len(pkgs) == 0 {
+		http.Error(w, "No module found", http.StatusNotFound)
+		return
+	}
+
+	switch req.kind {
+	case "list":
+		// 회수된 버전과 pseudo-version은 목록에서 빼지만 정확한 버전으로는 받을 수 있다
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		for _, p := range pkgs {
+			v := "v" + p.Version
+			if len(p.Yanked) == 0 && !module.IsPseudoVersion(v) {
+				fmt.Fprintln(w, v)
+			}
+		}
+		return
+	case "latest":
+		p, ok := latestVersion(pkgs)
+		if !ok {
+			http.Error(w, "No module version found", http.StatusNotFound)
+			return
+		}
+		writeModuleInfo(w, p)
+		return
+	}
+
+	p, ok := findModuleVersion(pkgs, req.version)
+	if !ok {
+		http.Error(w, "No module version found", http.StatusNotFound)
+		return
+	}
+	switch req.kind {
+	case "info":
+		writeModuleInfo(w, p)
+	case "mod":
+		m, err := config.packageStore.Metadata(r.Context(), p.OwnerId, p.Name, p.Version)
+		if err != nil && !errors.Is(err, store.ErrNotFound) {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		// go.mod가 없는 모듈은 go 명령처럼 module 지시어만 있는 파일로 대신한다
+		goMod := m.GoMod
+		if len(goMod) == 0 {
+			goMod = "module " + modfile.AutoQuote(p.Name) + "\n"
+		}
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		io.WriteString(w, goMod)
+	case "zip":
+		reader, err := config.packageBucket.NewReader(r.Context(), p.ObjectStoreId, nil)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		defer reader.Close()
+		w.Header().Set("Content-Type", "application/zip")
+		if _, err := io.Copy(w, reader); err != nil {
+			config.logger.Printf("Failed to send module %s: %v\n", p.ObjectStoreId, err)
+			return
+		}
+		config.downloads.Add(p)
+	}
+}
+
+func writeModuleInfo(w http.ResponseWriter, p store.Package) {
+	created, err := time.Parse(store.TimeFormat, p.Created)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, moduleInfo{Version: "v" + p.Version, Time: created})
+}
+
+// moduleUploadHandler는 PUT $module/@v/$version.zip 요청의 본문을 모듈 zip으로 게시한다.
+func moduleUploadHandler(
+	w http.ResponseWriter,
+	r *http.Request,
+	config appConfig,
+	req moduleRequest,
+) {
+	a, ok := requireScope(w, r, scopePublish)
+	if !ok {
+		return
+	}
+	if req.kind != "zip" {
+		http.Error(w, "Invalid Method", http.StatusMethodNotAllowed)
+		return
+	}
+	quota, ok := checkPublishQuota(w, r, config, a.userId)
+	if !ok {
+		return
+	}
+	mod := module.Version{Path: req.path, Version: req.version}
+	d, err := publishModule(r.Context(), config, a.userId, mod, r.Body, quota)
+	if err != nil {
+		http.Error(w, err.Error(), uploadErrorStatus(err))
+		return
+	}
+	writeJSON(w, http.StatusOK, d)
+}
+
+// publishModule은 모듈 zip을 검사하고 go.mod를 꺼내 메타데이터와 함께 게시한다.
+// 버전은 v 접두사 없이 저장한다.
+func publishModule(
+	ctx context.Context, config appConfig, owner int,
+	mod module.Version, r io.Reader, quota ownerQuota,
+) (pkgRegisterResponse, error) {
+	if err := module.Check(mod.Path, mod.Version); err != nil {
+		return pkgRegisterResponse{}, badRequest("%v", err)
+	}
+	if v := module.CanonicalVersion(mod.Version); v != mod.Version {
+		return pkgRegisterResponse{}, badRequest("version %q is not canonical (should be %q)", mod.Version, v)
+	}
+	v, err := semver.Parse(strings.TrimPrefix(mod.Version, "v"))
+	if err != nil {
+		return pkgRegisterResponse{}, err
+	}
+	// 두 소유자가 동시에 처음 게시하는 경우는 막지 못하지만 moduleVersions가 먼저 게시한 쪽을 고른다
+	pkgs, err := moduleVersions(ctx, config, mod.Path)
+	if err != nil {
+		return pkgRegisterResponse{}, err
+	}
+	if len(pkgs) != 0 && pkgs[0].OwnerId != owner {
+		return pkgRegisterResponse{}, errModuleOwned
+	}
+
+	// 대소문자를 구분하지 않는 버킷에서도 겹치지 않도록 인코딩한 경로를 키로 쓴다
+	escapedPath, err := module.EscapePath(mod.Path)
+	if err != nil {
+		return pkgRegisterResponse{}, badRequest("%v", err)
+	}
+	escapedVersion, err := module.EscapeVersion(mod.Version)
+	if err != nil {
+		return pkgRegisterResponse{}, badRequest("%v", err)
+	}
+	p := store.Package{
+		OwnerId:       owner,
+		Name:          mod.Path,
+		Version:       v.String(),
+		ObjectStoreId: fmt.Sprintf("%d/%s/@v/%s.zip", owner, escapedPath, escapedVersion),
+	}
+	inspect := func(ctx context.Context, stagingKey string) (store.Metadata, error) {
+		goMod, readme, err := checkModuleZip(ctx, config, stagingKey, mod)
+		if err != nil {
+			return store.Metadata{}, err
+		}
+		return store.Metadata{
+			OwnerId: owner,
+			Name:    p.Name,
+			Version: p.Version,
+			Readme:  readme,
+			GoMod:   goMod,
+		}, nil
+	}
+	return publishObject(ctx, config, p, r, "", quota, inspect)
+}
+
+// checkModuleZip은 go 명령과 같은 규칙으로 zip의 구조를 검사하고 go.mod와 모듈 최상위의
+// README를 읽는다. go.mod가 있으면 module 지시어가 모듈 경로와 같아야 한다.
+func checkModuleZip(
+	ctx context.Context, config appConfig, key string, mod module.Version,
+) (string, string, error) {
+	// modzip.CheckZip은 파일만 받으므로 임시 파일로 받는다
+	tmp, err := os.CreateTemp("", "module-*.zip")
+	if err != nil {
+		return "", "", err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+	if err := config.packageBucket.Download(ctx, key, tmp, nil); err != nil {
+		return "", "", err
+	}
+	if _, err := modzip.CheckZip(mod, tmp.Name()); err != nil {
+		return "", "", badRequest("invalid module zip: %v", err)
+	}
+
+	zr, err := zip.OpenReader(tmp.Name())
+	if err != nil {
+		return "", "", err
+	}
+	defer zr.Close()
+	prefix := mod.Path + "@" + mod.Version + "/"
+	var goMod, readme string
+	for _, zf := range zr.File {
+		name := strings.TrimPrefix(zf.Name, prefix)
+		open := func() (io.Reader, error) {
+			rc, err := zf.Open()
+			return rc, err
+		}
+		switch {
+		case name == "go.mod":
+			data, ok := readLimited(open, modzip.MaxGoMod)
+			if !ok {
+				return "", "", badRequest("failed to read go.mod")
+			}
+			goMod = string(data)
+		case !strings.Contains(name, "/") && isReadme(name) && len(readme) == 0:
+			if data, ok := readLimited(open, maxReadmeSize); ok {
+				readme = string(data)
+			}
+		}
+	}
+	if len(goMod) != 0 {
+		f, err := modfile.ParseLax("go.mod", []byte(goMod), nil)
+		if err != nil {
+			return "", "", badRequest("invalid go.mod: %v", err)
+		}
+		if f.Module == nil || f.Module.Mod.Path != mod.Path {
+			return "", "", badRequest("go.mod must declare module %s", mod.Path)
+		}
+	}
+	return goMod, readme, nil
+}
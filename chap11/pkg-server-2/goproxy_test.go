@@ -0,0 +1,318 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/PaulOh5/pkg-server-2/apitoken"
+	"github.com/PaulOh5/pkg-server-2/store"
+)
+
+func makeModuleZip(t *testing.T, prefix string, files map[string]string) []byte {
+	buf := bytes.Buffer{}
+	zw := zip.NewWriter(&buf)
+	for name, content := range files {
+		f, err := zw.Create(prefix + name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := io.WriteString(f, content); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestParseModuleRequest(t *testing.T) {
+	testConfigs := []struct {
+		path     string
+		expected moduleRequest
+		err      bool
+	}{
+		{path: "example.com/mod/@v/list", expected: moduleRequest{path: "example.com/mod", kind: "list"}},
+		{path: "example.com/mod/@latest", expected: moduleRequest{path: "example.com/mod", kind: "latest"}},
+		{
+			path:     "github.com/!azure/sdk/@v/v1.0.0-!r!c1.info",
+			expected: moduleRequest{path: "github.com/Azure/sdk", version: "v1.0.0-RC1", kind: "info"},
+		},
+		{path: "example.com/mod/v2/@v/v2.1.0.mod", expected: moduleRequest{path: "example.com/mod/v2", version: "v2.1.0", kind: "mod"}},
+		{path: "example.com/mod/@v/v1.0.0.zip", expected: moduleRequest{path: "example.com/mod", version: "v1.0.0", kind: "zip"}},
+		{path: "example.com/mod/@v/v1.0.0.tar", err: true},
+		{path: "example.com/Mod/@v/list", err: true},
+		{path: "example.com/mod", err: true},
+	}
+	for _, tc := range testConfigs {
+		req, err := parseModuleRequest(tc.path)
+		if tc.err {
+			if err == nil {
+				t.Errorf("%s: Expected error, Got: %#v", tc.path, req)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tc.path, err)
+			continue
+		}
+		if req != tc.expected {
+			t.Errorf("%s: Expected %#v, Got: %#v", tc.path, tc.expected, req)
+		}
+	}
+}
+
+func setupGoProxy(t *testing.T, anonymous bool) (*httptest.Server, appConfig) {
+	packageBucket, err := getTestBucket(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { packageBucket.Close() })
+
+	config := appConfig{
+		logger:               log.New(io.Discard, "", 0),
+		packageBucket:        packageBucket,
+		packageStore:         store.NewMemoryStore(),
+		anonymousModuleReads: anonymous,
+	}
+	for userId, token := range []string{"owner", "other"} {
+		_, err := config.packageStore.AddToken(
+			context.Background(),
+			store.Token{UserId: userId + 1, Name: token, Scopes: []string{scopePublish, scopeRead}},
+			apitoken.Hash(token),
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	mux := http.NewServeMux()
+	setupHandlers(mux, config)
+	ts := httptest.NewServer(mux)
+	t.Cleanup(ts.Close)
+	return ts, config
+}
+
+func doRequest(t *testing.T, method, url, token string, body []byte) (int, string) {
+	req, err := http.NewRequest(method, url, bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(token) != 0 {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp.StatusCode, string(data)
+}
+
+func TestGoProxy(t *testing.T) {
+	ts, config := setupGoProxy(t, false)
+	base := ts.URL + "/go/example.com/!hello"
+	goMod := "module example.com/Hello\n\ngo 1.22\n"
+	module := func(version string, files map[string]string) []byte {
+		return makeModuleZip(t, "example.com/Hello@"+version+"/", files)
+	}
+
+	testConfigs := []struct {
+		name   string
+		url    string
+		token  string
+		body   []byte
+		status int
+	}{
+		{
+			name: "publish", url: base + "/@v/v1.0.0.zip", token: "owner", status: http.StatusOK,
+			body: module("v1.0.0", map[string]string{"go.mod": goMod, "hello.go": "package hello\n", "README.md": "# hello"}),
+		},
+		{
+			name: "publish newer", url: base + "/@v/v1.1.0.zip", token: "owner", status: http.StatusOK,
+			body: module("v1.1.0", map[string]string{"go.mod": goMod, "hello.go": "package hello\n"}),
+		},
+		{
+			name: "publish prerelease", url: base + "/@v/v1.2.0-rc.1.zip", token: "owner", status: http.StatusOK,
+			body: module("v1.2.0-rc.1", map[string]string{"go.mod": goMod, "hello.go": "package hello\n"}),
+		},
+		{
+			name: "duplicate", url: base + "/@v/v1.0.0.zip", token: "owner", status: http.StatusConflict,
+			body: module("v1.0.0", map[string]string{"go.mod": goMod}),
+		},
+		{
+			name: "another owner", url: base + "/@v/v1.3.0.zip", token: "other", status: http.StatusForbidden,
+			body: module("v1.3.0", map[string]string{"go.mod": goMod}),
+		},
+		{
+			name: "wrong prefix", url: base + "/@v/v1.4.0.zip", token: "owner", status: http.StatusBadRequest,
+			body: module("v1.0.0", map[string]string{"go.mod": goMod}),
+		},
+		{
+			name: "go.mod for another module", url: base + "/@v/v1.4.0.zip", token: "owner", status: http.StatusBadRequest,
+			body: module("v1.4.0", map[string]string{"go.mod": "module example.com/other\n"}),
+		},
+		{
+			name: "go.mod outside the root", url: base + "/@v/v1.4.0.zip", token: "owner", status: http.StatusBadRequest,
+			body: module("v1.4.0", map[string]string{"go.mod": goMod, "sub/go.mod": "module example.com/Hello/sub\n"}),
+		},
+		{
+			name: "not canonical", url: base + "/@v/v1.4.zip", token: "owner", status: http.StatusBadRequest,
+			body: module("v1.4", map[string]string{"go.mod": goMod}),
+		},
+		{
+			name: "major version mismatch", url: base + "/@v/v2.0.0.zip", token: "owner", status: http.StatusBadRequest,
+			body: module("v2.0.0", map[string]string{"go.mod": goMod}),
+		},
+		{
+			name: "anonymous publish", url: base + "/@v/v1.4.0.zip", token: "", status: http.StatusUnauthorized,
+			body: module("v1.4.0", map[string]string{"go.mod": goMod}),
+		},
+	}
+	for _, tc := range testConfigs {
+		status, body := doRequest(t, "PUT", tc.url, tc.token, tc.body)
+		if status != tc.status {
+			t.Errorf("%s: Expected status %d, Got: %d %s", tc.name, tc.status, status, body)
+		}
+	}
+	// 실패한 게시는 버전을 남기지 않는다
+	if status, _ := doRequest(t, "GET", base+"/@v/v1.4.0.info", "owner", nil); status != http.StatusNotFound {
+		t.Errorf("Expected rejected version to be missing, Got: %d", status)
+	}
+
+	// 회수한 버전은 목록과 latest에서 빠진다
+	if err := config.packageStore.YankPackage(context.Background(), 1, "example.com/Hello", "1.1.0"); err != nil {
+		t.Fatal(err)
+	}
+	if status, _ := doRequest(t, "GET", base+"/@v/list", "", nil); status != http.StatusUnauthorized {
+		t.Errorf("Expected status 401 without a token, Got: %d", status)
+	}
+
+	readConfigs := []struct {
+		path   string
+		status int
+		body   string
+	}{
+		{path: "/@v/list", status: http.StatusOK, body: "v1.0.0\nv1.2.0-rc.1\n"},
+		{path: "/@v/v1.0.0.mod", status: http.StatusOK, body: goMod},
+		{path: "/@v/v1.1.0.mod", status: http.StatusOK, body: goMod},
+		{path: "/@v/v9.0.0.mod", status: http.StatusNotFound},
+		{path: "/@v/master.info", status: http.StatusNotFound},
+		{path: "/@v/v1.0.0.tar", status: http.StatusNotFound},
+	}
+	for _, tc := range readConfigs {
+		status, body := doRequest(t, "GET", base+tc.path, "owner", nil)
+		if status != tc.status {
+			t.Errorf("%s: Expected status %d, Got: %d %s", tc.path, tc.status, status, body)
+			continue
+		}
+		if len(tc.body) != 0 && body != tc.body {
+			t.Errorf("%s: Expected %q, Got: %q", tc.path, tc.body, body)
+		}
+	}
+	if status, _ := doRequest(t, "GET", ts.URL+"/go/example.com/hello/@v/list", "owner", nil); status != http.StatusNotFound {
+		t.Errorf("Expected module path to be case sensitive, Got: %d", status)
+	}
+
+	info := func(path string) moduleInfo {
+		status, body := doRequest(t, "GET", base+path, "owner", nil)
+		if status != http.StatusOK {
+			t.Fatalf("%s: Expected status 200, Got: %d %s", path, status, body)
+		}
+		i := moduleInfo{}
+		if err := json.Unmarshal([]byte(body), &i); err != nil {
+			t.Fatal(err)
+		}
+		return i
+	}
+	if i := info("/@latest"); i.Version != "v1.0.0" || i.Time.IsZero() {
+		t.Errorf("Expected latest v1.0.0, Got: %#v", i)
+	}
+	if i := info("/@v/v1.1.0.info"); i.Version != "v1.1.0" {
+		t.Errorf("Expected yanked version info, Got: %#v", i)
+	}
+
+	status, body := doRequest(t, "GET", base+"/@v/v1.0.0.zip", "owner", nil)
+	if status != http.StatusOK {
+		t.Fatalf("Expected status 200, Got: %d", status)
+	}
+	zr, err := zip.NewReader(strings.NewReader(body), int64(len(body)))
+	if err != nil || len(zr.File) != 3 {
+		t.Fatalf("Expected module zip with 3 files, Got: %v", err)
+	}
+
+	m, err := config.packageStore.Metadata(context.Background(), 1, "example.com/Hello", "1.0.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.GoMod != goMod || m.Readme != "# hello" {
+		t.Errorf("Expected go.mod and README in metadata, Got: %#v", m)
+	}
+}
+
+// TestGoProxyWithGoCommand는 go 명령이 GOPROXY로 이 서버에서 모듈을 받아 빌드하는지 확인한다.
+func TestGoProxyWithGoCommand(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping go command test in short mode")
+	}
+	goBin, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("go command not found")
+	}
+	ts, _ := setupGoProxy(t, true)
+
+	lib := makeModuleZip(t, "example.com/greet@v1.0.0/", map[string]string{
+		"go.mod":   "module example.com/greet\n\ngo 1.22\n",
+		"greet.go": "package greet\n\nfunc Hello() string { return \"hello from the proxy\" }\n",
+	})
+	if status, body := doRequest(t, "PUT", ts.URL+"/go/example.com/greet/@v/v1.0.0.zip", "owner", lib); status != http.StatusOK {
+		t.Fatalf("Expected status 200, Got: %d %s", status, body)
+	}
+
+	dir := t.TempDir()
+	files := map[string]string{
+		"go.mod":  "module example.com/app\n\ngo 1.22\n\nrequire example.com/greet v1.0.0\n",
+		"main.go": "package main\n\nimport (\n\t\"fmt\"\n\n\t\"example.com/greet\"\n)\n\nfunc main() { fmt.Println(greet.Hello()) }\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cmd := exec.Command(goBin, "run", ".")
+	cmd.Dir = dir
+	cmd.Env = append(
+		os.Environ(),
+		"GOPROXY="+ts.URL+"/go",
+		"GOFLAGS=-mod=mod -modcacherw",
+		"GOSUMDB=off",
+		"GOTOOLCHAIN=local",
+		"GOPATH="+filepath.Join(dir, "gopath"),
+		"GOMODCACHE="+filepath.Join(dir, "gopath", "pkg", "mod"),
+	)
+	stderr := bytes.Buffer{}
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		t.Fatalf("go run failed: %v\n%s", err, stderr.String())
+	}
+	if strings.TrimSpace(string(out)) != "hello from the proxy" {
+		t.Errorf("Unexpected output: %s", out)
+	}
+}
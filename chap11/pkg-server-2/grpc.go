@@ -0,0 +1,325 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/PaulOh5/pkg-server-2/registry"
+	"github.com/PaulOh5/pkg-server-2/store"
+	"gocloud.dev/gcerrors"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// Download가 메시지 하나에 담아 보내는 파일의 바이트 수
+const grpcChunkSize = 64 << 10
+
+// registryService는 HTTP 핸들러와 같은 저장소와 버킷 코드로 PackageRegistry를 제공한다.
+type registryService struct {
+	registry.UnimplementedPackageRegistryServer
+	config appConfig
+}
+
+func newGRPCServer(config appConfig) *grpc.Server {
+	s := grpc.NewServer(
+		grpc.UnaryInterceptor(authUnaryInterceptor(config)),
+		grpc.StreamInterceptor(authStreamInterceptor(config)),
+	)
+	registry.RegisterPackageRegistryServer(s, &registryService{config: config})
+	return s
+}
+
+// authServerStream은 인증한 사용자를 담은 컨텍스트를 스트림 핸들러에 넘긴다.
+type authServerStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s authServerStream) Context() context.Context {
+	return s.ctx
+}
+
+// grpcAuthContext는 authMiddleware처럼 authorization 메타데이터의 Bearer 토큰을 사용자로
+// 바꿔 컨텍스트에 넣는다. 권한 검사는 각 RPC의 requireGRPCScope가 한다.
+func grpcAuthContext(ctx context.Context, config appConfig) (context.Context, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	values := md.Get("authorization")
+	if len(values) == 0 {
+		return ctx, nil
+	}
+	scheme, token, found := strings.Cut(values[0], " ")
+	token = strings.TrimSpace(token)
+	if !found || !strings.EqualFold(scheme, "Bearer") || len(token) == 0 {
+		return ctx, status.Error(codes.Unauthenticated, "Invalid authorization metadata")
+	}
+	ctx, err := authenticate(ctx, config, token)
+	if errors.Is(err, errInvalidToken) {
+		return ctx, status.Error(codes.Unauthenticated, err.Error())
+	}
+	if err != nil {
+		return ctx, status.Error(codes.Internal, err.Error())
+	}
+	return ctx, nil
+}
+
+func authUnaryInterceptor(config appConfig) grpc.UnaryServerInterceptor {
+	return func(
+		ctx context.Context,
+		req interface{},
+		info *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler,
+	) (interface{}, error) {
+		ctx, err := grpcAuthContext(ctx, config)
+		if err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+func authStreamInterceptor(config appConfig) grpc.StreamServerInterceptor {
+	return func(
+		srv interface{},
+		stream grpc.ServerStream,
+		info *grpc.StreamServerInfo,
+		handler grpc.StreamHandler,
+	) error {
+		ctx, err := grpcAuthContext(stream.Context(), config)
+		if err != nil {
+			return err
+		}
+		return handler(srv, authServerStream{ServerStream: stream, ctx: ctx})
+	}
+}
+
+func requireGRPCScope(ctx context.Context, scope string) (authContextValue, error) {
+	a, ok := authFromContext(ctx)
+	if !ok {
+		return a, status.Error(codes.Unauthenticated, "Authentication required")
+	}
+	if !a.hasScope(scope) {
+		return a, status.Errorf(codes.PermissionDenied, "Token is missing the %s scope", scope)
+	}
+	return a, nil
+}
+
+// grpcError는 HTTP 핸들러가 쓰는 상태 코드를 gRPC 상태 코드로 바꾼다. 클라이언트가 스트림을
+// 취소한 경우처럼 이미 gRPC 상태가 있는 오류는 그대로 반환한다.
+func grpcError(httpStatus int, err error) error {
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+	code := codes.Internal
+	switch httpStatus {
+	case http.StatusBadRequest:
+		code = codes.InvalidArgument
+	case http.StatusForbidden:
+		code = codes.PermissionDenied
+	case http.StatusNotFound:
+		code = codes.NotFound
+	case http.StatusConflict:
+		code = codes.AlreadyExists
+	case http.StatusRequestEntityTooLarge, http.StatusTooManyRequests, http.StatusInsufficientStorage:
+		code = codes.ResourceExhausted
+	}
+	return status.Error(code, err.Error())
+}
+
+func toProtoPackage(p store.Package) *registry.Package {
+	return &registry.Package{
+		OwnerId:       int32(p.OwnerId),
+		Name:          p.Name,
+		Version:       p.Version,
+		ObjectStoreId: p.ObjectStoreId,
+		Sha256:        p.Sha256,
+		Sha512:        p.Sha512,
+		Size:          p.Size,
+		Created:       p.Created,
+		Yanked:        p.Yanked,
+	}
+}
+
+// publishStreamReader는 context 뒤에 오는 data 메시지를 이어 붙여 읽는다.
+type publishStreamReader struct {
+	stream registry.PackageRegistry_PublishServer
+	buf    []byte
+}
+
+func (r *publishStreamReader) Read(p []byte) (int, error) {
+	for len(r.buf) == 0 {
+		req, err := r.stream.Recv()
+		if err != nil {
+			return 0, err
+		}
+		data, ok := req.Body.(*registry.PublishRequest_Data)
+		if !ok {
+			return 0, badRequest("Unexpected message type: %T", req.Body)
+		}
+		r.buf = data.Data
+	}
+	n := copy(p, r.buf)
+	r.buf = r.buf[n:]
+	return n, nil
+}
+
+func (s *registryService) Publish(stream registry.PackageRegistry_PublishServer) error {
+	ctx := stream.Context()
+	a, err := requireGRPCScope(ctx, scopePublish)
+	if err != nil {
+		return err
+	}
+	req, err := stream.Recv()
+	if err != nil {
+		return err
+	}
+	pc := req.GetContext()
+	if pc == nil {
+		return status.Error(codes.InvalidArgument, "The first message must be the package context")
+	}
+	if len(pc.Filename) == 0 {
+		return status.Error(codes.InvalidArgument, "filename is required")
+	}
+	quota, _, err := publishAllowed(ctx, s.config, a.userId, time.Now())
+	if err != nil {
+		return grpcError(uploadErrorStatus(err), err)
+	}
+
+	form := pkgRegisterForm{
+		name:           pc.Name,
+		version:        pc.Version,
+		expectedSha256: pc.ExpectedSha256,
+		manifest: packageManifest{
+			Description:  pc.Description,
+			License:      pc.License,
+			Homepage:     pc.Homepage,
+			Keywords:     pc.Keywords,
+			Readme:       pc.Readme,
+			Dependencies: pc.Dependencies,
+		},
+	}
+	d, err := publishPackage(ctx, s.config, a.userId, form, pc.Filename, &publishStreamReader{stream: stream}, quota)
+	if err != nil {
+		return grpcError(uploadErrorStatus(err), err)
+	}
+	return stream.SendAndClose(&registry.PublishReply{Id: d.ID, Size: d.Size, Sha256: d.Sha256, Sha512: d.Sha512})
+}
+
+// grpcOwner는 0을 모든 소유자를 뜻하는 -1로 바꾼다.
+func grpcOwner(ownerId int32) int {
+	if ownerId == 0 {
+		return -1
+	}
+	return int(ownerId)
+}
+
+func (s *registryService) lookup(ctx context.Context, ownerId int32, name, version string) (store.Package, error) {
+	if _, err := requireGRPCScope(ctx, scopeRead); err != nil {
+		return store.Package{}, err
+	}
+	spec, err := parseVersionSpec(version)
+	if err != nil {
+		return store.Package{}, status.Error(codes.InvalidArgument, err.Error())
+	}
+	pkg, err := lookupPackage(ctx, s.config, grpcOwner(ownerId), name, spec)
+	if err != nil {
+		return pkg, grpcError(lookupErrorStatus(err), err)
+	}
+	return pkg, nil
+}
+
+// Download는 package를 먼저 보내고 파일을 grpcChunkSize씩 나눠 보낸다.
+func (s *registryService) Download(req *registry.DownloadRequest, stream registry.PackageRegistry_DownloadServer) error {
+	ctx := stream.Context()
+	pkg, err := s.lookup(ctx, req.OwnerId, req.Name, req.Version)
+	if err != nil {
+		return err
+	}
+	reader, err := s.config.packageBucket.NewReader(ctx, pkg.ObjectStoreId, nil)
+	if gcerrors.Code(err) == gcerrors.NotFound {
+		return status.Error(codes.NotFound, "invalid package ID")
+	}
+	if err != nil {
+		return status.Error(codes.Internal, err.Error())
+	}
+	defer reader.Close()
+
+	err = stream.Send(&registry.DownloadReply{Body: &registry.DownloadReply_Package{Package: toProtoPackage(pkg)}})
+	if err != nil {
+		return err
+	}
+	buf := make([]byte, grpcChunkSize)
+	for {
+		n, err := reader.Read(buf)
+		if n > 0 {
+			data := registry.DownloadReply_Data{Data: buf[:n]}
+			if err := stream.Send(&registry.DownloadReply{Body: &data}); err != nil {
+				return err
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return status.Errorf(codes.Internal, "Failed to send file: %v", err)
+		}
+	}
+	s.config.downloads.Add(pkg)
+	return nil
+}
+
+func (s *registryService) Query(ctx context.Context, req *registry.QueryRequest) (*registry.QueryReply, error) {
+	if _, err := requireGRPCScope(ctx, scopeRead); err != nil {
+		return nil, err
+	}
+	spec, err := parseVersionSpec(req.Version)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	q := store.QueryParams{
+		OwnerId:    grpcOwner(req.OwnerId),
+		Name:       req.Name,
+		Version:    spec.exact,
+		NamePrefix: req.NamePrefix,
+	}
+	limit, err := setPageParams(&q, int(req.Limit), req.Sort, req.PageToken)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	resp, err := listPackages(ctx, s.config, q, spec, limit)
+	if errors.Is(err, store.ErrInvalidQuery) {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	reply := registry.QueryReply{NextPageToken: resp.NextPageToken}
+	for _, p := range resp.Packages {
+		reply.Packages = append(reply.Packages, toProtoPackage(p))
+	}
+	return &reply, nil
+}
+
+// Get은 패키지와 객체를 내려받을 서명된 URL을 반환한다. HTTP의 리디렉션처럼 다운로드로 센다.
+func (s *registryService) Get(ctx context.Context, req *registry.GetRequest) (*registry.GetReply, error) {
+	pkg, err := s.lookup(ctx, req.OwnerId, req.Name, req.Version)
+	if err != nil {
+		return nil, err
+	}
+	exists, err := s.config.packageBucket.Exists(ctx, pkg.ObjectStoreId)
+	if err != nil || !exists {
+		return nil, status.Error(codes.NotFound, "invalid package ID")
+	}
+	url, err := s.config.packageBucket.SignedURL(ctx, pkg.ObjectStoreId, nil)
+	if err != nil && gcerrors.Code(err) != gcerrors.Unimplemented {
+		return nil, status.Errorf(codes.Internal, "Failed to sign URL: %v", err)
+	}
+	s.config.downloads.Add(pkg)
+	return &registry.GetReply{Package: toProtoPackage(pkg), Url: url}, nil
+}
@@ -0,0 +1,245 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/PaulOh5/pkg-server-2/apitoken"
+	"github.com/PaulOh5/pkg-server-2/digest"
+	"github.com/PaulOh5/pkg-server-2/registry"
+	"github.com/PaulOh5/pkg-server-2/store"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+func startTestGrpcServer(t *testing.T, config appConfig) registry.PackageRegistryClient {
+	l := bufconn.Listen(1 << 20)
+	s := newGRPCServer(config)
+	go func() {
+		s.Serve(l)
+	}()
+	t.Cleanup(s.Stop)
+
+	bufconnDialer := func(ctx context.Context, addr string) (net.Conn, error) {
+		return l.Dial()
+	}
+	client, err := grpc.DialContext(
+		context.Background(),
+		"", grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithContextDialer(bufconnDialer),
+	)
+	if err != nil {
+		t.Fatal("DialContext", err)
+	}
+	t.Cleanup(func() { client.Close() })
+	return registry.NewPackageRegistryClient(client)
+}
+
+func withToken(token string) context.Context {
+	return metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer "+token)
+}
+
+// publishOverGrpc는 context를 보낸 뒤 data를 chunk 바이트씩 나눠 보낸다.
+func publishOverGrpc(
+	client registry.PackageRegistryClient, ctx context.Context,
+	first *registry.PublishRequest, data []byte, chunk int,
+) (*registry.PublishReply, error) {
+	stream, err := client.Publish(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := stream.Send(first); err != nil {
+		return nil, err
+	}
+	for len(data) > 0 {
+		n := min(chunk, len(data))
+		r := registry.PublishRequest{Body: &registry.PublishRequest_Data{Data: data[:n]}}
+		if err := stream.Send(&r); err != nil {
+			break
+		}
+		data = data[n:]
+	}
+	return stream.CloseAndRecv()
+}
+
+func TestPackageRegistry(t *testing.T) {
+	packageBucket, err := getTestBucket(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer packageBucket.Close()
+
+	config := appConfig{
+		logger:        log.New(io.Discard, "", 0),
+		packageBucket: packageBucket,
+		packageStore:  store.NewMemoryStore(),
+	}
+	ctx := context.Background()
+	tokens := map[string][]string{
+		"publisher": {scopePublish, scopeRead},
+		"reader":    {scopeRead},
+	}
+	for name, scopes := range tokens {
+		_, err := config.packageStore.AddToken(
+			ctx, store.Token{UserId: 1, Name: name, Scopes: scopes}, apitoken.Hash(name),
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	client := startTestGrpcServer(t, config)
+
+	pkgContext := func(version string) *registry.PublishRequest {
+		return &registry.PublishRequest{Body: &registry.PublishRequest_Context{
+			Context: &registry.PackageContext{
+				Name: "pkg", Version: version, Filename: "pkg.tar.gz",
+				Description: "a package", Keywords: []string{"grpc"},
+			},
+		}}
+	}
+	data := bytes.Repeat([]byte("package data "), 10000)
+	reply, err := publishOverGrpc(client, withToken("publisher"), pkgContext("1.0.0"), data, 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, size, err := digest.Compute(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reply.Id != "1/pkg-1.0.0-pkg.tar.gz" || reply.Size != size || reply.Sha256 != d.Sha256 {
+		t.Errorf("Unexpected publish reply: %v", reply)
+	}
+	if m, err := config.packageStore.Metadata(ctx, 1, "pkg", "1.0.0"); err != nil || m.Description != "a package" {
+		t.Errorf("Expected metadata to be stored, Got: %#v, %v", m, err)
+	}
+
+	publishErrors := []struct {
+		name  string
+		ctx   context.Context
+		first *registry.PublishRequest
+		code  codes.Code
+	}{
+		{name: "no token", ctx: ctx, first: pkgContext("1.1.0"), code: codes.Unauthenticated},
+		{name: "revoked token", ctx: withToken("unknown"), first: pkgContext("1.1.0"), code: codes.Unauthenticated},
+		{name: "read scope", ctx: withToken("reader"), first: pkgContext("1.1.0"), code: codes.PermissionDenied},
+		{name: "exists", ctx: withToken("publisher"), first: pkgContext("1.0.0"), code: codes.AlreadyExists},
+		{name: "bad version", ctx: withToken("publisher"), first: pkgContext("one"), code: codes.InvalidArgument},
+		{
+			name: "data first", ctx: withToken("publisher"), code: codes.InvalidArgument,
+			first: &registry.PublishRequest{Body: &registry.PublishRequest_Data{Data: data[:10]}},
+		},
+	}
+	for _, tc := range publishErrors {
+		_, err := publishOverGrpc(client, tc.ctx, tc.first, data[:100], 10)
+		if status.Code(err) != tc.code {
+			t.Errorf("%s: Expected %v, Got: %v", tc.name, tc.code, err)
+		}
+	}
+
+	// Download는 package를 먼저 보내고 파일을 이어서 보낸다
+	stream, err := client.Download(withToken("reader"), &registry.DownloadRequest{OwnerId: 1, Name: "pkg", Version: "latest"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	first, err := stream.Recv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p := first.GetPackage(); p == nil || p.Version != "1.0.0" || p.Sha512 != d.Sha512 {
+		t.Fatalf("Expected package 1.0.0 first, Got: %v", first)
+	}
+	downloaded := []byte{}
+	for {
+		r, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		downloaded = append(downloaded, r.GetData()...)
+	}
+	if !bytes.Equal(downloaded, data) {
+		t.Errorf("Expected %d bytes, Got: %d", len(data), len(downloaded))
+	}
+
+	get, err := client.Get(withToken("reader"), &registry.GetRequest{OwnerId: 1, Name: "pkg", Version: "^1.0.0"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if get.Package.ObjectStoreId != reply.Id || !strings.HasPrefix(get.Url, "file:///") {
+		t.Errorf("Unexpected get reply: %v", get)
+	}
+	query, err := client.Query(withToken("reader"), &registry.QueryRequest{Name: "pkg"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(query.Packages) != 1 || query.Packages[0].OwnerId != 1 || query.Packages[0].Size != size {
+		t.Errorf("Unexpected query reply: %v", query)
+	}
+
+	readErrors := []struct {
+		name string
+		call func() error
+		code codes.Code
+	}{
+		{
+			name: "get missing version",
+			call: func() error {
+				_, err := client.Get(withToken("reader"), &registry.GetRequest{OwnerId: 1, Name: "pkg", Version: "2.0.0"})
+				return err
+			},
+			code: codes.NotFound,
+		},
+		{
+			name: "get without owner",
+			call: func() error {
+				_, err := client.Get(withToken("reader"), &registry.GetRequest{Name: "pkg", Version: "1.0.0"})
+				return err
+			},
+			code: codes.InvalidArgument,
+		},
+		{
+			name: "query without token",
+			call: func() error {
+				_, err := client.Query(ctx, &registry.QueryRequest{Name: "pkg"})
+				return err
+			},
+			code: codes.Unauthenticated,
+		},
+		{
+			name: "query bad limit",
+			call: func() error {
+				_, err := client.Query(withToken("reader"), &registry.QueryRequest{Limit: -1})
+				return err
+			},
+			code: codes.InvalidArgument,
+		},
+		{
+			name: "download missing package",
+			call: func() error {
+				stream, err := client.Download(withToken("reader"), &registry.DownloadRequest{OwnerId: 2, Name: "pkg", Version: "1.0.0"})
+				if err != nil {
+					return err
+				}
+				_, err = stream.Recv()
+				return err
+			},
+			code: codes.NotFound,
+		},
+	}
+	for _, tc := range readErrors {
+		if err := tc.call(); status.Code(err) != tc.code {
+			t.Errorf("%s: Expected %v, Got: %v", tc.name, tc.code, err)
+		}
+	}
+}
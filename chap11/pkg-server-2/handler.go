@@ -1,91 +1,71 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
-	"log"
-	"math/rand"
 	"net/http"
 	"strconv"
-)
 
-func getOwnerId() int {
-	return rand.Intn(4) + 1
-}
+	"github.com/PaulOh5/pkg-server-2/digest"
+	"github.com/PaulOh5/pkg-server-2/store"
+	"gocloud.dev/gcerrors"
+)
 
+// packageRegHandler는 multipart 본문을 임시 파일에 저장하지 않고 filedata 파트를
+// 버킷으로 바로 흘려보낸다. 객체 키를 정하려면 name과 version을 먼저 알아야 하므로
+// 다른 필드는 filedata보다 앞에 와야 하고 filedata 뒤의 파트는 읽지 않는다.
 func packageRegHandler(
 	w http.ResponseWriter,
 	r *http.Request,
 	config appConfig,
 ) {
-	d := pkgRegisterResponse{}
-	err := r.ParseMultipartForm(5000)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
-		return
-	}
-	mForm := r.MultipartForm
-	fHeader := mForm.File["filedata"][0]
-
-	packageName := mForm.Value["name"][0]
-	packageVersion := mForm.Value["version"][0]
-	packageOwner := getOwnerId()
-
-	q := pkgQueryParams{
-		ownerId: packageOwner,
-		version: packageName,
-		name:    packageName,
-	}
-	pkgResults, err := queryDb(config, q)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	a, ok := requireScope(w, r, scopePublish)
+	if !ok {
 		return
 	}
-	if len(pkgResults) != 0 {
-		http.Error(w, "Package version for the owner exists", http.StatusBadRequest)
-		return
-	}
-
-	d.ID = fmt.Sprintf(
-		"%d/%s-%s-%s",
-		packageOwner,
-		packageName,
-		packageVersion,
-		fHeader.Filename,
-	)
-	nBytes, err := uploadData(config, d.ID, fHeader)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	quota, ok := checkPublishQuota(w, r, config, a.userId)
+	if !ok {
 		return
 	}
-
-	err = updateDb(
-		config,
-		pkgRow{
-			OwnerId:       packageOwner,
-			Name:          packageName,
-			Version:       packageVersion,
-			ObjectStoreId: d.ID,
-		},
-	)
+	r.Body = http.MaxBytesReader(w, r.Body, quota.MaxPackageSize+maxFormFieldsSize)
+	mr, err := r.MultipartReader()
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	config.logger.Printf(
-		"Package uploaded: %s. Bytes written: %d\n",
-		d.ID,
-		nBytes,
-	)
-	jsonData, err := json.Marshal(d)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
+	form := pkgRegisterForm{}
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			http.Error(w, "Missing filedata part", http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), uploadErrorStatus(err))
+			return
+		}
+		if part.FormName() == "filedata" {
+			if len(part.FileName()) == 0 {
+				http.Error(w, "filedata must be a file", http.StatusBadRequest)
+				return
+			}
+			d, err := publishPackage(r.Context(), config, a.userId, form, part.FileName(), part, quota)
+			if err != nil {
+				http.Error(w, err.Error(), uploadErrorStatus(err))
+				return
+			}
+			writeJSON(w, http.StatusOK, d)
+			return
+		}
+		if err := form.readField(part); err != nil {
+			http.Error(w, err.Error(), uploadErrorStatus(err))
+			return
+		}
 	}
-	w.Header().Set("Content-Type", "application/json")
-	fmt.Fprint(w, string(jsonData))
 }
 
 func packageGetHandler(
@@ -93,36 +73,49 @@ func packageGetHandler(
 	r *http.Request,
 	config appConfig,
 ) {
-	q, err := parseQuery(r)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+	if _, ok := requireScope(w, r, scopeRead); !ok {
 		return
 	}
-	if q.ownerId == -1 || len(q.name) == 0 || len(q.version) == 0 {
-		http.Error(w, "Must specify package owner, name and version", http.StatusBadRequest)
+	pkg, ok := findPackage(w, r, config)
+	if !ok {
 		return
 	}
+	packageID := pkg.ObjectStoreId
+	download := r.URL.Query().Get("download")
 
-	pkgResults, err := queryDb(config, q)
-	log.Println(pkgResults)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	exists, err := config.packageBucket.Exists(r.Context(), packageID)
+	if err != nil || !exists {
+		http.Error(w, "invalid package ID", http.StatusNotFound)
 		return
 	}
-	if len(pkgResults) == 0 {
-		http.Error(w, "No package found", http.StatusNotFound)
+
+	// 서명된 URL은 만료되므로 리디렉션은 캐시하지 않고, latest나 범위로 고른 버전은 바뀔 수 있다.
+	// 정확한 버전은 회수해도 객체가 그대로이므로 Last-Modified는 게시 시각이다. latest나 범위는
+	// 회수하거나 지우면 더 낮은 버전으로 바뀌므로 패키지를 마지막으로 바꾼 시각을 쓴다.
+	cacheControl := cacheControlRevalidate
+	modified := storeTime(pkg.Created)
+	if spec, _ := parseVersionSpec(r.URL.Query().Get("version")); len(spec.exact) != 0 {
+		if download == "true" {
+			cacheControl = cacheControlImmutable
+		}
+	} else {
+		modified, err = packageModified(r.Context(), config, pkg.OwnerId, pkg.Name)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+	if checkNotModified(w, r, packageETag(pkg), modified, cacheControl) {
 		return
 	}
 
-	packageID := pkgResults[0].ObjectStoreId
-
-	exists, err := config.packageBucket.Exists(r.Context(), packageID)
-	if err != nil || !exists {
-		http.Error(w, "invalid package ID", http.StatusNotFound)
-		return
+	// 체크섬이 없는 예전 패키지에는 헤더를 붙이지 않는다
+	digests := digest.Digests{Sha256: pkg.Sha256, Sha512: pkg.Sha512}
+	if !digests.IsEmpty() {
+		w.Header().Set("Repr-Digest", digests.ReprDigest())
+		w.Header().Set("Digest", digests.Digest())
 	}
 
-	download := r.URL.Query().Get("download")
 	if download == "true" {
 		reader, err := config.packageBucket.NewReader(r.Context(), packageID, nil)
 		if err != nil {
@@ -137,6 +130,7 @@ func packageGetHandler(
 			http.Error(w, "Failed to send file: "+err.Error(), http.StatusInternalServerError)
 			return
 		}
+		config.downloads.Add(pkg)
 	} else {
 		url, err := config.packageBucket.SignedURL(r.Context(), packageID, nil)
 		if err != nil {
@@ -144,31 +138,221 @@ func packageGetHandler(
 			return
 		}
 
+		config.downloads.Add(pkg)
 		http.Redirect(w, r, url, http.StatusTemporaryRedirect)
 	}
 }
 
+// packageDeleteHandler는 기본으로 버전을 회수(yank)한다. hard=true면 관리자만
+// 행을 지울 수 있고, 버킷의 객체는 GC가 지운다.
+func packageDeleteHandler(
+	w http.ResponseWriter,
+	r *http.Request,
+	config appConfig,
+) {
+	a, ok := requireScope(w, r, scopePublish)
+	if !ok {
+		return
+	}
+	q, spec, err := parseQuery(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if q.OwnerId == -1 || len(q.Name) == 0 || len(spec.exact) == 0 {
+		http.Error(w, "Must specify package owner, name and exact version", http.StatusBadRequest)
+		return
+	}
+	if q.OwnerId != a.userId && !a.hasScope(scopeAdmin) {
+		http.Error(w, "Cannot delete packages of other owners", http.StatusForbidden)
+		return
+	}
+
+	hard := r.URL.Query().Get("hard") == "true"
+	var deleted store.Package
+	if hard {
+		if !a.hasScope(scopeAdmin) {
+			http.Error(w, "Hard delete requires the admin scope", http.StatusForbidden)
+			return
+		}
+		deleted, err = config.packageStore.DeletePackage(r.Context(), q.OwnerId, q.Name, q.Version)
+	} else {
+		err = config.packageStore.YankPackage(r.Context(), q.OwnerId, q.Name, q.Version)
+	}
+	if errors.Is(err, store.ErrNotFound) {
+		http.Error(w, "No package found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	config.packages.invalidate(q.OwnerId, q.Name)
+	// 삭제와 회수는 이미 끝났으므로 클라이언트가 끊어도 이벤트는 큐에 넣는다
+	ctx := context.WithoutCancel(r.Context())
+	action := "yanked"
+	if hard {
+		action = "deleted"
+		notifyWebhooks(ctx, config, store.EventDeleted, deleted)
+	} else {
+		yanked := store.Package{OwnerId: q.OwnerId, Name: q.Name, Version: q.Version}
+		if pkgs, err := config.packageStore.QueryPackages(ctx, q); err == nil && len(pkgs) == 1 {
+			yanked = pkgs[0]
+		}
+		notifyWebhooks(ctx, config, store.EventYanked, yanked)
+	}
+	config.logger.Printf(
+		"Package %d/%s@%s %s by user %d\n",
+		q.OwnerId, q.Name, q.Version, action, a.userId,
+	)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// findPackage는 owner_id, name, version 파라미터로 lookupPackage를 호출한다.
+func findPackage(
+	w http.ResponseWriter,
+	r *http.Request,
+	config appConfig,
+) (store.Package, bool) {
+	q, spec, err := parseQuery(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return store.Package{}, false
+	}
+	pkg, err := lookupPackage(r.Context(), config, q.OwnerId, q.Name, spec)
+	if err != nil {
+		http.Error(w, err.Error(), lookupErrorStatus(err))
+		return store.Package{}, false
+	}
+	return pkg, true
+}
+
+var errNoPackage = errors.New("No package found")
+
+// lookupPackage는 소유자, 이름, 버전으로 패키지 하나를 찾는다.
+// 범위 제약과 일치하는 버전이 여럿이면 가장 높은 버전을 고른다.
+func lookupPackage(
+	ctx context.Context, config appConfig,
+	ownerId int, name string, spec versionSpec,
+) (store.Package, error) {
+	if ownerId == -1 || len(name) == 0 || spec.isEmpty() {
+		return store.Package{}, badRequest("Must specify package owner, name and version")
+	}
+	pkgResults, err := config.packages.versions(ctx, config.packageStore, ownerId, name)
+	if err != nil {
+		return store.Package{}, err
+	}
+	if len(spec.exact) != 0 {
+		pkgResults = exactVersion(pkgResults, spec.exact)
+	}
+	pkgResults = filterVersions(pkgResults, spec)
+	if len(pkgResults) == 0 {
+		return store.Package{}, errNoPackage
+	}
+	return pkgResults[len(pkgResults)-1], nil
+}
+
+func lookupErrorStatus(err error) int {
+	var badReq badRequestError
+	switch {
+	case errors.As(err, &badReq):
+		return http.StatusBadRequest
+	case errors.Is(err, errNoPackage):
+		return http.StatusNotFound
+	}
+	return http.StatusInternalServerError
+}
+
+// packageVerifyHandler는 버킷의 객체를 다시 읽어 저장된 체크섬과 비교한다.
+func packageVerifyHandler(
+	w http.ResponseWriter,
+	r *http.Request,
+	config appConfig,
+) {
+	if r.Method != "GET" && r.Method != "POST" {
+		http.Error(w, "Invalid Method", http.StatusMethodNotAllowed)
+		return
+	}
+	if _, ok := requireScope(w, r, scopeRead); !ok {
+		return
+	}
+	pkg, ok := findPackage(w, r, config)
+	if !ok {
+		return
+	}
+
+	actual, size, err := digest.Object(r.Context(), config.packageBucket, pkg.ObjectStoreId)
+	if gcerrors.Code(err) == gcerrors.NotFound {
+		http.Error(w, "invalid package ID", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	resp := pkgVerifyResponse{
+		ObjectStoreId: pkg.ObjectStoreId,
+		Size:          size,
+		Expected:      digest.Digests{Sha256: pkg.Sha256, Sha512: pkg.Sha512},
+		Actual:        actual,
+	}
+	switch {
+	case resp.Expected.IsEmpty():
+		resp.Error = "no checksum recorded for the package"
+	case !resp.Expected.Equal(actual):
+		resp.Error = "checksum mismatch"
+		config.logger.Printf("Checksum mismatch for %s\n", pkg.ObjectStoreId)
+	default:
+		resp.Verified = true
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
 func packageQueryHandler(
 	w http.ResponseWriter,
 	r *http.Request,
 	config appConfig,
 ) {
-	q, err := parseQuery(r)
+	if _, ok := requireScope(w, r, scopeRead); !ok {
+		return
+	}
+	q, spec, err := parseQuery(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	limit, err := parsePageParams(r, &q)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
 	}
 
-	pkgResults, err := queryDb(config, q)
+	// 결과를 읽기 전에 시각을 읽으므로 그사이 바뀌어도 Last-Modified가 결과보다 늦지 않다.
+	// 이름을 정하지 않은 질의는 소유자의 모든 패키지, 또는 모든 패키지가 바뀐 시각을 쓴다
+	modified, err := packageModified(r.Context(), config, q.OwnerId, q.Name)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	resp, err := listPackages(r.Context(), config, q, spec, limit)
+	if errors.Is(err, store.ErrInvalidQuery) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	jsonData, err := json.Marshal(pkgResults)
+	jsonData, err := json.Marshal(resp)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	if checkNotModified(w, r, contentETag(jsonData), modified, cacheControlRevalidate) {
+		return
+	}
 	w.Header().Set("Content-Type", "application/json")
 	fmt.Fprint(w, string(jsonData))
 }
@@ -183,12 +367,16 @@ func packageHandler(
 		packageQueryHandler(w, r, config)
 	case "POST":
 		packageRegHandler(w, r, config)
+	case "DELETE":
+		packageDeleteHandler(w, r, config)
 	default:
 		http.Error(w, "Invalid Method", http.StatusMethodNotAllowed)
 	}
 }
 
-func parseQuery(r *http.Request) (pkgQueryParams, error) {
+// parseQuery는 version 파라미터가 정확한 버전일 때만 QueryParams.Version을 채운다.
+// latest와 범위 제약은 결과를 받은 뒤 filterVersions로 거른다.
+func parseQuery(r *http.Request) (store.QueryParams, versionSpec, error) {
 	queryParams := r.URL.Query()
 	owner := queryParams.Get("owner_id")
 	if len(owner) == 0 {
@@ -196,15 +384,18 @@ func parseQuery(r *http.Request) (pkgQueryParams, error) {
 	}
 	ownerId, err := strconv.Atoi(owner)
 	if err != nil {
-		return pkgQueryParams{}, err
+		return store.QueryParams{}, versionSpec{}, err
 	}
 	name := queryParams.Get("name")
-	version := queryParams.Get("version")
+	spec, err := parseVersionSpec(queryParams.Get("version"))
+	if err != nil {
+		return store.QueryParams{}, versionSpec{}, err
+	}
 
-	q := pkgQueryParams{
-		ownerId: ownerId,
-		name:    name,
-		version: version,
+	q := store.QueryParams{
+		OwnerId: ownerId,
+		Name:    name,
+		Version: spec.exact,
 	}
-	return q, nil
+	return q, spec, nil
 }
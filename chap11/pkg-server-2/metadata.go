@@ -0,0 +1,333 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/PaulOh5/pkg-server-2/store"
+	"gocloud.dev/blob"
+)
+
+const (
+	// 아카이브 안에서 찾는 매니페스트 파일. npm의 package.json과 같은 필드를 쓴다.
+	manifestFilename = "package.json"
+	maxManifestSize  = 64 << 10
+	maxReadmeSize    = 512 << 10
+
+	maxDescriptionLength = 1000
+	maxLicenseLength     = 100
+	maxHomepageLength    = 300
+	maxKeywords          = 20
+	maxKeywordLength     = 50
+)
+
+// packageManifest는 폼 필드나 아카이브의 package.json으로 받는 메타데이터다.
+type packageManifest struct {
+	Description string   `json:"description"`
+	License     string   `json:"license"`
+	Homepage    string   `json:"homepage"`
+	Keywords    []string `json:"keywords"`
+	Readme      string   `json:"readme"`
+	// Dependencies는 package.json처럼 패키지 이름에서 버전 제약으로 가는 맵이다.
+	// 이름이 <소유자 ID>/로 시작하지 않으면 게시하는 소유자의 패키지다.
+	Dependencies map[string]string `json:"dependencies"`
+}
+
+// merge는 o에서 비어 있지 않은 필드로 m의 필드를 덮어쓴다.
+func (m packageManifest) merge(o packageManifest) packageManifest {
+	if len(o.Description) != 0 {
+		m.Description = o.Description
+	}
+	if len(o.License) != 0 {
+		m.License = o.License
+	}
+	if len(o.Homepage) != 0 {
+		m.Homepage = o.Homepage
+	}
+	if len(o.Keywords) != 0 {
+		m.Keywords = o.Keywords
+	}
+	if len(o.Readme) != 0 {
+		m.Readme = o.Readme
+	}
+	if len(o.Dependencies) != 0 {
+		m.Dependencies = o.Dependencies
+	}
+	return m
+}
+
+// normalize는 앞뒤 공백을 지우고 키워드의 빈 값과 중복을 없앤 뒤 길이를 검사한다.
+func (m *packageManifest) normalize() error {
+	m.Description = strings.TrimSpace(m.Description)
+	m.License = strings.TrimSpace(m.License)
+	m.Homepage = strings.TrimSpace(m.Homepage)
+	if len(m.Description) > maxDescriptionLength {
+		return badRequest("description must be at most %d bytes", maxDescriptionLength)
+	}
+	if len(m.License) > maxLicenseLength {
+		return badRequest("license must be at most %d bytes", maxLicenseLength)
+	}
+	if len(m.Homepage) != 0 {
+		u, err := url.Parse(m.Homepage)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || len(u.Host) == 0 ||
+			len(m.Homepage) > maxHomepageLength {
+			return badRequest("homepage must be an http or https URL of at most %d bytes", maxHomepageLength)
+		}
+	}
+	if len(m.Readme) > maxReadmeSize {
+		return badRequest("readme must be at most %d bytes", maxReadmeSize)
+	}
+
+	keywords := []string{}
+	seen := map[string]bool{}
+	for _, keyword := range m.Keywords {
+		keyword = strings.TrimSpace(keyword)
+		if len(keyword) == 0 || seen[strings.ToLower(keyword)] {
+			continue
+		}
+		if len(keyword) > maxKeywordLength || strings.Contains(keyword, ",") {
+			return badRequest("keywords must be at most %d bytes and cannot contain commas", maxKeywordLength)
+		}
+		seen[strings.ToLower(keyword)] = true
+		keywords = append(keywords, keyword)
+	}
+	if len(keywords) > maxKeywords {
+		return badRequest("at most %d keywords are allowed", maxKeywords)
+	}
+	m.Keywords = keywords
+
+	if len(m.Dependencies) > maxDependencies {
+		return badRequest("at most %d dependencies are allowed", maxDependencies)
+	}
+	for name, constraint := range m.Dependencies {
+		if _, _, err := parseDependencyName(name); err != nil {
+			return err
+		}
+		constraint = strings.TrimSpace(constraint)
+		spec, err := parseVersionSpec(constraint)
+		if err != nil || spec.isEmpty() {
+			return badRequest("invalid version constraint %q for dependency %s", constraint, name)
+		}
+		m.Dependencies[name] = constraint
+	}
+	return nil
+}
+
+func (m packageManifest) metadata(owner int, name, version string) store.Metadata {
+	return store.Metadata{
+		OwnerId:      owner,
+		Name:         name,
+		Version:      version,
+		Description:  m.Description,
+		License:      m.License,
+		Homepage:     m.Homepage,
+		Keywords:     m.Keywords,
+		Readme:       m.Readme,
+		Dependencies: dependencyList(owner, m.Dependencies),
+	}
+}
+
+// readArchiveManifest는 버킷에 올라간 아카이브에서 package.json과 README를 찾는다.
+// 최상위나 한 단계 아래 디렉터리(npm 아카이브의 package/)에 있는 파일만 보고,
+// 더 얕은 파일을 고른다. tar, tar.gz, zip이 아니거나 읽을 수 없는 아카이브는
+// 매니페스트가 없는 것으로 본다.
+func readArchiveManifest(ctx context.Context, bucket *blob.Bucket, key string) (packageManifest, error) {
+	r, err := bucket.NewReader(ctx, key, nil)
+	if err != nil {
+		return packageManifest{}, err
+	}
+	defer r.Close()
+
+	br := bufio.NewReader(r)
+	header, _ := br.Peek(512)
+	var f archiveFinder
+	switch {
+	case bytes.HasPrefix(header, []byte{0x1f, 0x8b}):
+		gr, err := gzip.NewReader(br)
+		if err != nil {
+			return packageManifest{}, nil
+		}
+		defer gr.Close()
+		f.scanTar(tar.NewReader(gr))
+	case bytes.HasPrefix(header, []byte("PK\x03\x04")):
+		ra := bucketReaderAt{ctx: ctx, bucket: bucket, key: key}
+		zr, err := zip.NewReader(ra, r.Size())
+		if err != nil {
+			return packageManifest{}, nil
+		}
+		f.scanZip(zr)
+	case len(header) >= 262 && string(header[257:262]) == "ustar":
+		f.scanTar(tar.NewReader(br))
+	}
+	if err := ctx.Err(); err != nil {
+		return packageManifest{}, err
+	}
+	return f.result()
+}
+
+type archiveFinder struct {
+	manifest      []byte
+	manifestDepth int
+	readme        []byte
+	readmeDepth   int
+}
+
+// entryDepth는 파일이 매니페스트 후보가 아니면 -1을 반환한다.
+func entryDepth(name string) int {
+	name = strings.TrimPrefix(path.Clean(strings.TrimPrefix(name, "/")), "./")
+	depth := strings.Count(name, "/")
+	if depth > 1 {
+		return -1
+	}
+	return depth
+}
+
+func isReadme(name string) bool {
+	base := strings.ToLower(path.Base(name))
+	ext := path.Ext(base)
+	switch ext {
+	case "", ".md", ".markdown", ".txt", ".rst":
+		return strings.TrimSuffix(base, ext) == "readme"
+	}
+	return false
+}
+
+// visit는 필요한 파일이면 open으로 내용을 읽는다.
+func (f *archiveFinder) visit(name string, open func() (io.Reader, error)) {
+	depth := entryDepth(name)
+	if depth < 0 {
+		return
+	}
+	switch {
+	case path.Base(name) == manifestFilename && (f.manifest == nil || depth < f.manifestDepth):
+		if data, ok := readLimited(open, maxManifestSize); ok {
+			f.manifest, f.manifestDepth = data, depth
+		}
+	case isReadme(name) && (f.readme == nil || depth < f.readmeDepth):
+		if data, ok := readLimited(open, maxReadmeSize); ok {
+			f.readme, f.readmeDepth = data, depth
+		}
+	}
+}
+
+// done은 최상위에서 두 파일을 모두 찾아 더 볼 필요가 없는지 확인한다.
+func (f *archiveFinder) done() bool {
+	return f.manifest != nil && f.manifestDepth == 0 && f.readme != nil && f.readmeDepth == 0
+}
+
+func (f *archiveFinder) scanTar(tr *tar.Reader) {
+	for !f.done() {
+		h, err := tr.Next()
+		if err != nil {
+			return
+		}
+		if h.Typeflag != tar.TypeReg {
+			continue
+		}
+		f.visit(h.Name, func() (io.Reader, error) { return tr, nil })
+	}
+}
+
+func (f *archiveFinder) scanZip(zr *zip.Reader) {
+	for _, zf := range zr.File {
+		if f.done() {
+			return
+		}
+		if !zf.Mode().IsRegular() {
+			continue
+		}
+		f.visit(zf.Name, func() (io.Reader, error) {
+			rc, err := zf.Open()
+			return rc, err
+		})
+	}
+}
+
+// readLimited는 limit보다 큰 파일은 건너뛴다. open이 돌려준 io.Closer는 닫는다.
+func readLimited(open func() (io.Reader, error), limit int64) ([]byte, bool) {
+	r, err := open()
+	if err != nil {
+		return nil, false
+	}
+	if c, ok := r.(io.Closer); ok {
+		defer c.Close()
+	}
+	data, err := io.ReadAll(io.LimitReader(r, limit+1))
+	if err != nil || int64(len(data)) > limit {
+		return nil, false
+	}
+	return data, true
+}
+
+func (f *archiveFinder) result() (packageManifest, error) {
+	m := packageManifest{}
+	if f.manifest != nil {
+		if err := json.Unmarshal(f.manifest, &m); err != nil {
+			return m, badRequest("invalid %s in the archive: %v", manifestFilename, err)
+		}
+	}
+	if len(m.Readme) == 0 && f.readme != nil {
+		m.Readme = string(f.readme)
+	}
+	return m, nil
+}
+
+// bucketReaderAt은 zip의 중앙 디렉터리를 읽을 수 있도록 객체를 범위 요청으로 읽는다.
+type bucketReaderAt struct {
+	ctx    context.Context
+	bucket *blob.Bucket
+	key    string
+}
+
+func (b bucketReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	r, err := b.bucket.NewRangeReader(b.ctx, b.key, off, int64(len(p)), nil)
+	if err != nil {
+		return 0, err
+	}
+	defer r.Close()
+	n, err := io.ReadFull(r, p)
+	if errors.Is(err, io.ErrUnexpectedEOF) {
+		err = io.EOF
+	}
+	return n, err
+}
+
+// packageMetadataHandler는 패키지 버전의 메타데이터와 README를 반환한다.
+func packageMetadataHandler(
+	w http.ResponseWriter,
+	r *http.Request,
+	config appConfig,
+) {
+	if r.Method != "GET" {
+		http.Error(w, "Invalid Method", http.StatusMethodNotAllowed)
+		return
+	}
+	if _, ok := requireScope(w, r, scopeRead); !ok {
+		return
+	}
+	pkg, ok := findPackage(w, r, config)
+	if !ok {
+		return
+	}
+	m, err := config.packageStore.Metadata(r.Context(), pkg.OwnerId, pkg.Name, pkg.Version)
+	if errors.Is(err, store.ErrNotFound) {
+		http.Error(w, "No metadata for the package", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, m)
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"text/tabwriter"
+
+	"github.com/PaulOh5/pkg-server-2/settings"
+	"github.com/PaulOh5/pkg-server-2/store"
+)
+
+const migrateUsage = "usage: pkg-server-2 migrate status|up [-to version]|down [-steps n]"
+
+// checkSchema는 적용하지 않은 마이그레이션이 있으면 migrate가 참일 때 적용하고,
+// 아니면 오래된 스키마로 서버가 뜨지 않도록 오류를 반환한다.
+func checkSchema(ctx context.Context, packageStore store.PackageStore, migrate bool, logger *log.Logger) error {
+	m, ok := packageStore.(store.Migrator)
+	if !ok {
+		return nil
+	}
+	if migrate {
+		applied, err := m.MigrateUp(ctx, 0)
+		for _, a := range applied {
+			logger.Printf("Applied migration %d (%s)\n", a.Version, a.Name)
+		}
+		return err
+	}
+	status, err := m.MigrationStatus(ctx)
+	if err != nil {
+		return err
+	}
+	if n := store.Pending(status); n != 0 {
+		return fmt.Errorf(
+			"%w: %d pending migrations, start with -migrate or run: pkg-server-2 migrate up",
+			store.ErrSchemaOutdated, n,
+		)
+	}
+	return nil
+}
+
+// runMigrate는 서버와 같은 설정으로 저장소를 열고 마이그레이션 명령을 실행한다.
+func runMigrate(args []string, out io.Writer) error {
+	if len(args) == 0 {
+		return errors.New(migrateUsage)
+	}
+	command := args[0]
+	fs := flag.NewFlagSet("migrate "+command, flag.ContinueOnError)
+	fs.SetOutput(out)
+	target := fs.Int("to", 0, "version to migrate up to, 0 applies all migrations")
+	steps := fs.Int("steps", 1, "number of migrations to revert")
+	loader := settings.NewLoader(fs)
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+	cfg, err := loader.Load(serverDefaults(), os.Getenv)
+	if err != nil {
+		return fmt.Errorf("invalid configuration:\n%w", err)
+	}
+
+	packageStore, err := cfg.OpenStore()
+	if err != nil {
+		return err
+	}
+	defer packageStore.Close()
+	m, ok := packageStore.(store.Migrator)
+	if !ok {
+		return errors.New("the store driver has no schema to migrate")
+	}
+
+	ctx := context.Background()
+	switch command {
+	case "status":
+		status, err := m.MigrationStatus(ctx)
+		if err != nil {
+			return err
+		}
+		tw := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "VERSION\tNAME\tAPPLIED")
+		for _, s := range status {
+			applied := s.Applied
+			switch {
+			case s.Unknown:
+				applied += " (unknown to this binary)"
+			case len(applied) == 0:
+				applied = "pending"
+			}
+			fmt.Fprintf(tw, "%d\t%s\t%s\n", s.Version, s.Name, applied)
+		}
+		return tw.Flush()
+	case "up":
+		applied, err := m.MigrateUp(ctx, *target)
+		for _, a := range applied {
+			fmt.Fprintf(out, "Applied migration %d (%s)\n", a.Version, a.Name)
+		}
+		return err
+	case "down":
+		if *steps <= 0 {
+			return errors.New("-steps must be positive")
+		}
+		reverted, err := m.MigrateDown(ctx, *steps)
+		for _, r := range reverted {
+			fmt.Fprintf(out, "Reverted migration %d (%s)\n", r.Version, r.Name)
+		}
+		return err
+	default:
+		return errors.New(migrateUsage)
+	}
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"log"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/PaulOh5/pkg-server-2/store"
+)
+
+func TestMigrateCommand(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "packages.db")
+	t.Setenv("STORE_DRIVER", "sqlite")
+	t.Setenv("SQLITE_PATH", path)
+
+	testConfigs := []struct {
+		args     []string
+		expected string
+	}{
+		{args: []string{"status"}, expected: "1        initial"},
+		{args: []string{"up", "-to", "2"}, expected: "Applied migration 2 (api_tokens)"},
+		{args: []string{"up"}, expected: "Applied migration 3 (version_key)"},
+		{args: []string{"down", "-steps", "2"}, expected: "Reverted migration"},
+		{args: []string{"status"}, expected: "pending"},
+	}
+	for _, tc := range testConfigs {
+		var out bytes.Buffer
+		if err := runMigrate(tc.args, &out); err != nil {
+			t.Fatalf("migrate %v: %v", tc.args, err)
+		}
+		if !strings.Contains(out.String(), tc.expected) {
+			t.Errorf("Expected output of migrate %v to contain %q, Got: %s", tc.args, tc.expected, out.String())
+		}
+	}
+	if err := runMigrate([]string{"sideways"}, io.Discard); err == nil {
+		t.Error("Expected error for unknown command")
+	}
+
+	// 서버는 -migrate 없이 오래된 스키마로 시작하지 않는다
+	packageStore, err := store.OpenSQLite(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer packageStore.Close()
+	logger := log.New(io.Discard, "", 0)
+	err = checkSchema(context.Background(), packageStore, false, logger)
+	if !errors.Is(err, store.ErrSchemaOutdated) {
+		t.Fatalf("Expected error: %v, Got: %v", store.ErrSchemaOutdated, err)
+	}
+	if err = checkSchema(context.Background(), packageStore, true, logger); err != nil {
+		t.Fatal(err)
+	}
+	if err = checkSchema(context.Background(), packageStore, false, logger); err != nil {
+		t.Fatal(err)
+	}
+}
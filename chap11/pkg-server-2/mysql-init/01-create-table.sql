@@ -1,5 +1,7 @@
 use package_server;
 
+-- 처음 배포할 때의 스키마다. 이후의 변경은 store/migrations에 있고
+-- 서버를 -migrate로 시작하거나 migrate up 명령으로 적용한다.
 CREATE TABLE users (
     id INT PRIMARY KEY AUTO_INCREMENT,
     username VARCHAR(30) NOT NULL
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/PaulOh5/pkg-server-2/apitoken"
+	"github.com/PaulOh5/pkg-server-2/store"
+	"gocloud.dev/blob/fileblob"
+)
+
+func TestPackageDeleteAndGC(t *testing.T) {
+	bucketDir := t.TempDir()
+	packageBucket, err := fileblob.OpenBucket(bucketDir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer packageBucket.Close()
+
+	config := appConfig{
+		logger:        log.New(io.Discard, "", 0),
+		packageBucket: packageBucket,
+		packageStore:  store.NewMemoryStore(),
+	}
+	ctx := context.Background()
+	for _, version := range []string{"1.0.0", "1.1.0"} {
+		id := "1/pkg-" + version
+		err := config.packageStore.AddPackage(ctx, store.Package{
+			OwnerId: 1, Name: "pkg", Version: version, ObjectStoreId: id,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := packageBucket.WriteAll(ctx, id, []byte(version), nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := packageBucket.WriteAll(ctx, "stray-object", []byte("x"), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	tokens := map[string][]string{
+		"owner": {scopePublish, scopeRead},
+		"admin": {scopeAdmin},
+	}
+	for name, scopes := range tokens {
+		userId := 1
+		if name == "admin" {
+			userId = 2
+		}
+		_, err := config.packageStore.AddToken(
+			ctx, store.Token{UserId: userId, Name: name, Scopes: scopes}, apitoken.Hash(name),
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	mux := http.NewServeMux()
+	setupHandlers(mux, config)
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	do := func(method, path, token string) *http.Response {
+		req, err := http.NewRequest(method, ts.URL+path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+	download := func(version string) (int, string) {
+		resp := do("GET", "/api/packages/download?owner_id=1&name=pkg&download=true&version="+version, "owner")
+		defer resp.Body.Close()
+		data, err := io.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp.StatusCode, string(data)
+	}
+
+	testConfigs := []struct {
+		method string
+		path   string
+		token  string
+		status int
+	}{
+		{method: "DELETE", path: "/api/packages?owner_id=1&name=pkg&version=^1.0", token: "owner", status: http.StatusBadRequest},
+		{method: "DELETE", path: "/api/packages?owner_id=1&name=pkg&version=2.0.0", token: "owner", status: http.StatusNotFound},
+		{method: "DELETE", path: "/api/packages?owner_id=1&name=pkg&version=1.1.0&hard=true", token: "owner", status: http.StatusForbidden},
+		{method: "DELETE", path: "/api/packages?owner_id=1&name=pkg&version=1.1.0", token: "owner", status: http.StatusNoContent},
+		{method: "POST", path: "/api/admin/gc", token: "owner", status: http.StatusForbidden},
+	}
+	for _, tc := range testConfigs {
+		resp := do(tc.method, tc.path, tc.token)
+		resp.Body.Close()
+		if resp.StatusCode != tc.status {
+			t.Fatalf("%s %s: Expected status %d, Got: %d", tc.method, tc.path, tc.status, resp.StatusCode)
+		}
+	}
+
+	// 회수된 버전은 latest에서 빠지지만 정확한 버전으로는 내려받을 수 있다
+	if status, body := download("latest"); status != http.StatusOK || body != "1.0.0" {
+		t.Errorf("Expected latest to resolve to 1.0.0, Got: %d %s", status, body)
+	}
+	if status, body := download("1.1.0"); status != http.StatusOK || body != "1.1.0" {
+		t.Errorf("Expected yanked version to be downloadable, Got: %d %s", status, body)
+	}
+
+	resp := do("DELETE", "/api/packages?owner_id=1&name=pkg&version=1.0.0&hard=true", "admin")
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("Expected status 204, Got: %d", resp.StatusCode)
+	}
+	if status, _ := download("1.0.0"); status != http.StatusNotFound {
+		t.Errorf("Expected deleted version to be gone, Got: %d", status)
+	}
+
+	// 삭제 기록은 초 단위이므로 객체가 삭제 전에 쓰였음이 분명하도록 수정 시각을 당긴다
+	old := time.Now().Add(-time.Hour)
+	if err := os.Chtimes(filepath.Join(bucketDir, "1", "pkg-1.0.0"), old, old); err != nil {
+		t.Fatal(err)
+	}
+
+	resp = do("POST", "/api/admin/gc", "admin")
+	report := gcReport{}
+	err = json.NewDecoder(resp.Body).Decode(&report)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(report.Removed, []string{"1/pkg-1.0.0"}) ||
+		!reflect.DeepEqual(report.Unreferenced, []string{"stray-object"}) {
+		t.Fatalf("Unexpected GC report: %#v", report)
+	}
+	if exists, _ := packageBucket.Exists(ctx, "1/pkg-1.0.0"); exists {
+		t.Error("Expected deleted object to be removed from the bucket")
+	}
+	if exists, _ := packageBucket.Exists(ctx, "stray-object"); !exists {
+		t.Error("Expected unreferenced object to be kept")
+	}
+}
@@ -9,6 +9,9 @@ import (
 	"os"
 	"strings"
 	"testing"
+
+	"github.com/PaulOh5/pkg-server-2/apitoken"
+	"github.com/PaulOh5/pkg-server-2/store"
 )
 
 func TestPackageGetHandler(t *testing.T) {
@@ -18,7 +21,7 @@ func TestPackageGetHandler(t *testing.T) {
 	}
 	defer packageBucket.Close()
 
-	testObjectId := "pkg-0.1-pkg-0.1.tar.gz"
+	testObjectId := "pkg-0.1.0-pkg-0.1.0.tar.gz"
 	err = packageBucket.WriteAll(
 		context.Background(),
 		testObjectId, []byte("test-data"),
@@ -28,27 +31,21 @@ func TestPackageGetHandler(t *testing.T) {
 		log.Fatal(err)
 	}
 
-	testC, testDb, err := getTestDb()
-	if err != nil {
-		t.Fatal(err)
-	}
-	defer testC.Terminate(context.Background())
-
 	config := appConfig{
 		logger: log.New(
 			os.Stdout, "",
 			log.Ldate|log.Ltime|log.Lshortfile,
 		),
 		packageBucket: packageBucket,
-		db:            testDb,
+		packageStore:  store.NewMemoryStore(),
 	}
 
-	err = updateDb(
-		config,
-		pkgRow{
+	err = config.packageStore.AddPackage(
+		context.Background(),
+		store.Package{
 			OwnerId:       1,
 			Name:          "pkg",
-			Version:       "0.1",
+			Version:       "0.1.0",
 			ObjectStoreId: testObjectId,
 		},
 	)
@@ -56,6 +53,16 @@ func TestPackageGetHandler(t *testing.T) {
 		t.Fatal(err)
 	}
 
+	token := "test-token"
+	_, err = config.packageStore.AddToken(
+		context.Background(),
+		store.Token{UserId: 1, Name: "test", Scopes: []string{scopeRead}},
+		apitoken.Hash(token),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
 	mux := http.NewServeMux()
 	setupHandlers(mux, config)
 	ts := httptest.NewServer(mux)
@@ -69,9 +76,16 @@ func TestPackageGetHandler(t *testing.T) {
 		},
 	}
 
-	_, err = client.Get(
-		"http://localhost:8080/api/packages/download?owner_id=1&name=pkg&version=0.1",
+	req, err := http.NewRequest(
+		"GET",
+		ts.URL+"/api/packages/download?owner_id=1&name=pkg&version=0.1.0",
+		nil,
 	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	_, err = client.Do(req)
 	if err == nil {
 		t.Fatal("Expected error: no redirect, but Got: nil")
 	}
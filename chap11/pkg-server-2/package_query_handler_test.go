@@ -0,0 +1,265 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"testing"
+
+	"github.com/PaulOh5/pkg-server-2/apitoken"
+	"github.com/PaulOh5/pkg-server-2/store"
+)
+
+func TestPackageQueryVersions(t *testing.T) {
+	packageBucket, err := getTestBucket(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer packageBucket.Close()
+
+	config := appConfig{
+		logger:        log.New(io.Discard, "", 0),
+		packageBucket: packageBucket,
+		packageStore:  store.NewMemoryStore(),
+	}
+	ctx := context.Background()
+	for _, version := range []string{
+		"1.10.0", "1.2.0", "2.0.0-rc.1", "1.4.1", "1.4.0", "0.9.0", "1.2.0-beta",
+	} {
+		err := config.packageStore.AddPackage(ctx, store.Package{
+			OwnerId: 1, Name: "pkg", Version: version,
+			ObjectStoreId: "1/pkg-" + version,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = packageBucket.WriteAll(ctx, "1/pkg-"+version, []byte(version), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	token := "test-token"
+	_, err = config.packageStore.AddToken(
+		ctx,
+		store.Token{UserId: 1, Name: "test", Scopes: []string{scopeRead}},
+		apitoken.Hash(token),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mux := http.NewServeMux()
+	setupHandlers(mux, config)
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	get := func(path string) *http.Response {
+		req, err := http.NewRequest("GET", ts.URL+path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+
+	// 목록은 문자열 순서가 아니라 버전 우선순위 순서여야 한다
+	testConfigs := []struct {
+		version  string
+		status   int
+		expected []string
+	}{
+		{
+			version:  "",
+			status:   http.StatusOK,
+			expected: []string{"0.9.0", "1.2.0-beta", "1.2.0", "1.4.0", "1.4.1", "1.10.0", "2.0.0-rc.1"},
+		},
+		{version: "latest", status: http.StatusOK, expected: []string{"1.10.0"}},
+		{version: "^1.2", status: http.StatusOK, expected: []string{"1.2.0", "1.4.0", "1.4.1", "1.10.0"}},
+		{version: "~1.4.0", status: http.StatusOK, expected: []string{"1.4.0", "1.4.1"}},
+		{version: ">=1.0 <1.4", status: http.StatusOK, expected: []string{"1.2.0"}},
+		{version: "1.4.1", status: http.StatusOK, expected: []string{"1.4.1"}},
+		{version: "not-a-version", status: http.StatusBadRequest},
+	}
+	for _, tc := range testConfigs {
+		resp := get("/api/packages?owner_id=1&name=pkg&version=" + url.QueryEscape(tc.version))
+		if resp.StatusCode != tc.status {
+			t.Fatalf("%q: Expected status %d, Got: %d", tc.version, tc.status, resp.StatusCode)
+		}
+		if tc.status != http.StatusOK {
+			resp.Body.Close()
+			continue
+		}
+		page := pkgQueryResponse{}
+		if err := json.NewDecoder(resp.Body).Decode(&page); err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		got := []string{}
+		for _, p := range page.Packages {
+			got = append(got, p.Version)
+		}
+		if !reflect.DeepEqual(got, tc.expected) {
+			t.Errorf("%q: Expected %v, Got: %v", tc.version, tc.expected, got)
+		}
+	}
+
+	// 다운로드는 일치하는 버전 중 가장 높은 버전을 내려준다
+	downloads := []struct {
+		version  string
+		expected string
+	}{
+		{version: "latest", expected: "1.10.0"},
+		{version: "~1.4.0", expected: "1.4.1"},
+		{version: "^1.2", expected: "1.10.0"},
+		{version: "1.2.0-beta", expected: "1.2.0-beta"},
+	}
+	for _, tc := range downloads {
+		resp := get("/api/packages/download?owner_id=1&name=pkg&download=true&version=" + url.QueryEscape(tc.version))
+		data, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != http.StatusOK || string(data) != tc.expected {
+			t.Errorf("%q: Expected %s, Got: %d %s", tc.version, tc.expected, resp.StatusCode, data)
+		}
+	}
+	resp := get("/api/packages/download?owner_id=1&name=pkg&version=^3.0")
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected status 404, Got: %d", resp.StatusCode)
+	}
+}
+
+func TestPackageQueryPagination(t *testing.T) {
+	config := appConfig{
+		logger:       log.New(io.Discard, "", 0),
+		packageStore: store.NewMemoryStore(),
+	}
+	ctx := context.Background()
+	// pkg-00 ~ pkg-24 각각 1.0.0과 2.0.0, 2.0.0은 짝수 번째만 회수
+	for i := 0; i < 25; i++ {
+		name := fmt.Sprintf("pkg-%02d", i)
+		for _, version := range []string{"1.0.0", "2.0.0"} {
+			err := config.packageStore.AddPackage(ctx, store.Package{
+				OwnerId: 1, Name: name, Version: version, ObjectStoreId: name + version,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		if i%2 == 0 {
+			if err := config.packageStore.YankPackage(ctx, 1, name, "2.0.0"); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	token := "test-token"
+	_, err := config.packageStore.AddToken(
+		ctx,
+		store.Token{UserId: 1, Name: "test", Scopes: []string{scopeRead}},
+		apitoken.Hash(token),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mux := http.NewServeMux()
+	setupHandlers(mux, config)
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	get := func(query string) (int, pkgQueryResponse) {
+		req, err := http.NewRequest("GET", ts.URL+"/api/packages?"+query, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		page := pkgQueryResponse{}
+		if resp.StatusCode == http.StatusOK {
+			if err := json.NewDecoder(resp.Body).Decode(&page); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return resp.StatusCode, page
+	}
+	// collect는 next_page_token을 따라가며 모든 페이지를 모은다
+	collect := func(query string) ([]string, int) {
+		got := []string{}
+		pages := 0
+		token := ""
+		for {
+			status, page := get(query + "&page_token=" + token)
+			if status != http.StatusOK {
+				t.Fatalf("%s: Expected status 200, Got: %d", query, status)
+			}
+			pages++
+			for _, p := range page.Packages {
+				got = append(got, p.Name+"@"+p.Version)
+			}
+			if len(page.NextPageToken) == 0 {
+				return got, pages
+			}
+			token = page.NextPageToken
+		}
+	}
+
+	got, pages := collect("limit=7")
+	if len(got) != 50 || pages != 8 || got[0] != "pkg-00@1.0.0" || got[49] != "pkg-24@2.0.0" {
+		t.Errorf("Expected 50 packages in 8 pages, Got: %d in %d pages: %v", len(got), pages, got)
+	}
+
+	// latest는 회수된 버전을 건너뛰므로 짝수 번째는 1.0.0, 홀수 번째는 2.0.0이다
+	got, _ = collect("version=latest&limit=4")
+	if len(got) != 25 || got[0] != "pkg-00@1.0.0" || got[1] != "pkg-01@2.0.0" {
+		t.Errorf("Expected latest version of 25 packages, Got: %v", got)
+	}
+
+	got, _ = collect("name_prefix=pkg-1&sort=version&limit=3")
+	if len(got) != 20 || got[0] != "pkg-10@1.0.0" || got[10] != "pkg-10@2.0.0" {
+		t.Errorf("Expected pkg-1x sorted by version, Got: %v", got)
+	}
+
+	// 서버는 최대 페이지 크기를 넘겨 돌려주지 않는다
+	status, page := get("limit=100000")
+	if status != http.StatusOK || len(page.Packages) != 50 {
+		t.Errorf("Expected 50 packages, Got: %d %d", status, len(page.Packages))
+	}
+	status, page = get("limit=1")
+	if status != http.StatusOK || len(page.NextPageToken) == 0 {
+		t.Fatalf("Expected next page token, Got: %d %#v", status, page)
+	}
+
+	badQueries := []string{
+		"limit=0",
+		"limit=abc",
+		"sort=size",
+		"page_token=not-a-token",
+		"sort=version&page_token=" + page.NextPageToken,
+		"created_after=yesterday",
+		"owner_id=abc",
+	}
+	for _, q := range badQueries {
+		if status, _ := get(q); status != http.StatusBadRequest {
+			t.Errorf("%s: Expected status 400, Got: %d", q, status)
+		}
+	}
+	if status, page := get("created_after=2999-01-01"); status != http.StatusOK || len(page.Packages) != 0 {
+		t.Errorf("Expected no packages, Got: %d %v", status, page.Packages)
+	}
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/PaulOh5/pkg-server-2/apitoken"
+	"github.com/PaulOh5/pkg-server-2/digest"
+	"github.com/PaulOh5/pkg-server-2/store"
+)
+
+func TestPackageRegChecksums(t *testing.T) {
+	packageBucket, err := getTestBucket(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer packageBucket.Close()
+
+	config := appConfig{
+		logger:        log.New(io.Discard, "", 0),
+		packageBucket: packageBucket,
+		packageStore:  store.NewMemoryStore(),
+	}
+	ctx := context.Background()
+	token := "test-token"
+	_, err = config.packageStore.AddToken(
+		ctx,
+		store.Token{UserId: 1, Name: "test", Scopes: []string{scopePublish, scopeRead}},
+		apitoken.Hash(token),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mux := http.NewServeMux()
+	setupHandlers(mux, config)
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	data := []byte("package-data")
+	expected, _, err := digest.Compute(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 체크섬이 다르면 거부하고 객체를 남기지 않는다
+	req, err := newUploadRequest(
+		ts.URL+"/api/packages", token,
+		map[string]string{"name": "pkg", "version": "1.0.0", "expected_sha256": expected.Sha512[:64]},
+		"pkg.tar.gz", data,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("Expected status 400, Got: %d", resp.StatusCode)
+	}
+	if exists, _ := packageBucket.Exists(ctx, "1/pkg-1.0.0-pkg.tar.gz"); exists {
+		t.Fatal("Expected rejected upload not to be stored")
+	}
+
+	req, err = newUploadRequest(
+		ts.URL+"/api/packages", token,
+		map[string]string{"name": "pkg", "version": "1.0.0", "expected_sha256": expected.Sha256},
+		"pkg.tar.gz", data,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	regResp := pkgRegisterResponse{}
+	err = json.NewDecoder(resp.Body).Decode(&regResp)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusOK || regResp.Sha256 != expected.Sha256 ||
+		regResp.Sha512 != expected.Sha512 || regResp.Size != int64(len(data)) {
+		t.Fatalf("Unexpected register response: %d %#v", resp.StatusCode, regResp)
+	}
+
+	get := func(path string) *http.Response {
+		req, err := http.NewRequest("GET", ts.URL+path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+
+	resp = get("/api/packages?owner_id=1&name=pkg")
+	page := pkgQueryResponse{}
+	err = json.NewDecoder(resp.Body).Decode(&page)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkgs := page.Packages
+	if len(pkgs) != 1 || pkgs[0].Sha256 != expected.Sha256 || pkgs[0].Sha512 != expected.Sha512 {
+		t.Fatalf("Expected checksums in query response, Got: %#v", pkgs)
+	}
+
+	resp = get("/api/packages/download?owner_id=1&name=pkg&version=1.0.0&download=true")
+	resp.Body.Close()
+	if resp.Header.Get("Repr-Digest") != expected.ReprDigest() || resp.Header.Get("Digest") != expected.Digest() {
+		t.Errorf("Expected digest headers, Got: %v", resp.Header)
+	}
+
+	verify := func() pkgVerifyResponse {
+		resp := get("/api/packages/verify?owner_id=1&name=pkg&version=1.0.0")
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("Expected status 200, Got: %d", resp.StatusCode)
+		}
+		v := pkgVerifyResponse{}
+		if err := json.NewDecoder(resp.Body).Decode(&v); err != nil {
+			t.Fatal(err)
+		}
+		return v
+	}
+	if v := verify(); !v.Verified || v.Actual != expected {
+		t.Errorf("Expected package to verify, Got: %#v", v)
+	}
+
+	// 저장된 객체가 바뀌면 검증에 실패해야 한다
+	err = packageBucket.WriteAll(ctx, regResp.ID, []byte("tampered"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v := verify(); v.Verified || v.Actual == expected {
+		t.Errorf("Expected tampered package to fail verification, Got: %#v", v)
+	}
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/PaulOh5/pkg-server-2/apitoken"
+	"github.com/PaulOh5/pkg-server-2/store"
+)
+
+// fileFirstRequest는 filedata 파트를 name, version보다 먼저 보내는 요청을 만든다.
+func fileFirstRequest(url, token string) (*http.Request, error) {
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	fw, err := mw.CreateFormFile("filedata", "pkg.tar.gz")
+	if err != nil {
+		return nil, err
+	}
+	if _, err := fw.Write([]byte("data")); err != nil {
+		return nil, err
+	}
+	mw.WriteField("name", "pkg")
+	mw.WriteField("version", "1.0.0")
+	if err := mw.Close(); err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest("POST", url, &body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	req.Header.Set("Authorization", "Bearer "+token)
+	return req, nil
+}
+
+func TestPackageRegLimits(t *testing.T) {
+	packageBucket, err := getTestBucket(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer packageBucket.Close()
+
+	config := appConfig{
+		logger:         log.New(io.Discard, "", 0),
+		packageBucket:  packageBucket,
+		packageStore:   store.NewMemoryStore(),
+		maxPackageSize: 16,
+	}
+	ctx := context.Background()
+	token := "test-token"
+	_, err = config.packageStore.AddToken(
+		ctx,
+		store.Token{UserId: 1, Name: "test", Scopes: []string{scopePublish}},
+		apitoken.Hash(token),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mux := http.NewServeMux()
+	setupHandlers(mux, config)
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	testConfigs := []struct {
+		name           string
+		newRequest     func() (*http.Request, error)
+		expectedStatus int
+	}{
+		{
+			name: "missing filedata",
+			newRequest: func() (*http.Request, error) {
+				var body bytes.Buffer
+				mw := multipart.NewWriter(&body)
+				mw.WriteField("name", "pkg")
+				mw.WriteField("version", "1.0.0")
+				mw.Close()
+				req, err := http.NewRequest("POST", ts.URL+"/api/packages", &body)
+				if err != nil {
+					return nil, err
+				}
+				req.Header.Set("Content-Type", mw.FormDataContentType())
+				req.Header.Set("Authorization", "Bearer "+token)
+				return req, nil
+			},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name: "missing name",
+			newRequest: func() (*http.Request, error) {
+				return newUploadRequest(
+					ts.URL+"/api/packages", token,
+					map[string]string{"version": "1.0.0"},
+					"pkg.tar.gz", []byte("data"),
+				)
+			},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name: "filedata before fields",
+			newRequest: func() (*http.Request, error) {
+				return fileFirstRequest(ts.URL+"/api/packages", token)
+			},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name: "not multipart",
+			newRequest: func() (*http.Request, error) {
+				req, err := http.NewRequest("POST", ts.URL+"/api/packages", bytes.NewReader([]byte("data")))
+				if err != nil {
+					return nil, err
+				}
+				req.Header.Set("Authorization", "Bearer "+token)
+				return req, nil
+			},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name: "too large",
+			newRequest: func() (*http.Request, error) {
+				return newUploadRequest(
+					ts.URL+"/api/packages", token,
+					map[string]string{"name": "pkg", "version": "1.0.0"},
+					"pkg.tar.gz", bytes.Repeat([]byte("x"), 17),
+				)
+			},
+			expectedStatus: http.StatusRequestEntityTooLarge,
+		},
+		{
+			name: "fields too large",
+			newRequest: func() (*http.Request, error) {
+				return newUploadRequest(
+					ts.URL+"/api/packages", token,
+					map[string]string{"name": "pkg", "version": "1.0.0", "description": string(bytes.Repeat([]byte("x"), maxFormFieldsSize))},
+					"pkg.tar.gz", []byte("data"),
+				)
+			},
+			expectedStatus: http.StatusRequestEntityTooLarge,
+		},
+		{
+			name: "max size",
+			newRequest: func() (*http.Request, error) {
+				return newUploadRequest(
+					ts.URL+"/api/packages", token,
+					map[string]string{"name": "pkg", "version": "1.0.0"},
+					"pkg.tar.gz", bytes.Repeat([]byte("x"), 16),
+				)
+			},
+			expectedStatus: http.StatusOK,
+		},
+	}
+
+	for _, tc := range testConfigs {
+		t.Run(tc.name, func(t *testing.T) {
+			req, err := tc.newRequest()
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != tc.expectedStatus {
+				t.Fatalf("Expected status %d, Got: %d", tc.expectedStatus, resp.StatusCode)
+			}
+			if tc.expectedStatus == http.StatusOK {
+				return
+			}
+			if exists, _ := packageBucket.Exists(ctx, "1/pkg-1.0.0-pkg.tar.gz"); exists {
+				t.Fatal("Expected rejected upload not to be stored")
+			}
+		})
+	}
+}
+
+func TestUploadDataCancel(t *testing.T) {
+	packageBucket, err := getTestBucket(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer packageBucket.Close()
+	config := appConfig{packageBucket: packageBucket}
+
+	// 클라이언트가 연결을 끊으면 요청 컨텍스트가 취소되고 본문 읽기가 실패한다
+	ctx, cancel := context.WithCancel(context.Background())
+	pr, pw := io.Pipe()
+	go func() {
+		pw.Write([]byte("partial"))
+		cancel()
+		pw.CloseWithError(io.ErrUnexpectedEOF)
+	}()
+	_, err = uploadData(ctx, config, "obj", pr, "", 1024)
+	if err == nil {
+		t.Fatal("Expected error for interrupted upload")
+	}
+	if exists, _ := packageBucket.Exists(context.Background(), "obj"); exists {
+		t.Fatal("Expected interrupted upload not to be stored")
+	}
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/PaulOh5/pkg-server-2/store"
+)
+
+const (
+	defaultPageSize = 50
+	maxPageSize     = 200
+	// latest나 범위 제약처럼 결과를 거르는 질의가 한 요청에서 읽을 수 있는 최대 배치 수.
+	// 다 채우지 못하면 지금까지 읽은 곳부터 이어지는 next_page_token을 돌려준다.
+	maxScanBatches = 10
+)
+
+var errInvalidPageToken = errors.New("invalid page_token")
+
+// pageToken은 정렬 방식과 마지막으로 읽은 행이다. 클라이언트에게는 불투명한 문자열로 보인다.
+type pageToken struct {
+	Sort  string       `json:"s"`
+	After store.Cursor `json:"a"`
+}
+
+func encodePageToken(sort string, p store.Package) string {
+	data, _ := json.Marshal(pageToken{Sort: sort, After: store.CursorOf(p)})
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodePageToken(s, sort string) (*store.Cursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, errInvalidPageToken
+	}
+	t := pageToken{}
+	if err := json.Unmarshal(data, &t); err != nil {
+		return nil, errInvalidPageToken
+	}
+	if t.Sort != sort {
+		return nil, fmt.Errorf("%w: token was issued for sort=%s", errInvalidPageToken, t.Sort)
+	}
+	return &t.After, nil
+}
+
+// parsePageParams는 limit, page_token, sort, name_prefix, created_after를 q에 채우고
+// 서버가 허용하는 범위로 줄인 페이지 크기를 반환한다.
+func parsePageParams(r *http.Request, q *store.QueryParams) (int, error) {
+	params := r.URL.Query()
+
+	limit := 0
+	if v := params.Get("limit"); len(v) != 0 {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			return 0, errors.New("limit must be a positive integer")
+		}
+		limit = n
+	}
+
+	q.NamePrefix = params.Get("name_prefix")
+	if v := params.Get("created_after"); len(v) != 0 {
+		t, err := parseTime(v)
+		if err != nil {
+			return 0, errors.New("created_after must be an RFC 3339 time or a YYYY-MM-DD date")
+		}
+		q.CreatedAfter = t.UTC().Format(store.TimeFormat)
+	}
+	return setPageParams(q, limit, params.Get("sort"), params.Get("page_token"))
+}
+
+// setPageParams는 sort와 page_token을 q에 채우고 페이지 크기를 서버가 허용하는 범위로
+// 줄인다. limit이 0이면 기본 크기를 쓴다.
+func setPageParams(q *store.QueryParams, limit int, sort, pageToken string) (int, error) {
+	switch {
+	case limit < 0:
+		return 0, errors.New("limit must be a positive integer")
+	case limit == 0:
+		limit = defaultPageSize
+	}
+	limit = min(limit, maxPageSize)
+
+	q.Sort = sort
+	if len(q.Sort) == 0 {
+		q.Sort = store.SortName
+	}
+	if q.Sort != store.SortName && q.Sort != store.SortCreated && q.Sort != store.SortVersion {
+		return 0, errors.New("sort must be name, created or version")
+	}
+	if len(pageToken) != 0 {
+		after, err := decodePageToken(pageToken, q.Sort)
+		if err != nil {
+			return 0, err
+		}
+		q.After = after
+	}
+	return limit, nil
+}
+
+func parseTime(s string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.DateOnly, s)
+}
+
+// listPackages는 한 페이지를 채울 때까지 저장소에서 배치를 읽으며 spec으로 거른다.
+// 다음 페이지가 있는지 알기 위해 limit보다 하나 더 읽는다.
+func listPackages(
+	ctx context.Context, config appConfig,
+	q store.QueryParams, spec versionSpec, limit int,
+) (pkgQueryResponse, error) {
+	resp := pkgQueryResponse{Packages: []store.Package{}}
+	latest := map[string]string{}
+	q.Limit = limit + 1
+
+	var last store.Package
+	for batch := 0; batch < maxScanBatches; batch++ {
+		pkgs, err := config.packageStore.QueryPackages(ctx, q)
+		if err != nil {
+			return resp, err
+		}
+		for _, p := range pkgs {
+			last = p
+			ok, err := matchesSpec(ctx, config, spec, p, latest)
+			if err != nil {
+				return resp, err
+			}
+			if !ok {
+				continue
+			}
+			if len(resp.Packages) == limit {
+				resp.NextPageToken = encodePageToken(q.Sort, resp.Packages[limit-1])
+				return resp, nil
+			}
+			resp.Packages = append(resp.Packages, p)
+		}
+		if len(pkgs) < q.Limit {
+			return resp, nil
+		}
+		after := store.CursorOf(last)
+		q.After = &after
+	}
+	// 읽을 수 있는 배치를 다 썼으면 마지막으로 읽은 행부터 이어 가게 한다
+	resp.NextPageToken = encodePageToken(q.Sort, last)
+	return resp, nil
+}
+
+// matchesSpec은 목록의 패키지가 version 파라미터와 일치하는지 확인한다. latest는 패키지마다
+// 가장 높은 버전을 알아야 하므로 소유자와 이름별로 한 번씩 조회해 cache에 담는다.
+func matchesSpec(
+	ctx context.Context, config appConfig,
+	spec versionSpec, p store.Package, cache map[string]string,
+) (bool, error) {
+	switch {
+	case spec.constraint != nil:
+		return spec.matches(p), nil
+	case !spec.latest:
+		return true, nil
+	}
+	key := fmt.Sprintf("%d/%s", p.OwnerId, p.Name)
+	version, ok := cache[key]
+	if !ok {
+		pkgs, err := config.packages.versions(ctx, config.packageStore, p.OwnerId, p.Name)
+		if err != nil {
+			return false, err
+		}
+		latest, _ := latestVersion(pkgs)
+		version = latest.Version
+		cache[key] = version
+	}
+	return p.Version == version, nil
+}
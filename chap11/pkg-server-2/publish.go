@@ -0,0 +1,277 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/PaulOh5/pkg-server-2/store"
+	"gocloud.dev/blob"
+	"gocloud.dev/gcerrors"
+)
+
+const (
+	// stagingPrefix 아래에는 게시가 끝나지 않은 업로드가 있다. 패키지 객체는 소유자 ID로
+	// 시작하므로 겹치지 않는다.
+	stagingPrefix = "staging/"
+	// defaultStalePublishAge보다 오래 게시 중인 행과 임시 객체는 서버가 게시 도중 멈춘
+	// 것으로 보고 reconcilePublishes가 정리한다.
+	defaultStalePublishAge = time.Hour
+)
+
+func newStagingKey(owner int) (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s%d-%s", stagingPrefix, owner, hex.EncodeToString(b)), nil
+}
+
+// objectKeyEscaper는 패키지 객체 키의 구성 요소에서 구분자로 쓰는 '-'와 '/', 그리고 '%'를
+// 이스케이프한다. 이름, 버전, 파일 이름에 '-'가 있어도 서로 다른 버전의 키가 같아지지 않는다.
+var objectKeyEscaper = strings.NewReplacer("%", "%25", "-", "%2D", "/", "%2F")
+
+func packageObjectKey(owner int, name, version, filename string) string {
+	return fmt.Sprintf(
+		"%d/%s-%s-%s",
+		owner,
+		objectKeyEscaper.Replace(name),
+		objectKeyEscaper.Replace(version),
+		objectKeyEscaper.Replace(filename),
+	)
+}
+
+// inspectFunc는 임시 키에 올라간 파일을 검사하고 버전과 함께 쓸 메타데이터를 만든다.
+type inspectFunc func(ctx context.Context, stagingKey string) (store.Metadata, error)
+
+// publishPackage는 폼으로 받은 패키지를 게시한다. 아카이브의 매니페스트를 폼 필드와 합쳐
+// 메타데이터로 쓴다. gRPC의 Publish도 받은 필드를 폼으로 옮겨 이 함수로 게시한다.
+func publishPackage(
+	ctx context.Context, config appConfig, owner int,
+	form pkgRegisterForm, filename string, r io.Reader, quota ownerQuota,
+) (pkgRegisterResponse, error) {
+	if err := form.validate(); err != nil {
+		return pkgRegisterResponse{}, err
+	}
+
+	p := store.Package{
+		OwnerId:       owner,
+		Name:          form.name,
+		Version:       form.version,
+		ObjectStoreId: packageObjectKey(owner, form.name, form.version, filename),
+	}
+	inspect := inspectArchive(config, owner, form.name, form.version, form.manifest)
+	return publishObject(ctx, config, p, r, form.expectedSha256, quota, inspect)
+}
+
+// inspectArchive는 아카이브의 매니페스트를 요청으로 받은 manifest와 합쳐 메타데이터로 쓰는
+// inspectFunc를 반환한다. 의존성을 풀 수 없거나 사이클이 생기면 게시하지 않는다.
+func inspectArchive(config appConfig, owner int, name, version string, manifest packageManifest) inspectFunc {
+	return func(ctx context.Context, stagingKey string) (store.Metadata, error) {
+		m, err := readArchiveManifest(ctx, config.packageBucket, stagingKey)
+		if err != nil {
+			return store.Metadata{}, err
+		}
+		m = m.merge(manifest)
+		if err := m.normalize(); err != nil {
+			return store.Metadata{}, err
+		}
+		metadata := m.metadata(owner, name, version)
+		if err := checkDependencies(ctx, config, metadata); err != nil {
+			return store.Metadata{}, err
+		}
+		return metadata, nil
+	}
+}
+
+// publishObject는 클라이언트가 보기에 게시가 한 번에 일어나도록 한다.
+//  1. 게시 중인 행을 넣어 버전을 예약한다. 같은 버전의 게시는 여기서 실패한다.
+//  2. 파일을 임시 키에 올리고 저장 한도를 확인한 뒤 inspect로 검사한다.
+//  3. 객체를 패키지 키로 복사한 뒤 트랜잭션으로 행을 게시하고 메타데이터를 쓴다.
+//
+// 어느 단계든 실패하면 예약과 올린 객체를 지운다. 정리하기 전에 서버가 멈추면
+// reconcilePublishes가 남은 상태를 정리한다.
+func publishObject(
+	ctx context.Context, config appConfig, p store.Package,
+	r io.Reader, expectedSha256 string, quota ownerQuota, inspect inspectFunc,
+) (pkgRegisterResponse, error) {
+	d := pkgRegisterResponse{ID: p.ObjectStoreId}
+	stagingKey, err := newStagingKey(p.OwnerId)
+	if err != nil {
+		return d, err
+	}
+	pending := store.PendingPackage{Package: p, StagingKey: stagingKey}
+	err = config.packageStore.ReservePackage(ctx, pending)
+	if errors.Is(err, store.ErrExists) {
+		return d, errPackageExists
+	}
+	if err != nil {
+		return d, err
+	}
+	published := false
+	defer func() {
+		if !published {
+			abortPublish(config, pending)
+		}
+	}()
+
+	result, err := uploadData(ctx, config, stagingKey, r, expectedSha256, quota.MaxPackageSize)
+	if err != nil {
+		return d, err
+	}
+	if err := checkStorageQuota(ctx, config, p.OwnerId, quota, result.size); err != nil {
+		return d, err
+	}
+	m, err := inspect(ctx, stagingKey)
+	if err != nil {
+		return d, err
+	}
+	d, err = finishPublish(ctx, config, pending, result, m)
+	if err != nil {
+		return d, err
+	}
+	published = true
+	return d, nil
+}
+
+// finishPublish는 검사를 마친 임시 객체를 패키지 키로 복사하고 예약한 행을 게시한다.
+// 오류를 반환하면 행은 게시되지 않은 것이다.
+func finishPublish(
+	ctx context.Context, config appConfig, pending store.PendingPackage,
+	result uploadResult, m store.Metadata,
+) (pkgRegisterResponse, error) {
+	d := pkgRegisterResponse{
+		ID:     pending.ObjectStoreId,
+		Size:   result.size,
+		Sha256: result.digests.Sha256,
+		Sha512: result.digests.Sha512,
+	}
+	if err := config.packageBucket.Copy(ctx, d.ID, pending.StagingKey, nil); err != nil {
+		return d, err
+	}
+	p := pending.Package
+	p.Size = d.Size
+	p.Sha256 = d.Sha256
+	p.Sha512 = d.Sha512
+	if err := config.packageStore.PublishPackage(ctx, p, m); err != nil {
+		// 복사한 객체는 이 게시가 쓴 것이므로 지운다. 같은 업로드를 동시에 완료해 다른 요청이 먼저
+		// 게시했으면 그 객체이므로 남긴다. 지우지 못하면 GC가 참조되지 않는 객체로 보고한다
+		cleanupCtx := context.WithoutCancel(ctx)
+		q := store.QueryParams{OwnerId: p.OwnerId, Name: p.Name, Version: p.Version}
+		if pkgs, qerr := config.packageStore.QueryPackages(cleanupCtx, q); qerr != nil || len(pkgs) != 0 {
+			return d, err
+		}
+		if err := config.packageBucket.Delete(cleanupCtx, d.ID); err != nil {
+			config.logger.Printf("Failed to remove unpublished object %s: %v\n", d.ID, err)
+		}
+		return d, err
+	}
+	config.packages.invalidate(p.OwnerId, p.Name)
+	notifyWebhooks(context.WithoutCancel(ctx), config, store.EventPublished, p)
+
+	// 지우지 못한 임시 객체는 reconcilePublishes가 지운다
+	if err := config.packageBucket.Delete(ctx, pending.StagingKey); err != nil {
+		config.logger.Printf("Failed to remove staged upload %s: %v\n", pending.StagingKey, err)
+	}
+	config.logger.Printf(
+		"Package uploaded: %s. Bytes written: %d. SHA-256: %s\n",
+		d.ID,
+		d.Size,
+		d.Sha256,
+	)
+	return d, nil
+}
+
+// abortPublish는 게시에 실패한 버전의 임시 객체와 예약을 지운다. 패키지 키로 복사한 객체는
+// finishPublish가 지운다. 클라이언트가 연결을 끊었어도 정리해야 하므로 요청 컨텍스트를 쓰지 않는다.
+func abortPublish(config appConfig, p store.PendingPackage) {
+	ctx := context.Background()
+	if err := removePendingObjects(ctx, config, p, false); err != nil {
+		config.logger.Printf("Failed to clean up aborted publish %s: %v\n", p.ObjectStoreId, err)
+		return
+	}
+	err := config.packageStore.AbortPackage(ctx, p.OwnerId, p.Name, p.Version)
+	if err != nil && !errors.Is(err, store.ErrNotFound) {
+		config.logger.Printf("Failed to abort publish %s: %v\n", p.ObjectStoreId, err)
+	}
+}
+
+// removePendingObjects는 게시 중인 버전의 임시 객체를 지우고, packageObject가 true면 패키지
+// 객체도 지운다. 패키지 키는 packageObjectKey로 만들어 버전마다 다르고 예약한 행이 버전을 막고
+// 있으므로, 게시 도중 멈춘 버전의 패키지 키에는 그 게시가 복사한 객체만 있다.
+func removePendingObjects(ctx context.Context, config appConfig, p store.PendingPackage, packageObject bool) error {
+	keys := []string{p.StagingKey}
+	if packageObject {
+		keys = append(keys, p.ObjectStoreId)
+	}
+	for _, key := range keys {
+		err := config.packageBucket.Delete(ctx, key)
+		if err != nil && gcerrors.Code(err) != gcerrors.NotFound {
+			return err
+		}
+	}
+	return nil
+}
+
+// reconcilePublishes는 게시 도중 서버가 멈춰 남은 상태와 기한이 지난 업로드를 정리한다.
+// olderThan보다 오래 게시 중인 행은 객체와 함께 지우고, 어떤 행도 참조하지 않는 오래된
+// 임시 객체도 지운다. 게시가 끝나지 않은 요청은 클라이언트가 성공 응답을 받지 못했으므로
+// 되돌려도 된다. 기한이 남은 업로드의 예약은 오래되었어도 남긴다.
+func reconcilePublishes(ctx context.Context, config appConfig, olderThan time.Duration) ([]string, error) {
+	cutoff := time.Now().Add(-olderThan)
+	active := map[string]bool{}
+	removed, err := reconcileUploads(ctx, config, active)
+	if err != nil {
+		return removed, err
+	}
+
+	pending, err := config.packageStore.PendingPackages(ctx)
+	if err != nil {
+		return removed, err
+	}
+	for _, p := range pending {
+		created, err := time.Parse(store.TimeFormat, p.Created)
+		if err != nil {
+			return removed, err
+		}
+		if active[p.StagingKey] || created.After(cutoff) {
+			active[p.StagingKey] = true
+			continue
+		}
+		// 복사한 뒤 멈췄을 수 있다
+		if err := removePendingObjects(ctx, config, p, true); err != nil {
+			return removed, err
+		}
+		err = config.packageStore.AbortPackage(ctx, p.OwnerId, p.Name, p.Version)
+		if err != nil && !errors.Is(err, store.ErrNotFound) {
+			return removed, err
+		}
+		removed = append(removed, p.StagingKey)
+		config.logger.Printf("Aborted stale publish of %s\n", p.ObjectStoreId)
+	}
+
+	iter := config.packageBucket.List(&blob.ListOptions{Prefix: stagingPrefix})
+	for {
+		obj, err := iter.Next(ctx)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return removed, err
+		}
+		if obj.IsDir || active[obj.Key] || obj.ModTime.After(cutoff) {
+			continue
+		}
+		err = config.packageBucket.Delete(ctx, obj.Key)
+		if err != nil && gcerrors.Code(err) != gcerrors.NotFound {
+			return removed, err
+		}
+		removed = append(removed, obj.Key)
+	}
+	return removed, nil
+}
@@ -0,0 +1,305 @@
+package main
+
+import (
+	"context"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/PaulOh5/pkg-server-2/apitoken"
+	"github.com/PaulOh5/pkg-server-2/store"
+	"gocloud.dev/blob"
+	"gocloud.dev/blob/fileblob"
+)
+
+func listKeys(t *testing.T, bucket *blob.Bucket) []string {
+	keys := []string{}
+	iter := bucket.List(nil)
+	for {
+		obj, err := iter.Next(context.Background())
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		keys = append(keys, obj.Key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func TestPublishConsistency(t *testing.T) {
+	packageBucket, err := fileblob.OpenBucket(t.TempDir(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer packageBucket.Close()
+
+	config := appConfig{
+		logger:        log.New(io.Discard, "", 0),
+		packageBucket: packageBucket,
+		packageStore:  store.NewMemoryStore(),
+	}
+	ctx := context.Background()
+	token := "test-token"
+	_, err = config.packageStore.AddToken(
+		ctx,
+		store.Token{UserId: 1, Name: "test", Scopes: []string{scopePublish}},
+		apitoken.Hash(token),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mux := http.NewServeMux()
+	setupHandlers(mux, config)
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	publish := func(fields map[string]string) int {
+		req, err := newUploadRequest(ts.URL+"/api/packages", token, fields, "pkg.tar.gz", []byte("data"))
+		if err != nil {
+			t.Error(err)
+			return 0
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Error(err)
+			return 0
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	// 실패한 게시는 예약과 객체를 남기지 않으므로 같은 버전을 다시 게시할 수 있다
+	status := publish(map[string]string{"name": "pkg", "version": "1.0.0", "expected_sha256": strings.Repeat("0", 64)})
+	if status != http.StatusBadRequest {
+		t.Fatalf("Expected status 400, Got: %d", status)
+	}
+	if keys := listKeys(t, packageBucket); len(keys) != 0 {
+		t.Fatalf("Expected no objects after failed publish, Got: %v", keys)
+	}
+	if pending, _ := config.packageStore.PendingPackages(ctx); len(pending) != 0 {
+		t.Fatalf("Expected no pending packages after failed publish, Got: %#v", pending)
+	}
+
+	// 같은 버전을 동시에 게시하면 하나만 성공하고 나머지는 409를 받는다
+	const n = 8
+	statuses := make([]int, n)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			statuses[i] = publish(map[string]string{"name": "pkg", "version": "1.0.0"})
+		}(i)
+	}
+	wg.Wait()
+	counts := map[int]int{}
+	for _, s := range statuses {
+		counts[s]++
+	}
+	if counts[http.StatusOK] != 1 || counts[http.StatusConflict] != n-1 {
+		t.Fatalf("Expected one 200 and %d 409 responses, Got: %v", n-1, statuses)
+	}
+	if keys := listKeys(t, packageBucket); !reflect.DeepEqual(keys, []string{"1/pkg-1.0.0-pkg.tar.gz"}) {
+		t.Errorf("Expected only the published object, Got: %v", keys)
+	}
+	if status := publish(map[string]string{"name": "pkg", "version": "1.0.0"}); status != http.StatusConflict {
+		t.Errorf("Expected status 409, Got: %d", status)
+	}
+}
+
+func TestReconcilePublishes(t *testing.T) {
+	bucketDir := t.TempDir()
+	packageBucket, err := fileblob.OpenBucket(bucketDir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer packageBucket.Close()
+
+	config := appConfig{
+		logger:          log.New(io.Discard, "", 0),
+		packageBucket:   packageBucket,
+		packageStore:    store.NewMemoryStore(),
+		stalePublishAge: time.Nanosecond,
+	}
+	ctx := context.Background()
+
+	// 복사까지 끝났지만 게시하기 전에 멈춘 상태
+	crashed := store.PendingPackage{
+		Package:    store.Package{OwnerId: 1, Name: "pkg", Version: "1.0.0", ObjectStoreId: "1/pkg-1.0.0"},
+		StagingKey: stagingPrefix + "1-a",
+	}
+	if err := config.packageStore.ReservePackage(ctx, crashed); err != nil {
+		t.Fatal(err)
+	}
+	// 게시한 뒤 임시 객체를 지우기 전에 멈춘 상태
+	published := store.Package{OwnerId: 1, Name: "pkg", Version: "1.1.0", ObjectStoreId: "1/pkg-1.1.0"}
+	if err := config.packageStore.AddPackage(ctx, published); err != nil {
+		t.Fatal(err)
+	}
+	keys := []string{crashed.StagingKey, crashed.ObjectStoreId, published.ObjectStoreId, stagingPrefix + "1-b"}
+	for _, key := range keys {
+		if err := packageBucket.WriteAll(ctx, key, []byte("data"), nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	old := time.Now().Add(-time.Hour)
+	if err := os.Chtimes(filepath.Join(bucketDir, "staging", "1-b"), old, old); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := collectGarbage(ctx, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{stagingPrefix + "1-a", stagingPrefix + "1-b"}
+	if !reflect.DeepEqual(report.AbortedPublishes, expected) {
+		t.Errorf("Expected aborted publishes %v, Got: %v", expected, report.AbortedPublishes)
+	}
+	if keys := listKeys(t, packageBucket); !reflect.DeepEqual(keys, []string{published.ObjectStoreId}) {
+		t.Errorf("Expected only the published object, Got: %v", keys)
+	}
+	if pending, _ := config.packageStore.PendingPackages(ctx); len(pending) != 0 {
+		t.Errorf("Expected no pending packages, Got: %#v", pending)
+	}
+	// 정리한 버전은 다시 게시할 수 있다
+	if err := config.packageStore.ReservePackage(ctx, crashed); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRemoveDeletedObject(t *testing.T) {
+	bucketDir := t.TempDir()
+	packageBucket, err := fileblob.OpenBucket(bucketDir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer packageBucket.Close()
+
+	config := appConfig{
+		logger:        log.New(io.Discard, "", 0),
+		packageBucket: packageBucket,
+		packageStore:  store.NewMemoryStore(),
+	}
+	ctx := context.Background()
+	deleted := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	testConfigs := []struct {
+		key      string
+		modTime  time.Time
+		expected bool
+	}{
+		// 삭제 시각은 초 단위라 같은 초의 앞부분에 쓰인 객체도 수정 시각이 더 늦다
+		{key: "same-second", modTime: deleted.Add(500 * time.Millisecond), expected: true},
+		{key: "before", modTime: deleted.Add(-time.Minute), expected: true},
+		{key: "rewritten", modTime: deleted.Add(2 * time.Second), expected: false},
+	}
+	for _, tc := range testConfigs {
+		if err := packageBucket.WriteAll(ctx, tc.key, []byte("data"), nil); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(filepath.Join(bucketDir, tc.key), tc.modTime, tc.modTime); err != nil {
+			t.Fatal(err)
+		}
+		o := store.DeletedObject{ObjectStoreId: tc.key, Deleted: deleted.Format(store.TimeFormat)}
+		removed, err := removeDeletedObject(ctx, config, o, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if removed != tc.expected {
+			t.Errorf("%s: Expected removed %v, Got: %v", tc.key, tc.expected, removed)
+		}
+		if exists, _ := packageBucket.Exists(ctx, tc.key); exists == tc.expected {
+			t.Errorf("%s: Expected object to exist %v, Got: %v", tc.key, !tc.expected, exists)
+		}
+	}
+}
+
+func TestPublishObjectKeys(t *testing.T) {
+	packageBucket, err := fileblob.OpenBucket(t.TempDir(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer packageBucket.Close()
+
+	config := appConfig{
+		logger:        log.New(io.Discard, "", 0),
+		packageBucket: packageBucket,
+		packageStore:  store.NewMemoryStore(),
+	}
+	ctx := context.Background()
+	token := "test-token"
+	_, err = config.packageStore.AddToken(
+		ctx,
+		store.Token{UserId: 1, Name: "test", Scopes: []string{scopePublish}},
+		apitoken.Hash(token),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mux := http.NewServeMux()
+	setupHandlers(mux, config)
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	publish := func(fields map[string]string, filename string, data []byte) int {
+		req, err := newUploadRequest(ts.URL+"/api/packages", token, fields, filename, data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	// 이스케이프하지 않으면 두 패키지 모두 1/a-1.0.0-b-1.0.0-c가 된다
+	testConfigs := []struct {
+		name     string
+		filename string
+		data     string
+		key      string
+	}{
+		{name: "a", filename: "b-1.0.0-c", data: "first", key: "1/a-1.0.0-b%2D1.0.0%2Dc"},
+		{name: "a-1.0.0-b", filename: "c", data: "second", key: "1/a%2D1.0.0%2Db-1.0.0-c"},
+	}
+	for _, tc := range testConfigs {
+		if status := publish(map[string]string{"name": tc.name, "version": "1.0.0"}, tc.filename, []byte(tc.data)); status != http.StatusOK {
+			t.Fatalf("%s: Expected status 200, Got: %d", tc.name, status)
+		}
+	}
+
+	// 실패한 게시는 다른 패키지의 객체를 지우지 않는다
+	fields := map[string]string{"name": "a-1.0.0-b", "version": "2.0.0-c", "expected_sha256": strings.Repeat("0", 64)}
+	if status := publish(fields, "x", []byte("third")); status != http.StatusBadRequest {
+		t.Fatalf("Expected status 400, Got: %d", status)
+	}
+	for _, tc := range testConfigs {
+		data, err := packageBucket.ReadAll(ctx, tc.key)
+		if err != nil || string(data) != tc.data {
+			t.Errorf("%s: Expected %s to contain %q, Got: %q, %v", tc.name, tc.key, tc.data, data, err)
+		}
+		pkgs, err := config.packageStore.QueryPackages(ctx, store.QueryParams{OwnerId: 1, Name: tc.name})
+		if err != nil || len(pkgs) != 1 || pkgs[0].ObjectStoreId != tc.key {
+			t.Errorf("%s: Expected object %s, Got: %#v, %v", tc.name, tc.key, pkgs, err)
+		}
+	}
+	if keys := listKeys(t, packageBucket); len(keys) != 2 {
+		t.Errorf("Expected two objects, Got: %v", keys)
+	}
+}
@@ -0,0 +1,280 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/PaulOh5/pkg-server-2/store"
+)
+
+const (
+	rateLimitLimitHeader     = "RateLimit-Limit"
+	rateLimitRemainingHeader = "RateLimit-Remaining"
+	rateLimitResetHeader     = "RateLimit-Reset"
+
+	// publishWindow 동안의 게시 수로 게시 속도를 제한한다.
+	publishWindow = time.Hour
+)
+
+var (
+	errStorageQuota     = errors.New("storage quota exceeded")
+	errPublishRateLimit = errors.New("publish rate limit exceeded")
+)
+
+// ownerQuota는 소유자에게 적용하는 한도다. MaxStorage와 PublishesPerHour가 0이면 제한하지
+// 않는다.
+type ownerQuota struct {
+	MaxStorage       int64 `json:"max_storage"`
+	MaxPackageSize   int64 `json:"max_package_size"`
+	PublishesPerHour int   `json:"publishes_per_hour"`
+}
+
+// effectiveQuota는 서버 기본값에 관리자가 소유자에게 따로 정한 한도를 덮어쓴다.
+func effectiveQuota(ctx context.Context, config appConfig, owner int) (ownerQuota, error) {
+	q := ownerQuota{
+		MaxStorage:       config.maxStorage,
+		MaxPackageSize:   config.maxPackageSize,
+		PublishesPerHour: config.publishesPerHour,
+	}
+	if q.MaxPackageSize <= 0 {
+		q.MaxPackageSize = defaultMaxPackageSize
+	}
+	l, err := config.packageStore.OwnerLimits(ctx, owner)
+	if errors.Is(err, store.ErrNotFound) {
+		return q, nil
+	}
+	if err != nil {
+		return q, err
+	}
+	switch {
+	case l.MaxStorage == store.LimitUnlimited:
+		q.MaxStorage = 0
+	case l.MaxStorage > 0:
+		q.MaxStorage = l.MaxStorage
+	}
+	if l.MaxPackageSize > 0 {
+		q.MaxPackageSize = l.MaxPackageSize
+	}
+	switch {
+	case l.PublishesPerHour == store.LimitUnlimited:
+		q.PublishesPerHour = 0
+	case l.PublishesPerHour > 0:
+		q.PublishesPerHour = l.PublishesPerHour
+	}
+	return q, nil
+}
+
+func recentUsage(ctx context.Context, config appConfig, owner int, now time.Time) (store.Usage, error) {
+	since := now.Add(-publishWindow).UTC().Format(store.TimeFormat)
+	return config.packageStore.Usage(ctx, owner, since)
+}
+
+// resetAfter는 가장 이른 게시가 publishWindow를 벗어나 한도가 하나 늘어날 때까지의 시간이다.
+func resetAfter(u store.Usage, now time.Time) time.Duration {
+	first, err := time.Parse(store.TimeFormat, u.FirstPublish)
+	if err != nil {
+		return 0
+	}
+	reset := first.Add(publishWindow).Sub(now)
+	if reset < 0 {
+		return 0
+	}
+	return reset.Round(time.Second)
+}
+
+// publishAllowed는 소유자가 지금 게시를 시작할 수 있는지 확인한다. 게시 속도나 저장 한도를
+// 넘었으면 errPublishRateLimit이나 errStorageQuota를 감싼 오류를 반환한다.
+// 올린 뒤의 크기는 publishObject가 checkStorageQuota로 다시 확인한다.
+func publishAllowed(ctx context.Context, config appConfig, owner int, now time.Time) (ownerQuota, store.Usage, error) {
+	q, err := effectiveQuota(ctx, config, owner)
+	if err != nil {
+		return q, store.Usage{}, err
+	}
+	u, err := recentUsage(ctx, config, owner, now)
+	if err != nil {
+		return q, u, err
+	}
+	if q.PublishesPerHour > 0 && u.Publishes >= q.PublishesPerHour {
+		return q, u, fmt.Errorf("%w: %d publishes per hour", errPublishRateLimit, q.PublishesPerHour)
+	}
+	if q.MaxStorage > 0 && u.StoredBytes >= q.MaxStorage {
+		return q, u, fmt.Errorf("%w: %d of %d bytes used", errStorageQuota, u.StoredBytes, q.MaxStorage)
+	}
+	return q, u, nil
+}
+
+// checkPublishQuota는 publishAllowed로 확인하고 게시 속도 한도가 있으면 RateLimit 헤더를
+// 붙인다. 게시할 수 없으면 응답을 쓰고 false를 반환한다.
+func checkPublishQuota(w http.ResponseWriter, r *http.Request, config appConfig, owner int) (ownerQuota, bool) {
+	now := time.Now()
+	q, u, err := publishAllowed(r.Context(), config, owner, now)
+	if q.PublishesPerHour > 0 && (err == nil || errors.Is(err, errPublishRateLimit) || errors.Is(err, errStorageQuota)) {
+		// 이번 게시도 한도에서 뺀다
+		remaining := max(q.PublishesPerHour-u.Publishes-1, 0)
+		reset := strconv.Itoa(int(resetAfter(u, now).Seconds()))
+		w.Header().Set(rateLimitLimitHeader, strconv.Itoa(q.PublishesPerHour))
+		w.Header().Set(rateLimitRemainingHeader, strconv.Itoa(remaining))
+		w.Header().Set(rateLimitResetHeader, reset)
+		if errors.Is(err, errPublishRateLimit) {
+			w.Header().Set(rateLimitRemainingHeader, "0")
+			w.Header().Set("Retry-After", reset)
+		}
+	}
+	if err != nil {
+		http.Error(w, err.Error(), uploadErrorStatus(err))
+		return q, false
+	}
+	return q, true
+}
+
+// checkStorageQuota는 size 바이트를 더 저장해도 소유자의 저장 한도를 넘지 않는지 확인한다.
+// 동시에 게시하는 버전끼리는 서로의 크기를 보지 못하므로 한도를 조금 넘을 수 있다.
+func checkStorageQuota(ctx context.Context, config appConfig, owner int, q ownerQuota, size int64) error {
+	if q.MaxStorage <= 0 {
+		return nil
+	}
+	u, err := recentUsage(ctx, config, owner, time.Now())
+	if err != nil {
+		return err
+	}
+	if u.StoredBytes+size > q.MaxStorage {
+		return fmt.Errorf(
+			"%w: %d bytes would exceed %d of %d bytes used",
+			errStorageQuota, size, u.StoredBytes, q.MaxStorage,
+		)
+	}
+	return nil
+}
+
+// usageHandler는 소유자의 저장 공간, 최근 게시 수와 적용되는 한도를 보여준다.
+// 다른 소유자의 사용량은 관리자만 볼 수 있다.
+func usageHandler(
+	w http.ResponseWriter,
+	r *http.Request,
+	config appConfig,
+) {
+	if r.Method != "GET" {
+		http.Error(w, "Invalid Method", http.StatusMethodNotAllowed)
+		return
+	}
+	a, ok := requireScope(w, r, scopeRead)
+	if !ok {
+		return
+	}
+	owner := a.userId
+	if v := r.URL.Query().Get("owner_id"); len(v) != 0 {
+		id, err := strconv.Atoi(v)
+		if err != nil {
+			http.Error(w, "Invalid owner_id", http.StatusBadRequest)
+			return
+		}
+		if id != a.userId && !a.hasScope(scopeAdmin) {
+			http.Error(w, "Viewing usage of other owners requires the admin scope", http.StatusForbidden)
+			return
+		}
+		owner = id
+	}
+	q, err := effectiveQuota(r.Context(), config, owner)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	now := time.Now()
+	u, err := recentUsage(r.Context(), config, owner, now)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	resp := usageResponse{
+		OwnerId:           owner,
+		StoredBytes:       u.StoredBytes,
+		Versions:          u.Versions,
+		PublishesLastHour: u.Publishes,
+		Limits:            q,
+	}
+	if q.PublishesPerHour > 0 {
+		resp.PublishesReset = int(resetAfter(u, now).Seconds())
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// limitsHandler는 관리자가 소유자의 한도를 보고(GET) 바꾸고(PUT) 서버 기본값으로
+// 되돌린다(DELETE).
+func limitsHandler(
+	w http.ResponseWriter,
+	r *http.Request,
+	config appConfig,
+) {
+	a, ok := requireScope(w, r, scopeAdmin)
+	if !ok {
+		return
+	}
+	switch r.Method {
+	case "GET":
+		owner, err := strconv.Atoi(r.URL.Query().Get("owner_id"))
+		if err != nil {
+			http.Error(w, "Must specify owner_id", http.StatusBadRequest)
+			return
+		}
+		l, err := config.packageStore.OwnerLimits(r.Context(), owner)
+		if errors.Is(err, store.ErrNotFound) {
+			http.Error(w, "No limits set for the owner", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, http.StatusOK, l)
+	case "PUT":
+		l := store.Limits{}
+		if err := json.NewDecoder(r.Body).Decode(&l); err != nil {
+			http.Error(w, "Invalid JSON body: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		if l.OwnerId <= 0 || l.MaxStorage < store.LimitUnlimited || l.MaxPackageSize < 0 ||
+			l.PublishesPerHour < store.LimitUnlimited {
+			http.Error(w, "owner_id is required and limits must be -1 (unlimited), 0 (default) or positive; max_package_size cannot be unlimited", http.StatusBadRequest)
+			return
+		}
+		exists, err := config.packageStore.UserExists(r.Context(), l.OwnerId)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if !exists {
+			http.Error(w, "No such user", http.StatusNotFound)
+			return
+		}
+		if err := config.packageStore.SetOwnerLimits(r.Context(), l); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		config.logger.Printf("Limits of owner %d set by user %d: %+v\n", l.OwnerId, a.userId, l)
+		w.WriteHeader(http.StatusNoContent)
+	case "DELETE":
+		owner, err := strconv.Atoi(r.URL.Query().Get("owner_id"))
+		if err != nil {
+			http.Error(w, "Must specify owner_id", http.StatusBadRequest)
+			return
+		}
+		err = config.packageStore.DeleteOwnerLimits(r.Context(), owner)
+		if errors.Is(err, store.ErrNotFound) {
+			http.Error(w, "No limits set for the owner", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		config.logger.Printf("Limits of owner %d reset by user %d\n", owner, a.userId)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "Invalid Method", http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/PaulOh5/pkg-server-2/apitoken"
+	"github.com/PaulOh5/pkg-server-2/store"
+)
+
+func TestQuotas(t *testing.T) {
+	packageBucket, err := getTestBucket(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer packageBucket.Close()
+
+	config := appConfig{
+		logger:           log.New(io.Discard, "", 0),
+		packageBucket:    packageBucket,
+		packageStore:     store.NewMemoryStore(),
+		maxPackageSize:   1024,
+		maxStorage:       30,
+		publishesPerHour: 3,
+	}
+	ctx := context.Background()
+	tokens := map[string][]string{
+		"owner": {scopePublish, scopeRead},
+		"other": {scopePublish, scopeRead},
+		"admin": {scopeAdmin},
+	}
+	userIds := map[string]int{}
+	for _, token := range []string{"owner", "other", "admin"} {
+		id, err := config.packageStore.AddUser(ctx, token)
+		if err != nil {
+			t.Fatal(err)
+		}
+		userIds[token] = id
+		_, err = config.packageStore.AddToken(
+			ctx, store.Token{UserId: id, Name: token, Scopes: tokens[token]}, apitoken.Hash(token),
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	mux := http.NewServeMux()
+	setupHandlers(mux, config)
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	publish := func(token, version string, data []byte) *http.Response {
+		fields := map[string]string{"name": "pkg", "version": version}
+		req, err := newUploadRequest(ts.URL+"/api/packages", token, fields, "pkg.tar.gz", data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp
+	}
+	do := func(method, path, token string, body interface{}) *http.Response {
+		var r io.Reader
+		if body != nil {
+			data, err := json.Marshal(body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			r = bytes.NewReader(data)
+		}
+		req, err := http.NewRequest(method, ts.URL+path, r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+	expectStatus := func(name string, resp *http.Response, status int) {
+		t.Helper()
+		resp.Body.Close()
+		if resp.StatusCode != status {
+			t.Errorf("%s: Expected status %d, Got: %d", name, status, resp.StatusCode)
+		}
+	}
+	usage := func(token, query string) usageResponse {
+		t.Helper()
+		resp := do("GET", "/api/usage"+query, token, nil)
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("Expected status 200, Got: %d", resp.StatusCode)
+		}
+		u := usageResponse{}
+		if err := json.NewDecoder(resp.Body).Decode(&u); err != nil {
+			t.Fatal(err)
+		}
+		return u
+	}
+
+	testConfigs := []struct {
+		name      string
+		version   string
+		data      []byte
+		status    int
+		remaining string
+	}{
+		{name: "first", version: "1.0.0", data: make([]byte, 10), status: http.StatusOK, remaining: "2"},
+		{name: "exceeds storage", version: "1.0.1", data: make([]byte, 21), status: http.StatusInsufficientStorage, remaining: "1"},
+		{name: "fits storage", version: "1.0.2", data: make([]byte, 20), status: http.StatusOK, remaining: "1"},
+		{name: "storage full", version: "1.0.3", data: make([]byte, 1), status: http.StatusInsufficientStorage, remaining: "0"},
+	}
+	for _, tc := range testConfigs {
+		resp := publish("owner", tc.version, tc.data)
+		if resp.StatusCode != tc.status {
+			t.Errorf("%s: Expected status %d, Got: %d", tc.name, tc.status, resp.StatusCode)
+		}
+		if got := resp.Header.Get(rateLimitLimitHeader); got != "3" {
+			t.Errorf("%s: Expected %s 3, Got: %q", tc.name, rateLimitLimitHeader, got)
+		}
+		if got := resp.Header.Get(rateLimitRemainingHeader); got != tc.remaining {
+			t.Errorf("%s: Expected %s %s, Got: %q", tc.name, rateLimitRemainingHeader, tc.remaining, got)
+		}
+	}
+
+	u := usage("owner", "")
+	expected := usageResponse{
+		OwnerId:           userIds["owner"],
+		StoredBytes:       30,
+		Versions:          2,
+		PublishesLastHour: 2,
+		Limits:            ownerQuota{MaxStorage: 30, MaxPackageSize: 1024, PublishesPerHour: 3},
+	}
+	if u.PublishesReset <= 0 || u.PublishesReset > 3600 {
+		t.Errorf("Expected reset within an hour, Got: %d", u.PublishesReset)
+	}
+	u.PublishesReset = 0
+	if u != expected {
+		t.Errorf("Expected %#v, Got: %#v", expected, u)
+	}
+	expectStatus("other owner's usage", do("GET", "/api/usage?owner_id="+strconv.Itoa(userIds["owner"]), "other", nil), http.StatusForbidden)
+	if u := usage("admin", "?owner_id="+strconv.Itoa(userIds["owner"])); u.StoredBytes != 30 {
+		t.Errorf("Expected admin to see 30 stored bytes, Got: %d", u.StoredBytes)
+	}
+
+	// 관리자가 저장 한도를 없애도 시간당 게시 수는 기본값을 따른다
+	limits := store.Limits{OwnerId: userIds["owner"], MaxStorage: store.LimitUnlimited, MaxPackageSize: 8}
+	expectStatus("set limits without admin", do("PUT", "/api/admin/limits", "owner", limits), http.StatusForbidden)
+	expectStatus("invalid limits", do("PUT", "/api/admin/limits", "admin", store.Limits{OwnerId: userIds["owner"], MaxPackageSize: -1}), http.StatusBadRequest)
+	expectStatus("unknown user", do("PUT", "/api/admin/limits", "admin", store.Limits{OwnerId: 99}), http.StatusNotFound)
+	expectStatus("set limits", do("PUT", "/api/admin/limits", "admin", limits), http.StatusNoContent)
+	expectStatus("package too large", publish("owner", "1.0.3", make([]byte, 9)), http.StatusRequestEntityTooLarge)
+	expectStatus("unlimited storage", publish("owner", "1.0.3", make([]byte, 8)), http.StatusOK)
+
+	resp := publish("owner", "1.0.4", make([]byte, 1))
+	if resp.StatusCode != http.StatusTooManyRequests {
+		t.Errorf("Expected status 429, Got: %d", resp.StatusCode)
+	}
+	if resp.Header.Get(rateLimitRemainingHeader) != "0" || len(resp.Header.Get("Retry-After")) == 0 {
+		t.Errorf("Unexpected rate limit headers: %v", resp.Header)
+	}
+	// 다른 소유자의 한도에는 영향이 없다
+	expectStatus("other owner", publish("other", "1.0.0", make([]byte, 10)), http.StatusOK)
+
+	limits.PublishesPerHour = store.LimitUnlimited
+	expectStatus("unlimited publishes", do("PUT", "/api/admin/limits", "admin", limits), http.StatusNoContent)
+	resp = publish("owner", "1.0.4", make([]byte, 1))
+	if resp.StatusCode != http.StatusOK || len(resp.Header.Get(rateLimitLimitHeader)) != 0 {
+		t.Errorf("Expected unlimited publish, Got: %d %v", resp.StatusCode, resp.Header)
+	}
+
+	resp = do("GET", "/api/admin/limits?owner_id="+strconv.Itoa(userIds["owner"]), "admin", nil)
+	got := store.Limits{}
+	err = json.NewDecoder(resp.Body).Decode(&got)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.MaxStorage != store.LimitUnlimited || got.MaxPackageSize != 8 || got.PublishesPerHour != store.LimitUnlimited {
+		t.Errorf("Unexpected limits: %#v", got)
+	}
+
+	// 한도를 지우면 서버 기본값으로 돌아간다
+	path := "/api/admin/limits?owner_id=" + strconv.Itoa(userIds["owner"])
+	expectStatus("reset limits", do("DELETE", path, "admin", nil), http.StatusNoContent)
+	expectStatus("reset again", do("DELETE", path, "admin", nil), http.StatusNotFound)
+	expectStatus("default limits", publish("owner", "1.0.5", make([]byte, 1)), http.StatusTooManyRequests)
+	if u := usage("owner", ""); u.Limits.MaxStorage != 30 || u.StoredBytes != 39 {
+		t.Errorf("Expected default limits and 39 stored bytes, Got: %#v", u)
+	}
+}
@@ -0,0 +1,275 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.2.0
+// - protoc             (unknown)
+// source: registry.proto
+
+package registry
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+// PackageRegistryClient is the client API for PackageRegistry service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type PackageRegistryClient interface {
+	Publish(ctx context.Context, opts ...grpc.CallOption) (PackageRegistry_PublishClient, error)
+	Download(ctx context.Context, in *DownloadRequest, opts ...grpc.CallOption) (PackageRegistry_DownloadClient, error)
+	Query(ctx context.Context, in *QueryRequest, opts ...grpc.CallOption) (*QueryReply, error)
+	Get(ctx context.Context, in *GetRequest, opts ...grpc.CallOption) (*GetReply, error)
+}
+
+type packageRegistryClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewPackageRegistryClient(cc grpc.ClientConnInterface) PackageRegistryClient {
+	return &packageRegistryClient{cc}
+}
+
+func (c *packageRegistryClient) Publish(ctx context.Context, opts ...grpc.CallOption) (PackageRegistry_PublishClient, error) {
+	stream, err := c.cc.NewStream(ctx, &PackageRegistry_ServiceDesc.Streams[0], "/registry.PackageRegistry/Publish", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &packageRegistryPublishClient{stream}
+	return x, nil
+}
+
+type PackageRegistry_PublishClient interface {
+	Send(*PublishRequest) error
+	CloseAndRecv() (*PublishReply, error)
+	grpc.ClientStream
+}
+
+type packageRegistryPublishClient struct {
+	grpc.ClientStream
+}
+
+func (x *packageRegistryPublishClient) Send(m *PublishRequest) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *packageRegistryPublishClient) CloseAndRecv() (*PublishReply, error) {
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	m := new(PublishReply)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *packageRegistryClient) Download(ctx context.Context, in *DownloadRequest, opts ...grpc.CallOption) (PackageRegistry_DownloadClient, error) {
+	stream, err := c.cc.NewStream(ctx, &PackageRegistry_ServiceDesc.Streams[1], "/registry.PackageRegistry/Download", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &packageRegistryDownloadClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type PackageRegistry_DownloadClient interface {
+	Recv() (*DownloadReply, error)
+	grpc.ClientStream
+}
+
+type packageRegistryDownloadClient struct {
+	grpc.ClientStream
+}
+
+func (x *packageRegistryDownloadClient) Recv() (*DownloadReply, error) {
+	m := new(DownloadReply)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *packageRegistryClient) Query(ctx context.Context, in *QueryRequest, opts ...grpc.CallOption) (*QueryReply, error) {
+	out := new(QueryReply)
+	err := c.cc.Invoke(ctx, "/registry.PackageRegistry/Query", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *packageRegistryClient) Get(ctx context.Context, in *GetRequest, opts ...grpc.CallOption) (*GetReply, error) {
+	out := new(GetReply)
+	err := c.cc.Invoke(ctx, "/registry.PackageRegistry/Get", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// PackageRegistryServer is the server API for PackageRegistry service.
+// All implementations must embed UnimplementedPackageRegistryServer
+// for forward compatibility
+type PackageRegistryServer interface {
+	Publish(PackageRegistry_PublishServer) error
+	Download(*DownloadRequest, PackageRegistry_DownloadServer) error
+	Query(context.Context, *QueryRequest) (*QueryReply, error)
+	Get(context.Context, *GetRequest) (*GetReply, error)
+	mustEmbedUnimplementedPackageRegistryServer()
+}
+
+// UnimplementedPackageRegistryServer must be embedded to have forward compatible implementations.
+type UnimplementedPackageRegistryServer struct {
+}
+
+func (UnimplementedPackageRegistryServer) Publish(PackageRegistry_PublishServer) error {
+	return status.Errorf(codes.Unimplemented, "method Publish not implemented")
+}
+func (UnimplementedPackageRegistryServer) Download(*DownloadRequest, PackageRegistry_DownloadServer) error {
+	return status.Errorf(codes.Unimplemented, "method Download not implemented")
+}
+func (UnimplementedPackageRegistryServer) Query(context.Context, *QueryRequest) (*QueryReply, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Query not implemented")
+}
+func (UnimplementedPackageRegistryServer) Get(context.Context, *GetRequest) (*GetReply, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Get not implemented")
+}
+func (UnimplementedPackageRegistryServer) mustEmbedUnimplementedPackageRegistryServer() {}
+
+// UnsafePackageRegistryServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to PackageRegistryServer will
+// result in compilation errors.
+type UnsafePackageRegistryServer interface {
+	mustEmbedUnimplementedPackageRegistryServer()
+}
+
+func RegisterPackageRegistryServer(s grpc.ServiceRegistrar, srv PackageRegistryServer) {
+	s.RegisterService(&PackageRegistry_ServiceDesc, srv)
+}
+
+func _PackageRegistry_Publish_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(PackageRegistryServer).Publish(&packageRegistryPublishServer{stream})
+}
+
+type PackageRegistry_PublishServer interface {
+	SendAndClose(*PublishReply) error
+	Recv() (*PublishRequest, error)
+	grpc.ServerStream
+}
+
+type packageRegistryPublishServer struct {
+	grpc.ServerStream
+}
+
+func (x *packageRegistryPublishServer) SendAndClose(m *PublishReply) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *packageRegistryPublishServer) Recv() (*PublishRequest, error) {
+	m := new(PublishRequest)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func _PackageRegistry_Download_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(DownloadRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(PackageRegistryServer).Download(m, &packageRegistryDownloadServer{stream})
+}
+
+type PackageRegistry_DownloadServer interface {
+	Send(*DownloadReply) error
+	grpc.ServerStream
+}
+
+type packageRegistryDownloadServer struct {
+	grpc.ServerStream
+}
+
+func (x *packageRegistryDownloadServer) Send(m *DownloadReply) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _PackageRegistry_Query_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(QueryRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PackageRegistryServer).Query(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/registry.PackageRegistry/Query",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PackageRegistryServer).Query(ctx, req.(*QueryRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _PackageRegistry_Get_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PackageRegistryServer).Get(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/registry.PackageRegistry/Get",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PackageRegistryServer).Get(ctx, req.(*GetRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// PackageRegistry_ServiceDesc is the grpc.ServiceDesc for PackageRegistry service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var PackageRegistry_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "registry.PackageRegistry",
+	HandlerType: (*PackageRegistryServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Query",
+			Handler:    _PackageRegistry_Query_Handler,
+		},
+		{
+			MethodName: "Get",
+			Handler:    _PackageRegistry_Get_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Publish",
+			Handler:       _PackageRegistry_Publish_Handler,
+			ClientStreams: true,
+		},
+		{
+			StreamName:    "Download",
+			Handler:       _PackageRegistry_Download_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "registry.proto",
+}
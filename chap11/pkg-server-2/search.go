@@ -0,0 +1,196 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/PaulOh5/pkg-server-2/store"
+)
+
+const (
+	defaultSearchLimit = 20
+	maxSearchLimit     = 100
+	maxSearchTerms     = 10
+	// exactNameBonus는 검색어가 패키지 이름과 같을 때 더하는 점수다.
+	exactNameBonus = 50
+)
+
+// fieldWeights는 필드마다 토큰 하나가 나올 때의 점수다.
+// 설명에 같은 토큰이 여러 번 나와도 maxTermCount번까지만 센다.
+var fieldWeights = map[string]int{
+	store.FieldName:        10,
+	store.FieldKeyword:     5,
+	store.FieldDescription: 1,
+}
+
+const maxTermCount = 3
+
+type packageRef struct {
+	ownerId int
+	name    string
+}
+
+type searchHit struct {
+	version string
+	terms   map[string]bool
+	score   int
+}
+
+// searchPackages는 검색어의 토큰이 많이 맞는 패키지를 먼저, 같으면 점수가 높은 패키지를
+// 먼저 돌려준다. 패키지마다 latest 버전의 메타데이터만 보므로 회수된 버전이나
+// 예전 버전에만 있는 단어로는 찾지 않는다.
+func searchPackages(
+	ctx context.Context, config appConfig, query string, ownerId int, license string, limit int,
+) ([]searchResult, error) {
+	terms := []string{}
+	seen := map[string]bool{}
+	for _, term := range store.Tokenize(query) {
+		if !seen[term] {
+			seen[term] = true
+			terms = append(terms, term)
+		}
+	}
+	if len(terms) == 0 {
+		return nil, badRequest("q must contain at least one word")
+	}
+	if len(terms) > maxSearchTerms {
+		return nil, badRequest("q must contain at most %d words", maxSearchTerms)
+	}
+
+	postings, err := config.packageStore.SearchPostings(ctx, terms, ownerId)
+	if err != nil {
+		return nil, err
+	}
+	hits := map[packageRef]map[string]*searchHit{}
+	for _, p := range postings {
+		ref := packageRef{p.OwnerId, p.Name}
+		if hits[ref] == nil {
+			hits[ref] = map[string]*searchHit{}
+		}
+		hit := hits[ref][p.Version]
+		if hit == nil {
+			hit = &searchHit{version: p.Version, terms: map[string]bool{}}
+			hits[ref][p.Version] = hit
+		}
+		hit.terms[p.Term] = true
+		count := p.Count
+		if count > maxTermCount {
+			count = maxTermCount
+		}
+		hit.score += fieldWeights[p.Field] * count
+	}
+
+	results := []searchResult{}
+	for ref, versions := range hits {
+		pkgs, err := config.packageStore.QueryPackages(ctx, store.QueryParams{
+			OwnerId: ref.ownerId,
+			Name:    ref.name,
+			Sort:    store.SortVersion,
+		})
+		if err != nil {
+			return nil, err
+		}
+		latest, ok := latestVersion(pkgs)
+		if !ok {
+			continue
+		}
+		hit, ok := versions[latest.Version]
+		if !ok {
+			continue
+		}
+		score := hit.score
+		if strings.EqualFold(strings.TrimSpace(query), ref.name) {
+			score += exactNameBonus
+		}
+		results = append(results, searchResult{
+			Metadata: store.Metadata{OwnerId: ref.ownerId, Name: ref.name, Version: hit.version},
+			Matched:  len(hit.terms),
+			Score:    score,
+		})
+	}
+	sort.Slice(results, func(i, j int) bool {
+		a, b := results[i], results[j]
+		if a.Matched != b.Matched {
+			return a.Matched > b.Matched
+		}
+		if a.Score != b.Score {
+			return a.Score > b.Score
+		}
+		if a.Name != b.Name {
+			return a.Name < b.Name
+		}
+		return a.OwnerId < b.OwnerId
+	})
+
+	// 메타데이터는 순위를 정한 뒤 필요한 만큼만 읽는다
+	page := []searchResult{}
+	for _, result := range results {
+		if len(page) == limit {
+			break
+		}
+		m, err := config.packageStore.Metadata(ctx, result.OwnerId, result.Name, result.Version)
+		if err != nil {
+			return nil, err
+		}
+		if len(license) != 0 && !strings.EqualFold(m.License, license) {
+			continue
+		}
+		m.Readme = ""
+		m.GoMod = ""
+		result.Metadata = m
+		page = append(page, result)
+	}
+	return page, nil
+}
+
+func searchHandler(
+	w http.ResponseWriter,
+	r *http.Request,
+	config appConfig,
+) {
+	if r.Method != "GET" {
+		http.Error(w, "Invalid Method", http.StatusMethodNotAllowed)
+		return
+	}
+	if _, ok := requireScope(w, r, scopeRead); !ok {
+		return
+	}
+	queryParams := r.URL.Query()
+	ownerId := -1
+	if owner := queryParams.Get("owner_id"); len(owner) != 0 {
+		var err error
+		if ownerId, err = strconv.Atoi(owner); err != nil {
+			http.Error(w, "invalid owner_id", http.StatusBadRequest)
+			return
+		}
+	}
+	limit := defaultSearchLimit
+	if l := queryParams.Get("limit"); len(l) != 0 {
+		var err error
+		if limit, err = strconv.Atoi(l); err != nil || limit <= 0 {
+			http.Error(w, "invalid limit", http.StatusBadRequest)
+			return
+		}
+		if limit > maxSearchLimit {
+			limit = maxSearchLimit
+		}
+	}
+
+	results, err := searchPackages(
+		r.Context(), config, queryParams.Get("q"), ownerId, queryParams.Get("license"), limit,
+	)
+	var badReq badRequestError
+	if errors.As(err, &badReq) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, searchResponse{Results: results})
+}
@@ -0,0 +1,238 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/PaulOh5/pkg-server-2/apitoken"
+	"github.com/PaulOh5/pkg-server-2/store"
+)
+
+func tarGz(t *testing.T, files map[string]string) []byte {
+	var buf bytes.Buffer
+	gw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gw)
+	for name, content := range files {
+		err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(content))})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func zipArchive(t *testing.T, files map[string]string) []byte {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, content := range files {
+		fw, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := fw.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestSearch(t *testing.T) {
+	packageBucket, err := getTestBucket(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer packageBucket.Close()
+
+	config := appConfig{
+		logger:        log.New(io.Discard, "", 0),
+		packageBucket: packageBucket,
+		packageStore:  store.NewMemoryStore(),
+	}
+	ctx := context.Background()
+	token := "test-token"
+	_, err = config.packageStore.AddToken(
+		ctx,
+		store.Token{UserId: 1, Name: "test", Scopes: []string{scopePublish, scopeRead}},
+		apitoken.Hash(token),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mux := http.NewServeMux()
+	setupHandlers(mux, config)
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	do := func(req *http.Request, err error) *http.Response {
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+	publish := func(fields map[string]string, filename string, data []byte) int {
+		resp := do(newUploadRequest(ts.URL+"/api/packages", token, fields, filename, data))
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	uploads := []struct {
+		fields   map[string]string
+		filename string
+		data     []byte
+	}{
+		{
+			fields: map[string]string{
+				"name": "http-router", "version": "1.0.0",
+				"description": "Fast HTTP router", "keywords": "http, routing", "license": "MIT",
+			},
+			filename: "http-router.tar.gz",
+			data:     []byte("not an archive"),
+		},
+		{
+			fields:   map[string]string{"name": "json-parser", "version": "2.0.0"},
+			filename: "json-parser.tgz",
+			data: tarGz(t, map[string]string{
+				"package/package.json": `{"description": "Parse JSON from HTTP responses", "license": "Apache-2.0", "keywords": ["json"]}`,
+				"package/README.md":    "# json-parser",
+				"package/src/README":   "nested readme",
+			}),
+		},
+		{
+			// 폼 필드가 아카이브의 매니페스트보다 우선한다
+			fields:   map[string]string{"name": "router-utils", "version": "0.1.0", "license": "MIT"},
+			filename: "router-utils.zip",
+			data: zipArchive(t, map[string]string{
+				"package.json": `{"description": "Helpers for an HTTP router", "license": "BSD-3-Clause"}`,
+			}),
+		},
+		{
+			fields:   map[string]string{"name": "old-router", "version": "1.0.0", "description": "HTTP router"},
+			filename: "old-router.tar.gz",
+			data:     []byte("old"),
+		},
+	}
+	for _, u := range uploads {
+		if status := publish(u.fields, u.filename, u.data); status != http.StatusOK {
+			t.Fatalf("Expected status 200 for %s, Got: %d", u.filename, status)
+		}
+	}
+	// 회수된 패키지는 검색되지 않는다
+	resp := do(http.NewRequest("DELETE", ts.URL+"/api/packages?owner_id=1&name=old-router&version=1.0.0", nil))
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("Expected status 204, Got: %d", resp.StatusCode)
+	}
+
+	// 잘못된 매니페스트는 거부하고 객체를 남기지 않는다
+	status := publish(
+		map[string]string{"name": "broken", "version": "1.0.0"}, "broken.zip",
+		zipArchive(t, map[string]string{"package.json": "{"}),
+	)
+	if status != http.StatusBadRequest {
+		t.Fatalf("Expected status 400 for invalid manifest, Got: %d", status)
+	}
+	if exists, _ := packageBucket.Exists(ctx, "1/broken-1.0.0-broken.zip"); exists {
+		t.Fatal("Expected rejected upload not to be stored")
+	}
+
+	testConfigs := []struct {
+		query          string
+		expected       []string
+		expectedStatus int
+	}{
+		{query: "q=http+router", expected: []string{"http-router", "router-utils", "json-parser"}, expectedStatus: http.StatusOK},
+		{query: "q=http-router", expected: []string{"http-router", "router-utils", "json-parser"}, expectedStatus: http.StatusOK},
+		{query: "q=JSON", expected: []string{"json-parser"}, expectedStatus: http.StatusOK},
+		{query: "q=router&license=mit", expected: []string{"http-router", "router-utils"}, expectedStatus: http.StatusOK},
+		{query: "q=router&limit=1", expected: []string{"http-router"}, expectedStatus: http.StatusOK},
+		{query: "q=router&owner_id=2", expected: []string{}, expectedStatus: http.StatusOK},
+		{query: "q=routing", expected: []string{"http-router"}, expectedStatus: http.StatusOK},
+		{query: "q=+-+", expectedStatus: http.StatusBadRequest},
+		{query: "q=router&owner_id=x", expectedStatus: http.StatusBadRequest},
+	}
+	for _, tc := range testConfigs {
+		resp := do(http.NewRequest("GET", ts.URL+"/api/search?"+tc.query, nil))
+		if resp.StatusCode != tc.expectedStatus {
+			resp.Body.Close()
+			t.Errorf("Expected status %d for %s, Got: %d", tc.expectedStatus, tc.query, resp.StatusCode)
+			continue
+		}
+		if tc.expectedStatus != http.StatusOK {
+			resp.Body.Close()
+			continue
+		}
+		sr := searchResponse{}
+		err := json.NewDecoder(resp.Body).Decode(&sr)
+		resp.Body.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		names := []string{}
+		for _, r := range sr.Results {
+			names = append(names, r.Name)
+			if len(r.Readme) != 0 {
+				t.Errorf("Expected search results without readme, Got: %#v", r)
+			}
+		}
+		if len(names) != len(tc.expected) {
+			t.Errorf("Expected %v for %s, Got: %v", tc.expected, tc.query, names)
+			continue
+		}
+		for i := range names {
+			if names[i] != tc.expected[i] {
+				t.Errorf("Expected %v for %s, Got: %v", tc.expected, tc.query, names)
+				break
+			}
+		}
+	}
+
+	resp = do(http.NewRequest("GET", ts.URL+"/api/packages/metadata?owner_id=1&name=json-parser&version=latest", nil))
+	m := store.Metadata{}
+	err = json.NewDecoder(resp.Body).Decode(&m)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Version != "2.0.0" || m.License != "Apache-2.0" || m.Readme != "# json-parser" ||
+		len(m.Keywords) != 1 || m.Keywords[0] != "json" {
+		t.Errorf("Unexpected metadata from the archive: %#v", m)
+	}
+
+	resp = do(http.NewRequest("GET", ts.URL+"/api/packages/metadata?owner_id=1&name=router-utils&version=0.1.0", nil))
+	m = store.Metadata{}
+	err = json.NewDecoder(resp.Body).Decode(&m)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.License != "MIT" || m.Description != "Helpers for an HTTP router" {
+		t.Errorf("Expected form fields to override the manifest, Got: %#v", m)
+	}
+}
@@ -0,0 +1,226 @@
+package semver
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var ErrInvalidConstraint = errors.New("invalid version constraint")
+
+type operator int
+
+const (
+	opEQ operator = iota
+	opGT
+	opGTE
+	opLT
+	opLTE
+)
+
+type comparator struct {
+	op      operator
+	version Version
+}
+
+func (c comparator) check(v Version) bool {
+	n := v.Compare(c.version)
+	switch c.op {
+	case opGT:
+		return n > 0
+	case opGTE:
+		return n >= 0
+	case opLT:
+		return n < 0
+	case opLTE:
+		return n <= 0
+	}
+	return n == 0
+}
+
+// Constraint는 ||로 나뉜 그룹 중 하나라도 만족하면 참이다.
+// 그룹 안의 비교식은 공백으로 구분하며 모두 만족해야 한다.
+type Constraint struct {
+	groups [][]comparator
+}
+
+// ParseConstraint는 다음 형식을 받는다.
+//
+//	1.2.3, =1.2.3     정확히 일치
+//	1.2, 1.2.x        >=1.2.0 <1.3.0
+//	^1.2.3            >=1.2.3 <2.0.0 (^0.2.3은 <0.3.0, ^0.0.3은 <0.0.4)
+//	~1.4.0, ~1.4      >=1.4.0 <1.5.0
+//	>=1.0 <2.0        비교식의 AND
+//	^1.0 || ^2.0      그룹의 OR
+//	*                 모든 정식 버전
+func ParseConstraint(s string) (Constraint, error) {
+	c := Constraint{}
+	for _, group := range strings.Split(s, "||") {
+		fields := strings.Fields(group)
+		if len(fields) == 0 {
+			return c, fmt.Errorf("%w: %q", ErrInvalidConstraint, s)
+		}
+		comparators := []comparator{}
+		for _, f := range fields {
+			cs, err := parseComparator(f)
+			if err != nil {
+				return c, fmt.Errorf("%w: %q: %v", ErrInvalidConstraint, s, err)
+			}
+			comparators = append(comparators, cs...)
+		}
+		c.groups = append(c.groups, comparators)
+	}
+	return c, nil
+}
+
+// partial은 1, 1.2, 1.2.x처럼 일부만 지정한 버전이다. n은 지정한 숫자의 개수다.
+type partial struct {
+	v Version
+	n int
+}
+
+func parsePartial(s string) (partial, error) {
+	p := partial{}
+	if s == "*" || s == "x" || s == "X" {
+		return p, nil
+	}
+	if v, err := Parse(s); err == nil {
+		return partial{v: v, n: 3}, nil
+	}
+	if strings.ContainsAny(s, "-+") {
+		return p, fmt.Errorf("%q is not a valid version", s)
+	}
+	parts := strings.Split(s, ".")
+	if len(parts) > 3 {
+		return p, fmt.Errorf("%q is not a valid version", s)
+	}
+	nums := []*uint64{&p.v.Major, &p.v.Minor, &p.v.Patch}
+	for i, part := range parts {
+		if part == "*" || part == "x" || part == "X" {
+			// 와일드카드 뒤에는 다른 숫자가 올 수 없다
+			if i != len(parts)-1 {
+				return p, fmt.Errorf("%q is not a valid version", s)
+			}
+			break
+		}
+		n, err := parseNumber(part)
+		if err != nil {
+			return p, err
+		}
+		*nums[i] = n
+		p.n++
+	}
+	return p, nil
+}
+
+// next는 지정한 마지막 숫자를 하나 올린 버전을 반환한다. 1.2는 1.3.0, 1은 2.0.0이 된다.
+func (p partial) next() Version {
+	switch p.n {
+	case 1:
+		return Version{Major: p.v.Major + 1}
+	case 2:
+		return Version{Major: p.v.Major, Minor: p.v.Minor + 1}
+	}
+	return Version{Major: p.v.Major, Minor: p.v.Minor, Patch: p.v.Patch + 1}
+}
+
+func (p partial) lower() Version {
+	return Version{
+		Major: p.v.Major, Minor: p.v.Minor, Patch: p.v.Patch,
+		Prerelease: p.v.Prerelease,
+	}
+}
+
+func parseComparator(s string) ([]comparator, error) {
+	var op string
+	for _, prefix := range []string{">=", "<=", ">", "<", "=", "^", "~"} {
+		if strings.HasPrefix(s, prefix) {
+			op = prefix
+			break
+		}
+	}
+	p, err := parsePartial(s[len(op):])
+	if err != nil {
+		return nil, err
+	}
+	lower := p.lower()
+
+	if p.n == 0 {
+		// *, >=*, ^* 등은 모든 버전과 일치한다
+		if op == "<" || op == ">" {
+			return nil, fmt.Errorf("%q never matches", s)
+		}
+		return []comparator{{op: opGTE, version: Version{}}}, nil
+	}
+
+	switch op {
+	case "", "=":
+		if p.n == 3 {
+			return []comparator{{op: opEQ, version: p.v}}, nil
+		}
+		return []comparator{{op: opGTE, version: lower}, {op: opLT, version: p.next()}}, nil
+	case ">=":
+		return []comparator{{op: opGTE, version: lower}}, nil
+	case ">":
+		if p.n == 3 {
+			return []comparator{{op: opGT, version: p.v}}, nil
+		}
+		return []comparator{{op: opGTE, version: p.next()}}, nil
+	case "<":
+		return []comparator{{op: opLT, version: lower}}, nil
+	case "<=":
+		if p.n == 3 {
+			return []comparator{{op: opLTE, version: p.v}}, nil
+		}
+		return []comparator{{op: opLT, version: p.next()}}, nil
+	case "~":
+		upper := partial{v: p.v, n: 2}.next()
+		if p.n == 1 {
+			upper = p.next()
+		}
+		return []comparator{{op: opGTE, version: lower}, {op: opLT, version: upper}}, nil
+	}
+
+	// ^는 0이 아닌 첫 번째 숫자를 바꾸지 않는 범위다
+	var upper Version
+	switch {
+	case p.v.Major != 0 || p.n == 1:
+		upper = Version{Major: p.v.Major + 1}
+	case p.v.Minor != 0 || p.n == 2:
+		upper = Version{Minor: p.v.Minor + 1}
+	default:
+		upper = Version{Patch: p.v.Patch + 1}
+	}
+	return []comparator{{op: opGTE, version: lower}, {op: opLT, version: upper}}, nil
+}
+
+// Check는 v가 제약을 만족하는지 확인한다.
+// prerelease 버전은 같은 MAJOR.MINOR.PATCH의 prerelease를 명시한 그룹에서만 일치한다.
+// 그래서 ^1.2는 1.3.0-beta와 일치하지 않지만 >=1.3.0-alpha <2.0은 일치한다.
+func (c Constraint) Check(v Version) bool {
+	for _, group := range c.groups {
+		if checkGroup(group, v) {
+			return true
+		}
+	}
+	return false
+}
+
+func checkGroup(group []comparator, v Version) bool {
+	for _, c := range group {
+		if !c.check(v) {
+			return false
+		}
+	}
+	if !v.IsPrerelease() {
+		return true
+	}
+	for _, c := range group {
+		cv := c.version
+		if cv.IsPrerelease() &&
+			cv.Major == v.Major && cv.Minor == v.Minor && cv.Patch == v.Patch {
+			return true
+		}
+	}
+	return false
+}
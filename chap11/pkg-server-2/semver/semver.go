@@ -0,0 +1,183 @@
+// Package semver는 Semantic Versioning 2.0.0 버전과 ^1.2, ~1.4.0, >=1.0 <2.0 같은
+// 범위 제약을 파싱한다.
+package semver
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+var ErrInvalidVersion = errors.New("invalid semantic version")
+
+type Version struct {
+	Major      uint64
+	Minor      uint64
+	Patch      uint64
+	Prerelease []string
+	Build      string
+}
+
+// Parse는 1.2.3-rc.1+build.5 형식의 버전만 받는다. v 접두사나 1.2 같은 축약형은 허용하지 않는다.
+func Parse(s string) (Version, error) {
+	v := Version{}
+	rest := s
+	if i := strings.IndexByte(rest, '+'); i != -1 {
+		v.Build = rest[i+1:]
+		rest = rest[:i]
+		if !validIdentifiers(v.Build, false) {
+			return v, fmt.Errorf("%w: %q: invalid build metadata", ErrInvalidVersion, s)
+		}
+	}
+	if i := strings.IndexByte(rest, '-'); i != -1 {
+		pre := rest[i+1:]
+		rest = rest[:i]
+		if !validIdentifiers(pre, true) {
+			return v, fmt.Errorf("%w: %q: invalid prerelease", ErrInvalidVersion, s)
+		}
+		v.Prerelease = strings.Split(pre, ".")
+	}
+	parts := strings.Split(rest, ".")
+	if len(parts) != 3 {
+		return v, fmt.Errorf("%w: %q: must be MAJOR.MINOR.PATCH", ErrInvalidVersion, s)
+	}
+	nums := []*uint64{&v.Major, &v.Minor, &v.Patch}
+	for i, p := range parts {
+		n, err := parseNumber(p)
+		if err != nil {
+			return v, fmt.Errorf("%w: %q: %v", ErrInvalidVersion, s, err)
+		}
+		*nums[i] = n
+	}
+	return v, nil
+}
+
+func parseNumber(s string) (uint64, error) {
+	if len(s) == 0 || !isNumeric(s) {
+		return 0, fmt.Errorf("%q is not a number", s)
+	}
+	if len(s) > 1 && s[0] == '0' {
+		return 0, fmt.Errorf("%q has a leading zero", s)
+	}
+	return strconv.ParseUint(s, 10, 64)
+}
+
+func isNumeric(s string) bool {
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+func validIdentifiers(s string, prerelease bool) bool {
+	for _, id := range strings.Split(s, ".") {
+		if len(id) == 0 {
+			return false
+		}
+		for _, c := range id {
+			if !(c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c == '-') {
+				return false
+			}
+		}
+		// 숫자로만 된 prerelease 식별자는 0으로 시작할 수 없다
+		if prerelease && isNumeric(id) && len(id) > 1 && id[0] == '0' {
+			return false
+		}
+	}
+	return true
+}
+
+func (v Version) String() string {
+	s := fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Patch)
+	if len(v.Prerelease) != 0 {
+		s += "-" + strings.Join(v.Prerelease, ".")
+	}
+	if len(v.Build) != 0 {
+		s += "+" + v.Build
+	}
+	return s
+}
+
+func (v Version) IsPrerelease() bool {
+	return len(v.Prerelease) != 0
+}
+
+// Compare는 SemVer 우선순위에 따라 -1, 0, 1을 반환한다. 빌드 메타데이터는 무시한다.
+func (v Version) Compare(o Version) int {
+	if c := compareNumber(v.Major, o.Major); c != 0 {
+		return c
+	}
+	if c := compareNumber(v.Minor, o.Minor); c != 0 {
+		return c
+	}
+	if c := compareNumber(v.Patch, o.Patch); c != 0 {
+		return c
+	}
+	// prerelease가 없는 버전이 더 높다
+	switch {
+	case len(v.Prerelease) == 0 && len(o.Prerelease) == 0:
+		return 0
+	case len(v.Prerelease) == 0:
+		return 1
+	case len(o.Prerelease) == 0:
+		return -1
+	}
+	for i := 0; i < len(v.Prerelease) && i < len(o.Prerelease); i++ {
+		if c := compareIdentifier(v.Prerelease[i], o.Prerelease[i]); c != 0 {
+			return c
+		}
+	}
+	return compareNumber(uint64(len(v.Prerelease)), uint64(len(o.Prerelease)))
+}
+
+func compareNumber(a, b uint64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// 숫자 식별자는 숫자로 비교하고 영숫자 식별자보다 항상 낮다.
+func compareIdentifier(a, b string) int {
+	aNum, bNum := isNumeric(a), isNumeric(b)
+	switch {
+	case aNum && bNum:
+		x, _ := strconv.ParseUint(a, 10, 64)
+		y, _ := strconv.ParseUint(b, 10, 64)
+		return compareNumber(x, y)
+	case aNum:
+		return -1
+	case bNum:
+		return 1
+	}
+	return strings.Compare(a, b)
+}
+
+// Key는 바이트 단위로 비교했을 때 Compare와 같은 순서가 되는 문자열을 반환한다.
+// 데이터베이스에서 ORDER BY로 우선순위 정렬을 할 수 있도록 저장한다.
+//
+// 숫자는 20자리로 채우고, 정식 버전은 '~'(0x7E)로, prerelease는 '-'(0x2D) 뒤에
+// 식별자를 붙여 prerelease가 먼저 오게 한다. 식별자 사이는 식별자에 쓸 수 있는
+// 어떤 문자보다 작은 '!'로 구분해 식별자가 적은 쪽이 먼저 오게 한다.
+func (v Version) Key() string {
+	k := fmt.Sprintf("%020d.%020d.%020d", v.Major, v.Minor, v.Patch)
+	if len(v.Prerelease) == 0 {
+		return k + "~"
+	}
+	ids := make([]string, len(v.Prerelease))
+	for i, id := range v.Prerelease {
+		if isNumeric(id) {
+			n, _ := strconv.ParseUint(id, 10, 64)
+			ids[i] = fmt.Sprintf("0%020d", n)
+		} else {
+			ids[i] = "1" + id
+		}
+	}
+	return k + "-" + strings.Join(ids, "!")
+}
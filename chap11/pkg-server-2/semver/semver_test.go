@@ -0,0 +1,212 @@
+package semver
+
+import (
+	"errors"
+	"sort"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	testConfigs := []struct {
+		input string
+		valid bool
+	}{
+		{input: "1.2.3", valid: true},
+		{input: "0.0.0", valid: true},
+		{input: "1.0.0-alpha.1", valid: true},
+		{input: "1.0.0-x-y-z.--", valid: true},
+		{input: "1.0.0+20130313144700", valid: true},
+		{input: "1.0.0-beta+exp.sha.5114f85", valid: true},
+		{input: "1.2", valid: false},
+		{input: "v1.2.3", valid: false},
+		{input: "01.2.3", valid: false},
+		{input: "1.2.3-01", valid: false},
+		{input: "1.2.3-", valid: false},
+		{input: "1.2.3-a..b", valid: false},
+		{input: "1.2.3+", valid: false},
+		{input: "1.2.3.4", valid: false},
+		{input: "1.2.3-beta!", valid: false},
+	}
+	for _, tc := range testConfigs {
+		v, err := Parse(tc.input)
+		if tc.valid && err != nil {
+			t.Errorf("%q: Expected nil error, Got: %v", tc.input, err)
+		}
+		if !tc.valid && !errors.Is(err, ErrInvalidVersion) {
+			t.Errorf("%q: Expected error: %v, Got: %v", tc.input, ErrInvalidVersion, err)
+		}
+		if tc.valid && v.String() != tc.input {
+			t.Errorf("Expected %q, Got: %q", tc.input, v.String())
+		}
+	}
+}
+
+// SemVer 명세 11절의 예시 순서
+var ordered = []string{
+	"0.9.0",
+	"1.0.0-alpha",
+	"1.0.0-alpha.1",
+	"1.0.0-alpha.beta",
+	"1.0.0-beta",
+	"1.0.0-beta.2",
+	"1.0.0-beta.11",
+	"1.0.0-rc.1",
+	"1.0.0",
+	"1.0.1",
+	"1.2.0",
+	"1.10.0",
+	"2.0.0",
+}
+
+func TestPrecedence(t *testing.T) {
+	versions := []Version{}
+	for _, s := range ordered {
+		v, err := Parse(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		versions = append(versions, v)
+	}
+	for i := range versions {
+		for j := range versions {
+			expected := 0
+			if i < j {
+				expected = -1
+			} else if i > j {
+				expected = 1
+			}
+			if got := versions[i].Compare(versions[j]); got != expected {
+				t.Errorf("Compare(%s, %s): Expected %d, Got: %d", versions[i], versions[j], expected, got)
+			}
+			keyOrder := 0
+			if versions[i].Key() < versions[j].Key() {
+				keyOrder = -1
+			} else if versions[i].Key() > versions[j].Key() {
+				keyOrder = 1
+			}
+			if keyOrder != expected {
+				t.Errorf("Key order of %s and %s: Expected %d, Got: %d", versions[i], versions[j], expected, keyOrder)
+			}
+		}
+	}
+
+	// 식별자에 '-'가 들어가도 식별자 수가 적은 쪽이 먼저 와야 한다
+	a, _ := Parse("1.0.0-a")
+	b, _ := Parse("1.0.0-a-")
+	c, _ := Parse("1.0.0-a.b")
+	keys := []string{b.Key(), c.Key(), a.Key()}
+	sort.Strings(keys)
+	if keys[0] != a.Key() || keys[1] != c.Key() || keys[2] != b.Key() {
+		t.Errorf("Expected 1.0.0-a < 1.0.0-a.b < 1.0.0-a-")
+	}
+
+	x, _ := Parse("1.0.0+build.1")
+	y, _ := Parse("1.0.0+build.2")
+	if x.Compare(y) != 0 || x.Key() != y.Key() {
+		t.Error("Expected build metadata to be ignored")
+	}
+}
+
+func TestConstraint(t *testing.T) {
+	testConfigs := []struct {
+		constraint string
+		matches    []string
+		misses     []string
+	}{
+		{
+			constraint: "^1.2",
+			matches:    []string{"1.2.0", "1.9.9"},
+			misses:     []string{"1.1.9", "2.0.0", "1.3.0-beta"},
+		},
+		{
+			constraint: "^1.2.3",
+			matches:    []string{"1.2.3", "1.4.0"},
+			misses:     []string{"1.2.2", "2.0.0"},
+		},
+		{
+			constraint: "^0.2.3",
+			matches:    []string{"0.2.3", "0.2.9"},
+			misses:     []string{"0.3.0"},
+		},
+		{
+			constraint: "^0.0.3",
+			matches:    []string{"0.0.3"},
+			misses:     []string{"0.0.4"},
+		},
+		{
+			constraint: "~1.4.0",
+			matches:    []string{"1.4.0", "1.4.7"},
+			misses:     []string{"1.5.0", "1.3.9"},
+		},
+		{
+			constraint: "~1",
+			matches:    []string{"1.0.0", "1.9.0"},
+			misses:     []string{"2.0.0"},
+		},
+		{
+			constraint: ">=1.0 <2.0",
+			matches:    []string{"1.0.0", "1.99.0"},
+			misses:     []string{"0.9.0", "2.0.0", "2.0.0-rc.1"},
+		},
+		{
+			constraint: ">1.2 <=1.4",
+			matches:    []string{"1.3.0", "1.4.5"},
+			misses:     []string{"1.2.9", "1.5.0"},
+		},
+		{
+			constraint: "1.2",
+			matches:    []string{"1.2.0", "1.2.5"},
+			misses:     []string{"1.3.0"},
+		},
+		{
+			constraint: "=1.2.3",
+			matches:    []string{"1.2.3", "1.2.3+build"},
+			misses:     []string{"1.2.4"},
+		},
+		{
+			constraint: "^1.0 || ^3.0",
+			matches:    []string{"1.1.0", "3.2.0"},
+			misses:     []string{"2.0.0"},
+		},
+		{
+			constraint: ">=1.3.0-alpha <2.0",
+			matches:    []string{"1.3.0-beta", "1.3.0", "1.5.0"},
+			misses:     []string{"1.4.0-beta", "1.2.0"},
+		},
+		{
+			constraint: "*",
+			matches:    []string{"0.0.1", "5.0.0"},
+			misses:     []string{"1.0.0-beta"},
+		},
+	}
+	for _, tc := range testConfigs {
+		c, err := ParseConstraint(tc.constraint)
+		if err != nil {
+			t.Fatalf("%q: %v", tc.constraint, err)
+		}
+		for _, s := range tc.matches {
+			v, err := Parse(s)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !c.Check(v) {
+				t.Errorf("Expected %s to match %q", s, tc.constraint)
+			}
+		}
+		for _, s := range tc.misses {
+			v, err := Parse(s)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if c.Check(v) {
+				t.Errorf("Expected %s not to match %q", s, tc.constraint)
+			}
+		}
+	}
+
+	for _, s := range []string{"", "^", ">=1.0 ||", "1.2.3.4", "~x.1", ">*", "latest"} {
+		if _, err := ParseConstraint(s); !errors.Is(err, ErrInvalidConstraint) {
+			t.Errorf("%q: Expected error: %v, Got: %v", s, ErrInvalidConstraint, err)
+		}
+	}
+}
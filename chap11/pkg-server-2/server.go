@@ -2,21 +2,43 @@ package main
 
 import (
 	"context"
-	"database/sql"
-	"fmt"
+	"errors"
+	"flag"
 	"log"
+	"net"
 	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
-	_ "github.com/go-sql-driver/mysql"
+	"github.com/PaulOh5/pkg-server-2/settings"
+	"github.com/PaulOh5/pkg-server-2/store"
 	"gocloud.dev/blob"
-	_ "gocloud.dev/blob/s3blob"
+	"google.golang.org/grpc"
 )
 
 type appConfig struct {
 	logger        *log.Logger
 	packageBucket *blob.Bucket
-	db            *sql.DB
+	packageStore  store.PackageStore
+	// maxPackageSize가 0이면 defaultMaxPackageSize를 쓴다.
+	maxPackageSize int64
+	// maxStorage와 publishesPerHour는 소유자마다 적용하는 기본 한도다. 0이면 제한하지 않는다.
+	maxStorage       int64
+	publishesPerHour int
+	// stalePublishAge가 0이면 defaultStalePublishAge를 쓴다.
+	stalePublishAge time.Duration
+	// downloads가 nil이면 다운로드 수를 세지 않는다.
+	downloads *downloadCounter
+	// anonymousModuleReads가 true면 토큰 없이 Go 모듈을 받을 수 있다.
+	anonymousModuleReads bool
+	// uploadExpiry가 0이면 defaultUploadExpiry를 쓴다.
+	uploadExpiry time.Duration
+	// packages가 nil이면 버전 목록을 캐시하지 않는다.
+	packages *packageCache
+	// webhooks가 nil이면 전송을 큐에 넣기만 하고 보내지 않는다.
+	webhooks *webhookDispatcher
 }
 
 type app struct {
@@ -31,77 +53,132 @@ func (a app) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 func setupHandlers(mux *http.ServeMux, config appConfig) {
 	mux.Handle(
 		"/api/packages",
-		&app{config: config, handler: packageHandler},
+		authMiddleware(&app{config: config, handler: packageHandler}, config),
+	)
+	mux.Handle(
+		"/api/packages/uploads",
+		authMiddleware(&app{config: config, handler: packageUploadsHandler}, config),
+	)
+	mux.Handle(
+		"/api/packages/uploads/finalize",
+		authMiddleware(&app{config: config, handler: uploadFinalizeHandler}, config),
 	)
 	mux.Handle(
 		"/api/packages/download",
-		&app{config: config, handler: packageGetHandler},
+		authMiddleware(&app{config: config, handler: packageGetHandler}, config),
+	)
+	mux.Handle(
+		"/api/packages/verify",
+		authMiddleware(&app{config: config, handler: packageVerifyHandler}, config),
+	)
+	mux.Handle(
+		"/api/packages/metadata",
+		authMiddleware(&app{config: config, handler: packageMetadataHandler}, config),
+	)
+	mux.Handle(
+		"/api/packages/dependencies",
+		authMiddleware(&app{config: config, handler: packageDependenciesHandler}, config),
+	)
+	mux.Handle(
+		"/api/packages/dependents",
+		authMiddleware(&app{config: config, handler: packageDependentsHandler}, config),
+	)
+	mux.Handle(
+		"/api/search",
+		authMiddleware(&app{config: config, handler: searchHandler}, config),
+	)
+	mux.Handle(
+		"/api/packages/stats",
+		authMiddleware(&app{config: config, handler: packageStatsHandler}, config),
+	)
+	mux.Handle(
+		"/api/admin/stats/top",
+		authMiddleware(&app{config: config, handler: topDownloadsHandler}, config),
+	)
+	mux.Handle(
+		goProxyPrefix,
+		authMiddleware(&app{config: config, handler: goProxyHandler}, config),
+	)
+	mux.Handle(
+		"/api/webhooks",
+		authMiddleware(&app{config: config, handler: webhookHandler}, config),
+	)
+	mux.Handle(
+		"/api/webhooks/deliveries",
+		authMiddleware(&app{config: config, handler: webhookDeliveriesHandler}, config),
+	)
+	mux.Handle(
+		"/api/usage",
+		authMiddleware(&app{config: config, handler: usageHandler}, config),
+	)
+	mux.Handle(
+		"/api/admin/limits",
+		authMiddleware(&app{config: config, handler: limitsHandler}, config),
+	)
+	mux.Handle(
+		"/api/admin/gc",
+		authMiddleware(&app{config: config, handler: gcHandler}, config),
+	)
+	mux.Handle(
+		"/api/tokens",
+		authMiddleware(&app{config: config, handler: tokenHandler}, config),
 	)
 }
 
-func getBucket(bucketName, s3Address, s3Region string) (*blob.Bucket, error) {
-	urlString := fmt.Sprintf("s3://%s?", bucketName)
-	if len(s3Region) != 0 {
-		urlString += fmt.Sprintf("region=%s&", s3Region)
-	}
+// shutdownTimeout은 종료 신호를 받은 뒤 진행 중인 요청을 기다리는 최대 시간이다.
+const shutdownTimeout = 30 * time.Second
 
-	if len(s3Address) != 0 {
-		urlString += fmt.Sprintf("endpoint=%s&"+
-			"disableSSL=true&"+
-			"s3ForcePathStyle=true",
-			s3Address,
-		)
-	}
-	return blob.OpenBucket(context.Background(), urlString)
+// serverDefaults는 서버의 기본값을 설정 기본값에 더한다.
+func serverDefaults() settings.Config {
+	c := settings.Defaults()
+	c.MaxPackageSize = defaultMaxPackageSize
+	c.UploadExpiry = defaultUploadExpiry
+	c.GCInterval = time.Hour
+	c.DownloadFlushInterval = defaultDownloadFlushInterval
+	c.WebhookInterval = defaultWebhookInterval
+	c.PackageCacheSize = defaultPackageCacheSize
+	return c
 }
 
 func main() {
-	bucketName := os.Getenv("BUCKET_NAME")
-	if len(bucketName) == 0 {
-		log.Fatal("Specify BUCKET_NAME")
+	// 운영자용 명령: pkg-server-2 migrate status|up|down
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err := runMigrate(os.Args[2:], os.Stdout); err != nil {
+			log.Fatal(err)
+		}
+		return
 	}
-	s3Address := os.Getenv("S3_ADDR")
-	if len(s3Address) == 0 {
-		log.Fatal("Specify S3_ADDR")
+	migrateOnStart := flag.Bool("migrate", false, "apply pending schema migrations at startup")
+	printConfig := flag.Bool("print-config", false, "print the effective configuration and exit")
+	loader := settings.NewLoader(flag.CommandLine)
+	flag.Parse()
+
+	cfg, err := loader.Load(serverDefaults(), os.Getenv)
+	err = errors.Join(err, cfg.Validate())
+	if *printConfig {
+		cfg.Print(os.Stdout)
+	}
+	if err != nil {
+		// 설정 문제는 한 번에 모두 보여준다
+		log.Fatalf("Invalid configuration:\n%v", err)
 	}
-	s3Region := os.Getenv("S3_REGION")
-	if len(s3Region) == 0 {
-		s3Region = "us-east-1"
+	if *printConfig {
+		return
 	}
 
-	packageBucket, err := getBucket(bucketName, s3Address, s3Region)
+	packageBucket, err := cfg.OpenBucket(context.Background())
 	if err != nil {
 		log.Fatal(err)
 	}
 	defer packageBucket.Close()
 
-	dbAddr := os.Getenv("DB_ADDR")
-	dbName := os.Getenv("DB_NAME")
-	dbUser := os.Getenv("DB_USER")
-	dbPassword := os.Getenv("DB_PASSWORD")
-
-	if len(dbAddr) == 0 || len(dbName) == 0 || len(dbUser) == 0 || len(dbPassword) == 0 {
-		log.Fatal(
-			"Must specfy DB details - DB_ADDR, DB_NAME, DB_USER, DB_PASSWORD",
-		)
-	}
-
-	db, err := getDatabaseConn(
-		dbAddr, dbName,
-		dbUser, dbPassword,
-	)
-
+	packageStore, err := cfg.OpenStore()
 	if err != nil {
 		log.Fatal(err)
 	}
-
-	if err = db.Ping(); err != nil {
-		log.Fatalf("Ping failed: %v", err)
-	}
-
-	listenAddr := os.Getenv("LISTEN_ADDR")
-	if len(listenAddr) == 0 {
-		listenAddr = ":8080"
+	defer packageStore.Close()
+	if err = checkSchema(context.Background(), packageStore, *migrateOnStart, log.Default()); err != nil {
+		log.Fatal(err)
 	}
 
 	config := appConfig{
@@ -109,13 +186,84 @@ func main() {
 			os.Stdout, "",
 			log.Ldate|log.Ltime|log.Lshortfile,
 		),
-		packageBucket: packageBucket,
-		db:            db,
+		packageBucket:        packageBucket,
+		packageStore:         packageStore,
+		maxPackageSize:       cfg.MaxPackageSize,
+		maxStorage:           cfg.MaxStorage,
+		publishesPerHour:     cfg.PublishesPerHour,
+		uploadExpiry:         cfg.UploadExpiry,
+		anonymousModuleReads: cfg.GoProxyAnonymous,
+		downloads:            newDownloadCounter(packageStore),
+		webhooks:             newWebhookDispatcher(cfg.WebhookAllowPrivate),
+	}
+	if cfg.PackageCacheSize > 0 {
+		config.packages = newPackageCache(cfg.PackageCacheSize, defaultPackageCacheAge)
+	}
+	config.logger.Println("Effective configuration:")
+	cfg.Print(config.logger.Writer())
+
+	if len(cfg.BootstrapAdminToken) != 0 {
+		if err = ensureBootstrapToken(config, cfg.BootstrapAdminToken, cfg.BootstrapAdminUser); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// gc_interval이 0이면 주기적인 GC를 끄고 /api/admin/gc로만 실행한다
+	if cfg.GCInterval > 0 {
+		go runGC(ctx, config, cfg.GCInterval)
+	}
+	go runWebhooks(ctx, config, cfg.WebhookInterval)
+	// 다운로드 수는 요청을 모두 처리한 뒤에 마지막으로 기록하므로 별도 컨텍스트를 쓴다
+	flushCtx, stopFlush := context.WithCancel(context.Background())
+	flushed := make(chan struct{})
+	go func() {
+		runDownloadFlush(flushCtx, config, cfg.DownloadFlushInterval)
+		close(flushed)
+	}()
+
+	// gRPC는 같은 프로세스에서 별도 포트로 제공한다
+	var grpcServer *grpc.Server
+	if len(cfg.GRPCListenAddr) != 0 {
+		lis, err := net.Listen("tcp", cfg.GRPCListenAddr)
+		if err != nil {
+			log.Fatal(err)
+		}
+		s := newGRPCServer(config)
+		grpcServer = s
+		go func() {
+			// GracefulStop 뒤에는 nil을 반환한다
+			if err := s.Serve(lis); err != nil {
+				log.Fatal(err)
+			}
+		}()
 	}
 
 	mux := http.NewServeMux()
 	setupHandlers(mux, config)
 
-	log.Fatal(http.ListenAndServe(listenAddr, mux))
-	db.Close()
+	srv := &http.Server{Addr: cfg.ListenAddr, Handler: mux}
+	errc := make(chan error, 1)
+	go func() {
+		errc <- srv.ListenAndServe()
+	}()
+	select {
+	case err := <-errc:
+		log.Fatal(err)
+	case <-ctx.Done():
+	}
+
+	config.logger.Println("Shutting down")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		config.logger.Printf("Failed to shut down HTTP server: %v\n", err)
+	}
+	if grpcServer != nil {
+		grpcServer.GracefulStop()
+	}
+	stopFlush()
+	<-flushed
 }
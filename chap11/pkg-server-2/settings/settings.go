@@ -0,0 +1,452 @@
+// Package settings는 서버와 pkgadmin이 함께 쓰는 설정을 읽고 저장소와 버킷을 연다.
+// 설정은 기본값, 설정 파일, 환경 변수, 플래그 순서로 읽고 뒤의 것이 앞의 것을 덮어쓴다.
+// 두 명령이 같은 설정으로 같은 데이터를 다루도록 한다.
+package settings
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/PaulOh5/pkg-server-2/store"
+	"gocloud.dev/blob"
+	_ "gocloud.dev/blob/fileblob"
+	_ "gocloud.dev/blob/memblob"
+	_ "gocloud.dev/blob/s3blob"
+)
+
+// 설정 값의 출처
+const (
+	sourceDefault = "default"
+	sourceFile    = "file"
+	sourceEnv     = "env"
+	sourceFlag    = "flag"
+)
+
+const masked = "****"
+
+// Config의 시간 값이 0이면 서버가 기본값을 쓰거나 그 작업을 끈다. 어느 쪽인지는 Load에
+// 넘기는 기본값으로 정한다.
+type Config struct {
+	ListenAddr string
+	// GRPCListenAddr가 비어 있으면 gRPC 서버를 띄우지 않는다.
+	GRPCListenAddr string
+
+	// BucketURL은 gocloud 버킷 URL이다. 비어 있으면 BucketName과 S3Addr로 s3:// URL을 만든다.
+	BucketURL  string
+	BucketName string
+	S3Addr     string
+	S3Region   string
+
+	Store store.Config
+
+	MaxPackageSize   int64
+	MaxStorage       int64
+	PublishesPerHour int
+	UploadExpiry     time.Duration
+	GoProxyAnonymous bool
+	// PackageCacheSize는 메모리에 담아 두는 패키지 버전 목록의 수다. 0이면 캐시를 끈다.
+	PackageCacheSize int
+
+	BootstrapAdminToken string
+	BootstrapAdminUser  int
+
+	GCInterval            time.Duration
+	DownloadFlushInterval time.Duration
+	WebhookInterval       time.Duration
+	// WebhookAllowPrivate가 true이면 웹훅을 루프백이나 사설망 주소로도 보낸다.
+	WebhookAllowPrivate bool
+
+	// sources는 설정 키마다 값을 읽은 곳이다.
+	sources map[string]string
+}
+
+// setting은 설정 파일의 키, 환경 변수, 플래그로 정할 수 있는 값 하나다.
+type setting struct {
+	key    string
+	env    string
+	usage  string
+	secret bool
+	get    func() string
+	set    func(v string) error
+}
+
+func (s setting) flagName() string {
+	return strings.ReplaceAll(s.key, "_", "-")
+}
+
+func stringSetting(key, env, usage string, p *string) setting {
+	return setting{
+		key: key, env: env, usage: usage,
+		get: func() string { return *p },
+		set: func(v string) error { *p = v; return nil },
+	}
+}
+
+func secretSetting(key, env, usage string, p *string) setting {
+	s := stringSetting(key, env, usage, p)
+	s.secret = true
+	return s
+}
+
+func intSetting(key, env, usage string, p *int, min int) setting {
+	return setting{
+		key: key, env: env, usage: usage,
+		get: func() string { return strconv.Itoa(*p) },
+		set: func(v string) error {
+			n, err := strconv.Atoi(v)
+			if err != nil {
+				return errors.New("must be an integer")
+			}
+			if n < min {
+				return fmt.Errorf("must be at least %d", min)
+			}
+			*p = n
+			return nil
+		},
+	}
+}
+
+func int64Setting(key, env, usage string, p *int64, min int64) setting {
+	return setting{
+		key: key, env: env, usage: usage,
+		get: func() string { return strconv.FormatInt(*p, 10) },
+		set: func(v string) error {
+			n, err := strconv.ParseInt(v, 10, 64)
+			if err != nil {
+				return errors.New("must be an integer")
+			}
+			if n < min {
+				return fmt.Errorf("must be at least %d", min)
+			}
+			*p = n
+			return nil
+		},
+	}
+}
+
+func durationSetting(key, env, usage string, p *time.Duration, allowZero bool) setting {
+	return setting{
+		key: key, env: env, usage: usage,
+		get: func() string { return p.String() },
+		set: func(v string) error {
+			d, err := time.ParseDuration(v)
+			if err != nil {
+				return errors.New("must be a duration such as 30s or 1h")
+			}
+			if d < 0 || (d == 0 && !allowZero) {
+				return errors.New("must be positive")
+			}
+			*p = d
+			return nil
+		},
+	}
+}
+
+func boolSetting(key, env, usage string, p *bool) setting {
+	return setting{
+		key: key, env: env, usage: usage,
+		get: func() string { return strconv.FormatBool(*p) },
+		set: func(v string) error {
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				return errors.New("must be true or false")
+			}
+			*p = b
+			return nil
+		},
+	}
+}
+
+// settings는 c의 필드에 연결된 설정 목록이다. 이 목록이 설정 파일의 키, 환경 변수와
+// 플래그 이름을 정한다.
+func (c *Config) settings() []setting {
+	return []setting{
+		stringSetting("listen_addr", "LISTEN_ADDR", "address the server listens on", &c.ListenAddr),
+		stringSetting("grpc_listen_addr", "GRPC_LISTEN_ADDR", "address the gRPC server listens on, empty disables it", &c.GRPCListenAddr),
+		stringSetting("bucket_url", "BUCKET_URL", "gocloud bucket URL such as file:///var/packages, mem:// or s3://bucket?region=us-east-1", &c.BucketURL),
+		stringSetting("bucket_name", "BUCKET_NAME", "S3 bucket name, used with s3_addr when bucket_url is not set", &c.BucketName),
+		stringSetting("s3_addr", "S3_ADDR", "address of the S3 compatible storage for bucket_name", &c.S3Addr),
+		stringSetting("s3_region", "S3_REGION", "region of bucket_name", &c.S3Region),
+		stringSetting("store_driver", "STORE_DRIVER", "store driver: mysql, sqlite or memory", &c.Store.Driver),
+		stringSetting("db_addr", "DB_ADDR", "MySQL address", &c.Store.Addr),
+		stringSetting("db_name", "DB_NAME", "MySQL database name", &c.Store.Name),
+		stringSetting("db_user", "DB_USER", "MySQL user", &c.Store.User),
+		secretSetting("db_password", "DB_PASSWORD", "MySQL password", &c.Store.Password),
+		stringSetting("sqlite_path", "SQLITE_PATH", "SQLite database file", &c.Store.Path),
+		int64Setting("max_package_size", "MAX_PACKAGE_SIZE", "largest package in bytes", &c.MaxPackageSize, 1),
+		int64Setting("max_storage_per_owner", "MAX_STORAGE_PER_OWNER", "bytes each owner may store, 0 is unlimited", &c.MaxStorage, 0),
+		intSetting("publishes_per_hour", "PUBLISHES_PER_HOUR", "versions each owner may publish per hour, 0 is unlimited", &c.PublishesPerHour, 0),
+		durationSetting("upload_expiry", "UPLOAD_EXPIRY", "how long a direct upload URL is valid", &c.UploadExpiry, false),
+		boolSetting("goproxy_anonymous", "GOPROXY_ANONYMOUS", "serve Go modules without a token", &c.GoProxyAnonymous),
+		intSetting("package_cache_size", "PACKAGE_CACHE_SIZE", "packages whose versions are cached in memory, 0 disables the cache", &c.PackageCacheSize, 0),
+		secretSetting("bootstrap_admin_token", "BOOTSTRAP_ADMIN_TOKEN", "admin token registered at startup", &c.BootstrapAdminToken),
+		intSetting("bootstrap_admin_user", "BOOTSTRAP_ADMIN_USER", "user who owns bootstrap_admin_token", &c.BootstrapAdminUser, 1),
+		durationSetting("gc_interval", "GC_INTERVAL", "interval of the object GC, 0 disables it", &c.GCInterval, true),
+		durationSetting("download_flush_interval", "DOWNLOAD_FLUSH_INTERVAL", "interval of writing download counts", &c.DownloadFlushInterval, false),
+		durationSetting("webhook_interval", "WEBHOOK_INTERVAL", "interval of sending webhooks", &c.WebhookInterval, false),
+		boolSetting("webhook_allow_private_targets", "WEBHOOK_ALLOW_PRIVATE_TARGETS", "send webhooks to loopback and private addresses", &c.WebhookAllowPrivate),
+	}
+}
+
+// Defaults는 서버가 따로 정하지 않는 설정의 기본값이다.
+func Defaults() Config {
+	return Config{
+		ListenAddr:         ":8080",
+		GRPCListenAddr:     ":50051",
+		S3Region:           "us-east-1",
+		Store:              store.Config{Driver: "mysql", Path: "packages.db"},
+		BootstrapAdminUser: 1,
+	}
+}
+
+// Loader는 FlagSet에 설정 플래그를 등록하고, 파싱한 뒤 설정 파일과 환경 변수를 합친다.
+type Loader struct {
+	configFile string
+	flags      map[string]string
+	// order는 플래그를 준 순서다. 같은 플래그를 여러 번 주면 마지막 값을 쓴다.
+	order []string
+}
+
+// NewLoader는 fs에 -config와 설정마다 하나씩 플래그를 등록한다.
+func NewLoader(fs *flag.FlagSet) *Loader {
+	l := &Loader{flags: map[string]string{}}
+	fs.StringVar(&l.configFile, "config", "", "JSON config file (env CONFIG_FILE)")
+	for _, s := range (&Config{}).settings() {
+		key := s.key
+		fs.Func(s.flagName(), fmt.Sprintf("%s (env %s)", s.usage, s.env), func(v string) error {
+			if _, ok := l.flags[key]; !ok {
+				l.order = append(l.order, key)
+			}
+			l.flags[key] = v
+			return nil
+		})
+	}
+	return l
+}
+
+// Load는 defaults에 설정 파일, 환경 변수, 플래그를 차례로 덮어쓴다. 문제를 모두 모아
+// errors.Join으로 반환하므로 처음 것에서 멈추지 않는다. 값이 잘못된 설정은 앞 단계의 값을 유지한다.
+func (l *Loader) Load(defaults Config, getenv func(string) string) (Config, error) {
+	c := defaults
+	c.sources = map[string]string{}
+	settings := c.settings()
+	index := map[string]setting{}
+	for _, s := range settings {
+		index[s.key] = s
+		c.sources[s.key] = sourceDefault
+	}
+
+	errs := []error{}
+	apply := func(s setting, v, source, from string) {
+		if err := s.set(v); err != nil {
+			shown := strconv.Quote(v)
+			if s.secret {
+				shown = masked
+			}
+			errs = append(errs, fmt.Errorf("%s: invalid value %s from %s: %w", s.key, shown, from, err))
+			return
+		}
+		c.sources[s.key] = source
+	}
+
+	path := l.configFile
+	if len(path) == 0 {
+		path = getenv("CONFIG_FILE")
+	}
+	if len(path) != 0 {
+		values, err := readFile(path)
+		if err != nil {
+			errs = append(errs, err)
+		}
+		for _, s := range settings {
+			if v, ok := values[s.key]; ok {
+				apply(s, v, sourceFile, "config file "+path)
+				delete(values, s.key)
+			}
+		}
+		for key := range values {
+			errs = append(errs, fmt.Errorf("%s: unknown setting in config file %s", key, path))
+		}
+	}
+	for _, s := range settings {
+		if v := getenv(s.env); len(v) != 0 {
+			apply(s, v, sourceEnv, "env "+s.env)
+		}
+	}
+	for _, key := range l.order {
+		s := index[key]
+		apply(s, l.flags[key], sourceFlag, "flag -"+s.flagName())
+	}
+	return c, errors.Join(errs...)
+}
+
+// readFile은 JSON 설정 파일을 읽는다. 값은 문자열, 숫자, 불리언 중 하나다.
+func readFile(path string) (map[string]string, error) {
+	values := map[string]string{}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return values, fmt.Errorf("config file: %w", err)
+	}
+	raw := map[string]json.RawMessage{}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return values, fmt.Errorf("config file %s: %w", path, err)
+	}
+	errs := []error{}
+	for key, v := range raw {
+		var s string
+		if err := json.Unmarshal(v, &s); err == nil {
+			values[key] = s
+			continue
+		}
+		var x interface{}
+		json.Unmarshal(v, &x)
+		switch x.(type) {
+		case float64, bool:
+			values[key] = string(v)
+		default:
+			errs = append(errs, fmt.Errorf("%s: config file %s: value must be a string, number or boolean", key, path))
+		}
+	}
+	return values, errors.Join(errs...)
+}
+
+// Validate는 값 하나만 보고는 알 수 없는 문제를 모두 모아 반환한다.
+func (c Config) Validate() error {
+	err := errors.Join(c.validateStore(), c.validateBucket())
+	if len(c.GRPCListenAddr) != 0 && c.GRPCListenAddr == c.ListenAddr {
+		err = errors.Join(err, errors.New("grpc_listen_addr: must differ from listen_addr"))
+	}
+	return err
+}
+
+func (c Config) validateStore() error {
+	switch c.Store.Driver {
+	case "", "mysql":
+		errs := []error{}
+		for _, s := range []struct{ key, value string }{
+			{key: "db_addr", value: c.Store.Addr},
+			{key: "db_name", value: c.Store.Name},
+			{key: "db_user", value: c.Store.User},
+			{key: "db_password", value: c.Store.Password},
+		} {
+			if len(s.value) == 0 {
+				errs = append(errs, fmt.Errorf("%s: required by the mysql store driver", s.key))
+			}
+		}
+		return errors.Join(errs...)
+	case "sqlite":
+		if len(c.Store.Path) == 0 {
+			return errors.New("sqlite_path: required by the sqlite store driver")
+		}
+	case "memory":
+	default:
+		return fmt.Errorf("store_driver: unknown driver %q", c.Store.Driver)
+	}
+	return nil
+}
+
+func (c Config) validateBucket() error {
+	if len(c.BucketURL) != 0 {
+		if len(c.BucketName) != 0 {
+			return errors.New("bucket_url: cannot be used together with bucket_name")
+		}
+		u, err := url.Parse(c.BucketURL)
+		if err != nil {
+			return fmt.Errorf("bucket_url: invalid URL %s", maskURL(c.BucketURL))
+		}
+		if !blob.DefaultURLMux().ValidBucketScheme(u.Scheme) {
+			return fmt.Errorf("bucket_url: unsupported scheme %q, use file, mem or s3", u.Scheme)
+		}
+		return nil
+	}
+	if len(c.BucketName) == 0 {
+		return errors.New("bucket_url: bucket_url or bucket_name is required")
+	}
+	if len(c.S3Addr) == 0 {
+		return errors.New("s3_addr: required with bucket_name")
+	}
+	return nil
+}
+
+// bucketURL은 BucketURL이 없으면 예전 설정인 BucketName, S3Addr, S3Region으로 s3:// URL을 만든다.
+func (c Config) bucketURL() string {
+	if len(c.BucketURL) != 0 {
+		return c.BucketURL
+	}
+	q := url.Values{}
+	if len(c.S3Region) != 0 {
+		q.Set("region", c.S3Region)
+	}
+	q.Set("endpoint", c.S3Addr)
+	q.Set("disableSSL", "true")
+	q.Set("s3ForcePathStyle", "true")
+	return fmt.Sprintf("s3://%s?%s", c.BucketName, q.Encode())
+}
+
+func (c Config) OpenBucket(ctx context.Context) (*blob.Bucket, error) {
+	if err := c.validateBucket(); err != nil {
+		return nil, err
+	}
+	return blob.OpenBucket(ctx, c.bucketURL())
+}
+
+func (c Config) OpenStore() (store.PackageStore, error) {
+	if err := c.validateStore(); err != nil {
+		return nil, err
+	}
+	return store.Open(c.Store)
+}
+
+// maskURL은 URL의 비밀번호와 비밀 값처럼 보이는 쿼리 매개변수를 가린다.
+func maskURL(s string) string {
+	u, err := url.Parse(s)
+	if err != nil {
+		return masked
+	}
+	if _, ok := u.User.Password(); ok {
+		u.User = url.UserPassword(u.User.Username(), masked)
+	}
+	q := u.Query()
+	for key := range q {
+		k := strings.ToLower(key)
+		for _, word := range []string{"secret", "password", "token", "key", "signature"} {
+			if strings.Contains(k, word) {
+				q.Set(key, masked)
+			}
+		}
+	}
+	u.RawQuery = q.Encode()
+	// url.String은 가린 값의 *를 인코딩한다
+	return strings.ReplaceAll(u.String(), url.QueryEscape(masked), masked)
+}
+
+// Print는 적용된 설정과 값의 출처를 쓴다. 비밀 값은 가린다.
+func (c Config) Print(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "KEY\tVALUE\tSOURCE")
+	for _, s := range c.settings() {
+		v := s.get()
+		switch {
+		case s.secret && len(v) != 0:
+			v = masked
+		case s.key == "bucket_url" && len(v) != 0:
+			v = maskURL(v)
+		}
+		source := c.sources[s.key]
+		if len(source) == 0 {
+			source = sourceDefault
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", s.key, v, source)
+	}
+	return tw.Flush()
+}
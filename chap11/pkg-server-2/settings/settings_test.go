@@ -0,0 +1,186 @@
+package settings
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func load(t *testing.T, file string, env map[string]string, args []string) (Config, error) {
+	t.Helper()
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	l := NewLoader(fs)
+	if len(file) != 0 {
+		path := filepath.Join(t.TempDir(), "config.json")
+		if err := os.WriteFile(path, []byte(file), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		args = append([]string{"-config", path}, args...)
+	}
+	if err := fs.Parse(args); err != nil {
+		t.Fatal(err)
+	}
+	return l.Load(Defaults(), func(key string) string { return env[key] })
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	file := `{
+		"listen_addr": ":9000",
+		"bucket_url": "mem://",
+		"store_driver": "sqlite",
+		"sqlite_path": "file.db",
+		"max_package_size": 2048,
+		"goproxy_anonymous": true,
+		"upload_expiry": "5m"
+	}`
+	env := map[string]string{"SQLITE_PATH": "env.db", "MAX_PACKAGE_SIZE": "4096", "LISTEN_ADDR": ":9001"}
+	c, err := load(t, file, env, []string{"-listen-addr", ":9002", "-publishes-per-hour", "5"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testConfigs := []struct {
+		name     string
+		got      interface{}
+		expected interface{}
+		source   string
+	}{
+		{name: "listen_addr", got: c.ListenAddr, expected: ":9002", source: sourceFlag},
+		{name: "max_package_size", got: c.MaxPackageSize, expected: int64(4096), source: sourceEnv},
+		{name: "sqlite_path", got: c.Store.Path, expected: "env.db", source: sourceEnv},
+		{name: "store_driver", got: c.Store.Driver, expected: "sqlite", source: sourceFile},
+		{name: "goproxy_anonymous", got: c.GoProxyAnonymous, expected: true, source: sourceFile},
+		{name: "upload_expiry", got: c.UploadExpiry, expected: 5 * time.Minute, source: sourceFile},
+		{name: "publishes_per_hour", got: c.PublishesPerHour, expected: 5, source: sourceFlag},
+		{name: "s3_region", got: c.S3Region, expected: "us-east-1", source: sourceDefault},
+	}
+	for _, tc := range testConfigs {
+		if tc.got != tc.expected {
+			t.Errorf("%s: Expected %v, Got: %v", tc.name, tc.expected, tc.got)
+		}
+		if c.sources[tc.name] != tc.source {
+			t.Errorf("%s: Expected source %s, Got: %s", tc.name, tc.source, c.sources[tc.name])
+		}
+	}
+	if err := c.Validate(); err != nil {
+		t.Errorf("Expected valid config, Got: %v", err)
+	}
+}
+
+func TestLoadReportsAllProblems(t *testing.T) {
+	file := `{"max_package_size": "big", "unknown_key": 1, "webhook_interval": [1]}`
+	env := map[string]string{
+		"UPLOAD_EXPIRY":         "0s",
+		"DB_PASSWORD":           "hunter2",
+		"BOOTSTRAP_ADMIN_USER":  "0",
+		"BOOTSTRAP_ADMIN_TOKEN": "pkg_secret",
+	}
+	c, err := load(t, file, env, []string{"-goproxy-anonymous", "maybe"})
+	if err == nil {
+		t.Fatal("Expected error, Got: nil")
+	}
+	expected := []string{
+		`max_package_size: invalid value "big" from config file`,
+		"unknown_key: unknown setting in config file",
+		"webhook_interval: config file",
+		`upload_expiry: invalid value "0s" from env UPLOAD_EXPIRY: must be positive`,
+		`bootstrap_admin_user: invalid value "0" from env BOOTSTRAP_ADMIN_USER: must be at least 1`,
+		`goproxy_anonymous: invalid value "maybe" from flag -goproxy-anonymous: must be true or false`,
+	}
+	for _, e := range expected {
+		if !strings.Contains(err.Error(), e) {
+			t.Errorf("Expected error to contain %q, Got: %v", e, err)
+		}
+	}
+
+	// mysql 드라이버에 빠진 값과 버킷 설정도 한 번에 보여준다
+	err = c.Validate()
+	for _, e := range []string{"db_addr: required", "db_name: required", "db_user: required", "bucket_url: bucket_url or bucket_name is required"} {
+		if err == nil || !strings.Contains(err.Error(), e) {
+			t.Errorf("Expected error to contain %q, Got: %v", e, err)
+		}
+	}
+	if strings.Contains(err.Error(), "db_password") {
+		t.Errorf("Expected db_password to be set, Got: %v", err)
+	}
+}
+
+func TestValidateBucket(t *testing.T) {
+	testConfigs := []struct {
+		config Config
+		err    string
+	}{
+		{config: Config{BucketURL: "file:///tmp/packages"}},
+		{config: Config{BucketURL: "mem://"}},
+		{config: Config{BucketURL: "s3://packages?region=us-east-1"}},
+		{config: Config{BucketName: "packages", S3Addr: "localhost:9000"}},
+		{config: Config{BucketURL: "gs://packages"}, err: `unsupported scheme "gs"`},
+		{config: Config{BucketURL: "mem://", BucketName: "packages"}, err: "cannot be used together"},
+		{config: Config{BucketName: "packages"}, err: "s3_addr: required"},
+		{config: Config{}, err: "bucket_url or bucket_name is required"},
+	}
+	for _, tc := range testConfigs {
+		err := tc.config.validateBucket()
+		if len(tc.err) == 0 && err != nil {
+			t.Errorf("%#v: Expected nil error, Got: %v", tc.config, err)
+		}
+		if len(tc.err) != 0 && (err == nil || !strings.Contains(err.Error(), tc.err)) {
+			t.Errorf("%#v: Expected error %q, Got: %v", tc.config, tc.err, err)
+		}
+	}
+
+	c := Config{BucketName: "packages", S3Addr: "minio:9000", S3Region: "us-east-1"}
+	expected := "s3://packages?disableSSL=true&endpoint=minio%3A9000&region=us-east-1&s3ForcePathStyle=true"
+	if c.bucketURL() != expected {
+		t.Errorf("Expected %s, Got: %s", expected, c.bucketURL())
+	}
+	b, err := Config{BucketURL: "mem://"}.OpenBucket(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.Close()
+}
+
+func TestPrintMasksSecrets(t *testing.T) {
+	env := map[string]string{
+		"BUCKET_URL":            "s3://user:pa55@packages?region=us-east-1&secret_access_key=abc",
+		"DB_PASSWORD":           "hunter2",
+		"BOOTSTRAP_ADMIN_TOKEN": "pkg_secret",
+	}
+	c, err := load(t, "", env, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := new(bytes.Buffer)
+	if err := c.Print(out); err != nil {
+		t.Fatal(err)
+	}
+	for _, secret := range []string{"pa55", "abc", "hunter2", "pkg_secret"} {
+		if strings.Contains(out.String(), secret) {
+			t.Errorf("Expected %s to be masked, Got: %s", secret, out.String())
+		}
+	}
+	rows := map[string][]string{}
+	for _, line := range strings.Split(out.String(), "\n") {
+		if fields := strings.Fields(line); len(fields) != 0 {
+			rows[fields[0]] = fields[1:]
+		}
+	}
+	for key, expected := range map[string]string{
+		"bucket_url":   "s3://user:****@packages?region=us-east-1&secret_access_key=**** env",
+		"db_password":  "**** env",
+		"listen_addr":  ":8080 default",
+		"store_driver": "mysql default",
+	} {
+		if got := strings.Join(rows[key], " "); got != expected {
+			t.Errorf("%s: Expected %q, Got: %q", key, expected, got)
+		}
+	}
+}
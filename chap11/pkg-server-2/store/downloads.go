@@ -0,0 +1,20 @@
+package store
+
+// DayFormat은 다운로드 집계에 쓰는 UTC 날짜 형식이다.
+const DayFormat = "2006-01-02"
+
+// DownloadCount는 패키지 버전 하나의 하루 다운로드 수다.
+type DownloadCount struct {
+	OwnerId int    `json:"owner_id"`
+	Name    string `json:"name"`
+	Version string `json:"version"`
+	Day     string `json:"day"`
+	Count   int64  `json:"count"`
+}
+
+// DownloadTotal은 패키지의 모든 버전을 더한 다운로드 수다.
+type DownloadTotal struct {
+	OwnerId int    `json:"owner_id"`
+	Name    string `json:"name"`
+	Count   int64  `json:"downloads"`
+}
@@ -0,0 +1,879 @@
+package store
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+)
+
+type packageKey struct {
+	ownerId    int
+	name       string
+	versionKey string
+}
+
+// packageName은 버전과 상관없이 소유자와 이름으로 패키지를 가리킨다.
+type packageName struct {
+	ownerId int
+	name    string
+}
+
+type memoryToken struct {
+	Token
+	hash string
+}
+
+// memoryStore는 테스트와 로컬 개발용 백엔드다. 프로세스가 끝나면 데이터가 사라진다.
+type memoryStore struct {
+	mu       sync.Mutex
+	packages map[packageKey]Package
+	pending  map[packageKey]PendingPackage
+	modified map[packageName]string
+	users    map[int]string
+	nextUser int
+	tokens   []*memoryToken
+	deleted  map[string]string
+	metadata map[packageKey]Metadata
+	// downloads의 키는 패키지 버전과 날짜다.
+	downloads map[downloadKey]DownloadCount
+	// index는 토큰에서 그 토큰을 가진 버전의 항목으로 가는 역색인이다.
+	index map[string]map[packageKey][]Posting
+	// ID는 지워진 웹훅과 전송의 것도 다시 쓰지 않는다.
+	webhooks     map[int]Webhook
+	nextWebhook  int
+	deliveries   map[int]Delivery
+	nextDelivery int
+	attempts     map[int][]DeliveryAttempt
+	uploads      map[string]Upload
+	limits       map[int]Limits
+}
+
+func NewMemoryStore() PackageStore {
+	return &memoryStore{
+		packages:   map[packageKey]Package{},
+		pending:    map[packageKey]PendingPackage{},
+		modified:   map[packageName]string{},
+		users:      map[int]string{},
+		nextUser:   1,
+		deleted:    map[string]string{},
+		metadata:   map[packageKey]Metadata{},
+		downloads:  map[downloadKey]DownloadCount{},
+		index:      map[string]map[packageKey][]Posting{},
+		webhooks:   map[int]Webhook{},
+		deliveries: map[int]Delivery{},
+		attempts:   map[int][]DeliveryAttempt{},
+		uploads:    map[string]Upload{},
+		limits:     map[int]Limits{},
+	}
+}
+
+func (s *memoryStore) AddPackage(ctx context.Context, p Package) error {
+	vKey, err := versionKey(p.Version)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := packageKey{p.OwnerId, p.Name, vKey}
+	if s.exists(key) {
+		return ErrExists
+	}
+	p.Created = now()
+	s.packages[key] = p
+	s.modified[packageName{p.OwnerId, p.Name}] = p.Created
+	return nil
+}
+
+func (s *memoryStore) exists(key packageKey) bool {
+	_, published := s.packages[key]
+	_, pending := s.pending[key]
+	return published || pending
+}
+
+func (s *memoryStore) ReservePackage(ctx context.Context, p PendingPackage) error {
+	vKey, err := versionKey(p.Version)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := packageKey{p.OwnerId, p.Name, vKey}
+	if s.exists(key) {
+		return ErrExists
+	}
+	p.Created = now()
+	p.Sha256, p.Sha512, p.Yanked, p.Size = "", "", "", 0
+	s.pending[key] = p
+	return nil
+}
+
+func (s *memoryStore) PublishPackage(ctx context.Context, p Package, m Metadata) error {
+	vKey, err := versionKey(p.Version)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := packageKey{p.OwnerId, p.Name, vKey}
+	pending, ok := s.pending[key]
+	if !ok {
+		return ErrNotFound
+	}
+	delete(s.pending, key)
+	published := pending.Package
+	published.Sha256 = p.Sha256
+	published.Sha512 = p.Sha512
+	published.Size = p.Size
+	published.Created = now()
+	s.packages[key] = published
+	s.modified[packageName{p.OwnerId, p.Name}] = published.Created
+	s.putMetadata(key, m)
+	return nil
+}
+
+func (s *memoryStore) AbortPackage(ctx context.Context, ownerId int, name, version string) error {
+	vKey, err := versionKey(version)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := packageKey{ownerId, name, vKey}
+	if _, ok := s.pending[key]; !ok {
+		return ErrNotFound
+	}
+	delete(s.pending, key)
+	return nil
+}
+
+func (s *memoryStore) PendingPackages(ctx context.Context) ([]PendingPackage, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rows := []memoryRow{}
+	staging := map[packageKey]string{}
+	for k, p := range s.pending {
+		rows = append(rows, memoryRow{Package: p.Package, key: k.versionKey})
+		staging[k] = p.StagingKey
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		return rows[i].compare(rows[j], sortColumns[SortCreated]) < 0
+	})
+	pkgs := []PendingPackage{}
+	for _, row := range rows {
+		key := packageKey{row.OwnerId, row.Name, row.key}
+		pkgs = append(pkgs, PendingPackage{Package: row.Package, StagingKey: staging[key]})
+	}
+	return pkgs, nil
+}
+
+func (s *memoryStore) QueryPackages(ctx context.Context, q QueryParams) ([]Package, error) {
+	if err := q.validate(); err != nil {
+		return nil, err
+	}
+	var qKey string
+	if len(q.Version) != 0 {
+		var err error
+		if qKey, err = versionKey(q.Version); err != nil {
+			return nil, err
+		}
+	}
+	columns := sortColumns[q.sort()]
+	var after *memoryRow
+	if q.After != nil {
+		key, err := versionKey(q.After.Version)
+		if err != nil {
+			return nil, err
+		}
+		after = &memoryRow{
+			Package: Package{OwnerId: q.After.OwnerId, Name: q.After.Name, Created: q.After.Created},
+			key:     key,
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rows := []memoryRow{}
+	for k, p := range s.packages {
+		if q.OwnerId != -1 && k.ownerId != q.OwnerId {
+			continue
+		}
+		if len(q.Name) != 0 && k.name != q.Name {
+			continue
+		}
+		if len(qKey) != 0 && k.versionKey != qKey {
+			continue
+		}
+		if !strings.HasPrefix(k.name, q.NamePrefix) {
+			continue
+		}
+		if len(q.CreatedAfter) != 0 && p.Created <= q.CreatedAfter {
+			continue
+		}
+		row := memoryRow{Package: p, key: k.versionKey}
+		if after != nil && row.compare(*after, columns) <= 0 {
+			continue
+		}
+		rows = append(rows, row)
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		return rows[i].compare(rows[j], columns) < 0
+	})
+	if q.Limit > 0 && len(rows) > q.Limit {
+		rows = rows[:q.Limit]
+	}
+	pkgResults := []Package{}
+	for _, row := range rows {
+		pkgResults = append(pkgResults, row.Package)
+	}
+	return pkgResults, nil
+}
+
+type memoryRow struct {
+	Package
+	key string
+}
+
+// compare는 SQL의 ORDER BY와 같은 순서로 두 행을 비교한다.
+func (r memoryRow) compare(o memoryRow, columns []string) int {
+	for _, column := range columns {
+		c := 0
+		switch column {
+		case "name":
+			c = strings.Compare(r.Name, o.Name)
+		case "owner_id":
+			c = r.OwnerId - o.OwnerId
+		case "created":
+			c = strings.Compare(r.Created, o.Created)
+		case "version_key":
+			c = strings.Compare(r.key, o.key)
+		}
+		if c != 0 {
+			return c
+		}
+	}
+	return 0
+}
+
+func (s *memoryStore) YankPackage(ctx context.Context, ownerId int, name, version string) error {
+	vKey, err := versionKey(version)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := packageKey{ownerId, name, vKey}
+	p, ok := s.packages[key]
+	if !ok {
+		return ErrNotFound
+	}
+	if len(p.Yanked) == 0 {
+		p.Yanked = now()
+		s.packages[key] = p
+		s.modified[packageName{ownerId, name}] = p.Yanked
+	}
+	return nil
+}
+
+func (s *memoryStore) PackagesModified(ctx context.Context, ownerId int, name string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	latest := ""
+	for key, t := range s.modified {
+		if (ownerId == -1 || key.ownerId == ownerId) && (len(name) == 0 || key.name == name) && t > latest {
+			latest = t
+		}
+	}
+	return latest, nil
+}
+
+func (s *memoryStore) DeletePackage(ctx context.Context, ownerId int, name, version string) (Package, error) {
+	vKey, err := versionKey(version)
+	if err != nil {
+		return Package{}, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := packageKey{ownerId, name, vKey}
+	p, ok := s.packages[key]
+	if !ok {
+		return Package{}, ErrNotFound
+	}
+	delete(s.packages, key)
+	s.removeMetadata(key)
+	s.deleted[p.ObjectStoreId] = now()
+	s.modified[packageName{ownerId, name}] = s.deleted[p.ObjectStoreId]
+	return p, nil
+}
+
+func (s *memoryStore) PutMetadata(ctx context.Context, m Metadata) error {
+	vKey, err := versionKey(m.Version)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := packageKey{m.OwnerId, m.Name, vKey}
+	p, ok := s.packages[key]
+	if !ok {
+		return ErrNotFound
+	}
+	m.Version = p.Version
+	s.putMetadata(key, m)
+	return nil
+}
+
+func (s *memoryStore) putMetadata(key packageKey, m Metadata) {
+	s.removeMetadata(key)
+	m.Keywords = append([]string{}, m.Keywords...)
+	m.Dependencies = sortedDependencies(m.Dependencies)
+	s.metadata[key] = m
+	for _, posting := range IndexTerms(m) {
+		if s.index[posting.Term] == nil {
+			s.index[posting.Term] = map[packageKey][]Posting{}
+		}
+		s.index[posting.Term][key] = append(s.index[posting.Term][key], posting)
+	}
+}
+
+func (s *memoryStore) removeMetadata(key packageKey) {
+	m, ok := s.metadata[key]
+	if !ok {
+		return
+	}
+	delete(s.metadata, key)
+	for _, posting := range IndexTerms(m) {
+		delete(s.index[posting.Term], key)
+		if len(s.index[posting.Term]) == 0 {
+			delete(s.index, posting.Term)
+		}
+	}
+}
+
+func (s *memoryStore) Metadata(ctx context.Context, ownerId int, name, version string) (Metadata, error) {
+	vKey, err := versionKey(version)
+	if err != nil {
+		return Metadata{}, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	m, ok := s.metadata[packageKey{ownerId, name, vKey}]
+	if !ok {
+		return Metadata{OwnerId: ownerId, Name: name}, ErrNotFound
+	}
+	m.Keywords = append([]string{}, m.Keywords...)
+	m.Dependencies = append([]Dependency{}, m.Dependencies...)
+	return m, nil
+}
+
+func sortedDependencies(deps []Dependency) []Dependency {
+	deps = append([]Dependency{}, deps...)
+	sort.Slice(deps, func(i, j int) bool {
+		if deps[i].OwnerId != deps[j].OwnerId {
+			return deps[i].OwnerId < deps[j].OwnerId
+		}
+		return deps[i].Name < deps[j].Name
+	})
+	return deps
+}
+
+func (s *memoryStore) Dependents(ctx context.Context, ownerId int, name string) ([]Dependent, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	keys := []packageKey{}
+	dependents := map[packageKey]Dependent{}
+	for key, m := range s.metadata {
+		for _, d := range m.Dependencies {
+			if d.OwnerId == ownerId && d.Name == name {
+				keys = append(keys, key)
+				dependents[key] = Dependent{
+					OwnerId:    m.OwnerId,
+					Name:       m.Name,
+					Version:    s.packages[key].Version,
+					Constraint: d.Constraint,
+				}
+			}
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].ownerId != keys[j].ownerId {
+			return keys[i].ownerId < keys[j].ownerId
+		}
+		if keys[i].name != keys[j].name {
+			return keys[i].name < keys[j].name
+		}
+		return keys[i].versionKey < keys[j].versionKey
+	})
+	result := []Dependent{}
+	for _, key := range keys {
+		result = append(result, dependents[key])
+	}
+	return result, nil
+}
+
+func (s *memoryStore) SearchPostings(ctx context.Context, terms []string, ownerId int) ([]Posting, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	postings := []Posting{}
+	seen := map[string]bool{}
+	for _, term := range terms {
+		if seen[term] {
+			continue
+		}
+		seen[term] = true
+		for key, keyPostings := range s.index[term] {
+			if ownerId != -1 && key.ownerId != ownerId {
+				continue
+			}
+			postings = append(postings, keyPostings...)
+		}
+	}
+	return postings, nil
+}
+
+type downloadKey struct {
+	packageKey
+	day string
+}
+
+func (s *memoryStore) AddDownloads(ctx context.Context, counts []DownloadCount) error {
+	keys := []downloadKey{}
+	for _, c := range counts {
+		vKey, err := versionKey(c.Version)
+		if err != nil {
+			return err
+		}
+		keys = append(keys, downloadKey{packageKey{c.OwnerId, c.Name, vKey}, c.Day})
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, c := range counts {
+		if existing, ok := s.downloads[keys[i]]; ok {
+			c.Version = existing.Version
+			c.Count += existing.Count
+		}
+		s.downloads[keys[i]] = c
+	}
+	return nil
+}
+
+func (s *memoryStore) DownloadStats(ctx context.Context, ownerId int, name, since string) ([]DownloadCount, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	keys := []downloadKey{}
+	for k := range s.downloads {
+		if k.ownerId == ownerId && k.name == name && k.day >= since {
+			keys = append(keys, k)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].day != keys[j].day {
+			return keys[i].day < keys[j].day
+		}
+		return keys[i].versionKey < keys[j].versionKey
+	})
+	counts := []DownloadCount{}
+	for _, k := range keys {
+		counts = append(counts, s.downloads[k])
+	}
+	return counts, nil
+}
+
+func (s *memoryStore) TopDownloads(ctx context.Context, since string, limit int) ([]DownloadTotal, error) {
+	s.mu.Lock()
+	type totalKey struct {
+		ownerId int
+		name    string
+	}
+	totals := map[totalKey]*DownloadTotal{}
+	for k, c := range s.downloads {
+		if k.day < since {
+			continue
+		}
+		tk := totalKey{k.ownerId, k.name}
+		if totals[tk] == nil {
+			totals[tk] = &DownloadTotal{OwnerId: k.ownerId, Name: k.name}
+		}
+		totals[tk].Count += c.Count
+	}
+	s.mu.Unlock()
+
+	results := []DownloadTotal{}
+	for _, t := range totals {
+		results = append(results, *t)
+	}
+	sort.Slice(results, func(i, j int) bool {
+		a, b := results[i], results[j]
+		if a.Count != b.Count {
+			return a.Count > b.Count
+		}
+		if a.Name != b.Name {
+			return a.Name < b.Name
+		}
+		return a.OwnerId < b.OwnerId
+	})
+	if limit > 0 && len(results) > limit {
+		results = results[:limit]
+	}
+	return results, nil
+}
+
+func (s *memoryStore) ReferencedObjects(ctx context.Context) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ids := []string{}
+	for _, p := range s.packages {
+		ids = append(ids, p.ObjectStoreId)
+	}
+	for _, p := range s.pending {
+		ids = append(ids, p.ObjectStoreId, p.StagingKey)
+	}
+	return ids, nil
+}
+
+func (s *memoryStore) DeletedObjects(ctx context.Context) ([]DeletedObject, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	objects := []DeletedObject{}
+	for id, deleted := range s.deleted {
+		objects = append(objects, DeletedObject{ObjectStoreId: id, Deleted: deleted})
+	}
+	sort.Slice(objects, func(i, j int) bool {
+		if objects[i].Deleted != objects[j].Deleted {
+			return objects[i].Deleted < objects[j].Deleted
+		}
+		return objects[i].ObjectStoreId < objects[j].ObjectStoreId
+	})
+	return objects, nil
+}
+
+func (s *memoryStore) PurgeDeletedObject(ctx context.Context, objectStoreId string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.deleted, objectStoreId)
+	return nil
+}
+
+func (s *memoryStore) AddUser(ctx context.Context, username string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	id := s.nextUser
+	s.nextUser++
+	s.users[id] = username
+	return id, nil
+}
+
+func (s *memoryStore) UserExists(ctx context.Context, id int) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.users[id]
+	return ok, nil
+}
+
+func (s *memoryStore) Users(ctx context.Context) ([]User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	users := []User{}
+	for id, username := range s.users {
+		users = append(users, User{Id: id, Username: username})
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].Id < users[j].Id })
+	return users, nil
+}
+
+func (s *memoryStore) AddToken(ctx context.Context, t Token, tokenHash string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, mt := range s.tokens {
+		if mt.hash == tokenHash {
+			return 0, ErrExists
+		}
+	}
+	t.Id = len(s.tokens) + 1
+	t.Created = now()
+	t.LastUsed = ""
+	t.Revoked = ""
+	t.Scopes = append([]string{}, t.Scopes...)
+	s.tokens = append(s.tokens, &memoryToken{Token: t, hash: tokenHash})
+	return t.Id, nil
+}
+
+// 호출자가 결과를 고쳐도 저장된 값이 바뀌지 않도록 복사해서 돌려준다.
+func (t *memoryToken) copy() Token {
+	c := t.Token
+	c.Scopes = append([]string{}, t.Scopes...)
+	return c
+}
+
+func (s *memoryStore) TokenByHash(ctx context.Context, tokenHash string) (Token, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, t := range s.tokens {
+		if t.hash == tokenHash {
+			return t.copy(), nil
+		}
+	}
+	return Token{}, ErrNotFound
+}
+
+func (s *memoryStore) Tokens(ctx context.Context, userId int) ([]Token, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	tokens := []Token{}
+	for _, t := range s.tokens {
+		if t.UserId == userId {
+			tokens = append(tokens, t.copy())
+		}
+	}
+	return tokens, nil
+}
+
+func (s *memoryStore) TouchToken(ctx context.Context, id int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if id >= 1 && id <= len(s.tokens) {
+		s.tokens[id-1].LastUsed = now()
+	}
+	return nil
+}
+
+func (s *memoryStore) RevokeToken(ctx context.Context, id, userId int) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if id < 1 || id > len(s.tokens) {
+		return false, nil
+	}
+	t := s.tokens[id-1]
+	if len(t.Revoked) != 0 || (userId != -1 && t.UserId != userId) {
+		return false, nil
+	}
+	t.Revoked = now()
+	return true, nil
+}
+
+func (s *memoryStore) Close() error {
+	return nil
+}
+
+func (s *memoryStore) AddWebhook(ctx context.Context, h Webhook) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.nextWebhook++
+	h.Id = s.nextWebhook
+	h.Created = now()
+	h.Events = append([]string{}, h.Events...)
+	s.webhooks[h.Id] = h
+	return h.Id, nil
+}
+
+func (s *memoryStore) Webhooks(ctx context.Context, ownerId int) ([]Webhook, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	hooks := []Webhook{}
+	for _, h := range s.webhooks {
+		if ownerId == -1 || h.OwnerId == ownerId {
+			h.Events = append([]string{}, h.Events...)
+			hooks = append(hooks, h)
+		}
+	}
+	sort.Slice(hooks, func(i, j int) bool { return hooks[i].Id < hooks[j].Id })
+	return hooks, nil
+}
+
+func (s *memoryStore) Webhook(ctx context.Context, id int) (Webhook, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	h, ok := s.webhooks[id]
+	if !ok {
+		return Webhook{}, ErrNotFound
+	}
+	h.Events = append([]string{}, h.Events...)
+	return h, nil
+}
+
+func (s *memoryStore) DeleteWebhook(ctx context.Context, id int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.webhooks[id]; !ok {
+		return ErrNotFound
+	}
+	delete(s.webhooks, id)
+	for deliveryId, d := range s.deliveries {
+		if d.WebhookId == id {
+			delete(s.deliveries, deliveryId)
+			delete(s.attempts, deliveryId)
+		}
+	}
+	return nil
+}
+
+func (s *memoryStore) AddDelivery(ctx context.Context, d Delivery) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.nextDelivery++
+	d.Id = s.nextDelivery
+	d.Created = now()
+	s.deliveries[d.Id] = d
+	return d.Id, nil
+}
+
+func (s *memoryStore) DueDeliveries(ctx context.Context, before string, limit int) ([]Delivery, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	due := []Delivery{}
+	for _, d := range s.deliveries {
+		if d.Status == DeliveryPending && len(d.NextAttempt) != 0 && d.NextAttempt <= before {
+			due = append(due, d)
+		}
+	}
+	sort.Slice(due, func(i, j int) bool {
+		if due[i].NextAttempt != due[j].NextAttempt {
+			return due[i].NextAttempt < due[j].NextAttempt
+		}
+		return due[i].Id < due[j].Id
+	})
+	if len(due) > limit {
+		due = due[:limit]
+	}
+	return due, nil
+}
+
+func (s *memoryStore) RecordAttempt(ctx context.Context, d Delivery, a DeliveryAttempt) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stored, ok := s.deliveries[d.Id]
+	if !ok {
+		return ErrNotFound
+	}
+	stored.Status = d.Status
+	stored.Attempts = d.Attempts
+	stored.NextAttempt = d.NextAttempt
+	s.deliveries[d.Id] = stored
+	a.DeliveryId = d.Id
+	a.Created = now()
+	s.attempts[d.Id] = append(s.attempts[d.Id], a)
+	return nil
+}
+
+func (s *memoryStore) Deliveries(ctx context.Context, webhookId int, limit int) ([]Delivery, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	deliveries := []Delivery{}
+	for _, d := range s.deliveries {
+		if d.WebhookId == webhookId {
+			deliveries = append(deliveries, d)
+		}
+	}
+	sort.Slice(deliveries, func(i, j int) bool { return deliveries[i].Id > deliveries[j].Id })
+	if len(deliveries) > limit {
+		deliveries = deliveries[:limit]
+	}
+	return deliveries, nil
+}
+
+func (s *memoryStore) DeliveryAttempts(ctx context.Context, deliveryId int) ([]DeliveryAttempt, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]DeliveryAttempt{}, s.attempts[deliveryId]...), nil
+}
+
+func (s *memoryStore) AddUpload(ctx context.Context, u Upload) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.uploads[u.Id]; ok {
+		return ErrExists
+	}
+	u.Created = now()
+	s.uploads[u.Id] = u
+	return nil
+}
+
+func (s *memoryStore) Upload(ctx context.Context, id string) (Upload, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u, ok := s.uploads[id]
+	if !ok {
+		return Upload{}, ErrNotFound
+	}
+	return u, nil
+}
+
+func (s *memoryStore) Uploads(ctx context.Context) ([]Upload, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	uploads := []Upload{}
+	for _, u := range s.uploads {
+		uploads = append(uploads, u)
+	}
+	sort.Slice(uploads, func(i, j int) bool {
+		if uploads[i].Expires != uploads[j].Expires {
+			return uploads[i].Expires < uploads[j].Expires
+		}
+		return uploads[i].Id < uploads[j].Id
+	})
+	return uploads, nil
+}
+
+func (s *memoryStore) DeleteUpload(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.uploads[id]; !ok {
+		return ErrNotFound
+	}
+	delete(s.uploads, id)
+	return nil
+}
+
+func (s *memoryStore) Usage(ctx context.Context, ownerId int, since string) (Usage, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u := Usage{OwnerId: ownerId}
+	count := func(p Package) {
+		if p.OwnerId != ownerId || p.Created < since {
+			return
+		}
+		u.Publishes++
+		if len(u.FirstPublish) == 0 || p.Created < u.FirstPublish {
+			u.FirstPublish = p.Created
+		}
+	}
+	for _, p := range s.packages {
+		count(p)
+		if p.OwnerId == ownerId {
+			u.StoredBytes += p.Size
+			u.Versions++
+		}
+	}
+	for _, p := range s.pending {
+		count(p.Package)
+	}
+	return u, nil
+}
+
+func (s *memoryStore) OwnerLimits(ctx context.Context, ownerId int) (Limits, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	l, ok := s.limits[ownerId]
+	if !ok {
+		return Limits{OwnerId: ownerId}, ErrNotFound
+	}
+	return l, nil
+}
+
+func (s *memoryStore) SetOwnerLimits(ctx context.Context, l Limits) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	l.Updated = now()
+	s.limits[l.OwnerId] = l
+	return nil
+}
+
+func (s *memoryStore) DeleteOwnerLimits(ctx context.Context, ownerId int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.limits[ownerId]; !ok {
+		return ErrNotFound
+	}
+	delete(s.limits, ownerId)
+	return nil
+}
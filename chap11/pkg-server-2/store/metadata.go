@@ -0,0 +1,119 @@
+package store
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Metadata는 게시할 때 받은 버전별 설명 정보다.
+type Metadata struct {
+	OwnerId     int      `json:"owner_id"`
+	Name        string   `json:"name"`
+	Version     string   `json:"version"`
+	Description string   `json:"description"`
+	License     string   `json:"license"`
+	Homepage    string   `json:"homepage"`
+	Keywords    []string `json:"keywords"`
+	Readme      string   `json:"readme,omitempty"`
+	// GoMod는 Go 모듈로 게시한 버전의 go.mod 내용이다.
+	GoMod string `json:"go_mod,omitempty"`
+	// Dependencies는 소유자 ID, 이름 순서로 정렬되어 있다.
+	Dependencies []Dependency `json:"dependencies"`
+}
+
+// Dependency는 버전이 의존하는 패키지와 버전 제약이다. Constraint는 정확한 버전, latest,
+// 범위 제약 중 하나다.
+type Dependency struct {
+	OwnerId    int    `json:"owner_id"`
+	Name       string `json:"name"`
+	Constraint string `json:"constraint"`
+}
+
+// Dependent는 패키지에 의존하는 버전이다.
+type Dependent struct {
+	OwnerId    int    `json:"owner_id"`
+	Name       string `json:"name"`
+	Version    string `json:"version"`
+	Constraint string `json:"constraint"`
+}
+
+// 검색 색인에 들어가는 필드
+const (
+	FieldName        = "name"
+	FieldKeyword     = "keyword"
+	FieldDescription = "description"
+)
+
+// maxTermLength보다 긴 토큰은 색인하지 않는다.
+const maxTermLength = 64
+
+// Posting은 역색인의 한 항목으로, Term이 패키지 버전의 Field에 Count번 나온다는 뜻이다.
+type Posting struct {
+	Term    string
+	OwnerId int
+	Name    string
+	Version string
+	Field   string
+	Count   int
+}
+
+// Tokenize는 s를 소문자로 바꾸고 글자와 숫자가 아닌 문자에서 나눈다.
+// 모든 백엔드가 같은 토큰을 쓰도록 색인과 검색 모두 이 함수를 쓴다.
+func Tokenize(s string) []string {
+	terms := []string{}
+	for _, term := range strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}) {
+		if len(term) <= maxTermLength {
+			terms = append(terms, term)
+		}
+	}
+	return terms
+}
+
+// IndexTerms는 m의 이름, 키워드, 설명으로 역색인 항목을 만든다.
+func IndexTerms(m Metadata) []Posting {
+	counts := map[[2]string]int{}
+	order := [][2]string{}
+	add := func(field string, terms []string) {
+		for _, term := range terms {
+			k := [2]string{term, field}
+			if counts[k] == 0 {
+				order = append(order, k)
+			}
+			counts[k]++
+		}
+	}
+	add(FieldName, Tokenize(m.Name))
+	for _, keyword := range m.Keywords {
+		add(FieldKeyword, Tokenize(keyword))
+	}
+	add(FieldDescription, Tokenize(m.Description))
+
+	postings := []Posting{}
+	for _, k := range order {
+		postings = append(postings, Posting{
+			Term:    k[0],
+			OwnerId: m.OwnerId,
+			Name:    m.Name,
+			Version: m.Version,
+			Field:   k[1],
+			Count:   counts[k],
+		})
+	}
+	return postings
+}
+
+func joinKeywords(keywords []string) string {
+	return strings.Join(keywords, ",")
+}
+
+func splitKeywords(s string) []string {
+	keywords := []string{}
+	for _, keyword := range strings.Split(s, ",") {
+		if len(keyword) != 0 {
+			keywords = append(keywords, keyword)
+		}
+	}
+	return keywords
+}
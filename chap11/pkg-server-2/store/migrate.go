@@ -0,0 +1,369 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// migrations/<방언>/NNNN_이름.up.sql과 NNNN_이름.down.sql 쌍이 하나의 마이그레이션이다.
+// 파일의 문장은 줄 끝의 ;로 나눈다.
+//
+//go:embed migrations
+var migrationFS embed.FS
+
+// migrationLock은 MySQL의 GET_LOCK에 쓰는 이름이다.
+const (
+	migrationLock        = "pkg_server_schema_migrations"
+	migrationLockTimeout = 60
+)
+
+// ErrSchemaOutdated는 적용하지 않은 마이그레이션이 있다는 뜻이다.
+var ErrSchemaOutdated = errors.New("database schema is out of date")
+
+// Migration은 마이그레이션 하나와 적용 상태다. Applied가 비어 있으면 아직 적용하지 않았다.
+type Migration struct {
+	Version int
+	Name    string
+	Applied string
+	// Unknown은 데이터베이스에는 기록되어 있지만 이 바이너리에는 없는 마이그레이션이다.
+	Unknown bool
+
+	up   string
+	down string
+}
+
+// Migrator는 스키마 마이그레이션을 지원하는 백엔드가 구현한다.
+// 메모리 백엔드는 스키마가 없으므로 구현하지 않는다.
+type Migrator interface {
+	// MigrationStatus는 모든 마이그레이션을 버전 순서로 반환한다.
+	MigrationStatus(ctx context.Context) ([]Migration, error)
+	// MigrateUp은 target 버전까지 적용한다. target이 0이면 모두 적용한다.
+	MigrateUp(ctx context.Context, target int) ([]Migration, error)
+	// MigrateDown은 마지막으로 적용한 마이그레이션부터 steps개를 되돌린다.
+	MigrateDown(ctx context.Context, steps int) ([]Migration, error)
+}
+
+// Pending은 적용하지 않은 마이그레이션 수를 반환한다.
+func Pending(migrations []Migration) int {
+	n := 0
+	for _, m := range migrations {
+		if len(m.Applied) == 0 {
+			n++
+		}
+	}
+	return n
+}
+
+// migrationHooks는 SQL만으로는 할 수 없는 데이터 변환이다. 같은 버전의 up.sql 뒤에 실행한다.
+var migrationHooks = map[int]func(ctx context.Context, db execQuerier) error{
+	3: backfillVersionKeys,
+}
+
+// execQuerier는 *sql.Conn과 *sql.Tx가 함께 구현한다.
+type execQuerier interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+func loadMigrations(dialect string) ([]Migration, error) {
+	dir := path.Join("migrations", dialect)
+	entries, err := fs.ReadDir(migrationFS, dir)
+	if err != nil {
+		return nil, err
+	}
+	byVersion := map[int]*Migration{}
+	for _, e := range entries {
+		name := e.Name()
+		var direction string
+		switch {
+		case strings.HasSuffix(name, ".up.sql"):
+			direction = "up"
+		case strings.HasSuffix(name, ".down.sql"):
+			direction = "down"
+		default:
+			return nil, fmt.Errorf("unexpected migration file %s", name)
+		}
+		base := strings.TrimSuffix(name, "."+direction+".sql")
+		number, title, ok := strings.Cut(base, "_")
+		version, err := strconv.Atoi(number)
+		if !ok || err != nil || version <= 0 {
+			return nil, fmt.Errorf("invalid migration file name %s", name)
+		}
+		data, err := fs.ReadFile(migrationFS, path.Join(dir, name))
+		if err != nil {
+			return nil, err
+		}
+		m := byVersion[version]
+		if m == nil {
+			m = &Migration{Version: version, Name: title}
+			byVersion[version] = m
+		}
+		if m.Name != title {
+			return nil, fmt.Errorf("migration %d has two names: %s, %s", version, m.Name, title)
+		}
+		if direction == "up" {
+			m.up = string(data)
+		} else {
+			m.down = string(data)
+		}
+	}
+
+	migrations := []Migration{}
+	for version := 1; version <= len(byVersion); version++ {
+		m, ok := byVersion[version]
+		if !ok {
+			return nil, fmt.Errorf("missing migration %d in %s", version, dir)
+		}
+		if len(m.up) == 0 || len(m.down) == 0 {
+			return nil, fmt.Errorf("migration %d needs both up and down files", version)
+		}
+		migrations = append(migrations, *m)
+	}
+	return migrations, nil
+}
+
+// splitStatements는 줄 끝의 ;에서 문장을 나누고 -- 주석 줄은 버린다.
+func splitStatements(script string) []string {
+	statements := []string{}
+	var b strings.Builder
+	for _, line := range strings.Split(script, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "--") {
+			continue
+		}
+		b.WriteString(line)
+		b.WriteString("\n")
+		if strings.HasSuffix(trimmed, ";") {
+			if s := strings.TrimSpace(b.String()); s != ";" {
+				statements = append(statements, strings.TrimSuffix(s, ";"))
+			}
+			b.Reset()
+		}
+	}
+	if s := strings.TrimSpace(b.String()); len(s) != 0 {
+		statements = append(statements, s)
+	}
+	return statements
+}
+
+func (s *sqlStore) migrationStatus(ctx context.Context, db execQuerier) ([]Migration, error) {
+	migrations, err := loadMigrations(s.dialect)
+	if err != nil {
+		return nil, err
+	}
+	_, err = db.ExecContext(
+		ctx,
+		`CREATE TABLE IF NOT EXISTS schema_migrations (
+			version INTEGER PRIMARY KEY,
+			name VARCHAR(255) NOT NULL,
+			applied `+s.timestampType()+` DEFAULT CURRENT_TIMESTAMP NOT NULL
+		)`,
+	)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := db.QueryContext(ctx, "SELECT version, name, applied FROM schema_migrations ORDER BY version")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var applied Migration
+		if err := rows.Scan(&applied.Version, &applied.Name, &applied.Applied); err != nil {
+			return nil, err
+		}
+		if applied.Version > len(migrations) {
+			applied.Unknown = true
+			migrations = append(migrations, applied)
+			continue
+		}
+		migrations[applied.Version-1].Applied = applied.Applied
+	}
+	return migrations, rows.Err()
+}
+
+func (s *sqlStore) timestampType() string {
+	if s.dialect == "sqlite" {
+		return "TEXT"
+	}
+	return "TIMESTAMP"
+}
+
+// withMigrationLock은 다른 인스턴스가 동시에 마이그레이션하지 못하게 막고 fn을 실행한다.
+// MySQL은 GET_LOCK 권고 잠금을 쓰고, DDL이 트랜잭션에 묶이지 않으므로 마이그레이션마다
+// 따로 기록한다. SQLite는 BEGIN IMMEDIATE로 쓰기 잠금을 잡고 전체를 한 트랜잭션으로 실행한다.
+func (s *sqlStore) withMigrationLock(ctx context.Context, fn func(db execQuerier) error) error {
+	conn, err := s.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if s.dialect == "sqlite" {
+		tx, err := conn.BeginTx(ctx, nil)
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+		if err := fn(tx); err != nil {
+			return err
+		}
+		return tx.Commit()
+	}
+
+	var locked sql.NullInt64
+	err = conn.QueryRowContext(
+		ctx, "SELECT GET_LOCK(?, ?)", migrationLock, migrationLockTimeout,
+	).Scan(&locked)
+	if err != nil {
+		return err
+	}
+	if locked.Int64 != 1 {
+		return fmt.Errorf("timed out waiting for the migration lock %s", migrationLock)
+	}
+	defer conn.ExecContext(context.Background(), "SELECT RELEASE_LOCK(?)", migrationLock)
+	return fn(conn)
+}
+
+func (s *sqlStore) MigrationStatus(ctx context.Context) ([]Migration, error) {
+	var migrations []Migration
+	err := s.withMigrationLock(ctx, func(db execQuerier) error {
+		var err error
+		migrations, err = s.migrationStatus(ctx, db)
+		return err
+	})
+	return migrations, err
+}
+
+func (s *sqlStore) MigrateUp(ctx context.Context, target int) ([]Migration, error) {
+	applied := []Migration{}
+	err := s.withMigrationLock(ctx, func(db execQuerier) error {
+		migrations, err := s.migrationStatus(ctx, db)
+		if err != nil {
+			return err
+		}
+		for _, m := range migrations {
+			if m.Unknown {
+				return fmt.Errorf(
+					"database has migration %d (%s) unknown to this binary", m.Version, m.Name,
+				)
+			}
+		}
+		for _, m := range migrations {
+			if len(m.Applied) != 0 || (target > 0 && m.Version > target) {
+				continue
+			}
+			if err := s.runMigration(ctx, db, m, m.up); err != nil {
+				return err
+			}
+			if hook, ok := migrationHooks[m.Version]; ok {
+				if err := hook(ctx, db); err != nil {
+					return fmt.Errorf("migration %d (%s): %w", m.Version, m.Name, err)
+				}
+			}
+			_, err := db.ExecContext(
+				ctx, "INSERT INTO schema_migrations (version, name) VALUES (?, ?)", m.Version, m.Name,
+			)
+			if err != nil {
+				return err
+			}
+			applied = append(applied, m)
+		}
+		return nil
+	})
+	return applied, err
+}
+
+func (s *sqlStore) MigrateDown(ctx context.Context, steps int) ([]Migration, error) {
+	reverted := []Migration{}
+	err := s.withMigrationLock(ctx, func(db execQuerier) error {
+		migrations, err := s.migrationStatus(ctx, db)
+		if err != nil {
+			return err
+		}
+		sort.Slice(migrations, func(i, j int) bool {
+			return migrations[i].Version > migrations[j].Version
+		})
+		for _, m := range migrations {
+			if len(reverted) == steps {
+				break
+			}
+			if len(m.Applied) == 0 {
+				continue
+			}
+			if m.Unknown {
+				return fmt.Errorf(
+					"cannot revert migration %d (%s) unknown to this binary", m.Version, m.Name,
+				)
+			}
+			if err := s.runMigration(ctx, db, m, m.down); err != nil {
+				return err
+			}
+			_, err := db.ExecContext(ctx, "DELETE FROM schema_migrations WHERE version=?", m.Version)
+			if err != nil {
+				return err
+			}
+			reverted = append(reverted, m)
+		}
+		return nil
+	})
+	return reverted, err
+}
+
+func (s *sqlStore) runMigration(ctx context.Context, db execQuerier, m Migration, script string) error {
+	for _, statement := range splitStatements(script) {
+		if _, err := db.ExecContext(ctx, statement); err != nil {
+			return fmt.Errorf("migration %d (%s): %w", m.Version, m.Name, err)
+		}
+	}
+	return nil
+}
+
+// backfillVersionKeys는 version_key가 없던 기존 행의 키를 채운다.
+// SemVer가 아닌 버전이 있으면 운영자가 고치거나 지울 수 있도록 실패한다.
+func backfillVersionKeys(ctx context.Context, db execQuerier) error {
+	rows, err := db.QueryContext(
+		ctx, "SELECT owner_id, name, version FROM packages WHERE version_key IS NULL",
+	)
+	if err != nil {
+		return err
+	}
+	pkgs := []Package{}
+	for rows.Next() {
+		var p Package
+		if err := rows.Scan(&p.OwnerId, &p.Name, &p.Version); err != nil {
+			rows.Close()
+			return err
+		}
+		pkgs = append(pkgs, p)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, p := range pkgs {
+		key, err := versionKey(p.Version)
+		if err != nil {
+			return fmt.Errorf("package %d/%s has invalid version %q: %w", p.OwnerId, p.Name, p.Version, err)
+		}
+		_, err = db.ExecContext(
+			ctx,
+			"UPDATE packages SET version_key=? WHERE owner_id=? AND name=? AND version=?",
+			key, p.OwnerId, p.Name, p.Version,
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
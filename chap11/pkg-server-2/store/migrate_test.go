@@ -0,0 +1,150 @@
+package store
+
+import (
+	"context"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestLoadMigrations(t *testing.T) {
+	names := map[string][]string{}
+	for _, dialect := range []string{"mysql", "sqlite"} {
+		migrations, err := loadMigrations(dialect)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, m := range migrations {
+			names[dialect] = append(names[dialect], m.Name)
+		}
+	}
+	// 두 방언의 버전 번호는 같은 변경을 가리켜야 한다
+	if !reflect.DeepEqual(names["mysql"], names["sqlite"]) {
+		t.Errorf("Expected the same migrations for mysql and sqlite, Got: %v, %v", names["mysql"], names["sqlite"])
+	}
+}
+
+func TestSplitStatements(t *testing.T) {
+	script := `-- comment;
+CREATE TABLE a (
+    id INT
+);
+
+ALTER TABLE a ADD COLUMN b INT;
+INSERT INTO a VALUES (1)`
+	expected := []string{
+		"CREATE TABLE a (\n    id INT\n)",
+		"ALTER TABLE a ADD COLUMN b INT",
+		"INSERT INTO a VALUES (1)",
+	}
+	if got := splitStatements(script); !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected %q, Got: %q", expected, got)
+	}
+}
+
+func openSQLiteMigrator(t *testing.T) (*sqlStore, Migrator) {
+	s, err := OpenSQLite(filepath.Join(t.TempDir(), "packages.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s.(*sqlStore), s.(Migrator)
+}
+
+func TestSQLiteMigrations(t *testing.T) {
+	ctx := context.Background()
+	_, m := openSQLiteMigrator(t)
+
+	status, err := m.MigrationStatus(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	total := len(status)
+	if Pending(status) != total {
+		t.Fatalf("Expected %d pending migrations, Got: %d", total, Pending(status))
+	}
+
+	applied, err := m.MigrateUp(ctx, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(applied) != 2 {
+		t.Fatalf("Expected 2 migrations applied, Got: %d", len(applied))
+	}
+	if applied, err = m.MigrateUp(ctx, 0); err != nil || len(applied) != total-2 {
+		t.Fatalf("Expected %d migrations applied, Got: %d, %v", total-2, len(applied), err)
+	}
+	if applied, err = m.MigrateUp(ctx, 0); err != nil || len(applied) != 0 {
+		t.Fatalf("Expected no migrations applied, Got: %d, %v", len(applied), err)
+	}
+	status, err = m.MigrationStatus(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range status {
+		if len(s.Applied) != len(TimeFormat) {
+			t.Errorf("Expected migration %d to be applied, Got: %#v", s.Version, s)
+		}
+	}
+
+	// 모두 되돌린 뒤 다시 적용할 수 있어야 한다
+	reverted, err := m.MigrateDown(ctx, total)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reverted) != total || reverted[0].Version != total {
+		t.Fatalf("Expected %d migrations reverted from the latest, Got: %#v", total, reverted)
+	}
+	if reverted, err = m.MigrateDown(ctx, 1); err != nil || len(reverted) != 0 {
+		t.Fatalf("Expected no migrations reverted, Got: %d, %v", len(reverted), err)
+	}
+	if _, err = m.MigrateUp(ctx, 0); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// 버전 키가 없던 예전 스키마의 데이터는 마이그레이션이 키를 채워야 한다.
+func TestSQLiteMigrationBackfill(t *testing.T) {
+	ctx := context.Background()
+	s, m := openSQLiteMigrator(t)
+	if _, err := m.MigrateUp(ctx, 2); err != nil {
+		t.Fatal(err)
+	}
+	_, err := s.db.Exec(`INSERT INTO users (username) VALUES ('joe_cool');
+		INSERT INTO packages (owner_id, name, version, object_store_id) VALUES
+		(1, 'pkg', '1.10.0', 'a'), (1, 'pkg', '1.9.0', 'b')`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.MigrateUp(ctx, 0); err != nil {
+		t.Fatal(err)
+	}
+	pkgs, err := s.QueryPackages(ctx, QueryParams{OwnerId: 1, Sort: SortVersion})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pkgs) != 2 || pkgs[0].Version != "1.9.0" || pkgs[1].Version != "1.10.0" {
+		t.Errorf("Expected backfilled versions in precedence order, Got: %#v", pkgs)
+	}
+
+	// SemVer가 아닌 버전이 있으면 실패하고 SQLite는 아무것도 적용하지 않는다
+	s, m = openSQLiteMigrator(t)
+	if _, err := m.MigrateUp(ctx, 2); err != nil {
+		t.Fatal(err)
+	}
+	_, err = s.db.Exec(`INSERT INTO users (username) VALUES ('joe_cool');
+		INSERT INTO packages (owner_id, name, version, object_store_id) VALUES (1, 'pkg', 'v1', 'a')`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.MigrateUp(ctx, 0); err == nil {
+		t.Fatal("Expected migration to fail for invalid version")
+	}
+	status, err := m.MigrationStatus(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if Pending(status) != len(status)-2 {
+		t.Errorf("Expected failed migrations to be rolled back, Got: %#v", status)
+	}
+}
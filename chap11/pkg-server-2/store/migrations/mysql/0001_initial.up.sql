@@ -0,0 +1,17 @@
+-- mysql-init로 만든 기존 데이터베이스에도 적용할 수 있도록 IF NOT EXISTS를 쓴다.
+CREATE TABLE IF NOT EXISTS users (
+    id INT PRIMARY KEY AUTO_INCREMENT,
+    username VARCHAR(30) NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS packages(
+    owner_id INT NOT NULL,
+    name VARCHAR(100) NOT NULL,
+    version VARCHAR(50) NOT NULL,
+    object_store_id VARCHAR(300) NOT NULL,
+    created TIMESTAMP DEFAULT CURRENT_TIMESTAMP NOT NULL,
+    PRIMARY KEY (owner_id, name, version),
+    FOREIGN KEY (owner_id)
+        REFERENCES users(id)
+        ON DELETE CASCADE
+);
@@ -0,0 +1,14 @@
+CREATE TABLE api_tokens(
+    id INT PRIMARY KEY AUTO_INCREMENT,
+    user_id INT NOT NULL,
+    name VARCHAR(100) NOT NULL,
+    token_hash CHAR(64) NOT NULL,
+    scopes VARCHAR(100) NOT NULL,
+    created TIMESTAMP DEFAULT CURRENT_TIMESTAMP NOT NULL,
+    last_used TIMESTAMP NULL,
+    revoked TIMESTAMP NULL,
+    UNIQUE (token_hash),
+    FOREIGN KEY (user_id)
+        REFERENCES users(id)
+        ON DELETE CASCADE
+);
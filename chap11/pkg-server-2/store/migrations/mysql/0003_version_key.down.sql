@@ -0,0 +1,3 @@
+ALTER TABLE packages
+    DROP COLUMN version_key,
+    MODIFY name VARCHAR(100) NOT NULL;
@@ -0,0 +1,5 @@
+-- 기존 행의 version_key는 이 마이그레이션 뒤에 Go 코드로 채운다.
+-- 이름 비교와 LIKE가 대소문자를 구분하도록 name의 콜레이션도 바꾼다.
+ALTER TABLE packages
+    MODIFY name VARCHAR(100) COLLATE utf8mb4_bin NOT NULL,
+    ADD COLUMN version_key VARBINARY(1024) NULL;
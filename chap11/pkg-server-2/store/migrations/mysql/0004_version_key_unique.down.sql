@@ -0,0 +1,3 @@
+ALTER TABLE packages
+    DROP INDEX packages_version_key,
+    MODIFY version_key VARBINARY(1024) NULL;
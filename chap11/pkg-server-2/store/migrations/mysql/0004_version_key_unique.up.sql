@@ -0,0 +1,3 @@
+ALTER TABLE packages
+    MODIFY version_key VARBINARY(1024) NOT NULL,
+    ADD CONSTRAINT packages_version_key UNIQUE (owner_id, name, version_key);
@@ -0,0 +1,3 @@
+ALTER TABLE packages
+    DROP COLUMN sha256,
+    DROP COLUMN sha512;
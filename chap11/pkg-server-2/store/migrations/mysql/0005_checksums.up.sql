@@ -0,0 +1,3 @@
+ALTER TABLE packages
+    ADD COLUMN sha256 CHAR(64) DEFAULT '' NOT NULL,
+    ADD COLUMN sha512 CHAR(128) DEFAULT '' NOT NULL;
@@ -0,0 +1,6 @@
+ALTER TABLE packages ADD COLUMN yanked TIMESTAMP NULL;
+
+CREATE TABLE deleted_objects(
+    object_store_id VARCHAR(300) PRIMARY KEY,
+    deleted TIMESTAMP DEFAULT CURRENT_TIMESTAMP NOT NULL
+);
@@ -0,0 +1,2 @@
+DROP TABLE search_terms;
+DROP TABLE package_metadata;
@@ -0,0 +1,28 @@
+CREATE TABLE package_metadata(
+    owner_id INT NOT NULL,
+    name VARCHAR(100) COLLATE utf8mb4_bin NOT NULL,
+    version_key VARBINARY(1024) NOT NULL,
+    description TEXT NOT NULL,
+    license VARCHAR(100) NOT NULL,
+    homepage VARCHAR(300) NOT NULL,
+    keywords VARCHAR(1100) NOT NULL,
+    readme MEDIUMTEXT NOT NULL,
+    PRIMARY KEY (owner_id, name, version_key),
+    FOREIGN KEY (owner_id, name, version_key)
+        REFERENCES packages(owner_id, name, version_key)
+        ON DELETE CASCADE
+);
+
+-- 검색용 역색인. 토큰은 store.Tokenize가 만든 소문자 문자열이다.
+CREATE TABLE search_terms(
+    term VARCHAR(64) COLLATE utf8mb4_bin NOT NULL,
+    owner_id INT NOT NULL,
+    name VARCHAR(100) COLLATE utf8mb4_bin NOT NULL,
+    version_key VARBINARY(1024) NOT NULL,
+    field VARCHAR(20) NOT NULL,
+    frequency INT NOT NULL,
+    PRIMARY KEY (term, owner_id, name, version_key, field),
+    FOREIGN KEY (owner_id, name, version_key)
+        REFERENCES packages(owner_id, name, version_key)
+        ON DELETE CASCADE
+);
@@ -0,0 +1,11 @@
+-- 패키지를 지워도 통계는 남도록 packages를 참조하지 않는다.
+CREATE TABLE download_counts(
+    owner_id INT NOT NULL,
+    name VARCHAR(100) COLLATE utf8mb4_bin NOT NULL,
+    version_key VARBINARY(1024) NOT NULL,
+    version VARCHAR(50) NOT NULL,
+    day DATE NOT NULL,
+    downloads BIGINT NOT NULL,
+    PRIMARY KEY (owner_id, name, version_key, day),
+    INDEX download_counts_day (day)
+);
@@ -0,0 +1,2 @@
+-- Go 모듈로 게시한 버전의 go.mod. 다른 패키지는 빈 문자열이다.
+ALTER TABLE package_metadata ADD COLUMN go_mod MEDIUMTEXT NOT NULL;
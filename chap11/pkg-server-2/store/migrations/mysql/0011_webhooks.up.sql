@@ -0,0 +1,43 @@
+-- 시크릿은 서명을 만들어야 하므로 해시가 아니라 원문으로 저장한다.
+CREATE TABLE webhooks(
+    id INT PRIMARY KEY AUTO_INCREMENT,
+    owner_id INT NOT NULL,
+    name VARCHAR(100) COLLATE utf8mb4_bin NOT NULL,
+    url VARCHAR(2000) NOT NULL,
+    secret VARCHAR(200) NOT NULL,
+    events VARCHAR(200) NOT NULL,
+    created TIMESTAMP DEFAULT CURRENT_TIMESTAMP NOT NULL,
+    INDEX webhooks_owner (owner_id),
+    FOREIGN KEY (owner_id)
+        REFERENCES users(id)
+        ON DELETE CASCADE
+);
+
+CREATE TABLE webhook_deliveries(
+    id INT PRIMARY KEY AUTO_INCREMENT,
+    webhook_id INT NOT NULL,
+    event VARCHAR(50) NOT NULL,
+    payload MEDIUMTEXT NOT NULL,
+    status VARCHAR(20) NOT NULL,
+    attempts INT NOT NULL,
+    next_attempt TIMESTAMP NULL,
+    created TIMESTAMP DEFAULT CURRENT_TIMESTAMP NOT NULL,
+    INDEX webhook_deliveries_due (status, next_attempt),
+    FOREIGN KEY (webhook_id)
+        REFERENCES webhooks(id)
+        ON DELETE CASCADE
+);
+
+CREATE TABLE webhook_attempts(
+    delivery_id INT NOT NULL,
+    attempt INT NOT NULL,
+    status_code INT NOT NULL,
+    response TEXT NOT NULL,
+    error TEXT NOT NULL,
+    duration_ms BIGINT NOT NULL,
+    created TIMESTAMP DEFAULT CURRENT_TIMESTAMP NOT NULL,
+    PRIMARY KEY (delivery_id, attempt),
+    FOREIGN KEY (delivery_id)
+        REFERENCES webhook_deliveries(id)
+        ON DELETE CASCADE
+);
@@ -0,0 +1,19 @@
+-- 게시 중인 행과 같은 버전을 가리키지만, 서명된 URL의 만료 시각과 클라이언트가 알린
+-- 크기와 체크섬은 업로드에만 있으므로 따로 저장한다.
+CREATE TABLE uploads(
+    id CHAR(32) PRIMARY KEY,
+    owner_id INT NOT NULL,
+    name VARCHAR(100) COLLATE utf8mb4_bin NOT NULL,
+    version VARCHAR(50) NOT NULL,
+    object_store_id VARCHAR(300) NOT NULL,
+    staging_key VARCHAR(300) NOT NULL,
+    size BIGINT NOT NULL,
+    sha256 CHAR(64) NOT NULL,
+    manifest MEDIUMTEXT NOT NULL,
+    expires TIMESTAMP NOT NULL,
+    created TIMESTAMP DEFAULT CURRENT_TIMESTAMP NOT NULL,
+    INDEX uploads_expires (expires),
+    FOREIGN KEY (owner_id)
+        REFERENCES users(id)
+        ON DELETE CASCADE
+);
@@ -0,0 +1,14 @@
+-- 의존하는 패키지는 나중에 지워질 수 있으므로 dep_owner_id, dep_name에는 외래 키를 걸지 않는다.
+CREATE TABLE package_dependencies(
+    owner_id INT NOT NULL,
+    name VARCHAR(100) COLLATE utf8mb4_bin NOT NULL,
+    version_key VARBINARY(1024) NOT NULL,
+    dep_owner_id INT NOT NULL,
+    dep_name VARCHAR(100) COLLATE utf8mb4_bin NOT NULL,
+    version_constraint VARCHAR(200) NOT NULL,
+    PRIMARY KEY (owner_id, name, version_key, dep_owner_id, dep_name),
+    INDEX package_dependencies_dep (dep_owner_id, dep_name),
+    FOREIGN KEY (owner_id, name, version_key)
+        REFERENCES packages(owner_id, name, version_key)
+        ON DELETE CASCADE
+);
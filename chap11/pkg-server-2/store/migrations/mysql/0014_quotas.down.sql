@@ -0,0 +1,2 @@
+DROP TABLE owner_limits;
+ALTER TABLE packages DROP COLUMN size;
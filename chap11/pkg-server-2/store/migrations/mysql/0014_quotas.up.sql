@@ -0,0 +1,14 @@
+-- 이 마이그레이션 이전에 게시한 버전의 크기는 0으로 남는다.
+ALTER TABLE packages ADD COLUMN size BIGINT NOT NULL DEFAULT 0;
+
+-- 관리자가 소유자에게 따로 정한 한도. 0은 서버 기본값, -1은 제한 없음이다.
+CREATE TABLE owner_limits(
+    owner_id INT PRIMARY KEY,
+    max_storage BIGINT NOT NULL,
+    max_package_size BIGINT NOT NULL,
+    publishes_per_hour INT NOT NULL,
+    updated TIMESTAMP DEFAULT CURRENT_TIMESTAMP NOT NULL,
+    FOREIGN KEY (owner_id)
+        REFERENCES users(id)
+        ON DELETE CASCADE
+);
@@ -0,0 +1,18 @@
+-- created 같은 시각 컬럼을 TEXT로 두어야 드라이버가 time.Time으로 바꾸지 않고
+-- MySQL과 같은 형식의 문자열을 돌려준다.
+CREATE TABLE IF NOT EXISTS users (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    username TEXT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS packages(
+    owner_id INTEGER NOT NULL,
+    name TEXT NOT NULL,
+    version TEXT NOT NULL,
+    object_store_id TEXT NOT NULL,
+    created TEXT DEFAULT CURRENT_TIMESTAMP NOT NULL,
+    PRIMARY KEY (owner_id, name, version),
+    FOREIGN KEY (owner_id)
+        REFERENCES users(id)
+        ON DELETE CASCADE
+);
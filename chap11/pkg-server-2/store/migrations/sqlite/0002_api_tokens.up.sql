@@ -0,0 +1,13 @@
+CREATE TABLE api_tokens(
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL,
+    name TEXT NOT NULL,
+    token_hash TEXT NOT NULL UNIQUE,
+    scopes TEXT NOT NULL,
+    created TEXT DEFAULT CURRENT_TIMESTAMP NOT NULL,
+    last_used TEXT NULL,
+    revoked TEXT NULL,
+    FOREIGN KEY (user_id)
+        REFERENCES users(id)
+        ON DELETE CASCADE
+);
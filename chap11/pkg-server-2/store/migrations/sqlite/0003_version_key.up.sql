@@ -0,0 +1,2 @@
+-- 기존 행의 version_key는 이 마이그레이션 뒤에 Go 코드로 채운다.
+ALTER TABLE packages ADD COLUMN version_key TEXT NULL;
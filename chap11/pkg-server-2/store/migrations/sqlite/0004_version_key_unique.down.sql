@@ -0,0 +1 @@
+DROP INDEX packages_version_key;
@@ -0,0 +1,2 @@
+-- SQLite는 기존 컬럼에 NOT NULL을 붙일 수 없으므로 고유 인덱스만 만든다.
+CREATE UNIQUE INDEX packages_version_key ON packages(owner_id, name, version_key);
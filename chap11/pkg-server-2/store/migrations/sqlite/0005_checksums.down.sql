@@ -0,0 +1,2 @@
+ALTER TABLE packages DROP COLUMN sha256;
+ALTER TABLE packages DROP COLUMN sha512;
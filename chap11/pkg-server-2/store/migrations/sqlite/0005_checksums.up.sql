@@ -0,0 +1,2 @@
+ALTER TABLE packages ADD COLUMN sha256 TEXT DEFAULT '' NOT NULL;
+ALTER TABLE packages ADD COLUMN sha512 TEXT DEFAULT '' NOT NULL;
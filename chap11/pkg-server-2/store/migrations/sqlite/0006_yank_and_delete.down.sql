@@ -0,0 +1,3 @@
+DROP TABLE deleted_objects;
+
+ALTER TABLE packages DROP COLUMN yanked;
@@ -0,0 +1,6 @@
+ALTER TABLE packages ADD COLUMN yanked TEXT NULL;
+
+CREATE TABLE deleted_objects(
+    object_store_id TEXT PRIMARY KEY,
+    deleted TEXT DEFAULT CURRENT_TIMESTAMP NOT NULL
+);
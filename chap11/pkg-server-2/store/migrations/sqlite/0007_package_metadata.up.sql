@@ -0,0 +1,27 @@
+CREATE TABLE package_metadata(
+    owner_id INTEGER NOT NULL,
+    name TEXT NOT NULL,
+    version_key TEXT NOT NULL,
+    description TEXT NOT NULL,
+    license TEXT NOT NULL,
+    homepage TEXT NOT NULL,
+    keywords TEXT NOT NULL,
+    readme TEXT NOT NULL,
+    PRIMARY KEY (owner_id, name, version_key),
+    FOREIGN KEY (owner_id, name, version_key)
+        REFERENCES packages(owner_id, name, version_key)
+        ON DELETE CASCADE
+);
+
+CREATE TABLE search_terms(
+    term TEXT NOT NULL,
+    owner_id INTEGER NOT NULL,
+    name TEXT NOT NULL,
+    version_key TEXT NOT NULL,
+    field TEXT NOT NULL,
+    frequency INTEGER NOT NULL,
+    PRIMARY KEY (term, owner_id, name, version_key, field),
+    FOREIGN KEY (owner_id, name, version_key)
+        REFERENCES packages(owner_id, name, version_key)
+        ON DELETE CASCADE
+);
@@ -0,0 +1 @@
+ALTER TABLE packages DROP COLUMN staging_key;
@@ -0,0 +1,2 @@
+-- staging_key가 있는 행은 게시 중인 버전이다. 객체는 아직 staging_key에 있다.
+ALTER TABLE packages ADD COLUMN staging_key TEXT NULL;
@@ -0,0 +1,12 @@
+-- 패키지를 지워도 통계는 남도록 packages를 참조하지 않는다.
+CREATE TABLE download_counts(
+    owner_id INTEGER NOT NULL,
+    name TEXT NOT NULL,
+    version_key TEXT NOT NULL,
+    version TEXT NOT NULL,
+    day TEXT NOT NULL,
+    downloads INTEGER NOT NULL,
+    PRIMARY KEY (owner_id, name, version_key, day)
+);
+
+CREATE INDEX download_counts_day ON download_counts(day);
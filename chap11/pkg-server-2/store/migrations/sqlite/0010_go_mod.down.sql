@@ -0,0 +1 @@
+ALTER TABLE package_metadata DROP COLUMN go_mod;
@@ -0,0 +1 @@
+ALTER TABLE package_metadata ADD COLUMN go_mod TEXT DEFAULT '' NOT NULL;
@@ -0,0 +1,43 @@
+CREATE TABLE webhooks(
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    owner_id INTEGER NOT NULL,
+    name TEXT NOT NULL,
+    url TEXT NOT NULL,
+    secret TEXT NOT NULL,
+    events TEXT NOT NULL,
+    created TEXT DEFAULT CURRENT_TIMESTAMP NOT NULL,
+    FOREIGN KEY (owner_id)
+        REFERENCES users(id)
+        ON DELETE CASCADE
+);
+CREATE INDEX webhooks_owner ON webhooks(owner_id);
+
+CREATE TABLE webhook_deliveries(
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    webhook_id INTEGER NOT NULL,
+    event TEXT NOT NULL,
+    payload TEXT NOT NULL,
+    status TEXT NOT NULL,
+    attempts INTEGER NOT NULL,
+    next_attempt TEXT NULL,
+    created TEXT DEFAULT CURRENT_TIMESTAMP NOT NULL,
+    FOREIGN KEY (webhook_id)
+        REFERENCES webhooks(id)
+        ON DELETE CASCADE
+);
+CREATE INDEX webhook_deliveries_due ON webhook_deliveries(status, next_attempt);
+CREATE INDEX webhook_deliveries_webhook ON webhook_deliveries(webhook_id);
+
+CREATE TABLE webhook_attempts(
+    delivery_id INTEGER NOT NULL,
+    attempt INTEGER NOT NULL,
+    status_code INTEGER NOT NULL,
+    response TEXT NOT NULL,
+    error TEXT NOT NULL,
+    duration_ms INTEGER NOT NULL,
+    created TEXT DEFAULT CURRENT_TIMESTAMP NOT NULL,
+    PRIMARY KEY (delivery_id, attempt),
+    FOREIGN KEY (delivery_id)
+        REFERENCES webhook_deliveries(id)
+        ON DELETE CASCADE
+);
@@ -0,0 +1,17 @@
+CREATE TABLE uploads(
+    id TEXT PRIMARY KEY,
+    owner_id INTEGER NOT NULL,
+    name TEXT NOT NULL,
+    version TEXT NOT NULL,
+    object_store_id TEXT NOT NULL,
+    staging_key TEXT NOT NULL,
+    size INTEGER NOT NULL,
+    sha256 TEXT NOT NULL,
+    manifest TEXT NOT NULL,
+    expires TEXT NOT NULL,
+    created TEXT DEFAULT CURRENT_TIMESTAMP NOT NULL,
+    FOREIGN KEY (owner_id)
+        REFERENCES users(id)
+        ON DELETE CASCADE
+);
+CREATE INDEX uploads_expires ON uploads(expires);
@@ -0,0 +1,13 @@
+CREATE TABLE package_dependencies(
+    owner_id INTEGER NOT NULL,
+    name TEXT NOT NULL,
+    version_key TEXT NOT NULL,
+    dep_owner_id INTEGER NOT NULL,
+    dep_name TEXT NOT NULL,
+    version_constraint TEXT NOT NULL,
+    PRIMARY KEY (owner_id, name, version_key, dep_owner_id, dep_name),
+    FOREIGN KEY (owner_id, name, version_key)
+        REFERENCES packages(owner_id, name, version_key)
+        ON DELETE CASCADE
+);
+CREATE INDEX package_dependencies_dep ON package_dependencies(dep_owner_id, dep_name);
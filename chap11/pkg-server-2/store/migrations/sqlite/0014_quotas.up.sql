@@ -0,0 +1,12 @@
+ALTER TABLE packages ADD COLUMN size INTEGER DEFAULT 0 NOT NULL;
+
+CREATE TABLE owner_limits(
+    owner_id INTEGER PRIMARY KEY,
+    max_storage INTEGER NOT NULL,
+    max_package_size INTEGER NOT NULL,
+    publishes_per_hour INTEGER NOT NULL,
+    updated TEXT DEFAULT CURRENT_TIMESTAMP NOT NULL,
+    FOREIGN KEY (owner_id)
+        REFERENCES users(id)
+        ON DELETE CASCADE
+);
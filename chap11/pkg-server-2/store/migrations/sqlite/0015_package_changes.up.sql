@@ -0,0 +1,10 @@
+-- 패키지의 버전을 마지막으로 게시, 회수, 삭제한 시각. 삭제한 버전은 행이 남지 않으므로 따로 기록한다.
+-- 이전에 바뀐 시각은 알 수 없으므로 기존 패키지는 마이그레이션한 시각으로 채운다.
+CREATE TABLE package_changes(
+    owner_id INTEGER NOT NULL,
+    name TEXT NOT NULL,
+    modified TEXT DEFAULT CURRENT_TIMESTAMP NOT NULL,
+    PRIMARY KEY (owner_id, name)
+);
+INSERT INTO package_changes (owner_id, name)
+    SELECT DISTINCT owner_id, name FROM packages WHERE staging_key IS NULL;
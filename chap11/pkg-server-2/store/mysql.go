@@ -0,0 +1,35 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// 스키마는 MigrateUp으로 만든다.
+// 다른 백엔드와 같은 시각을 돌려주도록 세션 시간대를 UTC로 맞추고,
+// 값이 바뀌지 않은 UPDATE도 일치한 행 수를 돌려주도록 clientFoundRows를 켠다.
+func OpenMySQL(addr, name, user, password string) (PackageStore, error) {
+	dsn := fmt.Sprintf(
+		"%s:%s@tcp(%s)/%s?time_zone=%%27%%2B00%%3A00%%27&clientFoundRows=true",
+		user, password,
+		addr, name,
+	)
+	db, err := sql.Open("mysql", dsn)
+	if err != nil {
+		return nil, err
+	}
+	if err = db.Ping(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("ping failed: %w", err)
+	}
+	return &sqlStore{db: db, isDuplicate: isMySQLDuplicate, dialect: "mysql"}, nil
+}
+
+func isMySQLDuplicate(err error) bool {
+	var mysqlErr *mysql.MySQLError
+	// ER_DUP_ENTRY
+	return errors.As(err, &mysqlErr) && mysqlErr.Number == 1062
+}
@@ -0,0 +1,99 @@
+package store
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/docker/go-connections/nat"
+	"github.com/testcontainers/testcontainers-go"
+	"github.com/testcontainers/testcontainers-go/wait"
+)
+
+// startMySQL은 mysql-init 스크립트로 초기화한 MySQL 컨테이너를 시작하고 주소를 돌려준다.
+// Docker를 쓸 수 없는 환경에서는 테스트를 건너뛴다.
+func startMySQL(t *testing.T) string {
+	testcontainers.SkipIfProviderIsNotHealthy(t)
+
+	initDir, err := filepath.Abs(filepath.Join("..", "mysql-init"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(initDir); err != nil {
+		t.Fatal(err)
+	}
+
+	waitForSql := wait.ForSQL("3306/tcp", "mysql", func(host string, p nat.Port) string {
+		return "root:rootpw@tcp(127.0.0.1:" + p.Port() + ")/package_server"
+	})
+	waitForSql.WithPollInterval(5 * time.Second)
+	waitForSql.WithStartupTimeout(1 * time.Minute)
+
+	req := testcontainers.ContainerRequest{
+		Image:        "mysql:latest",
+		ExposedPorts: []string{"3306/tcp"},
+		Env: map[string]string{
+			"MYSQL_DATABASE":      "package_server",
+			"MYSQL_USER":          "packages_rw",
+			"MYSQL_PASSWORD":      "password",
+			"MYSQL_ROOT_PASSWORD": "rootpw",
+		},
+		ImagePlatform: "linux/x86_64",
+		Files: []testcontainers.ContainerFile{
+			{
+				HostFilePath:      initDir,
+				ContainerFilePath: "/docker-entrypoint-initdb.d",
+				FileMode:          0o777,
+			},
+		},
+		WaitingFor: waitForSql,
+	}
+	ctx := context.Background()
+	mysqlC, err := testcontainers.GenericContainer(
+		ctx,
+		testcontainers.GenericContainerRequest{
+			ContainerRequest: req,
+			Started:          true,
+		},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { mysqlC.Terminate(context.Background()) })
+
+	addr, err := mysqlC.PortEndpoint(ctx, "3306", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return addr
+}
+
+// 하위 테스트마다 컨테이너를 새로 띄우면 너무 느리므로 테이블을 비워서 재사용한다.
+// mysql-init은 예전 스키마만 만들므로 마이그레이션으로 기존 데이터베이스를 올리는 경로도 함께 확인한다.
+func TestMySQLStore(t *testing.T) {
+	addr := startMySQL(t)
+	s, err := OpenMySQL(addr, "package_server", "root", "rootpw")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.(Migrator).MigrateUp(context.Background(), 0); err != nil {
+		t.Fatal(err)
+	}
+	s.Close()
+
+	testPackageStore(t, func(t *testing.T) PackageStore {
+		s, err := OpenMySQL(addr, "package_server", "root", "rootpw")
+		if err != nil {
+			t.Fatal(err)
+		}
+		db := s.(*sqlStore).db
+		for _, table := range []string{"owner_limits", "uploads", "webhook_attempts", "webhook_deliveries", "webhooks", "api_tokens", "deleted_objects", "search_terms", "package_dependencies", "package_metadata", "packages", "users", "download_counts"} {
+			if _, err := db.Exec("DELETE FROM " + table); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return s
+	})
+}
@@ -0,0 +1,28 @@
+package store
+
+// Usage는 소유자가 쓰고 있는 저장 공간과 최근 게시 수다.
+type Usage struct {
+	OwnerId     int   `json:"owner_id"`
+	StoredBytes int64 `json:"stored_bytes"`
+	Versions    int   `json:"versions"`
+	// Publishes는 since 이후 게시했거나 게시 중인 버전의 수다.
+	Publishes int `json:"publishes"`
+	// FirstPublish는 Publishes에 센 버전 중 가장 이른 시각이다. 없으면 비어 있다.
+	FirstPublish string `json:"first_publish,omitempty"`
+}
+
+// 한도의 특별한 값
+const (
+	LimitDefault   = 0
+	LimitUnlimited = -1
+)
+
+// Limits는 관리자가 소유자에게 따로 정한 한도다. 필드가 LimitDefault면 서버 기본값을,
+// LimitUnlimited면 제한 없음을 쓴다.
+type Limits struct {
+	OwnerId          int    `json:"owner_id"`
+	MaxStorage       int64  `json:"max_storage"`
+	MaxPackageSize   int64  `json:"max_package_size"`
+	PublishesPerHour int    `json:"publishes_per_hour"`
+	Updated          string `json:"updated"`
+}
@@ -0,0 +1,1152 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// sqlStore는 MySQL과 SQLite가 함께 쓰는 database/sql 구현이다.
+// 두 데이터베이스 모두 ? 플레이스홀더를 쓰므로 쿼리는 대부분 같다.
+type sqlStore struct {
+	db          *sql.DB
+	isDuplicate func(err error) bool
+	// dialect는 마이그레이션 디렉터리 이름이다.
+	dialect string
+}
+
+func (s *sqlStore) AddPackage(ctx context.Context, p Package) error {
+	key, err := versionKey(p.Version)
+	if err != nil {
+		return err
+	}
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(
+		ctx,
+		`INSERT INTO packages (
+			owner_id, name, version, version_key,
+			object_store_id, sha256, sha512, size
+		) VALUES (?,?,?,?,?,?,?,?);`,
+		p.OwnerId, p.Name, p.Version, key,
+		p.ObjectStoreId, p.Sha256, p.Sha512, p.Size,
+	)
+	if err != nil {
+		if s.isDuplicate(err) {
+			return ErrExists
+		}
+		return err
+	}
+	nRows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if nRows != 1 {
+		return fmt.Errorf(
+			"expected 1 row to be inserted, Got: %v",
+			nRows,
+		)
+	}
+	if err := s.touchPackage(ctx, tx, p.OwnerId, p.Name); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *sqlStore) ReservePackage(ctx context.Context, p PendingPackage) error {
+	key, err := versionKey(p.Version)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.ExecContext(
+		ctx,
+		`INSERT INTO packages (owner_id, name, version, version_key, object_store_id, staging_key)
+		VALUES (?,?,?,?,?,?)`,
+		p.OwnerId, p.Name, p.Version, key, p.ObjectStoreId, p.StagingKey,
+	)
+	if s.isDuplicate(err) {
+		return ErrExists
+	}
+	return err
+}
+
+func (s *sqlStore) PublishPackage(ctx context.Context, p Package, m Metadata) error {
+	key, err := versionKey(p.Version)
+	if err != nil {
+		return err
+	}
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(
+		ctx,
+		`UPDATE packages SET staging_key=NULL, sha256=?, sha512=?, size=?, created=CURRENT_TIMESTAMP
+		WHERE owner_id=? AND name=? AND version_key=? AND staging_key IS NOT NULL`,
+		p.Sha256, p.Sha512, p.Size, p.OwnerId, p.Name, key,
+	)
+	if err != nil {
+		return err
+	}
+	nRows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if nRows == 0 {
+		return ErrNotFound
+	}
+	if err := writeMetadata(ctx, tx, m, key); err != nil {
+		return err
+	}
+	if err := s.touchPackage(ctx, tx, p.OwnerId, p.Name); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// touchPackage는 패키지를 바꾼 시각을 기록한다. 버전을 바꾸는 트랜잭션 안에서 호출한다.
+func (s *sqlStore) touchPackage(ctx context.Context, tx execQuerier, ownerId int, name string) error {
+	upsert := "INSERT INTO package_changes (owner_id, name) VALUES (?,?)"
+	if s.dialect == "sqlite" {
+		upsert += " ON CONFLICT (owner_id, name) DO UPDATE SET modified=CURRENT_TIMESTAMP"
+	} else {
+		upsert += " ON DUPLICATE KEY UPDATE modified=CURRENT_TIMESTAMP"
+	}
+	_, err := tx.ExecContext(ctx, upsert, ownerId, name)
+	return err
+}
+
+func (s *sqlStore) AbortPackage(ctx context.Context, ownerId int, name, version string) error {
+	key, err := versionKey(version)
+	if err != nil {
+		return err
+	}
+	result, err := s.db.ExecContext(
+		ctx,
+		`DELETE FROM packages
+		WHERE owner_id=? AND name=? AND version_key=? AND staging_key IS NOT NULL`,
+		ownerId, name, key,
+	)
+	if err != nil {
+		return err
+	}
+	nRows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if nRows == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *sqlStore) PendingPackages(ctx context.Context) ([]PendingPackage, error) {
+	rows, err := s.db.QueryContext(
+		ctx,
+		`SELECT owner_id, name, version, object_store_id, staging_key, created
+		FROM packages WHERE staging_key IS NOT NULL ORDER BY created, owner_id, name, version_key`,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	pkgs := []PendingPackage{}
+	for rows.Next() {
+		var p PendingPackage
+		if err := rows.Scan(
+			&p.OwnerId, &p.Name, &p.Version, &p.ObjectStoreId, &p.StagingKey, &p.Created,
+		); err != nil {
+			return nil, err
+		}
+		pkgs = append(pkgs, p)
+	}
+	return pkgs, rows.Err()
+}
+
+func (s *sqlStore) QueryPackages(ctx context.Context, q QueryParams) ([]Package, error) {
+	if err := q.validate(); err != nil {
+		return nil, err
+	}
+	args := []interface{}{}
+	// 게시 중인 행은 조회하지 않는다
+	conditions := []string{"staging_key IS NULL"}
+	if q.OwnerId != -1 {
+		conditions = append(conditions, "owner_id=?")
+		args = append(args, q.OwnerId)
+	}
+	if len(q.Name) != 0 {
+		conditions = append(conditions, "name=?")
+		args = append(args, q.Name)
+	}
+	if len(q.Version) != 0 {
+		key, err := versionKey(q.Version)
+		if err != nil {
+			return nil, err
+		}
+		conditions = append(conditions, "version_key=?")
+		args = append(args, key)
+	}
+	if len(q.NamePrefix) != 0 {
+		conditions = append(conditions, "name LIKE ? ESCAPE '!'")
+		args = append(args, likePrefix(q.NamePrefix))
+	}
+	if len(q.CreatedAfter) != 0 {
+		conditions = append(conditions, "created>?")
+		args = append(args, q.CreatedAfter)
+	}
+	columns := sortColumns[q.sort()]
+	if q.After != nil {
+		values, err := cursorValues(*q.After, columns)
+		if err != nil {
+			return nil, err
+		}
+		// (a, b) > (?, ?) 형식의 행 값 비교는 MySQL과 SQLite 모두 지원한다
+		conditions = append(conditions, fmt.Sprintf(
+			"(%s) > (%s)",
+			strings.Join(columns, ", "),
+			strings.TrimSuffix(strings.Repeat("?, ", len(columns)), ", "),
+		))
+		args = append(args, values...)
+	}
+
+	query := `SELECT owner_id, name, version, object_store_id, sha256, sha512, size, created, yanked
+		FROM packages WHERE ` + strings.Join(conditions, " AND ")
+	query += " ORDER BY " + strings.Join(columns, ", ")
+	if q.Limit > 0 {
+		query += " LIMIT ?"
+		args = append(args, q.Limit)
+	}
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	pkgResults := []Package{}
+	for rows.Next() {
+		var pkg Package
+		var yanked sql.NullString
+		if err := rows.Scan(
+			&pkg.OwnerId, &pkg.Name, &pkg.Version,
+			&pkg.ObjectStoreId, &pkg.Sha256, &pkg.Sha512, &pkg.Size, &pkg.Created,
+			&yanked,
+		); err != nil {
+			return nil, err
+		}
+		pkg.Yanked = yanked.String
+		pkgResults = append(pkgResults, pkg)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return pkgResults, nil
+}
+
+// likePrefix는 LIKE의 특수 문자를 '!'로 이스케이프한 접두사 패턴을 반환한다.
+func likePrefix(prefix string) string {
+	r := strings.NewReplacer("!", "!!", "%", "!%", "_", "!_")
+	return r.Replace(prefix) + "%"
+}
+
+func cursorValues(c Cursor, columns []string) ([]interface{}, error) {
+	values := []interface{}{}
+	for _, column := range columns {
+		switch column {
+		case "name":
+			values = append(values, c.Name)
+		case "owner_id":
+			values = append(values, c.OwnerId)
+		case "created":
+			values = append(values, c.Created)
+		case "version_key":
+			key, err := versionKey(c.Version)
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, key)
+		}
+	}
+	return values, nil
+}
+
+func (s *sqlStore) YankPackage(ctx context.Context, ownerId int, name, version string) error {
+	key, err := versionKey(version)
+	if err != nil {
+		return err
+	}
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// 이미 회수된 버전도 찾을 수 있도록 yanked는 조건에 넣지 않고 COALESCE로 시각을 유지한다
+	result, err := tx.ExecContext(
+		ctx,
+		`UPDATE packages SET yanked=COALESCE(yanked, CURRENT_TIMESTAMP)
+		WHERE owner_id=? AND name=? AND version_key=? AND staging_key IS NULL`,
+		ownerId, name, key,
+	)
+	if err != nil {
+		return err
+	}
+	nRows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if nRows == 0 {
+		return ErrNotFound
+	}
+	if err := s.touchPackage(ctx, tx, ownerId, name); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *sqlStore) PackagesModified(ctx context.Context, ownerId int, name string) (string, error) {
+	query := "SELECT MAX(modified) FROM package_changes WHERE (?=-1 OR owner_id=?) AND (?='' OR name=?)"
+	modified := sql.NullString{}
+	err := s.db.QueryRowContext(ctx, query, ownerId, ownerId, name, name).Scan(&modified)
+	return modified.String, err
+}
+
+func (s *sqlStore) DeletePackage(ctx context.Context, ownerId int, name, version string) (Package, error) {
+	key, err := versionKey(version)
+	if err != nil {
+		return Package{}, err
+	}
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return Package{}, err
+	}
+	defer tx.Rollback()
+
+	p := Package{OwnerId: ownerId, Name: name}
+	err = tx.QueryRowContext(
+		ctx,
+		`SELECT version, object_store_id FROM packages
+		WHERE owner_id=? AND name=? AND version_key=? AND staging_key IS NULL`,
+		ownerId, name, key,
+	).Scan(&p.Version, &p.ObjectStoreId)
+	if errors.Is(err, sql.ErrNoRows) {
+		return p, ErrNotFound
+	}
+	if err != nil {
+		return p, err
+	}
+	_, err = tx.ExecContext(
+		ctx,
+		"DELETE FROM packages WHERE owner_id=? AND name=? AND version_key=?",
+		ownerId, name, key,
+	)
+	if err != nil {
+		return p, err
+	}
+	_, err = tx.ExecContext(
+		ctx, "DELETE FROM deleted_objects WHERE object_store_id=?", p.ObjectStoreId,
+	)
+	if err != nil {
+		return p, err
+	}
+	_, err = tx.ExecContext(
+		ctx, "INSERT INTO deleted_objects (object_store_id) VALUES (?)", p.ObjectStoreId,
+	)
+	if err != nil {
+		return p, err
+	}
+	if err := s.touchPackage(ctx, tx, ownerId, name); err != nil {
+		return p, err
+	}
+	return p, tx.Commit()
+}
+
+func (s *sqlStore) queryStrings(ctx context.Context, query string) ([]string, error) {
+	rows, err := s.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	results := []string{}
+	for rows.Next() {
+		var v string
+		if err := rows.Scan(&v); err != nil {
+			return nil, err
+		}
+		results = append(results, v)
+	}
+	return results, rows.Err()
+}
+
+func (s *sqlStore) ReferencedObjects(ctx context.Context) ([]string, error) {
+	return s.queryStrings(
+		ctx,
+		`SELECT object_store_id FROM packages
+		UNION SELECT staging_key FROM packages WHERE staging_key IS NOT NULL`,
+	)
+}
+
+func (s *sqlStore) DeletedObjects(ctx context.Context) ([]DeletedObject, error) {
+	rows, err := s.db.QueryContext(
+		ctx, "SELECT object_store_id, deleted FROM deleted_objects ORDER BY deleted",
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	objects := []DeletedObject{}
+	for rows.Next() {
+		var o DeletedObject
+		if err := rows.Scan(&o.ObjectStoreId, &o.Deleted); err != nil {
+			return nil, err
+		}
+		objects = append(objects, o)
+	}
+	return objects, rows.Err()
+}
+
+func (s *sqlStore) PurgeDeletedObject(ctx context.Context, objectStoreId string) error {
+	_, err := s.db.ExecContext(
+		ctx, "DELETE FROM deleted_objects WHERE object_store_id=?", objectStoreId,
+	)
+	return err
+}
+
+func (s *sqlStore) AddUser(ctx context.Context, username string) (int, error) {
+	result, err := s.db.ExecContext(
+		ctx, "INSERT INTO users (username) VALUES (?)", username,
+	)
+	if err != nil {
+		return 0, err
+	}
+	id, err := result.LastInsertId()
+	return int(id), err
+}
+
+func (s *sqlStore) UserExists(ctx context.Context, id int) (bool, error) {
+	var n int
+	err := s.db.QueryRowContext(
+		ctx, "SELECT COUNT(*) FROM users WHERE id=?", id,
+	).Scan(&n)
+	return n == 1, err
+}
+
+func (s *sqlStore) Users(ctx context.Context) ([]User, error) {
+	rows, err := s.db.QueryContext(ctx, "SELECT id, username FROM users ORDER BY id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := []User{}
+	for rows.Next() {
+		u := User{}
+		if err := rows.Scan(&u.Id, &u.Username); err != nil {
+			return nil, err
+		}
+		users = append(users, u)
+	}
+	return users, rows.Err()
+}
+
+func (s *sqlStore) AddToken(ctx context.Context, t Token, tokenHash string) (int, error) {
+	result, err := s.db.ExecContext(
+		ctx,
+		`INSERT INTO api_tokens (user_id, name, token_hash, scopes)
+		VALUES (?,?,?,?);`,
+		t.UserId, t.Name, tokenHash, joinScopes(t.Scopes),
+	)
+	if err != nil {
+		if s.isDuplicate(err) {
+			return 0, ErrExists
+		}
+		return 0, err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	return int(id), nil
+}
+
+func scanToken(scan func(dest ...interface{}) error) (Token, error) {
+	var t Token
+	var scopes string
+	var lastUsed, revoked sql.NullString
+	err := scan(
+		&t.Id, &t.UserId, &t.Name, &scopes,
+		&t.Created, &lastUsed, &revoked,
+	)
+	if err != nil {
+		return t, err
+	}
+	t.Scopes = splitScopes(scopes)
+	t.LastUsed = lastUsed.String
+	t.Revoked = revoked.String
+	return t, nil
+}
+
+func (s *sqlStore) TokenByHash(ctx context.Context, tokenHash string) (Token, error) {
+	row := s.db.QueryRowContext(
+		ctx,
+		`SELECT id, user_id, name, scopes, created, last_used, revoked
+		FROM api_tokens WHERE token_hash=?`,
+		tokenHash,
+	)
+	t, err := scanToken(row.Scan)
+	if errors.Is(err, sql.ErrNoRows) {
+		return t, ErrNotFound
+	}
+	return t, err
+}
+
+func (s *sqlStore) Tokens(ctx context.Context, userId int) ([]Token, error) {
+	rows, err := s.db.QueryContext(
+		ctx,
+		`SELECT id, user_id, name, scopes, created, last_used, revoked
+		FROM api_tokens WHERE user_id=? ORDER BY id`,
+		userId,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tokens := []Token{}
+	for rows.Next() {
+		t, err := scanToken(rows.Scan)
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, t)
+	}
+	return tokens, rows.Err()
+}
+
+func (s *sqlStore) TouchToken(ctx context.Context, id int) error {
+	_, err := s.db.ExecContext(
+		ctx,
+		"UPDATE api_tokens SET last_used=CURRENT_TIMESTAMP WHERE id=?",
+		id,
+	)
+	return err
+}
+
+func (s *sqlStore) RevokeToken(ctx context.Context, id, userId int) (bool, error) {
+	query := "UPDATE api_tokens SET revoked=CURRENT_TIMESTAMP WHERE id=? AND revoked IS NULL"
+	args := []interface{}{id}
+	if userId != -1 {
+		query += " AND user_id=?"
+		args = append(args, userId)
+	}
+	result, err := s.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return false, err
+	}
+	nRows, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return nRows == 1, nil
+}
+
+func (s *sqlStore) Close() error {
+	return s.db.Close()
+}
+
+// 메타데이터와 색인은 packages를 참조하는 외래 키의 ON DELETE CASCADE로 함께 지워진다.
+func (s *sqlStore) PutMetadata(ctx context.Context, m Metadata) error {
+	key, err := versionKey(m.Version)
+	if err != nil {
+		return err
+	}
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var n int
+	err = tx.QueryRowContext(
+		ctx,
+		`SELECT COUNT(*) FROM packages
+		WHERE owner_id=? AND name=? AND version_key=? AND staging_key IS NULL`,
+		m.OwnerId, m.Name, key,
+	).Scan(&n)
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+	if err := writeMetadata(ctx, tx, m, key); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func writeMetadata(ctx context.Context, tx *sql.Tx, m Metadata, key string) error {
+	for _, table := range []string{"package_metadata", "search_terms", "package_dependencies"} {
+		_, err := tx.ExecContext(
+			ctx,
+			"DELETE FROM "+table+" WHERE owner_id=? AND name=? AND version_key=?",
+			m.OwnerId, m.Name, key,
+		)
+		if err != nil {
+			return err
+		}
+	}
+	_, err := tx.ExecContext(
+		ctx,
+		`INSERT INTO package_metadata (
+			owner_id, name, version_key,
+			description, license, homepage, keywords, readme, go_mod
+		) VALUES (?,?,?,?,?,?,?,?,?)`,
+		m.OwnerId, m.Name, key,
+		m.Description, m.License, m.Homepage, joinKeywords(m.Keywords), m.Readme, m.GoMod,
+	)
+	if err != nil {
+		return err
+	}
+	for _, d := range m.Dependencies {
+		_, err = tx.ExecContext(
+			ctx,
+			`INSERT INTO package_dependencies (owner_id, name, version_key, dep_owner_id, dep_name, version_constraint)
+			VALUES (?,?,?,?,?,?)`,
+			m.OwnerId, m.Name, key, d.OwnerId, d.Name, d.Constraint,
+		)
+		if err != nil {
+			return err
+		}
+	}
+	for _, p := range IndexTerms(m) {
+		_, err = tx.ExecContext(
+			ctx,
+			`INSERT INTO search_terms (term, owner_id, name, version_key, field, frequency)
+			VALUES (?,?,?,?,?,?)`,
+			p.Term, p.OwnerId, p.Name, key, p.Field, p.Count,
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *sqlStore) Metadata(ctx context.Context, ownerId int, name, version string) (Metadata, error) {
+	m := Metadata{OwnerId: ownerId, Name: name}
+	key, err := versionKey(version)
+	if err != nil {
+		return m, err
+	}
+	var keywords string
+	err = s.db.QueryRowContext(
+		ctx,
+		`SELECT p.version, m.description, m.license, m.homepage, m.keywords, m.readme, m.go_mod
+		FROM package_metadata m JOIN packages p
+		ON p.owner_id=m.owner_id AND p.name=m.name AND p.version_key=m.version_key
+		WHERE m.owner_id=? AND m.name=? AND m.version_key=?`,
+		ownerId, name, key,
+	).Scan(&m.Version, &m.Description, &m.License, &m.Homepage, &keywords, &m.Readme, &m.GoMod)
+	if errors.Is(err, sql.ErrNoRows) {
+		return m, ErrNotFound
+	}
+	if err != nil {
+		return m, err
+	}
+	m.Keywords = splitKeywords(keywords)
+	m.Dependencies, err = s.dependencies(ctx, ownerId, name, key)
+	return m, err
+}
+
+func (s *sqlStore) dependencies(ctx context.Context, ownerId int, name, key string) ([]Dependency, error) {
+	rows, err := s.db.QueryContext(
+		ctx,
+		`SELECT dep_owner_id, dep_name, version_constraint FROM package_dependencies
+		WHERE owner_id=? AND name=? AND version_key=? ORDER BY dep_owner_id, dep_name`,
+		ownerId, name, key,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	deps := []Dependency{}
+	for rows.Next() {
+		var d Dependency
+		if err := rows.Scan(&d.OwnerId, &d.Name, &d.Constraint); err != nil {
+			return nil, err
+		}
+		deps = append(deps, d)
+	}
+	return deps, rows.Err()
+}
+
+func (s *sqlStore) Dependents(ctx context.Context, ownerId int, name string) ([]Dependent, error) {
+	rows, err := s.db.QueryContext(
+		ctx,
+		`SELECT d.owner_id, d.name, p.version, d.version_constraint
+		FROM package_dependencies d JOIN packages p
+		ON p.owner_id=d.owner_id AND p.name=d.name AND p.version_key=d.version_key
+		WHERE d.dep_owner_id=? AND d.dep_name=?
+		ORDER BY d.owner_id, d.name, d.version_key`,
+		ownerId, name,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	dependents := []Dependent{}
+	for rows.Next() {
+		var d Dependent
+		if err := rows.Scan(&d.OwnerId, &d.Name, &d.Version, &d.Constraint); err != nil {
+			return nil, err
+		}
+		dependents = append(dependents, d)
+	}
+	return dependents, rows.Err()
+}
+
+func (s *sqlStore) SearchPostings(ctx context.Context, terms []string, ownerId int) ([]Posting, error) {
+	postings := []Posting{}
+	if len(terms) == 0 {
+		return postings, nil
+	}
+	args := []interface{}{}
+	for _, term := range terms {
+		args = append(args, term)
+	}
+	query := `SELECT t.term, t.owner_id, t.name, p.version, t.field, t.frequency
+		FROM search_terms t JOIN packages p
+		ON p.owner_id=t.owner_id AND p.name=t.name AND p.version_key=t.version_key
+		WHERE t.term IN (` + strings.TrimSuffix(strings.Repeat("?, ", len(terms)), ", ") + ")"
+	if ownerId != -1 {
+		query += " AND t.owner_id=?"
+		args = append(args, ownerId)
+	}
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var p Posting
+		if err := rows.Scan(&p.Term, &p.OwnerId, &p.Name, &p.Version, &p.Field, &p.Count); err != nil {
+			return nil, err
+		}
+		postings = append(postings, p)
+	}
+	return postings, rows.Err()
+}
+
+func (s *sqlStore) AddDownloads(ctx context.Context, counts []DownloadCount) error {
+	upsert := `INSERT INTO download_counts (owner_id, name, version_key, version, day, downloads)
+		VALUES (?,?,?,?,?,?)`
+	if s.dialect == "sqlite" {
+		upsert += ` ON CONFLICT (owner_id, name, version_key, day)
+		DO UPDATE SET downloads=downloads+excluded.downloads`
+	} else {
+		upsert += " ON DUPLICATE KEY UPDATE downloads=downloads+VALUES(downloads)"
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	stmt, err := tx.PrepareContext(ctx, upsert)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	for _, c := range counts {
+		key, err := versionKey(c.Version)
+		if err != nil {
+			return err
+		}
+		_, err = stmt.ExecContext(ctx, c.OwnerId, c.Name, key, c.Version, c.Day, c.Count)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (s *sqlStore) DownloadStats(ctx context.Context, ownerId int, name, since string) ([]DownloadCount, error) {
+	rows, err := s.db.QueryContext(
+		ctx,
+		`SELECT version, day, downloads FROM download_counts
+		WHERE owner_id=? AND name=? AND day>=?
+		ORDER BY day, version_key`,
+		ownerId, name, since,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	counts := []DownloadCount{}
+	for rows.Next() {
+		c := DownloadCount{OwnerId: ownerId, Name: name}
+		if err := rows.Scan(&c.Version, &c.Day, &c.Count); err != nil {
+			return nil, err
+		}
+		counts = append(counts, c)
+	}
+	return counts, rows.Err()
+}
+
+func (s *sqlStore) TopDownloads(ctx context.Context, since string, limit int) ([]DownloadTotal, error) {
+	query := `SELECT owner_id, name, SUM(downloads) AS total FROM download_counts
+		WHERE day>=?
+		GROUP BY owner_id, name
+		ORDER BY total DESC, name, owner_id`
+	args := []interface{}{since}
+	if limit > 0 {
+		query += " LIMIT ?"
+		args = append(args, limit)
+	}
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	totals := []DownloadTotal{}
+	for rows.Next() {
+		var t DownloadTotal
+		if err := rows.Scan(&t.OwnerId, &t.Name, &t.Count); err != nil {
+			return nil, err
+		}
+		totals = append(totals, t)
+	}
+	return totals, rows.Err()
+}
+
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: len(s) != 0}
+}
+
+func (s *sqlStore) AddWebhook(ctx context.Context, h Webhook) (int, error) {
+	result, err := s.db.ExecContext(
+		ctx,
+		`INSERT INTO webhooks (owner_id, name, url, secret, events)
+		VALUES (?,?,?,?,?)`,
+		h.OwnerId, h.Name, h.URL, h.Secret, joinScopes(h.Events),
+	)
+	if err != nil {
+		return 0, err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	return int(id), nil
+}
+
+const webhookColumns = "id, owner_id, name, url, secret, events, created"
+
+func scanWebhook(scan func(dest ...interface{}) error) (Webhook, error) {
+	var h Webhook
+	var events string
+	err := scan(&h.Id, &h.OwnerId, &h.Name, &h.URL, &h.Secret, &events, &h.Created)
+	h.Events = splitScopes(events)
+	return h, err
+}
+
+func (s *sqlStore) Webhooks(ctx context.Context, ownerId int) ([]Webhook, error) {
+	query := "SELECT " + webhookColumns + " FROM webhooks"
+	args := []interface{}{}
+	if ownerId != -1 {
+		query += " WHERE owner_id=?"
+		args = append(args, ownerId)
+	}
+	rows, err := s.db.QueryContext(ctx, query+" ORDER BY id", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	hooks := []Webhook{}
+	for rows.Next() {
+		h, err := scanWebhook(rows.Scan)
+		if err != nil {
+			return nil, err
+		}
+		hooks = append(hooks, h)
+	}
+	return hooks, rows.Err()
+}
+
+func (s *sqlStore) Webhook(ctx context.Context, id int) (Webhook, error) {
+	row := s.db.QueryRowContext(ctx, "SELECT "+webhookColumns+" FROM webhooks WHERE id=?", id)
+	h, err := scanWebhook(row.Scan)
+	if errors.Is(err, sql.ErrNoRows) {
+		return h, ErrNotFound
+	}
+	return h, err
+}
+
+// 전송과 시도 기록은 외래 키의 ON DELETE CASCADE로 함께 지워진다.
+func (s *sqlStore) DeleteWebhook(ctx context.Context, id int) error {
+	result, err := s.db.ExecContext(ctx, "DELETE FROM webhooks WHERE id=?", id)
+	if err != nil {
+		return err
+	}
+	nRows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if nRows == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *sqlStore) AddDelivery(ctx context.Context, d Delivery) (int, error) {
+	result, err := s.db.ExecContext(
+		ctx,
+		`INSERT INTO webhook_deliveries (webhook_id, event, payload, status, attempts, next_attempt)
+		VALUES (?,?,?,?,?,?)`,
+		d.WebhookId, d.Event, d.Payload, d.Status, d.Attempts, nullString(d.NextAttempt),
+	)
+	if err != nil {
+		return 0, err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	return int(id), nil
+}
+
+const deliveryColumns = "id, webhook_id, event, payload, status, attempts, next_attempt, created"
+
+func (s *sqlStore) queryDeliveries(ctx context.Context, query string, args ...interface{}) ([]Delivery, error) {
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	deliveries := []Delivery{}
+	for rows.Next() {
+		var d Delivery
+		var next sql.NullString
+		err := rows.Scan(&d.Id, &d.WebhookId, &d.Event, &d.Payload, &d.Status, &d.Attempts, &next, &d.Created)
+		if err != nil {
+			return nil, err
+		}
+		d.NextAttempt = next.String
+		deliveries = append(deliveries, d)
+	}
+	return deliveries, rows.Err()
+}
+
+func (s *sqlStore) DueDeliveries(ctx context.Context, before string, limit int) ([]Delivery, error) {
+	return s.queryDeliveries(
+		ctx,
+		"SELECT "+deliveryColumns+` FROM webhook_deliveries
+		WHERE status=? AND next_attempt<=?
+		ORDER BY next_attempt, id LIMIT ?`,
+		DeliveryPending, before, limit,
+	)
+}
+
+func (s *sqlStore) RecordAttempt(ctx context.Context, d Delivery, a DeliveryAttempt) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(
+		ctx,
+		"UPDATE webhook_deliveries SET status=?, attempts=?, next_attempt=? WHERE id=?",
+		d.Status, d.Attempts, nullString(d.NextAttempt), d.Id,
+	)
+	if err != nil {
+		return err
+	}
+	nRows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if nRows == 0 {
+		return ErrNotFound
+	}
+	_, err = tx.ExecContext(
+		ctx,
+		`INSERT INTO webhook_attempts (
+			delivery_id, attempt, status_code, response, error, duration_ms
+		) VALUES (?,?,?,?,?,?)`,
+		d.Id, a.Attempt, a.StatusCode, a.Response, a.Error, a.DurationMs,
+	)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *sqlStore) Deliveries(ctx context.Context, webhookId int, limit int) ([]Delivery, error) {
+	return s.queryDeliveries(
+		ctx,
+		"SELECT "+deliveryColumns+" FROM webhook_deliveries WHERE webhook_id=? ORDER BY id DESC LIMIT ?",
+		webhookId, limit,
+	)
+}
+
+func (s *sqlStore) DeliveryAttempts(ctx context.Context, deliveryId int) ([]DeliveryAttempt, error) {
+	rows, err := s.db.QueryContext(
+		ctx,
+		`SELECT delivery_id, attempt, status_code, response, error, duration_ms, created
+		FROM webhook_attempts WHERE delivery_id=? ORDER BY attempt`,
+		deliveryId,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	attempts := []DeliveryAttempt{}
+	for rows.Next() {
+		var a DeliveryAttempt
+		err := rows.Scan(&a.DeliveryId, &a.Attempt, &a.StatusCode, &a.Response, &a.Error, &a.DurationMs, &a.Created)
+		if err != nil {
+			return nil, err
+		}
+		attempts = append(attempts, a)
+	}
+	return attempts, rows.Err()
+}
+
+func (s *sqlStore) AddUpload(ctx context.Context, u Upload) error {
+	_, err := s.db.ExecContext(
+		ctx,
+		`INSERT INTO uploads
+		(id, owner_id, name, version, object_store_id, staging_key, size, sha256, manifest, expires)
+		VALUES (?,?,?,?,?,?,?,?,?,?)`,
+		u.Id, u.OwnerId, u.Name, u.Version, u.ObjectStoreId, u.StagingKey,
+		u.Size, u.Sha256, u.Manifest, u.Expires,
+	)
+	if s.isDuplicate(err) {
+		return ErrExists
+	}
+	return err
+}
+
+const uploadColumns = "id, owner_id, name, version, object_store_id, staging_key, size, sha256, manifest, expires, created"
+
+func scanUpload(scan func(dest ...interface{}) error) (Upload, error) {
+	var u Upload
+	err := scan(
+		&u.Id, &u.OwnerId, &u.Name, &u.Version, &u.ObjectStoreId, &u.StagingKey,
+		&u.Size, &u.Sha256, &u.Manifest, &u.Expires, &u.Created,
+	)
+	return u, err
+}
+
+func (s *sqlStore) Upload(ctx context.Context, id string) (Upload, error) {
+	row := s.db.QueryRowContext(ctx, "SELECT "+uploadColumns+" FROM uploads WHERE id=?", id)
+	u, err := scanUpload(row.Scan)
+	if errors.Is(err, sql.ErrNoRows) {
+		return u, ErrNotFound
+	}
+	return u, err
+}
+
+func (s *sqlStore) Uploads(ctx context.Context) ([]Upload, error) {
+	rows, err := s.db.QueryContext(ctx, "SELECT "+uploadColumns+" FROM uploads ORDER BY expires, id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	uploads := []Upload{}
+	for rows.Next() {
+		u, err := scanUpload(rows.Scan)
+		if err != nil {
+			return nil, err
+		}
+		uploads = append(uploads, u)
+	}
+	return uploads, rows.Err()
+}
+
+func (s *sqlStore) DeleteUpload(ctx context.Context, id string) error {
+	result, err := s.db.ExecContext(ctx, "DELETE FROM uploads WHERE id=?", id)
+	if err != nil {
+		return err
+	}
+	nRows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if nRows == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *sqlStore) Usage(ctx context.Context, ownerId int, since string) (Usage, error) {
+	u := Usage{OwnerId: ownerId}
+	var first sql.NullString
+	err := s.db.QueryRowContext(
+		ctx,
+		`SELECT
+			COALESCE(SUM(CASE WHEN staging_key IS NULL THEN size ELSE 0 END), 0),
+			COALESCE(SUM(CASE WHEN staging_key IS NULL THEN 1 ELSE 0 END), 0),
+			COALESCE(SUM(CASE WHEN created >= ? THEN 1 ELSE 0 END), 0),
+			MIN(CASE WHEN created >= ? THEN created END)
+		FROM packages WHERE owner_id=?`,
+		since, since, ownerId,
+	).Scan(&u.StoredBytes, &u.Versions, &u.Publishes, &first)
+	u.FirstPublish = first.String
+	return u, err
+}
+
+func (s *sqlStore) OwnerLimits(ctx context.Context, ownerId int) (Limits, error) {
+	l := Limits{OwnerId: ownerId}
+	err := s.db.QueryRowContext(
+		ctx,
+		`SELECT max_storage, max_package_size, publishes_per_hour, updated
+		FROM owner_limits WHERE owner_id=?`,
+		ownerId,
+	).Scan(&l.MaxStorage, &l.MaxPackageSize, &l.PublishesPerHour, &l.Updated)
+	if errors.Is(err, sql.ErrNoRows) {
+		return l, ErrNotFound
+	}
+	return l, err
+}
+
+func (s *sqlStore) SetOwnerLimits(ctx context.Context, l Limits) error {
+	upsert := `INSERT INTO owner_limits (owner_id, max_storage, max_package_size, publishes_per_hour)
+		VALUES (?,?,?,?)`
+	if s.dialect == "sqlite" {
+		upsert += ` ON CONFLICT (owner_id) DO UPDATE SET max_storage=excluded.max_storage,
+			max_package_size=excluded.max_package_size, publishes_per_hour=excluded.publishes_per_hour,
+			updated=CURRENT_TIMESTAMP`
+	} else {
+		upsert += ` ON DUPLICATE KEY UPDATE max_storage=VALUES(max_storage),
+			max_package_size=VALUES(max_package_size), publishes_per_hour=VALUES(publishes_per_hour),
+			updated=CURRENT_TIMESTAMP`
+	}
+	_, err := s.db.ExecContext(ctx, upsert, l.OwnerId, l.MaxStorage, l.MaxPackageSize, l.PublishesPerHour)
+	return err
+}
+
+func (s *sqlStore) DeleteOwnerLimits(ctx context.Context, ownerId int) error {
+	result, err := s.db.ExecContext(ctx, "DELETE FROM owner_limits WHERE owner_id=?", ownerId)
+	if err != nil {
+		return err
+	}
+	nRows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if nRows == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
@@ -0,0 +1,35 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// OpenSQLite는 path의 데이터베이스를 연다. 스키마는 MigrateUp으로 만든다.
+// MySQL의 utf8mb4_bin 컬럼과 같게 LIKE가 대소문자를 구분하도록 하고, 트랜잭션이
+// 시작할 때 쓰기 잠금을 잡도록 해 여러 프로세스의 마이그레이션이 겹치지 않게 한다.
+func OpenSQLite(path string) (PackageStore, error) {
+	db, err := sql.Open(
+		"sqlite3",
+		"file:"+path+"?_foreign_keys=on&_busy_timeout=5000&_cslike=true&_txlock=immediate",
+	)
+	if err != nil {
+		return nil, err
+	}
+	// SQLite는 쓰기를 하나씩만 처리하므로 연결을 하나로 제한해 잠금 오류를 피한다
+	db.SetMaxOpenConns(1)
+	if err = db.Ping(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &sqlStore{db: db, isDuplicate: isSQLiteDuplicate, dialect: "sqlite"}, nil
+}
+
+func isSQLiteDuplicate(err error) bool {
+	var sqliteErr sqlite3.Error
+	return errors.As(err, &sqliteErr) &&
+		(sqliteErr.ExtendedCode == sqlite3.ErrConstraintPrimaryKey ||
+			sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique)
+}
@@ -0,0 +1,291 @@
+// Package store는 패키지 메타데이터와 API 토큰을 저장하는 백엔드를 제공한다.
+// 핸들러는 PackageStore 인터페이스에만 의존하고, 실제 백엔드(MySQL, SQLite, 메모리)는
+// 설정으로 고른다.
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/PaulOh5/pkg-server-2/semver"
+)
+
+var (
+	ErrNotFound     = errors.New("not found")
+	ErrExists       = errors.New("already exists")
+	ErrInvalidQuery = errors.New("invalid query")
+)
+
+// 모든 백엔드가 같은 형식의 시각 문자열을 돌려주도록 MySQL의 TIMESTAMP 형식을 따른다.
+const TimeFormat = "2006-01-02 15:04:05"
+
+type Package struct {
+	OwnerId       int    `json:"owner_id"`
+	Name          string `json:"name"`
+	Version       string `json:"version"`
+	ObjectStoreId string `json:"object_store_id"`
+	Sha256        string `json:"sha256"`
+	Sha512        string `json:"sha512"`
+	// Size는 객체의 바이트 수다. 크기를 기록하기 전에 게시한 버전은 0이다.
+	Size    int64  `json:"size"`
+	Created string `json:"created"`
+	// Yanked는 회수된 시각이다. 회수된 버전은 latest나 범위 제약으로는 고르지 않지만
+	// 정확한 버전으로는 계속 내려받을 수 있다.
+	Yanked string `json:"yanked,omitempty"`
+}
+
+// PendingPackage는 게시 중인 버전이다. 객체는 StagingKey에 올라가 있고 게시가 끝나면
+// ObjectStoreId로 옮긴다. 게시 중인 버전은 조회되지 않지만 같은 버전의 게시는 막는다.
+type PendingPackage struct {
+	Package
+	StagingKey string
+}
+
+// DeletedObject는 행이 삭제되어 GC가 버킷에서 지워야 하는 객체다.
+type DeletedObject struct {
+	ObjectStoreId string
+	Deleted       string
+}
+
+const (
+	SortName    = "name"
+	SortCreated = "created"
+	SortVersion = "version"
+)
+
+// sortColumns는 정렬마다 ORDER BY에 쓰는 컬럼이다. 마지막 컬럼까지 쓰면 행이 하나로
+// 정해지므로 커서 페이지네이션에 그대로 쓸 수 있다.
+var sortColumns = map[string][]string{
+	SortName:    {"name", "owner_id", "version_key"},
+	SortCreated: {"created", "name", "owner_id", "version_key"},
+	SortVersion: {"version_key", "name", "owner_id"},
+}
+
+// Cursor는 이전 페이지의 마지막 패키지다. 결과는 이 패키지 다음부터 시작한다.
+type Cursor struct {
+	OwnerId int    `json:"o"`
+	Name    string `json:"n"`
+	Version string `json:"v"`
+	Created string `json:"c"`
+}
+
+func CursorOf(p Package) Cursor {
+	return Cursor{OwnerId: p.OwnerId, Name: p.Name, Version: p.Version, Created: p.Created}
+}
+
+// OwnerId가 -1이면 소유자로 거르지 않는다.
+// Version은 정확한 SemVer 버전이며 빌드 메타데이터는 비교하지 않는다.
+type QueryParams struct {
+	OwnerId int
+	Name    string
+	Version string
+
+	// NamePrefix는 대소문자를 구분한다.
+	NamePrefix string
+	// CreatedAfter는 TimeFormat 형식의 UTC 시각이다.
+	CreatedAfter string
+
+	// Sort가 비어 있으면 SortName으로 정렬한다.
+	Sort  string
+	After *Cursor
+	// Limit이 0이면 결과 수를 제한하지 않는다.
+	Limit int
+}
+
+func (q QueryParams) validate() error {
+	if len(q.Version) != 0 && q.OwnerId == -1 && len(q.Name) == 0 {
+		return fmt.Errorf("%w: quering by only version is not allowed", ErrInvalidQuery)
+	}
+	if _, ok := sortColumns[q.sort()]; !ok {
+		return fmt.Errorf("%w: unknown sort %q", ErrInvalidQuery, q.Sort)
+	}
+	if len(q.CreatedAfter) != 0 {
+		if _, err := time.Parse(TimeFormat, q.CreatedAfter); err != nil {
+			return fmt.Errorf("%w: invalid created_after", ErrInvalidQuery)
+		}
+	}
+	return nil
+}
+
+func (q QueryParams) sort() string {
+	if len(q.Sort) == 0 {
+		return SortName
+	}
+	return q.Sort
+}
+
+// versionKey는 정렬 가능한 형태로 저장할 버전 키를 반환한다.
+func versionKey(version string) (string, error) {
+	v, err := semver.Parse(version)
+	if err != nil {
+		return "", err
+	}
+	return v.Key(), nil
+}
+
+type User struct {
+	Id       int    `json:"id"`
+	Username string `json:"username"`
+}
+
+type Token struct {
+	Id       int      `json:"id"`
+	UserId   int      `json:"user_id"`
+	Name     string   `json:"name"`
+	Scopes   []string `json:"scopes"`
+	Created  string   `json:"created"`
+	LastUsed string   `json:"last_used,omitempty"`
+	Revoked  string   `json:"revoked,omitempty"`
+}
+
+type PackageStore interface {
+	// AddPackage는 같은 소유자, 이름에 우선순위가 같은 버전이 있으면 ErrExists를,
+	// 버전이 SemVer가 아니면 semver.ErrInvalidVersion을 반환한다.
+	AddPackage(ctx context.Context, p Package) error
+	// ReservePackage는 게시 중인 행을 넣는다. 게시되었거나 게시 중인 같은 버전이 있으면
+	// ErrExists를 반환한다.
+	ReservePackage(ctx context.Context, p PendingPackage) error
+	// PublishPackage는 게시 중인 행을 p의 체크섬과 크기로 게시하고 메타데이터와 검색 색인을
+	// 같은 트랜잭션에서 쓴다. 게시 중인 행이 없으면 ErrNotFound를 반환한다.
+	PublishPackage(ctx context.Context, p Package, m Metadata) error
+	// AbortPackage는 게시 중인 행을 지운다. 게시 중인 행이 없으면 ErrNotFound를 반환한다.
+	AbortPackage(ctx context.Context, ownerId int, name, version string) error
+	// PendingPackages는 게시 중인 행을 Created 순서로 반환한다.
+	PendingPackages(ctx context.Context) ([]PendingPackage, error)
+	// QueryPackages는 q.Sort 순서로 정렬된 결과를 반환한다. 버전은 우선순위로 정렬한다.
+	QueryPackages(ctx context.Context, q QueryParams) ([]Package, error)
+	// YankPackage는 버전을 회수한다. 버전이 없으면 ErrNotFound를 반환한다.
+	YankPackage(ctx context.Context, ownerId int, name, version string) error
+	// DeletePackage는 행과 메타데이터를 지우고 객체를 삭제 대상으로 기록한다.
+	// 버전이 없으면 ErrNotFound를 반환한다.
+	DeletePackage(ctx context.Context, ownerId int, name, version string) (Package, error)
+	// PackagesModified는 패키지의 버전을 마지막으로 게시, 회수, 삭제한 시각을 반환한다.
+	// ownerId가 -1이면 모든 소유자를, name이 비어 있으면 모든 이름을 본다. 바뀐 적이 없으면 빈 문자열을 반환한다.
+	PackagesModified(ctx context.Context, ownerId int, name string) (string, error)
+
+	// PutMetadata는 버전의 메타데이터와 검색 색인을 새로 쓴다.
+	// 버전이 없으면 ErrNotFound를 반환한다.
+	PutMetadata(ctx context.Context, m Metadata) error
+	// Metadata는 메타데이터가 없으면 ErrNotFound를 반환한다.
+	Metadata(ctx context.Context, ownerId int, name, version string) (Metadata, error)
+	// Dependents는 패키지에 의존하는 게시된 버전을 소유자 ID, 이름, 버전 순서로 반환한다.
+	Dependents(ctx context.Context, ownerId int, name string) ([]Dependent, error)
+	// SearchPostings는 terms 중 하나의 역색인 항목을 모두 반환한다.
+	// ownerId가 -1이면 소유자로 거르지 않는다.
+	SearchPostings(ctx context.Context, terms []string, ownerId int) ([]Posting, error)
+
+	// AddDownloads는 counts를 기존 집계에 더한다.
+	AddDownloads(ctx context.Context, counts []DownloadCount) error
+	// DownloadStats는 since(DayFormat) 이후 패키지의 버전별, 날짜별 다운로드 수를
+	// 날짜와 버전 순서로 반환한다. since가 비어 있으면 모든 날짜를 반환한다.
+	DownloadStats(ctx context.Context, ownerId int, name, since string) ([]DownloadCount, error)
+	// TopDownloads는 since 이후 다운로드가 많은 패키지를 limit개까지 반환한다.
+	// limit이 0이면 모두 반환한다.
+	TopDownloads(ctx context.Context, since string, limit int) ([]DownloadTotal, error)
+
+	AddWebhook(ctx context.Context, h Webhook) (int, error)
+	// Webhooks는 ownerId가 -1이면 모든 웹훅을 ID 순서로 반환한다.
+	Webhooks(ctx context.Context, ownerId int) ([]Webhook, error)
+	// Webhook은 웹훅이 없으면 ErrNotFound를 반환한다.
+	Webhook(ctx context.Context, id int) (Webhook, error)
+	// DeleteWebhook은 웹훅과 전송 기록을 지운다. 웹훅이 없으면 ErrNotFound를 반환한다.
+	DeleteWebhook(ctx context.Context, id int) error
+	// AddDelivery는 전송을 큐에 넣는다.
+	AddDelivery(ctx context.Context, d Delivery) (int, error)
+	// DueDeliveries는 NextAttempt가 before 이전인 대기 중인 전송을 NextAttempt 순서로
+	// limit개까지 반환한다.
+	DueDeliveries(ctx context.Context, before string, limit int) ([]Delivery, error)
+	// RecordAttempt는 시도 기록을 넣고 전송의 상태, 시도 횟수, 다음 시도 시각을 d의 값으로
+	// 바꾼다. 전송이 없으면 ErrNotFound를 반환한다.
+	RecordAttempt(ctx context.Context, d Delivery, a DeliveryAttempt) error
+	// Deliveries는 웹훅의 전송을 최근 것부터 limit개까지 반환한다.
+	Deliveries(ctx context.Context, webhookId int, limit int) ([]Delivery, error)
+	// DeliveryAttempts는 전송의 시도를 순서대로 반환한다.
+	DeliveryAttempts(ctx context.Context, deliveryId int) ([]DeliveryAttempt, error)
+
+	// AddUpload는 업로드를 기록한다. 버전은 호출하는 쪽이 ReservePackage로 먼저 예약한다.
+	AddUpload(ctx context.Context, u Upload) error
+	// Upload는 업로드가 없으면 ErrNotFound를 반환한다.
+	Upload(ctx context.Context, id string) (Upload, error)
+	// Uploads는 모든 업로드를 Expires 순서로 반환한다.
+	Uploads(ctx context.Context) ([]Upload, error)
+	// DeleteUpload는 업로드가 없으면 ErrNotFound를 반환한다. 예약한 행은 지우지 않는다.
+	DeleteUpload(ctx context.Context, id string) error
+
+	// Usage는 소유자가 게시한 버전의 수와 크기, since 이후 게시했거나 게시 중인 버전의 수를
+	// 반환한다.
+	Usage(ctx context.Context, ownerId int, since string) (Usage, error)
+	// OwnerLimits는 소유자에게 따로 정한 한도가 없으면 ErrNotFound를 반환한다.
+	OwnerLimits(ctx context.Context, ownerId int) (Limits, error)
+	SetOwnerLimits(ctx context.Context, l Limits) error
+	// DeleteOwnerLimits는 따로 정한 한도가 없으면 ErrNotFound를 반환한다.
+	DeleteOwnerLimits(ctx context.Context, ownerId int) error
+
+	// ReferencedObjects는 게시 중인 행을 포함해 패키지 행이 참조하는 모든 객체 키를 반환한다.
+	ReferencedObjects(ctx context.Context) ([]string, error)
+	DeletedObjects(ctx context.Context) ([]DeletedObject, error)
+	PurgeDeletedObject(ctx context.Context, objectStoreId string) error
+
+	AddUser(ctx context.Context, username string) (int, error)
+	UserExists(ctx context.Context, id int) (bool, error)
+	// Users는 모든 사용자를 ID 순서로 반환한다.
+	Users(ctx context.Context) ([]User, error)
+
+	AddToken(ctx context.Context, t Token, tokenHash string) (int, error)
+	// TokenByHash는 토큰이 없으면 ErrNotFound를 반환한다.
+	TokenByHash(ctx context.Context, tokenHash string) (Token, error)
+	Tokens(ctx context.Context, userId int) ([]Token, error)
+	TouchToken(ctx context.Context, id int) error
+	// RevokeToken은 userId가 -1이면 소유자와 관계없이 토큰을 폐기한다.
+	RevokeToken(ctx context.Context, id, userId int) (bool, error)
+
+	Close() error
+}
+
+type Config struct {
+	// Driver는 mysql, sqlite, memory 중 하나다.
+	Driver string
+
+	// MySQL
+	Addr     string
+	Name     string
+	User     string
+	Password string
+
+	// SQLite 데이터베이스 파일 경로
+	Path string
+}
+
+func Open(c Config) (PackageStore, error) {
+	switch c.Driver {
+	case "mysql", "":
+		return OpenMySQL(c.Addr, c.Name, c.User, c.Password)
+	case "sqlite":
+		return OpenSQLite(c.Path)
+	case "memory":
+		return NewMemoryStore(), nil
+	default:
+		return nil, fmt.Errorf("unknown store driver: %s", c.Driver)
+	}
+}
+
+func now() string {
+	return time.Now().UTC().Format(TimeFormat)
+}
+
+func joinScopes(scopes []string) string {
+	return strings.Join(scopes, ",")
+}
+
+func splitScopes(s string) []string {
+	scopes := []string{}
+	for _, scope := range strings.Split(s, ",") {
+		if len(scope) != 0 {
+			scopes = append(scopes, scope)
+		}
+	}
+	return scopes
+}
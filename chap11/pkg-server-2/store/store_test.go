@@ -0,0 +1,1223 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/PaulOh5/pkg-server-2/semver"
+)
+
+// testPackageStore는 모든 백엔드가 통과해야 하는 공통 테스트다.
+// open은 호출할 때마다 비어 있는 저장소를 돌려줘야 한다.
+func testPackageStore(t *testing.T, open func(t *testing.T) PackageStore) {
+	testConfigs := []struct {
+		name string
+		test func(t *testing.T, s PackageStore)
+	}{
+		{name: "AddPackage", test: testAddPackage},
+		{name: "QueryPackages", test: testQueryPackages},
+		{name: "VersionPrecedence", test: testVersionPrecedence},
+		{name: "Pagination", test: testPagination},
+		{name: "Filters", test: testFilters},
+		{name: "YankPackage", test: testYankPackage},
+		{name: "DeletePackage", test: testDeletePackage},
+		{name: "PackagesModified", test: testPackagesModified},
+		{name: "Metadata", test: testMetadata},
+		{name: "Dependencies", test: testDependencies},
+		{name: "PendingPublish", test: testPendingPublish},
+		{name: "Uploads", test: testUploads},
+		{name: "Downloads", test: testDownloads},
+		{name: "Webhooks", test: testWebhooks},
+		{name: "Quotas", test: testQuotas},
+		{name: "Users", test: testUsers},
+		{name: "Tokens", test: testTokens},
+		{name: "RevokeToken", test: testRevokeToken},
+	}
+	for _, tc := range testConfigs {
+		t.Run(tc.name, func(t *testing.T) {
+			s := open(t)
+			defer s.Close()
+			tc.test(t, s)
+		})
+	}
+}
+
+func addTestUsers(t *testing.T, s PackageStore, n int) []int {
+	ids := []int{}
+	for i := 0; i < n; i++ {
+		id, err := s.AddUser(context.Background(), "user")
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+func testAddPackage(t *testing.T, s PackageStore) {
+	ctx := context.Background()
+	owner := addTestUsers(t, s, 1)[0]
+	p := Package{
+		OwnerId: owner, Name: "pkg", Version: "0.1.0", ObjectStoreId: "1/pkg-0.1.0",
+		Sha256: "ba7816bf", Sha512: "ddaf35a1",
+	}
+	if err := s.AddPackage(ctx, p); err != nil {
+		t.Fatal(err)
+	}
+	err := s.AddPackage(ctx, p)
+	if !errors.Is(err, ErrExists) {
+		t.Fatalf("Expected error: %v, Got: %v", ErrExists, err)
+	}
+	// 빌드 메타데이터만 다른 버전은 우선순위가 같으므로 중복이다
+	err = s.AddPackage(ctx, Package{OwnerId: owner, Name: "pkg", Version: "0.1.0+build.1", ObjectStoreId: "x"})
+	if !errors.Is(err, ErrExists) {
+		t.Fatalf("Expected error: %v, Got: %v", ErrExists, err)
+	}
+	err = s.AddPackage(ctx, Package{OwnerId: owner, Name: "pkg", Version: "0.1", ObjectStoreId: "x"})
+	if !errors.Is(err, semver.ErrInvalidVersion) {
+		t.Fatalf("Expected error: %v, Got: %v", semver.ErrInvalidVersion, err)
+	}
+
+	pkgs, err := s.QueryPackages(ctx, QueryParams{OwnerId: owner, Name: "pkg", Version: "0.1.0"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pkgs) != 1 {
+		t.Fatalf("Expected 1 package, Got: %v", pkgs)
+	}
+	got := pkgs[0]
+	if got.ObjectStoreId != p.ObjectStoreId || got.Sha256 != p.Sha256 || got.Sha512 != p.Sha512 ||
+		len(got.Created) != len(TimeFormat) {
+		t.Errorf("Expected %#v with created timestamp, Got: %#v", p, got)
+	}
+}
+
+func testQueryPackages(t *testing.T, s PackageStore) {
+	ctx := context.Background()
+	users := addTestUsers(t, s, 2)
+	for _, p := range []Package{
+		{OwnerId: users[1], Name: "b", Version: "1.0.0"},
+		{OwnerId: users[0], Name: "b", Version: "1.0.0"},
+		{OwnerId: users[0], Name: "a", Version: "2.0.0"},
+		{OwnerId: users[0], Name: "a", Version: "1.0.0"},
+	} {
+		p.ObjectStoreId = p.Name + p.Version
+		if err := s.AddPackage(ctx, p); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	type key struct {
+		owner   int
+		name    string
+		version string
+	}
+	testConfigs := []struct {
+		q        QueryParams
+		expected []key
+		err      error
+	}{
+		{
+			q: QueryParams{OwnerId: -1},
+			expected: []key{
+				{users[0], "a", "1.0.0"}, {users[0], "a", "2.0.0"},
+				{users[0], "b", "1.0.0"}, {users[1], "b", "1.0.0"},
+			},
+		},
+		{
+			q:        QueryParams{OwnerId: users[0], Name: "a"},
+			expected: []key{{users[0], "a", "1.0.0"}, {users[0], "a", "2.0.0"}},
+		},
+		{
+			q:        QueryParams{OwnerId: -1, Name: "b"},
+			expected: []key{{users[0], "b", "1.0.0"}, {users[1], "b", "1.0.0"}},
+		},
+		{
+			q:        QueryParams{OwnerId: users[1], Name: "a"},
+			expected: []key{},
+		},
+		{
+			q:        QueryParams{OwnerId: users[0], Name: "a", Version: "2.0.0"},
+			expected: []key{{users[0], "a", "2.0.0"}},
+		},
+		{
+			q:   QueryParams{OwnerId: -1, Version: "1.0.0"},
+			err: ErrInvalidQuery,
+		},
+	}
+	for _, tc := range testConfigs {
+		pkgs, err := s.QueryPackages(ctx, tc.q)
+		if !errors.Is(err, tc.err) {
+			t.Fatalf("%+v: Expected error: %v, Got: %v", tc.q, tc.err, err)
+		}
+		if tc.err != nil {
+			continue
+		}
+		got := []key{}
+		for _, p := range pkgs {
+			got = append(got, key{p.OwnerId, p.Name, p.Version})
+		}
+		if !reflect.DeepEqual(got, tc.expected) {
+			t.Errorf("%+v: Expected %v, Got: %v", tc.q, tc.expected, got)
+		}
+	}
+}
+
+func testVersionPrecedence(t *testing.T, s PackageStore) {
+	ctx := context.Background()
+	owner := addTestUsers(t, s, 1)[0]
+	ordered := []string{
+		"0.9.0",
+		"1.0.0-alpha",
+		"1.0.0-alpha.1",
+		"1.0.0-alpha.beta",
+		"1.0.0-beta",
+		"1.0.0-beta.2",
+		"1.0.0-beta.11",
+		"1.0.0-rc.1",
+		"1.0.0",
+		"1.2.0",
+		"1.10.0",
+		"10.0.0",
+	}
+	// 문자열 순서와 우선순위가 다르도록 섞어서 넣는다
+	for _, i := range []int{11, 3, 8, 0, 6, 10, 1, 5, 9, 2, 7, 4} {
+		p := Package{OwnerId: owner, Name: "pkg", Version: ordered[i], ObjectStoreId: ordered[i]}
+		if err := s.AddPackage(ctx, p); err != nil {
+			t.Fatal(err)
+		}
+	}
+	pkgs, err := s.QueryPackages(ctx, QueryParams{OwnerId: owner, Name: "pkg"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := []string{}
+	for _, p := range pkgs {
+		got = append(got, p.Version)
+	}
+	if !reflect.DeepEqual(got, ordered) {
+		t.Errorf("Expected %v, Got: %v", ordered, got)
+	}
+
+	pkgs, err = s.QueryPackages(ctx, QueryParams{OwnerId: owner, Name: "pkg", Version: "1.0.0-beta.11+build"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pkgs) != 1 || pkgs[0].Version != "1.0.0-beta.11" {
+		t.Errorf("Expected 1.0.0-beta.11, Got: %v", pkgs)
+	}
+}
+
+func testPagination(t *testing.T, s PackageStore) {
+	ctx := context.Background()
+	users := addTestUsers(t, s, 2)
+	for _, p := range []Package{
+		{OwnerId: users[0], Name: "b", Version: "1.0.0"},
+		{OwnerId: users[1], Name: "a", Version: "1.10.0"},
+		{OwnerId: users[0], Name: "a", Version: "1.2.0"},
+		{OwnerId: users[0], Name: "c", Version: "0.1.0"},
+		{OwnerId: users[1], Name: "b", Version: "1.0.0-rc.1"},
+		{OwnerId: users[0], Name: "a", Version: "1.10.0"},
+	} {
+		p.ObjectStoreId = p.Name + p.Version
+		if err := s.AddPackage(ctx, p); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	testConfigs := []struct {
+		sort     string
+		expected []string
+	}{
+		{
+			sort: SortName,
+			expected: []string{
+				"a@1.2.0", "a@1.10.0", "a@1.10.0", "b@1.0.0", "b@1.0.0-rc.1", "c@0.1.0",
+			},
+		},
+		{
+			sort: SortVersion,
+			expected: []string{
+				"c@0.1.0", "b@1.0.0-rc.1", "b@1.0.0", "a@1.2.0", "a@1.10.0", "a@1.10.0",
+			},
+		},
+	}
+	for _, tc := range testConfigs {
+		// 한 번에 가져온 결과와 커서로 두 개씩 나눠 가져온 결과가 같아야 한다
+		all, err := s.QueryPackages(ctx, QueryParams{OwnerId: -1, Sort: tc.sort})
+		if err != nil {
+			t.Fatal(err)
+		}
+		paged := []Package{}
+		q := QueryParams{OwnerId: -1, Sort: tc.sort, Limit: 2}
+		for {
+			page, err := s.QueryPackages(ctx, q)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(page) > 2 {
+				t.Fatalf("Expected at most 2 results, Got: %d", len(page))
+			}
+			paged = append(paged, page...)
+			if len(page) < 2 {
+				break
+			}
+			c := CursorOf(page[len(page)-1])
+			q.After = &c
+		}
+		got := []string{}
+		for _, p := range paged {
+			got = append(got, p.Name+"@"+p.Version)
+		}
+		if !reflect.DeepEqual(got, tc.expected) {
+			t.Errorf("%s: Expected %v, Got: %v", tc.sort, tc.expected, got)
+		}
+		if !reflect.DeepEqual(all, paged) {
+			t.Errorf("%s: Expected paged results to match %v, Got: %v", tc.sort, all, paged)
+		}
+	}
+
+	all, err := s.QueryPackages(ctx, QueryParams{OwnerId: -1, Sort: SortCreated})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 1; i < len(all); i++ {
+		if all[i-1].Created > all[i].Created {
+			t.Errorf("Expected results sorted by created, Got: %v", all)
+		}
+	}
+
+	_, err = s.QueryPackages(ctx, QueryParams{OwnerId: -1, Sort: "size"})
+	if !errors.Is(err, ErrInvalidQuery) {
+		t.Errorf("Expected error: %v, Got: %v", ErrInvalidQuery, err)
+	}
+}
+
+func testFilters(t *testing.T, s PackageStore) {
+	ctx := context.Background()
+	owner := addTestUsers(t, s, 1)[0]
+	for _, name := range []string{"http_client", "httpxclient", "http-server", "HTTP", "grpc"} {
+		p := Package{OwnerId: owner, Name: name, Version: "1.0.0", ObjectStoreId: name}
+		if err := s.AddPackage(ctx, p); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	testConfigs := []struct {
+		q        QueryParams
+		expected []string
+	}{
+		{q: QueryParams{OwnerId: -1, NamePrefix: "http"}, expected: []string{"http-server", "http_client", "httpxclient"}},
+		{q: QueryParams{OwnerId: -1, NamePrefix: "http_"}, expected: []string{"http_client"}},
+		{q: QueryParams{OwnerId: -1, NamePrefix: "HT"}, expected: []string{"HTTP"}},
+		{q: QueryParams{OwnerId: -1, NamePrefix: "%"}, expected: []string{}},
+		{q: QueryParams{OwnerId: -1, CreatedAfter: "2000-01-01 00:00:00", NamePrefix: "g"}, expected: []string{"grpc"}},
+		{q: QueryParams{OwnerId: -1, CreatedAfter: "2999-01-01 00:00:00"}, expected: []string{}},
+	}
+	for _, tc := range testConfigs {
+		pkgs, err := s.QueryPackages(ctx, tc.q)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := []string{}
+		for _, p := range pkgs {
+			got = append(got, p.Name)
+		}
+		if !reflect.DeepEqual(got, tc.expected) {
+			t.Errorf("%+v: Expected %v, Got: %v", tc.q, tc.expected, got)
+		}
+	}
+
+	_, err := s.QueryPackages(ctx, QueryParams{OwnerId: -1, CreatedAfter: "yesterday"})
+	if !errors.Is(err, ErrInvalidQuery) {
+		t.Errorf("Expected error: %v, Got: %v", ErrInvalidQuery, err)
+	}
+}
+
+func testUsers(t *testing.T, s PackageStore) {
+	ctx := context.Background()
+	ids := addTestUsers(t, s, 2)
+	if ids[0] == ids[1] {
+		t.Fatalf("Expected unique user ids, Got: %v", ids)
+	}
+	for _, id := range ids {
+		exists, err := s.UserExists(ctx, id)
+		if err != nil || !exists {
+			t.Errorf("Expected user %d to exist, Got: %v, %v", id, exists, err)
+		}
+	}
+	exists, err := s.UserExists(ctx, ids[1]+100)
+	if err != nil || exists {
+		t.Errorf("Expected user not to exist, Got: %v, %v", exists, err)
+	}
+	users, err := s.Users(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []User{{Id: ids[0], Username: "user"}, {Id: ids[1], Username: "user"}}
+	if !reflect.DeepEqual(users, expected) {
+		t.Errorf("Expected %#v, Got: %#v", expected, users)
+	}
+}
+
+func testTokens(t *testing.T, s PackageStore) {
+	ctx := context.Background()
+	users := addTestUsers(t, s, 2)
+
+	id1, err := s.AddToken(ctx, Token{UserId: users[0], Name: "ci", Scopes: []string{"publish", "read"}}, "hash1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	id2, err := s.AddToken(ctx, Token{UserId: users[0], Name: "laptop", Scopes: []string{"read"}}, "hash2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.AddToken(ctx, Token{UserId: users[1], Name: "dup", Scopes: []string{"read"}}, "hash1"); !errors.Is(err, ErrExists) {
+		t.Fatalf("Expected error: %v, Got: %v", ErrExists, err)
+	}
+
+	tok, err := s.TokenByHash(ctx, "hash1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tok.Id != id1 || tok.UserId != users[0] || tok.Name != "ci" ||
+		!reflect.DeepEqual(tok.Scopes, []string{"publish", "read"}) ||
+		len(tok.Created) == 0 || len(tok.LastUsed) != 0 || len(tok.Revoked) != 0 {
+		t.Errorf("Unexpected token: %#v", tok)
+	}
+	if _, err := s.TokenByHash(ctx, "missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected error: %v, Got: %v", ErrNotFound, err)
+	}
+
+	if err := s.TouchToken(ctx, id1); err != nil {
+		t.Fatal(err)
+	}
+	tok, err = s.TokenByHash(ctx, "hash1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tok.LastUsed) == 0 {
+		t.Error("Expected last_used to be set")
+	}
+
+	tokens, err := s.Tokens(ctx, users[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tokens) != 2 || tokens[0].Id != id1 || tokens[1].Id != id2 {
+		t.Errorf("Expected tokens %d and %d, Got: %#v", id1, id2, tokens)
+	}
+	tokens, err = s.Tokens(ctx, users[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tokens) != 0 {
+		t.Errorf("Expected no tokens, Got: %#v", tokens)
+	}
+}
+
+func testRevokeToken(t *testing.T, s PackageStore) {
+	ctx := context.Background()
+	users := addTestUsers(t, s, 2)
+	id, err := s.AddToken(ctx, Token{UserId: users[0], Name: "ci", Scopes: []string{"read"}}, "hash")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testConfigs := []struct {
+		id      int
+		userId  int
+		revoked bool
+	}{
+		{id: id, userId: users[1], revoked: false},
+		{id: id + 100, userId: -1, revoked: false},
+		{id: id, userId: users[0], revoked: true},
+		{id: id, userId: -1, revoked: false},
+	}
+	for _, tc := range testConfigs {
+		revoked, err := s.RevokeToken(ctx, tc.id, tc.userId)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if revoked != tc.revoked {
+			t.Errorf("RevokeToken(%d, %d): Expected %v, Got: %v", tc.id, tc.userId, tc.revoked, revoked)
+		}
+	}
+	tok, err := s.TokenByHash(ctx, "hash")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tok.Revoked) == 0 {
+		t.Error("Expected revoked to be set")
+	}
+}
+
+func TestMemoryStore(t *testing.T) {
+	testPackageStore(t, func(t *testing.T) PackageStore {
+		return NewMemoryStore()
+	})
+}
+
+func TestSQLiteStore(t *testing.T) {
+	testPackageStore(t, func(t *testing.T) PackageStore {
+		s, err := OpenSQLite(filepath.Join(t.TempDir(), "packages.db"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := s.(Migrator).MigrateUp(context.Background(), 0); err != nil {
+			t.Fatal(err)
+		}
+		return s
+	})
+}
+
+func testYankPackage(t *testing.T, s PackageStore) {
+	ctx := context.Background()
+	owner := addTestUsers(t, s, 1)[0]
+	for _, v := range []string{"1.0.0", "1.1.0"} {
+		if err := s.AddPackage(ctx, Package{OwnerId: owner, Name: "pkg", Version: v, ObjectStoreId: v}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.YankPackage(ctx, owner, "pkg", "1.1.0"); err != nil {
+		t.Fatal(err)
+	}
+	pkgs, err := s.QueryPackages(ctx, QueryParams{OwnerId: owner, Name: "pkg"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pkgs) != 2 || len(pkgs[0].Yanked) != 0 || len(pkgs[1].Yanked) == 0 {
+		t.Fatalf("Expected only 1.1.0 to be yanked, Got: %#v", pkgs)
+	}
+	// 다시 회수해도 오류가 아니고 회수 시각은 바뀌지 않는다
+	if err := s.YankPackage(ctx, owner, "pkg", "1.1.0"); err != nil {
+		t.Fatal(err)
+	}
+	again, err := s.QueryPackages(ctx, QueryParams{OwnerId: owner, Name: "pkg", Version: "1.1.0"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(again) != 1 || again[0].Yanked != pkgs[1].Yanked {
+		t.Errorf("Expected yanked timestamp %s, Got: %#v", pkgs[1].Yanked, again)
+	}
+	if err := s.YankPackage(ctx, owner, "pkg", "2.0.0"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected error: %v, Got: %v", ErrNotFound, err)
+	}
+}
+
+func testDeletePackage(t *testing.T, s PackageStore) {
+	ctx := context.Background()
+	owner := addTestUsers(t, s, 1)[0]
+	for _, v := range []string{"1.0.0", "1.1.0"} {
+		if err := s.AddPackage(ctx, Package{OwnerId: owner, Name: "pkg", Version: v, ObjectStoreId: "obj-" + v}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	p, err := s.DeletePackage(ctx, owner, "pkg", "1.0.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.ObjectStoreId != "obj-1.0.0" {
+		t.Errorf("Expected deleted package obj-1.0.0, Got: %#v", p)
+	}
+	if _, err := s.DeletePackage(ctx, owner, "pkg", "1.0.0"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected error: %v, Got: %v", ErrNotFound, err)
+	}
+
+	refs, err := s.ReferencedObjects(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(refs, []string{"obj-1.1.0"}) {
+		t.Errorf("Expected [obj-1.1.0], Got: %v", refs)
+	}
+	deleted, err := s.DeletedObjects(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(deleted) != 1 || deleted[0].ObjectStoreId != "obj-1.0.0" || len(deleted[0].Deleted) != len(TimeFormat) {
+		t.Fatalf("Expected obj-1.0.0 to be recorded as deleted, Got: %#v", deleted)
+	}
+	if err := s.PurgeDeletedObject(ctx, "obj-1.0.0"); err != nil {
+		t.Fatal(err)
+	}
+	deleted, err = s.DeletedObjects(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(deleted) != 0 {
+		t.Errorf("Expected no deleted objects, Got: %#v", deleted)
+	}
+
+	// 지운 버전은 다시 게시할 수 있다
+	if err := s.AddPackage(ctx, Package{OwnerId: owner, Name: "pkg", Version: "1.0.0", ObjectStoreId: "obj-1.0.0"}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func testPackagesModified(t *testing.T, s PackageStore) {
+	ctx := context.Background()
+	owners := addTestUsers(t, s, 2)
+	modified := func(ownerId int, name string) string {
+		t.Helper()
+		m, err := s.PackagesModified(ctx, ownerId, name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return m
+	}
+	if m := modified(-1, ""); len(m) != 0 {
+		t.Fatalf("Expected no modification, Got: %s", m)
+	}
+	for _, name := range []string{"a", "b"} {
+		if err := s.AddPackage(ctx, Package{OwnerId: owners[0], Name: name, Version: "1.0.0", ObjectStoreId: name}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	added := modified(owners[0], "a")
+	if len(added) != len(TimeFormat) {
+		t.Fatalf("Expected a modification time, Got: %q", added)
+	}
+	// 시각은 초 단위이므로 다음 변경이 더 늦은 시각이 되도록 기다린다
+	time.Sleep(1100 * time.Millisecond)
+	if err := s.YankPackage(ctx, owners[0], "a", "1.0.0"); err != nil {
+		t.Fatal(err)
+	}
+	yanked := modified(owners[0], "a")
+	if yanked <= added || modified(owners[0], "b") != added {
+		t.Errorf("Expected yank to move only a, Got: %s, %s", yanked, modified(owners[0], "b"))
+	}
+	if _, err := s.DeletePackage(ctx, owners[0], "b", "1.0.0"); err != nil {
+		t.Fatal(err)
+	}
+	deleted := modified(owners[0], "b")
+	if deleted <= added {
+		t.Errorf("Expected delete to move b, Got: %s", deleted)
+	}
+
+	testConfigs := []struct {
+		ownerId  int
+		name     string
+		expected string
+	}{
+		{ownerId: owners[0], name: "", expected: max(yanked, deleted)},
+		{ownerId: -1, name: "", expected: max(yanked, deleted)},
+		{ownerId: -1, name: "a", expected: yanked},
+		{ownerId: owners[1], name: "", expected: ""},
+		{ownerId: owners[0], name: "c", expected: ""},
+	}
+	for _, tc := range testConfigs {
+		if m := modified(tc.ownerId, tc.name); m != tc.expected {
+			t.Errorf("%d/%s: Expected %q, Got: %q", tc.ownerId, tc.name, tc.expected, m)
+		}
+	}
+}
+
+func TestIndexTerms(t *testing.T) {
+	m := Metadata{
+		OwnerId: 1, Name: "http-Router", Version: "1.0.0",
+		Keywords:    []string{"HTTP", "web server"},
+		Description: "A fast HTTP router. Routes HTTP requests.",
+	}
+	expected := []Posting{
+		{Term: "http", Field: FieldName, Count: 1},
+		{Term: "router", Field: FieldName, Count: 1},
+		{Term: "http", Field: FieldKeyword, Count: 1},
+		{Term: "web", Field: FieldKeyword, Count: 1},
+		{Term: "server", Field: FieldKeyword, Count: 1},
+		{Term: "a", Field: FieldDescription, Count: 1},
+		{Term: "fast", Field: FieldDescription, Count: 1},
+		{Term: "http", Field: FieldDescription, Count: 2},
+		{Term: "router", Field: FieldDescription, Count: 1},
+		{Term: "routes", Field: FieldDescription, Count: 1},
+		{Term: "requests", Field: FieldDescription, Count: 1},
+	}
+	for i := range expected {
+		expected[i].OwnerId, expected[i].Name, expected[i].Version = 1, "http-Router", "1.0.0"
+	}
+	if postings := IndexTerms(m); !reflect.DeepEqual(postings, expected) {
+		t.Errorf("Expected %v, Got: %v", expected, postings)
+	}
+}
+
+func testMetadata(t *testing.T, s PackageStore) {
+	ctx := context.Background()
+	owners := addTestUsers(t, s, 2)
+	for _, p := range []Package{
+		{OwnerId: owners[0], Name: "router", Version: "1.0.0", ObjectStoreId: "a"},
+		{OwnerId: owners[0], Name: "router", Version: "1.1.0", ObjectStoreId: "b"},
+		{OwnerId: owners[1], Name: "json", Version: "2.0.0", ObjectStoreId: "c"},
+	} {
+		if err := s.AddPackage(ctx, p); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	m := Metadata{
+		OwnerId: owners[0], Name: "router", Version: "1.0.0",
+		Description: "HTTP router", License: "MIT", Homepage: "https://example.com",
+		Keywords: []string{"http", "routing"}, Readme: "# router",
+		GoMod: "module router\n",
+		Dependencies: []Dependency{
+			{OwnerId: owners[0], Name: "mux", Constraint: "^1.2.0"},
+			{OwnerId: owners[1], Name: "json", Constraint: "latest"},
+		},
+	}
+	if err := s.PutMetadata(ctx, m); err != nil {
+		t.Fatal(err)
+	}
+	got, err := s.Metadata(ctx, owners[0], "router", "1.0.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, m) {
+		t.Errorf("Expected %#v, Got: %#v", m, got)
+	}
+	if _, err := s.Metadata(ctx, owners[0], "router", "1.1.0"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected error: %v, Got: %v", ErrNotFound, err)
+	}
+	missing := Metadata{OwnerId: owners[0], Name: "router", Version: "9.0.0"}
+	if err := s.PutMetadata(ctx, missing); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected error: %v, Got: %v", ErrNotFound, err)
+	}
+
+	// 다시 쓰면 예전 색인은 사라진다
+	m.Description = "fast router"
+	m.Keywords = nil
+	if err := s.PutMetadata(ctx, m); err != nil {
+		t.Fatal(err)
+	}
+	err = s.PutMetadata(ctx, Metadata{
+		OwnerId: owners[1], Name: "json", Version: "2.0.0", Description: "JSON parser for HTTP APIs",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	count := func(terms []string, ownerId int) map[string]int {
+		postings, err := s.SearchPostings(ctx, terms, ownerId)
+		if err != nil {
+			t.Fatal(err)
+		}
+		counts := map[string]int{}
+		for _, p := range postings {
+			counts[p.Name+"@"+p.Version+" "+p.Term+" "+p.Field] += p.Count
+		}
+		return counts
+	}
+	testConfigs := []struct {
+		terms    []string
+		ownerId  int
+		expected map[string]int
+	}{
+		{
+			terms:   []string{"http", "router"},
+			ownerId: -1,
+			expected: map[string]int{
+				"router@1.0.0 router name":        1,
+				"router@1.0.0 router description": 1,
+				"json@2.0.0 http description":     1,
+			},
+		},
+		{
+			terms:    []string{"http", "router"},
+			ownerId:  owners[1],
+			expected: map[string]int{"json@2.0.0 http description": 1},
+		},
+		{terms: []string{"routing"}, ownerId: -1, expected: map[string]int{}},
+	}
+	for _, tc := range testConfigs {
+		if got := count(tc.terms, tc.ownerId); !reflect.DeepEqual(got, tc.expected) {
+			t.Errorf("Expected postings for %v: %v, Got: %v", tc.terms, tc.expected, got)
+		}
+	}
+
+	if _, err := s.DeletePackage(ctx, owners[0], "router", "1.0.0"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Metadata(ctx, owners[0], "router", "1.0.0"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected metadata to be deleted with the package, Got: %v", err)
+	}
+	if got := count([]string{"router"}, -1); len(got) != 0 {
+		t.Errorf("Expected no postings for deleted package, Got: %v", got)
+	}
+}
+
+func testDependencies(t *testing.T, s PackageStore) {
+	ctx := context.Background()
+	owners := addTestUsers(t, s, 2)
+	lib := Dependency{OwnerId: owners[1], Name: "lib", Constraint: "^1.0.0"}
+	for _, m := range []Metadata{
+		{OwnerId: owners[0], Name: "app", Version: "1.10.0", Dependencies: []Dependency{lib}},
+		{OwnerId: owners[0], Name: "app", Version: "1.9.0", Dependencies: []Dependency{lib}},
+		{OwnerId: owners[0], Name: "cli", Version: "1.0.0", Dependencies: []Dependency{
+			{OwnerId: owners[1], Name: "lib", Constraint: "1.2.3"},
+			{OwnerId: owners[0], Name: "app", Constraint: "latest"},
+		}},
+		{OwnerId: owners[1], Name: "lib", Version: "1.0.0"},
+	} {
+		p := Package{OwnerId: m.OwnerId, Name: m.Name, Version: m.Version, ObjectStoreId: m.Name + m.Version}
+		if err := s.AddPackage(ctx, p); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.PutMetadata(ctx, m); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	dependents, err := s.Dependents(ctx, owners[1], "lib")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []Dependent{
+		{OwnerId: owners[0], Name: "app", Version: "1.9.0", Constraint: "^1.0.0"},
+		{OwnerId: owners[0], Name: "app", Version: "1.10.0", Constraint: "^1.0.0"},
+		{OwnerId: owners[0], Name: "cli", Version: "1.0.0", Constraint: "1.2.3"},
+	}
+	if !reflect.DeepEqual(dependents, expected) {
+		t.Errorf("Expected %#v, Got: %#v", expected, dependents)
+	}
+	if dependents, err = s.Dependents(ctx, owners[0], "lib"); err != nil || len(dependents) != 0 {
+		t.Errorf("Expected no dependents, Got: %#v, %v", dependents, err)
+	}
+	m, err := s.Metadata(ctx, owners[1], "lib", "1.0.0")
+	if err != nil || m.Dependencies == nil || len(m.Dependencies) != 0 {
+		t.Errorf("Expected empty dependencies, Got: %#v, %v", m.Dependencies, err)
+	}
+
+	// 메타데이터를 다시 쓰거나 버전을 지우면 의존 관계도 사라진다
+	if err := s.PutMetadata(ctx, Metadata{OwnerId: owners[0], Name: "cli", Version: "1.0.0"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.DeletePackage(ctx, owners[0], "app", "1.9.0"); err != nil {
+		t.Fatal(err)
+	}
+	dependents, err = s.Dependents(ctx, owners[1], "lib")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(dependents, expected[1:2]) {
+		t.Errorf("Expected %#v, Got: %#v", expected[1:2], dependents)
+	}
+}
+
+func testPendingPublish(t *testing.T, s PackageStore) {
+	ctx := context.Background()
+	owner := addTestUsers(t, s, 1)[0]
+	p := PendingPackage{
+		Package:    Package{OwnerId: owner, Name: "pkg", Version: "1.0.0", ObjectStoreId: "obj-1.0.0"},
+		StagingKey: "staging/1",
+	}
+	if err := s.ReservePackage(ctx, p); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.ReservePackage(ctx, p); !errors.Is(err, ErrExists) {
+		t.Errorf("Expected error: %v, Got: %v", ErrExists, err)
+	}
+	if err := s.AddPackage(ctx, p.Package); !errors.Is(err, ErrExists) {
+		t.Errorf("Expected error: %v, Got: %v", ErrExists, err)
+	}
+
+	// 게시 중인 버전은 조회, 회수, 삭제 대상이 아니다
+	pkgs, err := s.QueryPackages(ctx, QueryParams{OwnerId: owner})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pkgs) != 0 {
+		t.Errorf("Expected pending package to be hidden, Got: %#v", pkgs)
+	}
+	if err := s.YankPackage(ctx, owner, "pkg", "1.0.0"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected error: %v, Got: %v", ErrNotFound, err)
+	}
+	if _, err := s.DeletePackage(ctx, owner, "pkg", "1.0.0"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected error: %v, Got: %v", ErrNotFound, err)
+	}
+	refs, err := s.ReferencedObjects(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(refs)
+	if !reflect.DeepEqual(refs, []string{"obj-1.0.0", "staging/1"}) {
+		t.Errorf("Expected pending objects to be referenced, Got: %v", refs)
+	}
+	pending, err := s.PendingPackages(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pending) != 1 || pending[0].StagingKey != "staging/1" ||
+		pending[0].ObjectStoreId != "obj-1.0.0" || len(pending[0].Created) != len(TimeFormat) {
+		t.Fatalf("Unexpected pending packages: %#v", pending)
+	}
+
+	published := Package{OwnerId: owner, Name: "pkg", Version: "1.0.0", Sha256: "ba7816bf", Sha512: "ddaf35a1", Size: 42}
+	m := Metadata{OwnerId: owner, Name: "pkg", Version: "1.0.0", Description: "published package"}
+	if err := s.PublishPackage(ctx, published, m); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.PublishPackage(ctx, published, m); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected error: %v, Got: %v", ErrNotFound, err)
+	}
+	pkgs, err = s.QueryPackages(ctx, QueryParams{OwnerId: owner})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pkgs) != 1 || pkgs[0].ObjectStoreId != "obj-1.0.0" || pkgs[0].Sha256 != "ba7816bf" || pkgs[0].Size != 42 {
+		t.Fatalf("Expected published package, Got: %#v", pkgs)
+	}
+	if got, err := s.Metadata(ctx, owner, "pkg", "1.0.0"); err != nil || got.Description != m.Description {
+		t.Errorf("Expected metadata to be published, Got: %#v, %v", got, err)
+	}
+
+	p.Version, p.ObjectStoreId, p.StagingKey = "1.1.0", "obj-1.1.0", "staging/2"
+	if err := s.ReservePackage(ctx, p); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.AbortPackage(ctx, owner, "pkg", "1.0.0"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected published package not to be aborted, Got: %v", err)
+	}
+	if err := s.AbortPackage(ctx, owner, "pkg", "1.1.0"); err != nil {
+		t.Fatal(err)
+	}
+	if pending, err = s.PendingPackages(ctx); err != nil || len(pending) != 0 {
+		t.Errorf("Expected no pending packages, Got: %#v, %v", pending, err)
+	}
+	// 취소한 버전은 다시 게시할 수 있다
+	if err := s.ReservePackage(ctx, p); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func testUploads(t *testing.T, s PackageStore) {
+	ctx := context.Background()
+	owner := addTestUsers(t, s, 1)[0]
+	u := Upload{
+		Id: "0123456789abcdef0123456789abcdef", OwnerId: owner, Name: "pkg", Version: "1.0.0",
+		ObjectStoreId: "obj-1.0.0", StagingKey: "staging/1", Size: 12,
+		Sha256: strings.Repeat("a", 64), Manifest: `{"description":"pkg"}`, Expires: "2030-01-02 03:04:05",
+	}
+	if err := s.AddUpload(ctx, u); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.AddUpload(ctx, u); !errors.Is(err, ErrExists) {
+		t.Errorf("Expected error: %v, Got: %v", ErrExists, err)
+	}
+	earlier := u
+	earlier.Id, earlier.Version, earlier.StagingKey, earlier.Expires = "fedcba9876543210fedcba9876543210", "1.1.0", "staging/2", "2030-01-01 00:00:00"
+	if err := s.AddUpload(ctx, earlier); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := s.Upload(ctx, u.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got.Created) != len(TimeFormat) {
+		t.Errorf("Expected created time, Got: %q", got.Created)
+	}
+	got.Created = ""
+	if !reflect.DeepEqual(got, u) {
+		t.Errorf("Expected %#v, Got: %#v", u, got)
+	}
+	if _, err := s.Upload(ctx, "missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected error: %v, Got: %v", ErrNotFound, err)
+	}
+
+	uploads, err := s.Uploads(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(uploads) != 2 || uploads[0].Id != earlier.Id || uploads[1].Id != u.Id {
+		t.Fatalf("Expected uploads in expiry order, Got: %#v", uploads)
+	}
+
+	if err := s.DeleteUpload(ctx, u.Id); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.DeleteUpload(ctx, u.Id); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected error: %v, Got: %v", ErrNotFound, err)
+	}
+	if uploads, err = s.Uploads(ctx); err != nil || len(uploads) != 1 {
+		t.Errorf("Expected 1 upload, Got: %#v, %v", uploads, err)
+	}
+}
+
+func testQuotas(t *testing.T, s PackageStore) {
+	ctx := context.Background()
+	owners := addTestUsers(t, s, 2)
+	for _, p := range []Package{
+		{OwnerId: owners[0], Name: "pkg", Version: "1.0.0", ObjectStoreId: "a", Size: 100},
+		{OwnerId: owners[0], Name: "pkg", Version: "1.1.0", ObjectStoreId: "b", Size: 250},
+		{OwnerId: owners[1], Name: "pkg", Version: "1.0.0", ObjectStoreId: "c", Size: 1000},
+	} {
+		if err := s.AddPackage(ctx, p); err != nil {
+			t.Fatal(err)
+		}
+	}
+	pending := PendingPackage{
+		Package:    Package{OwnerId: owners[0], Name: "pkg", Version: "2.0.0", ObjectStoreId: "d"},
+		StagingKey: "staging/1",
+	}
+	if err := s.ReservePackage(ctx, pending); err != nil {
+		t.Fatal(err)
+	}
+
+	// 게시 중인 버전은 게시 수에만 센다
+	u, err := s.Usage(ctx, owners[0], "2000-01-01 00:00:00")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.OwnerId != owners[0] || u.StoredBytes != 350 || u.Versions != 2 || u.Publishes != 3 ||
+		len(u.FirstPublish) != len(TimeFormat) {
+		t.Errorf("Unexpected usage: %#v", u)
+	}
+	u, err = s.Usage(ctx, owners[0], "2999-01-01 00:00:00")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.StoredBytes != 350 || u.Publishes != 0 || len(u.FirstPublish) != 0 {
+		t.Errorf("Expected no recent publishes, Got: %#v", u)
+	}
+	unused := addTestUsers(t, s, 1)[0]
+	if u, err = s.Usage(ctx, unused, "2000-01-01 00:00:00"); err != nil || u.StoredBytes != 0 || u.Versions != 0 {
+		t.Errorf("Expected no usage, Got: %#v, %v", u, err)
+	}
+
+	if _, err := s.OwnerLimits(ctx, owners[0]); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected error: %v, Got: %v", ErrNotFound, err)
+	}
+	l := Limits{OwnerId: owners[0], MaxStorage: 1 << 20, MaxPackageSize: LimitDefault, PublishesPerHour: LimitUnlimited}
+	for i := 0; i < 2; i++ {
+		if err := s.SetOwnerLimits(ctx, l); err != nil {
+			t.Fatal(err)
+		}
+		got, err := s.OwnerLimits(ctx, owners[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(got.Updated) != len(TimeFormat) {
+			t.Errorf("Expected updated time, Got: %q", got.Updated)
+		}
+		got.Updated = ""
+		if !reflect.DeepEqual(got, l) {
+			t.Errorf("Expected %#v, Got: %#v", l, got)
+		}
+		l.MaxStorage, l.PublishesPerHour = 2<<20, 10
+	}
+	if err := s.DeleteOwnerLimits(ctx, owners[0]); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.DeleteOwnerLimits(ctx, owners[0]); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected error: %v, Got: %v", ErrNotFound, err)
+	}
+}
+
+func testWebhooks(t *testing.T, s PackageStore) {
+	ctx := context.Background()
+	owners := addTestUsers(t, s, 2)
+	hooks := []Webhook{
+		{OwnerId: owners[0], URL: "https://ci.example.com/a", Secret: "s1"},
+		{OwnerId: owners[0], Name: "router", URL: "https://ci.example.com/b", Secret: "s2", Events: []string{EventPublished}},
+		{OwnerId: owners[1], URL: "https://ci.example.com/c", Secret: "s3", Events: []string{EventYanked, EventDeleted}},
+	}
+	for i := range hooks {
+		id, err := s.AddWebhook(ctx, hooks[i])
+		if err != nil {
+			t.Fatal(err)
+		}
+		hooks[i].Id = id
+	}
+
+	got, err := s.Webhooks(ctx, owners[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || got[0].Id != hooks[0].Id || got[1].Name != "router" ||
+		got[1].Secret != "s2" || !reflect.DeepEqual(got[1].Events, []string{EventPublished}) || len(got[1].Created) == 0 {
+		t.Fatalf("Unexpected webhooks: %#v", got)
+	}
+	if all, err := s.Webhooks(ctx, -1); err != nil || len(all) != 3 {
+		t.Fatalf("Expected 3 webhooks, Got: %d %v", len(all), err)
+	}
+	h, err := s.Webhook(ctx, hooks[2].Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h.URL != hooks[2].URL || !reflect.DeepEqual(h.Events, hooks[2].Events) {
+		t.Errorf("Expected %#v, Got: %#v", hooks[2], h)
+	}
+	if _, err := s.Webhook(ctx, 1000); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected error: %v, Got: %v", ErrNotFound, err)
+	}
+
+	router := Package{OwnerId: owners[0], Name: "router", Version: "1.0.0"}
+	matches := []bool{}
+	for _, h := range got {
+		matches = append(matches, h.Matches(EventYanked, router), h.Matches(EventPublished, router))
+	}
+	if !reflect.DeepEqual(matches, []bool{true, true, false, true}) {
+		t.Errorf("Unexpected matches: %v", matches)
+	}
+
+	deliveries := []Delivery{
+		{WebhookId: hooks[0].Id, Event: EventPublished, Payload: "{}", Status: DeliveryPending, NextAttempt: "2024-05-01 10:00:00"},
+		{WebhookId: hooks[0].Id, Event: EventYanked, Payload: "{}", Status: DeliveryPending, NextAttempt: "2024-05-01 09:00:00"},
+		{WebhookId: hooks[1].Id, Event: EventPublished, Payload: "{}", Status: DeliveryPending, NextAttempt: "2024-05-01 12:00:00"},
+	}
+	for i := range deliveries {
+		id, err := s.AddDelivery(ctx, deliveries[i])
+		if err != nil {
+			t.Fatal(err)
+		}
+		deliveries[i].Id = id
+	}
+	due, err := s.DueDeliveries(ctx, "2024-05-01 11:00:00", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(due) != 2 || due[0].Id != deliveries[1].Id || due[1].Id != deliveries[0].Id {
+		t.Fatalf("Expected deliveries due in next_attempt order, Got: %#v", due)
+	}
+	if due, _ := s.DueDeliveries(ctx, "2024-05-01 11:00:00", 1); len(due) != 1 {
+		t.Errorf("Expected limit to apply, Got: %d", len(due))
+	}
+
+	// 실패하면 다음 시각으로 미루고, 성공하면 큐에서 빠진다
+	d := due[0]
+	d.Attempts, d.NextAttempt = 1, "2024-05-01 13:00:00"
+	err = s.RecordAttempt(ctx, d, DeliveryAttempt{Attempt: 1, StatusCode: 500, Response: "oops", DurationMs: 12})
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.Status, d.Attempts, d.NextAttempt = DeliveryDelivered, 2, ""
+	err = s.RecordAttempt(ctx, d, DeliveryAttempt{Attempt: 2, StatusCode: 204})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.RecordAttempt(ctx, Delivery{Id: 1000}, DeliveryAttempt{Attempt: 1}); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected error: %v, Got: %v", ErrNotFound, err)
+	}
+	due, err = s.DueDeliveries(ctx, "2024-05-02 00:00:00", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(due) != 2 || due[0].Id != deliveries[0].Id || due[1].Id != deliveries[2].Id {
+		t.Fatalf("Expected delivered delivery to leave the queue, Got: %#v", due)
+	}
+
+	log, err := s.Deliveries(ctx, hooks[0].Id, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(log) != 2 || log[0].Id != deliveries[1].Id || log[0].Status != DeliveryDelivered ||
+		log[0].Attempts != 2 || len(log[0].NextAttempt) != 0 || log[1].Status != DeliveryPending {
+		t.Fatalf("Unexpected deliveries: %#v", log)
+	}
+	attempts, err := s.DeliveryAttempts(ctx, d.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(attempts) != 2 || attempts[0].StatusCode != 500 || attempts[0].Response != "oops" ||
+		attempts[0].DurationMs != 12 || attempts[1].StatusCode != 204 || len(attempts[1].Created) == 0 {
+		t.Fatalf("Unexpected attempts: %#v", attempts)
+	}
+
+	if err := s.DeleteWebhook(ctx, hooks[0].Id); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.DeleteWebhook(ctx, hooks[0].Id); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected error: %v, Got: %v", ErrNotFound, err)
+	}
+	if log, _ := s.Deliveries(ctx, hooks[0].Id, 10); len(log) != 0 {
+		t.Errorf("Expected deliveries to be deleted with the webhook, Got: %#v", log)
+	}
+	if attempts, _ := s.DeliveryAttempts(ctx, d.Id); len(attempts) != 0 {
+		t.Errorf("Expected attempts to be deleted with the webhook, Got: %#v", attempts)
+	}
+}
+
+func testDownloads(t *testing.T, s PackageStore) {
+	ctx := context.Background()
+	counts := []DownloadCount{
+		{OwnerId: 1, Name: "pkg", Version: "1.10.0", Day: "2024-05-01", Count: 3},
+		{OwnerId: 1, Name: "pkg", Version: "1.9.0", Day: "2024-05-01", Count: 1},
+		{OwnerId: 1, Name: "pkg", Version: "1.10.0", Day: "2024-05-02", Count: 2},
+		{OwnerId: 2, Name: "pkg", Version: "1.0.0", Day: "2024-05-02", Count: 4},
+		{OwnerId: 1, Name: "other", Version: "0.1.0", Day: "2024-04-01", Count: 10},
+	}
+	if err := s.AddDownloads(ctx, counts); err != nil {
+		t.Fatal(err)
+	}
+	// 두 번째 배치는 기존 집계에 더해진다
+	err := s.AddDownloads(ctx, []DownloadCount{
+		{OwnerId: 1, Name: "pkg", Version: "1.10.0", Day: "2024-05-02", Count: 5},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stats, err := s.DownloadStats(ctx, 1, "pkg", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []DownloadCount{
+		{OwnerId: 1, Name: "pkg", Version: "1.9.0", Day: "2024-05-01", Count: 1},
+		{OwnerId: 1, Name: "pkg", Version: "1.10.0", Day: "2024-05-01", Count: 3},
+		{OwnerId: 1, Name: "pkg", Version: "1.10.0", Day: "2024-05-02", Count: 7},
+	}
+	if !reflect.DeepEqual(stats, expected) {
+		t.Errorf("Expected %v, Got: %v", expected, stats)
+	}
+	stats, err = s.DownloadStats(ctx, 1, "pkg", "2024-05-02")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(stats, expected[2:]) {
+		t.Errorf("Expected %v, Got: %v", expected[2:], stats)
+	}
+
+	testConfigs := []struct {
+		since    string
+		limit    int
+		expected []DownloadTotal
+	}{
+		{
+			since: "2024-05-01",
+			limit: 10,
+			expected: []DownloadTotal{
+				{OwnerId: 1, Name: "pkg", Count: 11},
+				{OwnerId: 2, Name: "pkg", Count: 4},
+			},
+		},
+		{
+			since: "",
+			limit: 1,
+			expected: []DownloadTotal{
+				{OwnerId: 1, Name: "pkg", Count: 11},
+			},
+		},
+		{
+			since: "",
+			limit: 0,
+			expected: []DownloadTotal{
+				{OwnerId: 1, Name: "pkg", Count: 11},
+				{OwnerId: 1, Name: "other", Count: 10},
+				{OwnerId: 2, Name: "pkg", Count: 4},
+			},
+		},
+	}
+	for _, tc := range testConfigs {
+		top, err := s.TopDownloads(ctx, tc.since, tc.limit)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(top, tc.expected) {
+			t.Errorf("Expected top downloads since %q: %v, Got: %v", tc.since, tc.expected, top)
+		}
+	}
+}
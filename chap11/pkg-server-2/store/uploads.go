@@ -0,0 +1,20 @@
+package store
+
+// Upload는 클라이언트가 서명된 URL로 버킷에 직접 올리는 2단계 업로드다. 버전은 StagingKey의
+// 게시 중인 행으로 예약되어 있고, 완료 요청이 올라간 객체를 검사한 뒤 그 행을 게시한다.
+type Upload struct {
+	Id            string `json:"id"`
+	OwnerId       int    `json:"owner_id"`
+	Name          string `json:"name"`
+	Version       string `json:"version"`
+	ObjectStoreId string `json:"object_store_id"`
+	StagingKey    string `json:"-"`
+	// Size와 Sha256은 클라이언트가 올리겠다고 알린 객체의 크기와 체크섬이다.
+	Size   int64  `json:"size"`
+	Sha256 string `json:"sha256"`
+	// Manifest는 요청으로 받은 메타데이터의 JSON이다. 저장소는 내용을 해석하지 않는다.
+	Manifest string `json:"-"`
+	// Expires는 TimeFormat 형식의 UTC 시각이다. 이 시각이 지나면 업로드를 완료할 수 없다.
+	Expires string `json:"expires"`
+	Created string `json:"created"`
+}
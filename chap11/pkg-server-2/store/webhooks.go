@@ -0,0 +1,70 @@
+package store
+
+// 웹훅 이벤트
+const (
+	EventPublished = "package.published"
+	EventYanked    = "package.yanked"
+	EventDeleted   = "package.deleted"
+)
+
+var Events = []string{EventPublished, EventYanked, EventDeleted}
+
+// 전송 상태
+const (
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	DeliveryFailed    = "failed"
+)
+
+type Webhook struct {
+	Id      int `json:"id"`
+	OwnerId int `json:"owner_id"`
+	// Name이 비어 있으면 소유자의 모든 패키지 이벤트를 받는다.
+	Name string `json:"name,omitempty"`
+	URL  string `json:"url"`
+	// Secret은 본문의 HMAC-SHA256 서명을 만드는 키다.
+	Secret string `json:"-"`
+	// Events가 비어 있으면 모든 이벤트를 받는다.
+	Events  []string `json:"events"`
+	Created string   `json:"created"`
+}
+
+// Matches는 웹훅이 패키지 p의 event를 받는지 확인한다.
+func (h Webhook) Matches(event string, p Package) bool {
+	if h.OwnerId != p.OwnerId || (len(h.Name) != 0 && h.Name != p.Name) {
+		return false
+	}
+	if len(h.Events) == 0 {
+		return true
+	}
+	for _, e := range h.Events {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+// Delivery는 재시도 큐에 있는 웹훅 전송이다.
+type Delivery struct {
+	Id        int    `json:"id"`
+	WebhookId int    `json:"webhook_id"`
+	Event     string `json:"event"`
+	Payload   string `json:"payload"`
+	Status    string `json:"status"`
+	Attempts  int    `json:"attempts"`
+	// NextAttempt는 다음에 보낼 TimeFormat 형식의 UTC 시각이다. 전송이 끝나면 비어 있다.
+	NextAttempt string `json:"next_attempt,omitempty"`
+	Created     string `json:"created"`
+}
+
+// DeliveryAttempt는 전송 시도 한 번의 기록이다. 연결하지 못했으면 StatusCode가 0이다.
+type DeliveryAttempt struct {
+	DeliveryId int    `json:"delivery_id"`
+	Attempt    int    `json:"attempt"`
+	StatusCode int    `json:"status_code"`
+	Response   string `json:"response"`
+	Error      string `json:"error,omitempty"`
+	DurationMs int64  `json:"duration_ms"`
+	Created    string `json:"created"`
+}
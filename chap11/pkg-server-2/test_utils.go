@@ -1,17 +1,13 @@
 package main
 
 import (
-	"context"
-	"database/sql"
+	"bytes"
 	"fmt"
+	"mime/multipart"
+	"net/http"
 	"net/url"
 	"os"
-	"path/filepath"
-	"time"
 
-	"github.com/docker/go-connections/nat"
-	"github.com/testcontainers/testcontainers-go"
-	"github.com/testcontainers/testcontainers-go/wait"
 	"gocloud.dev/blob"
 	"gocloud.dev/blob/fileblob"
 )
@@ -33,65 +29,32 @@ func getTestBucket(tmpDir string) (*blob.Bucket, error) {
 	return fileblob.OpenBucket(myDir, &opts)
 }
 
-func getTestDb() (testcontainers.Container, *sql.DB, error) {
-	myDir, err := os.Stat("mysql-init")
+func newUploadRequest(
+	url, token string, fields map[string]string,
+	filename string, data []byte,
+) (*http.Request, error) {
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	for k, v := range fields {
+		if err := mw.WriteField(k, v); err != nil {
+			return nil, err
+		}
+	}
+	fw, err := mw.CreateFormFile("filedata", filename)
 	if err != nil {
-		return nil, nil, err
-	}
-
-	cwd, err := os.Getwd()
-	if err != nil {
-		return nil, nil, err
-	}
-
-	bindMountPath := filepath.Join(cwd, myDir.Name())
-
-	waitForSql := wait.ForSQL("3306/tcp", "mysql", func(host string, p nat.Port) string {
-		return "root:rootpw@tcp(127.0.0.1:" + p.Port() + ")/pakcage_server"
-	})
-	waitForSql.WithPollInterval(5 * time.Second)
-	waitForSql.WithStartupTimeout(1 * time.Minute)
-
-	req := testcontainers.ContainerRequest{
-		Image:        "mysql:latest",
-		ExposedPorts: []string{"3306/tcp"},
-		Env: map[string]string{
-			"MYSQL_DATABASE":      "package_server",
-			"MYSQL_USER":          "packages_rw",
-			"MYSQL_PASSWORD":      "password",
-			"MYSQL_ROOT_PASSWORD": "rootpw",
-		},
-		ImagePlatform: "linux/x86_64",
-		Files: []testcontainers.ContainerFile{
-			{
-				HostFilePath:      bindMountPath,
-				ContainerFilePath: "/docker-entrypoint-initdb.d",
-				FileMode:          0o777,
-			},
-		},
-		WaitingFor: waitForSql,
+		return nil, err
 	}
-	ctx := context.Background()
-	mysqlC, err := testcontainers.GenericContainer(
-		ctx,
-		testcontainers.GenericContainerRequest{
-			ContainerRequest: req,
-			Started:          true,
-		},
-	)
-	if err != nil {
-		return mysqlC, nil, err
+	if _, err := fw.Write(data); err != nil {
+		return nil, err
 	}
-	addr, err := mysqlC.PortEndpoint(ctx, "3306", "")
-	if err != nil {
-		return mysqlC, nil, err
+	if err := mw.Close(); err != nil {
+		return nil, err
 	}
-	db, err := getDatabaseConn(
-		addr, "package_server",
-		"package_rw", "password",
-	)
+	req, err := http.NewRequest("POST", url, &body)
 	if err != nil {
-		return mysqlC, nil, nil
+		return nil, err
 	}
-	return mysqlC, db, nil
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	req.Header.Set("Authorization", "Bearer "+token)
+	return req, nil
 }
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/PaulOh5/pkg-server-2/apitoken"
+	"github.com/PaulOh5/pkg-server-2/store"
+)
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	jsonData, err := json.Marshal(v)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	fmt.Fprint(w, string(jsonData))
+}
+
+func tokenCreateHandler(
+	w http.ResponseWriter,
+	r *http.Request,
+	config appConfig,
+) {
+	a, ok := getAuth(r)
+	if !ok {
+		unauthorized(w, "Authentication required")
+		return
+	}
+
+	req := tokenCreateRequest{}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(req.Name) == 0 {
+		http.Error(w, "Must specify token name", http.StatusBadRequest)
+		return
+	}
+	if err := apitoken.ValidateScopes(req.Scopes); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	// 자신이 가진 것보다 넓은 권한의 토큰은 만들 수 없다
+	for _, scope := range req.Scopes {
+		if !a.hasScope(scope) {
+			http.Error(w, fmt.Sprintf("Cannot grant the %s scope", scope), http.StatusForbidden)
+			return
+		}
+	}
+
+	userId := a.userId
+	if req.UserId != 0 && req.UserId != a.userId {
+		if !a.hasScope(scopeAdmin) {
+			http.Error(w, "Creating tokens for other users requires the admin scope", http.StatusForbidden)
+			return
+		}
+		exists, err := config.packageStore.UserExists(r.Context(), req.UserId)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if !exists {
+			http.Error(w, "No such user", http.StatusNotFound)
+			return
+		}
+		userId = req.UserId
+	}
+
+	token, err := apitoken.Generate()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	t := store.Token{UserId: userId, Name: req.Name, Scopes: req.Scopes}
+	t.Id, err = config.packageStore.AddToken(r.Context(), t, apitoken.Hash(token))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	config.logger.Printf("Token %d created for user %d by user %d\n", t.Id, userId, a.userId)
+	writeJSON(w, http.StatusCreated, tokenCreateResponse{Token: t, Secret: token})
+}
+
+func tokenListHandler(
+	w http.ResponseWriter,
+	r *http.Request,
+	config appConfig,
+) {
+	a, ok := getAuth(r)
+	if !ok {
+		unauthorized(w, "Authentication required")
+		return
+	}
+
+	userId := a.userId
+	if user := r.URL.Query().Get("user_id"); len(user) != 0 {
+		id, err := strconv.Atoi(user)
+		if err != nil {
+			http.Error(w, "Invalid user_id", http.StatusBadRequest)
+			return
+		}
+		if id != a.userId && !a.hasScope(scopeAdmin) {
+			http.Error(w, "Listing tokens of other users requires the admin scope", http.StatusForbidden)
+			return
+		}
+		userId = id
+	}
+
+	tokens, err := config.packageStore.Tokens(r.Context(), userId)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, tokens)
+}
+
+func tokenRevokeHandler(
+	w http.ResponseWriter,
+	r *http.Request,
+	config appConfig,
+) {
+	a, ok := getAuth(r)
+	if !ok {
+		unauthorized(w, "Authentication required")
+		return
+	}
+	id, err := strconv.Atoi(r.URL.Query().Get("id"))
+	if err != nil {
+		http.Error(w, "Must specify token id", http.StatusBadRequest)
+		return
+	}
+
+	userId := a.userId
+	if a.hasScope(scopeAdmin) {
+		userId = -1
+	}
+	revoked, err := config.packageStore.RevokeToken(r.Context(), id, userId)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !revoked {
+		http.Error(w, "No such active token", http.StatusNotFound)
+		return
+	}
+	config.logger.Printf("Token %d revoked by user %d\n", id, a.userId)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func tokenHandler(
+	w http.ResponseWriter,
+	r *http.Request,
+	config appConfig,
+) {
+	switch r.Method {
+	case "GET":
+		tokenListHandler(w, r, config)
+	case "POST":
+		tokenCreateHandler(w, r, config)
+	case "DELETE":
+		tokenRevokeHandler(w, r, config)
+	default:
+		http.Error(w, "Invalid Method", http.StatusMethodNotAllowed)
+	}
+}
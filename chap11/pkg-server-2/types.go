@@ -1,5 +1,12 @@
 package main
 
+import (
+	"time"
+
+	"github.com/PaulOh5/pkg-server-2/digest"
+	"github.com/PaulOh5/pkg-server-2/store"
+)
+
 // type pkgData struct {
 // 	Name     string
 // 	Version  string
@@ -8,19 +15,142 @@ package main
 // }
 
 type pkgRegisterResponse struct {
-	ID string `json:"id"`
+	ID     string `json:"id"`
+	Size   int64  `json:"size"`
+	Sha256 string `json:"sha256"`
+	Sha512 string `json:"sha512"`
+}
+
+// uploadCreateRequest의 Size와 Sha256은 올릴 파일의 크기와 체크섬이다. 업로드를 완료할 때
+// 버킷에 올라간 객체와 비교한다.
+type uploadCreateRequest struct {
+	Name     string `json:"name"`
+	Version  string `json:"version"`
+	Filename string `json:"filename"`
+	Size     int64  `json:"size"`
+	Sha256   string `json:"sha256"`
+	packageManifest
+}
+
+// uploadCreateResponse의 URL로 Expires까지 Method 요청을 보내 파일을 올린다.
+type uploadCreateResponse struct {
+	Id      string `json:"id"`
+	URL     string `json:"url"`
+	Method  string `json:"method"`
+	Expires string `json:"expires"`
+}
+
+// dependencyNode는 의존성 트리의 한 버전이다. Version은 Constraint를 만족하는 가장 높은
+// 게시된 버전이고, 루트에는 Constraint가 없다.
+type dependencyNode struct {
+	OwnerId    int    `json:"owner_id"`
+	Name       string `json:"name"`
+	Version    string `json:"version,omitempty"`
+	Constraint string `json:"constraint,omitempty"`
+	// Unresolved는 제약을 만족하는 버전이 없다는 뜻이다.
+	Unresolved bool `json:"unresolved,omitempty"`
+	// Deduped는 트리의 앞에서 이미 펼친 버전이라 의존성을 생략했다는 뜻이다.
+	Deduped      bool             `json:"deduped,omitempty"`
+	Dependencies []dependencyNode `json:"dependencies"`
+}
+
+type pkgQueryResponse struct {
+	Packages      []store.Package `json:"packages"`
+	NextPageToken string          `json:"next_page_token,omitempty"`
+}
+
+type pkgVerifyResponse struct {
+	ObjectStoreId string         `json:"object_store_id"`
+	Size          int64          `json:"size"`
+	Expected      digest.Digests `json:"expected"`
+	Actual        digest.Digests `json:"actual"`
+	Verified      bool           `json:"verified"`
+	Error         string         `json:"error,omitempty"`
+}
+
+// searchResult는 README를 뺀 latest 버전의 메타데이터와 순위를 정한 값이다.
+type searchResult struct {
+	store.Metadata
+	Matched int `json:"matched_terms"`
+	Score   int `json:"score"`
+}
+
+type searchResponse struct {
+	Results []searchResult `json:"results"`
+}
+
+type versionDownloads struct {
+	Version   string `json:"version"`
+	Downloads int64  `json:"downloads"`
+}
+
+type dailyDownloads struct {
+	Day       string `json:"day"`
+	Downloads int64  `json:"downloads"`
+}
+
+type pkgStatsResponse struct {
+	OwnerId  int                `json:"owner_id"`
+	Name     string             `json:"name"`
+	Total    int64              `json:"total"`
+	Versions []versionDownloads `json:"versions"`
+	Daily    []dailyDownloads   `json:"daily"`
+}
+
+type topDownloadsResponse struct {
+	Since    string                `json:"since"`
+	Packages []store.DownloadTotal `json:"packages"`
+}
+
+// usageResponse의 PublishesReset은 게시 한도가 하나 늘어날 때까지 남은 초다.
+type usageResponse struct {
+	OwnerId           int        `json:"owner_id"`
+	StoredBytes       int64      `json:"stored_bytes"`
+	Versions          int        `json:"versions"`
+	PublishesLastHour int        `json:"publishes_last_hour"`
+	PublishesReset    int        `json:"publishes_reset,omitempty"`
+	Limits            ownerQuota `json:"limits"`
+}
+
+// moduleInfo는 GOPROXY의 .info와 @latest 응답이다.
+type moduleInfo struct {
+	Version string
+	Time    time.Time
+}
+
+type webhookPayload struct {
+	Event     string        `json:"event"`
+	Timestamp string        `json:"timestamp"`
+	Package   store.Package `json:"package"`
+}
+
+type webhookCreateRequest struct {
+	OwnerId int      `json:"owner_id"`
+	Name    string   `json:"name"`
+	URL     string   `json:"url"`
+	Events  []string `json:"events"`
+	// Secret이 비어 있으면 서버가 만든다.
+	Secret string `json:"secret"`
+}
+
+// webhookCreateResponse의 Secret은 웹훅을 만들 때만 보여준다.
+type webhookCreateResponse struct {
+	store.Webhook
+	Secret string `json:"secret"`
+}
+
+type deliveryLog struct {
+	store.Delivery
+	AttemptLog []store.DeliveryAttempt `json:"attempt_log"`
 }
 
-type pkgQueryParams struct {
-	name    string
-	version string
-	ownerId int
+type tokenCreateRequest struct {
+	Name   string   `json:"name"`
+	Scopes []string `json:"scopes"`
+	UserId int      `json:"user_id"`
 }
 
-type pkgRow struct {
-	OwnerId       int    `json:"owner_id"`
-	Name          string `json:"name"`
-	Version       string `json:"version"`
-	ObjectStoreId string `json:"object_store_id"`
-	Created       string `json:"created"`
+type tokenCreateResponse struct {
+	store.Token
+	Secret string `json:"token"`
 }
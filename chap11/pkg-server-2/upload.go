@@ -2,33 +2,196 @@ package main
 
 import (
 	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
 	"mime/multipart"
+	"net/http"
+	"strings"
+
+	"github.com/PaulOh5/pkg-server-2/digest"
+	"github.com/PaulOh5/pkg-server-2/semver"
 )
 
-func uploadData(
-	config appConfig, objectId string, f *multipart.FileHeader,
-) (int64, error) {
-	ctx := context.Background()
+const (
+	defaultMaxPackageSize = 100 << 20
+	// filedata 외의 필드를 모두 합친 크기의 상한. 본문 전체는 최대 패키지 크기에 이만큼을 더한 크기로 제한한다.
+	maxFormFieldsSize = 1 << 20
+)
+
+var (
+	errChecksumMismatch = errors.New("checksum mismatch")
+	errPackageTooLarge  = errors.New("package exceeds the maximum size")
+	errPackageExists    = errors.New("Package version for the owner exists")
+)
 
-	fData, err := f.Open()
+// badRequestError는 클라이언트가 고쳐야 하는 업로드 오류다.
+type badRequestError struct {
+	message string
+}
+
+func (e badRequestError) Error() string {
+	return e.message
+}
+
+func badRequest(format string, args ...interface{}) error {
+	return badRequestError{message: fmt.Sprintf(format, args...)}
+}
+
+func uploadErrorStatus(err error) int {
+	var maxBytesErr *http.MaxBytesError
+	var badReq badRequestError
+	switch {
+	case errors.As(err, &maxBytesErr) || errors.Is(err, errPackageTooLarge):
+		return http.StatusRequestEntityTooLarge
+	case errors.Is(err, errPackageExists):
+		return http.StatusConflict
+	case errors.Is(err, errModuleOwned):
+		return http.StatusForbidden
+	case errors.Is(err, errUploadExpired):
+		return http.StatusGone
+	case errors.Is(err, errStorageQuota):
+		return http.StatusInsufficientStorage
+	case errors.Is(err, errPublishRateLimit):
+		return http.StatusTooManyRequests
+	case errors.Is(err, errDependencyCycle) || errors.Is(err, errUnresolvedDependency) ||
+		errors.Is(err, errDependencyTooDeep):
+		return http.StatusBadRequest
+	case errors.As(err, &badReq) ||
+		errors.Is(err, errChecksumMismatch) ||
+		errors.Is(err, semver.ErrInvalidVersion):
+		return http.StatusBadRequest
+	case errors.Is(err, multipart.ErrMessageTooLarge):
+		return http.StatusRequestEntityTooLarge
+	}
+	return http.StatusInternalServerError
+}
+
+type pkgRegisterForm struct {
+	name           string
+	version        string
+	expectedSha256 string
+	// manifest는 폼 필드로 받은 메타데이터로, 아카이브의 package.json보다 우선한다.
+	manifest   packageManifest
+	fieldsSize int64
+}
+
+// readField는 filedata 앞에 오는 일반 필드를 읽는다. 모르는 필드는 무시한다.
+func (f *pkgRegisterForm) readField(part *multipart.Part) error {
+	if len(part.FileName()) != 0 {
+		return badRequest("unexpected file part %q", part.FormName())
+	}
+	data, err := io.ReadAll(io.LimitReader(part, maxFormFieldsSize-f.fieldsSize+1))
 	if err != nil {
-		return 0, err
+		return err
+	}
+	f.fieldsSize += int64(len(data))
+	if f.fieldsSize > maxFormFieldsSize {
+		return fmt.Errorf("%w: form fields are too large", errPackageTooLarge)
+	}
+	value := string(data)
+	switch part.FormName() {
+	case "name":
+		f.name = value
+	case "version":
+		f.version = value
+	case "expected_sha256":
+		f.expectedSha256 = value
+	case "description":
+		f.manifest.Description = value
+	case "license":
+		f.manifest.License = value
+	case "homepage":
+		f.manifest.Homepage = value
+	case "keywords":
+		// 쉼표로 구분한다
+		f.manifest.Keywords = strings.Split(value, ",")
+	case "readme":
+		f.manifest.Readme = value
+	case "dependencies":
+		// package.json의 dependencies와 같은 JSON 객체다
+		if err := json.Unmarshal(data, &f.manifest.Dependencies); err != nil {
+			return badRequest("dependencies must be a JSON object of version constraints: %v", err)
+		}
 	}
-	defer fData.Close()
+	return nil
+}
+
+func (f *pkgRegisterForm) validate() error {
+	if len(f.name) == 0 || len(f.version) == 0 {
+		return badRequest("name and version fields must be sent before filedata")
+	}
+	v, err := semver.Parse(f.version)
+	if err != nil {
+		return err
+	}
+	f.version = v.String()
+	if len(f.expectedSha256) != 0 && !isHexDigest(f.expectedSha256, 64) {
+		return badRequest("expected_sha256 must be a hex encoded SHA-256 digest")
+	}
+	return f.manifest.normalize()
+}
+
+// isHexDigest는 s가 length 글자의 16진수 다이제스트인지 확인한다. 대소문자는 가리지 않는다.
+func isHexDigest(s string, length int) bool {
+	if len(s) != length {
+		return false
+	}
+	_, err := hex.DecodeString(s)
+	return err == nil
+}
+
+type uploadResult struct {
+	size    int64
+	digests digest.Digests
+}
+
+// uploadData는 r을 버킷에 쓰면서 체크섬을 계산한다. 크기가 maxSize를 넘거나
+// expectedSha256과 다르거나 ctx가 취소되면(클라이언트가 연결을 끊은 경우 포함)
+// 쓰던 객체를 버리고 오류를 반환한다.
+func uploadData(
+	ctx context.Context,
+	config appConfig, objectId string, r io.Reader,
+	expectedSha256 string, maxSize int64,
+) (uploadResult, error) {
+	result := uploadResult{}
 
+	// Close 전에 컨텍스트를 취소하면 쓰던 객체는 버킷에 남지 않는다
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
 	w, err := config.packageBucket.NewWriter(ctx, objectId, nil)
 	if err != nil {
-		return 0, err
+		return result, err
+	}
+	abort := func(err error) (uploadResult, error) {
+		cancel()
+		w.Close()
+		return result, err
 	}
 
-	nBytes, err := io.Copy(w, fData)
+	h := digest.NewHasher()
+	result.size, err = io.Copy(io.MultiWriter(w, h), io.LimitReader(r, maxSize+1))
 	if err != nil {
-		return 0, err
+		return abort(err)
+	}
+	if result.size > maxSize {
+		return abort(fmt.Errorf("%w of %d bytes", errPackageTooLarge, maxSize))
+	}
+	if err := ctx.Err(); err != nil {
+		return abort(err)
+	}
+	result.digests = h.Digests()
+	if len(expectedSha256) != 0 && !strings.EqualFold(expectedSha256, result.digests.Sha256) {
+		return abort(fmt.Errorf(
+			"%w: expected sha256 %s, Got: %s",
+			errChecksumMismatch, expectedSha256, result.digests.Sha256,
+		))
 	}
 	err = w.Close()
 	if err != nil {
-		return nBytes, err
+		return result, err
 	}
-	return nBytes, nil
+	return result, nil
 }
@@ -0,0 +1,415 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/PaulOh5/pkg-server-2/digest"
+	"github.com/PaulOh5/pkg-server-2/semver"
+	"github.com/PaulOh5/pkg-server-2/store"
+	"gocloud.dev/blob"
+	"gocloud.dev/gcerrors"
+)
+
+// defaultUploadExpiry는 서명된 업로드 URL과 업로드를 완료할 수 있는 기한이다.
+const defaultUploadExpiry = 15 * time.Minute
+
+var errUploadExpired = errors.New("upload has expired")
+
+func newUploadId() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func (req *uploadCreateRequest) validate(maxSize int64) error {
+	if len(req.Name) == 0 || len(req.Version) == 0 || len(req.Filename) == 0 {
+		return badRequest("name, version and filename are required")
+	}
+	if strings.ContainsAny(req.Filename, `/\`) || req.Filename == "." || req.Filename == ".." {
+		return badRequest("filename must be a file name")
+	}
+	v, err := semver.Parse(req.Version)
+	if err != nil {
+		return err
+	}
+	req.Version = v.String()
+	if req.Size <= 0 {
+		return badRequest("size must be positive")
+	}
+	if req.Size > maxSize {
+		return fmt.Errorf("%w of %d bytes", errPackageTooLarge, maxSize)
+	}
+	if !isHexDigest(req.Sha256, 64) {
+		return badRequest("sha256 must be a hex encoded SHA-256 digest")
+	}
+	req.Sha256 = strings.ToLower(req.Sha256)
+	return req.packageManifest.normalize()
+}
+
+// findUpload은 id 파라미터의 업로드를 찾는다. 다른 소유자의 업로드는 관리자만 다룰 수 있다.
+func findUpload(w http.ResponseWriter, r *http.Request, config appConfig, a authContextValue) (store.Upload, bool) {
+	u, err := config.packageStore.Upload(r.Context(), r.URL.Query().Get("id"))
+	if err == nil && u.OwnerId != a.userId && !a.hasScope(scopeAdmin) {
+		err = store.ErrNotFound
+	}
+	if errors.Is(err, store.ErrNotFound) {
+		http.Error(w, "No such upload", http.StatusNotFound)
+		return u, false
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return u, false
+	}
+	return u, true
+}
+
+func uploadExpired(u store.Upload, now time.Time) (bool, error) {
+	expires, err := time.Parse(store.TimeFormat, u.Expires)
+	if err != nil {
+		return false, err
+	}
+	return now.After(expires), nil
+}
+
+// uploadCreateHandler는 버전을 예약하고 클라이언트가 패키지를 버킷에 직접 올릴 서명된
+// PUT URL을 돌려준다. 올린 뒤에는 /api/packages/uploads/finalize로 업로드를 완료한다.
+func uploadCreateHandler(
+	w http.ResponseWriter,
+	r *http.Request,
+	config appConfig,
+	a authContextValue,
+) {
+	req := uploadCreateRequest{}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	quota, ok := checkPublishQuota(w, r, config, a.userId)
+	if !ok {
+		return
+	}
+	if err := req.validate(quota.MaxPackageSize); err != nil {
+		http.Error(w, err.Error(), uploadErrorStatus(err))
+		return
+	}
+	// 올린 크기는 완료할 때 다시 확인한다
+	if err := checkStorageQuota(r.Context(), config, a.userId, quota, req.Size); err != nil {
+		http.Error(w, err.Error(), uploadErrorStatus(err))
+		return
+	}
+	manifest, err := json.Marshal(req.packageManifest)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	id, err := newUploadId()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	stagingKey, err := newStagingKey(a.userId)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	pending := store.PendingPackage{
+		Package: store.Package{
+			OwnerId:       a.userId,
+			Name:          req.Name,
+			Version:       req.Version,
+			ObjectStoreId: packageObjectKey(a.userId, req.Name, req.Version, req.Filename),
+		},
+		StagingKey: stagingKey,
+	}
+	err = config.packageStore.ReservePackage(r.Context(), pending)
+	if errors.Is(err, store.ErrExists) {
+		err = errPackageExists
+	}
+	if err != nil {
+		http.Error(w, err.Error(), uploadErrorStatus(err))
+		return
+	}
+
+	expiry := config.uploadExpiry
+	if expiry <= 0 {
+		expiry = defaultUploadExpiry
+	}
+	expires := time.Now().Add(expiry).UTC()
+	signedURL, err := config.packageBucket.SignedURL(r.Context(), stagingKey, &blob.SignedURLOptions{
+		Method: http.MethodPut,
+		Expiry: expiry,
+	})
+	if err == nil {
+		err = config.packageStore.AddUpload(r.Context(), store.Upload{
+			Id:            id,
+			OwnerId:       a.userId,
+			Name:          req.Name,
+			Version:       req.Version,
+			ObjectStoreId: pending.ObjectStoreId,
+			StagingKey:    stagingKey,
+			Size:          req.Size,
+			Sha256:        req.Sha256,
+			Manifest:      string(manifest),
+			Expires:       expires.Format(store.TimeFormat),
+		})
+	}
+	if err != nil {
+		abortPublish(config, pending)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	config.logger.Printf("Upload %s started for %s by user %d\n", id, pending.ObjectStoreId, a.userId)
+	writeJSON(w, http.StatusCreated, uploadCreateResponse{
+		Id:      id,
+		URL:     signedURL,
+		Method:  http.MethodPut,
+		Expires: expires.Format(time.RFC3339),
+	})
+}
+
+// uploadCancelHandler는 완료하지 않은 업로드와 예약을 지운다.
+func uploadCancelHandler(
+	w http.ResponseWriter,
+	r *http.Request,
+	config appConfig,
+	a authContextValue,
+) {
+	u, ok := findUpload(w, r, config, a)
+	if !ok {
+		return
+	}
+	if err := cancelUpload(r.Context(), config, u); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	config.logger.Printf("Upload %s cancelled by user %d\n", u.Id, a.userId)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// packageUploadsHandler는 2단계 업로드를 시작하고(POST) 취소한다(DELETE).
+func packageUploadsHandler(
+	w http.ResponseWriter,
+	r *http.Request,
+	config appConfig,
+) {
+	a, ok := requireScope(w, r, scopePublish)
+	if !ok {
+		return
+	}
+	switch r.Method {
+	case "POST":
+		uploadCreateHandler(w, r, config, a)
+	case "DELETE":
+		uploadCancelHandler(w, r, config, a)
+	default:
+		http.Error(w, "Invalid Method", http.StatusMethodNotAllowed)
+	}
+}
+
+// uploadFinalizeHandler는 클라이언트가 버킷에 올린 객체의 크기와 체크섬을 확인하고
+// 예약한 버전을 게시한다. 확인에 실패해도 기한 안에는 다시 올리고 완료할 수 있다.
+func uploadFinalizeHandler(
+	w http.ResponseWriter,
+	r *http.Request,
+	config appConfig,
+) {
+	if r.Method != "POST" {
+		http.Error(w, "Invalid Method", http.StatusMethodNotAllowed)
+		return
+	}
+	a, ok := requireScope(w, r, scopePublish)
+	if !ok {
+		return
+	}
+	u, ok := findUpload(w, r, config, a)
+	if !ok {
+		return
+	}
+	d, err := finalizeUpload(r.Context(), config, u)
+	if err != nil {
+		http.Error(w, err.Error(), uploadErrorStatus(err))
+		return
+	}
+	writeJSON(w, http.StatusOK, d)
+}
+
+func finalizeUpload(ctx context.Context, config appConfig, u store.Upload) (pkgRegisterResponse, error) {
+	expired, err := uploadExpired(u, time.Now())
+	if err != nil {
+		return pkgRegisterResponse{}, err
+	}
+	if expired {
+		return pkgRegisterResponse{}, errUploadExpired
+	}
+	// 클라이언트는 서명된 URL로 임시 객체를 계속 바꿀 수 있으므로 서버만 아는 키로 복사한 뒤
+	// 그 사본을 검사하고 게시한다
+	verifiedKey, err := newStagingKey(u.OwnerId)
+	if err != nil {
+		return pkgRegisterResponse{}, err
+	}
+	err = config.packageBucket.Copy(ctx, verifiedKey, u.StagingKey, nil)
+	if gcerrors.Code(err) == gcerrors.NotFound {
+		return pkgRegisterResponse{}, badRequest("package data has not been uploaded")
+	}
+	if err != nil {
+		return pkgRegisterResponse{}, err
+	}
+	published := false
+	defer func() {
+		if published {
+			return
+		}
+		// 지우지 못한 사본은 reconcilePublishes가 지운다
+		if err := config.packageBucket.Delete(context.WithoutCancel(ctx), verifiedKey); err != nil {
+			config.logger.Printf("Failed to remove staged copy %s: %v\n", verifiedKey, err)
+		}
+	}()
+
+	result, err := verifyUpload(ctx, config, u, verifiedKey)
+	if err != nil {
+		return pkgRegisterResponse{}, err
+	}
+	manifest := packageManifest{}
+	if err := json.Unmarshal([]byte(u.Manifest), &manifest); err != nil {
+		return pkgRegisterResponse{}, err
+	}
+	// 업로드를 시작한 뒤 다른 버전을 게시했거나 관리자가 한도를 낮췄을 수 있다
+	quota, err := effectiveQuota(ctx, config, u.OwnerId)
+	if err != nil {
+		return pkgRegisterResponse{}, err
+	}
+	if err := checkStorageQuota(ctx, config, u.OwnerId, quota, result.size); err != nil {
+		return pkgRegisterResponse{}, err
+	}
+	m, err := inspectArchive(config, u.OwnerId, u.Name, u.Version, manifest)(ctx, verifiedKey)
+	if err != nil {
+		return pkgRegisterResponse{}, err
+	}
+
+	pending := store.PendingPackage{
+		Package: store.Package{
+			OwnerId:       u.OwnerId,
+			Name:          u.Name,
+			Version:       u.Version,
+			ObjectStoreId: u.ObjectStoreId,
+		},
+		StagingKey: verifiedKey,
+	}
+	d, err := finishPublish(ctx, config, pending, result, m)
+	// 기한이 지나 reconcilePublishes가 예약을 지웠다
+	if errors.Is(err, store.ErrNotFound) {
+		return d, errUploadExpired
+	}
+	if err != nil {
+		return d, err
+	}
+	// finishPublish가 사본을 지웠다. 클라이언트가 올린 임시 객체와 남은 업로드는 예약이 이미
+	// 게시되었으므로 reconcilePublishes가 지운다
+	published = true
+	cleanupCtx := context.WithoutCancel(ctx)
+	if err := config.packageBucket.Delete(cleanupCtx, u.StagingKey); err != nil {
+		config.logger.Printf("Failed to remove staged upload %s: %v\n", u.StagingKey, err)
+	}
+	if err := config.packageStore.DeleteUpload(cleanupCtx, u.Id); err != nil {
+		config.logger.Printf("Failed to remove finalized upload %s: %v\n", u.Id, err)
+	}
+	return d, nil
+}
+
+// verifyUpload은 key에 복사한 업로드를 읽어 클라이언트가 알린 크기, SHA-256과 같은지 확인하고
+// 체크섬을 계산한다.
+func verifyUpload(ctx context.Context, config appConfig, u store.Upload, key string) (uploadResult, error) {
+	result := uploadResult{}
+	r, err := config.packageBucket.NewReader(ctx, key, nil)
+	if gcerrors.Code(err) == gcerrors.NotFound {
+		return result, badRequest("package data has not been uploaded")
+	}
+	if err != nil {
+		return result, err
+	}
+	defer r.Close()
+	if r.Size() != u.Size {
+		return result, badRequest("uploaded object is %d bytes, expected %d", r.Size(), u.Size)
+	}
+
+	h := digest.NewHasher()
+	result.size, err = io.Copy(h, io.LimitReader(r, u.Size+1))
+	if err != nil {
+		return result, err
+	}
+	if result.size != u.Size {
+		return result, badRequest("uploaded object is %d bytes, expected %d", result.size, u.Size)
+	}
+	result.digests = h.Digests()
+	if result.digests.Sha256 != u.Sha256 {
+		return result, fmt.Errorf(
+			"%w: expected sha256 %s, Got: %s",
+			errChecksumMismatch, u.Sha256, result.digests.Sha256,
+		)
+	}
+	return result, nil
+}
+
+// cancelUpload은 업로드의 예약이 아직 게시되지 않았으면 예약과 임시 객체를 지우고 업로드를
+// 지운다. 예약을 먼저 지우므로 그사이 완료하던 업로드는 게시에 실패하고 finishPublish가 복사한
+// 객체를 지운다.
+func cancelUpload(ctx context.Context, config appConfig, u store.Upload) error {
+	err := config.packageStore.AbortPackage(ctx, u.OwnerId, u.Name, u.Version)
+	switch {
+	case err == nil:
+		pending := store.PendingPackage{
+			Package:    store.Package{ObjectStoreId: u.ObjectStoreId},
+			StagingKey: u.StagingKey,
+		}
+		if err := removePendingObjects(ctx, config, pending, false); err != nil {
+			return err
+		}
+	case !errors.Is(err, store.ErrNotFound):
+		return err
+	}
+	err = config.packageStore.DeleteUpload(ctx, u.Id)
+	if err != nil && !errors.Is(err, store.ErrNotFound) {
+		return err
+	}
+	return nil
+}
+
+// reconcileUploads는 기한이 지난 업로드를 취소하고 지운 임시 키를 반환한다. active에는
+// 아직 완료할 수 있는 업로드의 임시 키를 넣는다. 이 업로드의 예약과 객체는 오래되었어도
+// 지우면 안 된다.
+func reconcileUploads(ctx context.Context, config appConfig, active map[string]bool) ([]string, error) {
+	removed := []string{}
+	uploads, err := config.packageStore.Uploads(ctx)
+	if err != nil {
+		return removed, err
+	}
+	now := time.Now()
+	for _, u := range uploads {
+		expired, err := uploadExpired(u, now)
+		if err != nil {
+			return removed, err
+		}
+		if !expired {
+			active[u.StagingKey] = true
+			continue
+		}
+		if err := cancelUpload(ctx, config, u); err != nil {
+			return removed, err
+		}
+		removed = append(removed, u.StagingKey)
+		config.logger.Printf("Removed expired upload %s of %s\n", u.Id, u.ObjectStoreId)
+	}
+	return removed, nil
+}
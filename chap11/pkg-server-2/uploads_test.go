@@ -0,0 +1,282 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/PaulOh5/pkg-server-2/apitoken"
+	"github.com/PaulOh5/pkg-server-2/store"
+	"gocloud.dev/blob"
+	"gocloud.dev/blob/fileblob"
+)
+
+// newSignedURLBucket은 서명된 URL이 storage 서버를 가리키는 버킷을 만든다. storage 서버는
+// S3처럼 서명과 만료 시각, 메서드를 확인한 뒤 본문을 버킷에 쓴다.
+func newSignedURLBucket(t *testing.T) (*blob.Bucket, *httptest.Server) {
+	dir := t.TempDir()
+	var signer *fileblob.URLSignerHMAC
+	var bucket *blob.Bucket
+	storage := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key, err := signer.KeyFromURL(r.Context(), r.URL)
+		if err != nil || r.URL.Query().Get("method") != r.Method {
+			http.Error(w, "invalid signature", http.StatusForbidden)
+			return
+		}
+		if r.Method != http.MethodPut {
+			http.Error(w, "Invalid Method", http.StatusMethodNotAllowed)
+			return
+		}
+		data, err := io.ReadAll(r.Body)
+		if err == nil {
+			err = bucket.WriteAll(r.Context(), key, data, nil)
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}))
+	t.Cleanup(storage.Close)
+
+	u, err := url.Parse(storage.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer = fileblob.NewURLSignerHMAC(u, []byte("super secret"))
+	bucket, err = fileblob.OpenBucket(dir, &fileblob.Options{URLSigner: signer})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { bucket.Close() })
+	return bucket, storage
+}
+
+func TestTwoPhaseUpload(t *testing.T) {
+	packageBucket, _ := newSignedURLBucket(t)
+	config := appConfig{
+		logger:         log.New(io.Discard, "", 0),
+		packageBucket:  packageBucket,
+		packageStore:   store.NewMemoryStore(),
+		maxPackageSize: 1024,
+	}
+	ctx := context.Background()
+	tokens := map[string]int{"owner": 1, "other": 2}
+	for token, userId := range tokens {
+		_, err := config.packageStore.AddToken(
+			ctx,
+			store.Token{UserId: userId, Name: token, Scopes: []string{scopePublish, scopeRead}},
+			apitoken.Hash(token),
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	mux := http.NewServeMux()
+	setupHandlers(mux, config)
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	do := func(method, path, token string, body interface{}) *http.Response {
+		data, err := json.Marshal(body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req, err := http.NewRequest(method, ts.URL+path, bytes.NewReader(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+	put := func(signedURL string, data []byte) int {
+		req, err := http.NewRequest(http.MethodPut, signedURL, bytes.NewReader(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	create := func(req uploadCreateRequest) uploadCreateResponse {
+		resp := do("POST", "/api/packages/uploads", "owner", req)
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusCreated {
+			t.Fatalf("Expected status 201, Got: %d", resp.StatusCode)
+		}
+		created := uploadCreateResponse{}
+		if err := json.NewDecoder(resp.Body).Decode(&created); err != nil {
+			t.Fatal(err)
+		}
+		return created
+	}
+	// stagedObjects는 임시 객체의 수다. 완료하면서 검사한 사본은 남지 않아야 한다
+	stagedObjects := func() int {
+		n := 0
+		iter := packageBucket.List(&blob.ListOptions{Prefix: stagingPrefix})
+		for {
+			_, err := iter.Next(ctx)
+			if err == io.EOF {
+				return n
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			n++
+		}
+	}
+	expectStatus := func(resp *http.Response, status int) {
+		t.Helper()
+		resp.Body.Close()
+		if resp.StatusCode != status {
+			t.Errorf("Expected status %d, Got: %d", status, resp.StatusCode)
+		}
+	}
+
+	data := []byte("package-data")
+	sum := sha256.Sum256(data)
+	checksum := hex.EncodeToString(sum[:])
+
+	testConfigs := []struct {
+		name   string
+		req    uploadCreateRequest
+		status int
+	}{
+		{name: "missing filename", req: uploadCreateRequest{Name: "pkg", Version: "1.0.0", Size: 12, Sha256: checksum}, status: http.StatusBadRequest},
+		{name: "path in filename", req: uploadCreateRequest{Name: "pkg", Version: "1.0.0", Filename: "../pkg.tar.gz", Size: 12, Sha256: checksum}, status: http.StatusBadRequest},
+		{name: "invalid version", req: uploadCreateRequest{Name: "pkg", Version: "1.0", Filename: "pkg.tar.gz", Size: 12, Sha256: checksum}, status: http.StatusBadRequest},
+		{name: "missing checksum", req: uploadCreateRequest{Name: "pkg", Version: "1.0.0", Filename: "pkg.tar.gz", Size: 12}, status: http.StatusBadRequest},
+		{name: "too large", req: uploadCreateRequest{Name: "pkg", Version: "1.0.0", Filename: "pkg.tar.gz", Size: 2048, Sha256: checksum}, status: http.StatusRequestEntityTooLarge},
+	}
+	for _, tc := range testConfigs {
+		resp := do("POST", "/api/packages/uploads", "owner", tc.req)
+		resp.Body.Close()
+		if resp.StatusCode != tc.status {
+			t.Errorf("%s: Expected status %d, Got: %d", tc.name, tc.status, resp.StatusCode)
+		}
+	}
+
+	req := uploadCreateRequest{
+		Name: "pkg", Version: "1.0.0", Filename: "pkg.tar.gz", Size: int64(len(data)), Sha256: strings.ToUpper(checksum),
+		packageManifest: packageManifest{Description: "uploaded directly"},
+	}
+	created := create(req)
+	if len(created.Id) != 32 || created.Method != http.MethodPut || len(created.Expires) == 0 {
+		t.Fatalf("Unexpected upload: %#v", created)
+	}
+	expectStatus(do("POST", "/api/packages/uploads", "owner", req), http.StatusConflict)
+	finalize := "/api/packages/uploads/finalize?id=" + created.Id
+	expectStatus(do("POST", finalize, "owner", nil), http.StatusBadRequest)
+
+	// 서명을 바꾸거나 다른 메서드로 보낸 요청은 저장소가 거절한다
+	tampered := strings.Replace(created.URL, "method=PUT", "method=GET", 1)
+	if status := put(tampered, data); status != http.StatusForbidden {
+		t.Errorf("Expected tampered URL to be rejected, Got: %d", status)
+	}
+
+	// 크기나 체크섬이 다르면 완료하지 않고, 기한 안에 다시 올릴 수 있다
+	for _, wrong := range [][]byte{[]byte("package"), []byte("PACKAGE-DATA")} {
+		if status := put(created.URL, wrong); status != http.StatusOK {
+			t.Fatalf("Expected status 200, Got: %d", status)
+		}
+		expectStatus(do("POST", finalize, "owner", nil), http.StatusBadRequest)
+	}
+	if n := stagedObjects(); n != 1 {
+		t.Errorf("Expected only the uploaded object to be staged, Got: %d", n)
+	}
+	if status := put(created.URL, data); status != http.StatusOK {
+		t.Fatalf("Expected status 200, Got: %d", status)
+	}
+	expectStatus(do("POST", finalize, "other", nil), http.StatusNotFound)
+
+	resp := do("POST", finalize, "owner", nil)
+	result := pkgRegisterResponse{}
+	err := json.NewDecoder(resp.Body).Decode(&result)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusOK || result.ID != "1/pkg-1.0.0-pkg.tar.gz" ||
+		result.Size != int64(len(data)) || result.Sha256 != checksum {
+		t.Fatalf("Unexpected result: %d %#v", resp.StatusCode, result)
+	}
+	expectStatus(do("POST", finalize, "owner", nil), http.StatusNotFound)
+	if n := stagedObjects(); n != 0 {
+		t.Errorf("Expected staged objects to be removed, Got: %d", n)
+	}
+
+	got, err := packageBucket.ReadAll(ctx, result.ID)
+	if err != nil || !bytes.Equal(got, data) {
+		t.Errorf("Expected published object, Got: %q, %v", got, err)
+	}
+	m, err := config.packageStore.Metadata(ctx, 1, "pkg", "1.0.0")
+	if err != nil || m.Description != "uploaded directly" {
+		t.Errorf("Expected metadata from the request, Got: %#v, %v", m, err)
+	}
+	if uploads, err := config.packageStore.Uploads(ctx); err != nil || len(uploads) != 0 {
+		t.Errorf("Expected finalized upload to be removed, Got: %#v, %v", uploads, err)
+	}
+
+	// 기한이 남은 업로드는 오래된 게시로 보고 지우지 않는다
+	req.Version = "2.0.0"
+	pendingUpload := create(req)
+	if status := put(pendingUpload.URL, data); status != http.StatusOK {
+		t.Fatalf("Expected status 200, Got: %d", status)
+	}
+	removed, err := reconcilePublishes(ctx, config, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(removed) != 0 {
+		t.Errorf("Expected active upload to be kept, Got: %v", removed)
+	}
+
+	// 완료하지 않은 업로드는 기한이 지나면 완료할 수 없고 reconcilePublishes가 지운다
+	u, err := config.packageStore.Upload(ctx, pendingUpload.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := config.packageStore.DeleteUpload(ctx, u.Id); err != nil {
+		t.Fatal(err)
+	}
+	u.Expires = "2000-01-01 00:00:00"
+	if err := config.packageStore.AddUpload(ctx, u); err != nil {
+		t.Fatal(err)
+	}
+	expectStatus(do("POST", "/api/packages/uploads/finalize?id="+u.Id, "owner", nil), http.StatusGone)
+	removed, err = reconcilePublishes(ctx, config, defaultStalePublishAge)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(removed) != 1 || removed[0] != u.StagingKey {
+		t.Errorf("Expected expired upload to be removed, Got: %v", removed)
+	}
+	if exists, err := packageBucket.Exists(ctx, u.StagingKey); err != nil || exists {
+		t.Errorf("Expected staged object to be removed, Got: %v, %v", exists, err)
+	}
+	if pending, err := config.packageStore.PendingPackages(ctx); err != nil || len(pending) != 0 {
+		t.Errorf("Expected reservation to be aborted, Got: %#v, %v", pending, err)
+	}
+
+	// 취소한 업로드의 버전은 다시 올릴 수 있다
+	cancelled := create(req)
+	expectStatus(do("DELETE", "/api/packages/uploads?id="+cancelled.Id, "other", nil), http.StatusNotFound)
+	expectStatus(do("DELETE", "/api/packages/uploads?id="+cancelled.Id, "owner", nil), http.StatusNoContent)
+	create(req)
+}
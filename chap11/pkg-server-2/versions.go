@@ -0,0 +1,94 @@
+package main
+
+import (
+	"github.com/PaulOh5/pkg-server-2/semver"
+	"github.com/PaulOh5/pkg-server-2/store"
+)
+
+// versionSpec은 version 쿼리 파라미터로 받는 정확한 버전, latest, 범위 제약 중 하나다.
+type versionSpec struct {
+	exact      string
+	latest     bool
+	constraint *semver.Constraint
+}
+
+func parseVersionSpec(s string) (versionSpec, error) {
+	if len(s) == 0 {
+		return versionSpec{}, nil
+	}
+	if s == "latest" {
+		return versionSpec{latest: true}, nil
+	}
+	if v, err := semver.Parse(s); err == nil {
+		return versionSpec{exact: v.String()}, nil
+	}
+	c, err := semver.ParseConstraint(s)
+	if err != nil {
+		return versionSpec{}, err
+	}
+	return versionSpec{constraint: &c}, nil
+}
+
+func (s versionSpec) isEmpty() bool {
+	return len(s.exact) == 0 && !s.latest && s.constraint == nil
+}
+
+// matches는 회수되지 않았고 범위 제약을 만족하는 패키지인지 확인한다.
+func (s versionSpec) matches(p store.Package) bool {
+	if len(p.Yanked) != 0 {
+		return false
+	}
+	v, err := semver.Parse(p.Version)
+	return err == nil && s.constraint.Check(v)
+}
+
+// filterVersions는 버전 우선순위로 정렬된 pkgs에서 spec과 일치하는 패키지만 남긴다.
+// latest는 패키지마다 가장 높은 정식 버전을, 정식 버전이 없으면 가장 높은 prerelease를 고른다.
+// 회수된 버전은 latest와 범위 제약에서 제외하고 정확한 버전으로만 찾을 수 있다.
+func filterVersions(pkgs []store.Package, spec versionSpec) []store.Package {
+	if spec.constraint == nil && !spec.latest {
+		return pkgs
+	}
+	results := []store.Package{}
+	for i := 0; i < len(pkgs); {
+		// 같은 소유자, 이름의 패키지는 연속해서 있다
+		j := i
+		for j < len(pkgs) && pkgs[j].OwnerId == pkgs[i].OwnerId && pkgs[j].Name == pkgs[i].Name {
+			j++
+		}
+		group := pkgs[i:j]
+		if spec.latest {
+			if p, ok := latestVersion(group); ok {
+				results = append(results, p)
+			}
+		} else {
+			for _, p := range group {
+				if spec.matches(p) {
+					results = append(results, p)
+				}
+			}
+		}
+		i = j
+	}
+	return results
+}
+
+func latestVersion(pkgs []store.Package) (store.Package, bool) {
+	var prerelease *store.Package
+	for i := len(pkgs) - 1; i >= 0; i-- {
+		if len(pkgs[i].Yanked) != 0 {
+			continue
+		}
+		v, err := semver.Parse(pkgs[i].Version)
+		if err == nil && !v.IsPrerelease() {
+			return pkgs[i], true
+		}
+		if prerelease == nil {
+			prerelease = &pkgs[i]
+		}
+	}
+	if prerelease == nil {
+		return store.Package{}, false
+	}
+	return *prerelease, true
+}
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/PaulOh5/pkg-server-2/store"
+)
+
+const (
+	defaultDeliveryLimit = 20
+	maxDeliveryLimit     = 100
+)
+
+func validateWebhook(h store.Webhook) error {
+	u, err := url.Parse(h.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || len(u.Host) == 0 {
+		return errors.New("url must be an absolute http or https URL")
+	}
+	for _, event := range h.Events {
+		valid := false
+		for _, e := range store.Events {
+			if event == e {
+				valid = true
+			}
+		}
+		if !valid {
+			return errors.New("invalid event: " + event)
+		}
+	}
+	return nil
+}
+
+// findWebhook은 id 파라미터의 웹훅을 찾는다. 다른 소유자의 웹훅은 관리자만 볼 수 있다.
+func findWebhook(w http.ResponseWriter, r *http.Request, config appConfig, a authContextValue, param string) (store.Webhook, bool) {
+	id, err := strconv.Atoi(r.URL.Query().Get(param))
+	if err != nil {
+		http.Error(w, "Must specify "+param, http.StatusBadRequest)
+		return store.Webhook{}, false
+	}
+	h, err := config.packageStore.Webhook(r.Context(), id)
+	if err == nil && h.OwnerId != a.userId && !a.hasScope(scopeAdmin) {
+		err = store.ErrNotFound
+	}
+	if errors.Is(err, store.ErrNotFound) {
+		http.Error(w, "No such webhook", http.StatusNotFound)
+		return h, false
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return h, false
+	}
+	return h, true
+}
+
+func webhookCreateHandler(
+	w http.ResponseWriter,
+	r *http.Request,
+	config appConfig,
+	a authContextValue,
+) {
+	req := webhookCreateRequest{}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	h := store.Webhook{
+		OwnerId: a.userId,
+		Name:    req.Name,
+		URL:     req.URL,
+		Secret:  req.Secret,
+		Events:  req.Events,
+	}
+	if req.OwnerId != 0 && req.OwnerId != a.userId {
+		if !a.hasScope(scopeAdmin) {
+			http.Error(w, "Creating webhooks for other owners requires the admin scope", http.StatusForbidden)
+			return
+		}
+		h.OwnerId = req.OwnerId
+	}
+	if err := validateWebhook(h); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(h.Secret) == 0 {
+		secret, err := generateWebhookSecret()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		h.Secret = secret
+	}
+
+	var err error
+	h.Id, err = config.packageStore.AddWebhook(r.Context(), h)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if h.Events == nil {
+		h.Events = []string{}
+	}
+	config.logger.Printf("Webhook %d created for owner %d by user %d\n", h.Id, h.OwnerId, a.userId)
+	writeJSON(w, http.StatusCreated, webhookCreateResponse{Webhook: h, Secret: h.Secret})
+}
+
+func webhookListHandler(
+	w http.ResponseWriter,
+	r *http.Request,
+	config appConfig,
+	a authContextValue,
+) {
+	ownerId := a.userId
+	if owner := r.URL.Query().Get("owner_id"); len(owner) != 0 {
+		id, err := strconv.Atoi(owner)
+		if err != nil {
+			http.Error(w, "Invalid owner_id", http.StatusBadRequest)
+			return
+		}
+		if id != a.userId && !a.hasScope(scopeAdmin) {
+			http.Error(w, "Listing webhooks of other owners requires the admin scope", http.StatusForbidden)
+			return
+		}
+		ownerId = id
+	}
+	hooks, err := config.packageStore.Webhooks(r.Context(), ownerId)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, hooks)
+}
+
+func webhookDeleteHandler(
+	w http.ResponseWriter,
+	r *http.Request,
+	config appConfig,
+	a authContextValue,
+) {
+	h, ok := findWebhook(w, r, config, a, "id")
+	if !ok {
+		return
+	}
+	err := config.packageStore.DeleteWebhook(r.Context(), h.Id)
+	if errors.Is(err, store.ErrNotFound) {
+		http.Error(w, "No such webhook", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	config.logger.Printf("Webhook %d deleted by user %d\n", h.Id, a.userId)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// webhookHandler는 웹훅을 만들고(POST), 목록을 보고(GET), 지운다(DELETE).
+// 웹훅은 패키지를 게시하는 소유자가 관리하므로 publish 스코프가 필요하다.
+func webhookHandler(
+	w http.ResponseWriter,
+	r *http.Request,
+	config appConfig,
+) {
+	a, ok := requireScope(w, r, scopePublish)
+	if !ok {
+		return
+	}
+	switch r.Method {
+	case "GET":
+		webhookListHandler(w, r, config, a)
+	case "POST":
+		webhookCreateHandler(w, r, config, a)
+	case "DELETE":
+		webhookDeleteHandler(w, r, config, a)
+	default:
+		http.Error(w, "Invalid Method", http.StatusMethodNotAllowed)
+	}
+}
+
+// webhookDeliveriesHandler는 웹훅의 최근 전송과 각 시도의 응답을 보여준다.
+func webhookDeliveriesHandler(
+	w http.ResponseWriter,
+	r *http.Request,
+	config appConfig,
+) {
+	if r.Method != "GET" {
+		http.Error(w, "Invalid Method", http.StatusMethodNotAllowed)
+		return
+	}
+	a, ok := requireScope(w, r, scopePublish)
+	if !ok {
+		return
+	}
+	h, ok := findWebhook(w, r, config, a, "webhook_id")
+	if !ok {
+		return
+	}
+	limit := defaultDeliveryLimit
+	if l := r.URL.Query().Get("limit"); len(l) != 0 {
+		var err error
+		limit, err = strconv.Atoi(l)
+		if err != nil || limit <= 0 {
+			http.Error(w, "invalid limit", http.StatusBadRequest)
+			return
+		}
+		if limit > maxDeliveryLimit {
+			limit = maxDeliveryLimit
+		}
+	}
+
+	deliveries, err := config.packageStore.Deliveries(r.Context(), h.Id, limit)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	logs := []deliveryLog{}
+	for _, d := range deliveries {
+		attempts, err := config.packageStore.DeliveryAttempts(r.Context(), d.Id)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		logs = append(logs, deliveryLog{Delivery: d, AttemptLog: attempts})
+	}
+	writeJSON(w, http.StatusOK, logs)
+}
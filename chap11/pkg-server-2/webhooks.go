@@ -0,0 +1,257 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/PaulOh5/pkg-server-2/store"
+)
+
+const (
+	webhookEventHeader     = "X-Pkg-Event"
+	webhookDeliveryHeader  = "X-Pkg-Delivery"
+	webhookSignatureHeader = "X-Pkg-Signature-256"
+
+	defaultWebhookInterval = 10 * time.Second
+	defaultWebhookBackoff  = 30 * time.Second
+	maxWebhookBackoff      = time.Hour
+	// maxWebhookAttempts번 실패한 전송은 failed로 남기고 더 보내지 않는다.
+	maxWebhookAttempts = 10
+	webhookTimeout     = 10 * time.Second
+	webhookBatchSize   = 100
+	// 전송 기록에는 응답 본문을 maxWebhookResponse 바이트까지만 남긴다.
+	maxWebhookResponse = 4 << 10
+)
+
+// webhookDispatcher는 큐에 넣은 전송을 보내는 작업자의 설정이다. 전송 자체는 저장소에
+// 있으므로 서버가 다시 시작해도 이어서 보낸다.
+type webhookDispatcher struct {
+	client *http.Client
+	// backoff는 첫 재시도까지의 시간이다. 재시도할 때마다 두 배로 늘린다.
+	backoff time.Duration
+	now     func() time.Time
+	wake    chan struct{}
+}
+
+// newWebhookDispatcher는 웹훅 전송자를 만든다. allowPrivate가 false이면 루프백, 사설망,
+// 링크 로컬 주소로는 연결하지 않는다. 그런 주소의 응답을 전송 기록으로 읽어 갈 수 있기 때문이다.
+func newWebhookDispatcher(allowPrivate bool) *webhookDispatcher {
+	dialer := &net.Dialer{Timeout: webhookTimeout}
+	if !allowPrivate {
+		// 이름을 해석한 뒤의 주소를 검사하므로 DNS로 내부 주소를 가리켜도 막힌다
+		dialer.Control = refusePrivateAddr
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+	return &webhookDispatcher{
+		client:  &http.Client{Timeout: webhookTimeout, Transport: transport},
+		backoff: defaultWebhookBackoff,
+		now:     time.Now,
+		wake:    make(chan struct{}, 1),
+	}
+}
+
+var errPrivateWebhookTarget = errors.New("webhook target is not a public address")
+
+// sharedAddressSpace는 통신사 NAT용 100.64.0.0/10이다. 일부 클라우드는 여기에 메타데이터 서버를 둔다.
+var sharedAddressSpace = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
+
+// refusePrivateAddr는 net.Dialer.Control로 쓰여 공개 주소가 아닌 곳으로의 연결을 거부한다.
+func refusePrivateAddr(network, address string, c syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsMulticast() ||
+		sharedAddressSpace.Contains(ip) {
+		return fmt.Errorf("%w: %s", errPrivateWebhookTarget, host)
+	}
+	return nil
+}
+
+// notify는 새 전송이 큐에 들어왔음을 작업자에게 알린다. d가 nil이면 아무것도 하지 않는다.
+func (d *webhookDispatcher) notify() {
+	if d == nil {
+		return
+	}
+	select {
+	case d.wake <- struct{}{}:
+	default:
+	}
+}
+
+// retryDelay는 attempts번 실패한 전송을 다시 보낼 때까지 기다릴 시간이다.
+func (d *webhookDispatcher) retryDelay(attempts int) time.Duration {
+	delay := d.backoff
+	for i := 1; i < attempts && delay < maxWebhookBackoff; i++ {
+		delay *= 2
+	}
+	if delay > maxWebhookBackoff {
+		delay = maxWebhookBackoff
+	}
+	return delay
+}
+
+func generateWebhookSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// signPayload는 수신자가 secret으로 검증할 수 있도록 본문의 HMAC-SHA256을 sha256=<hex> 형식으로 반환한다.
+func signPayload(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// notifyWebhooks는 패키지 p의 event를 받는 웹훅마다 전송을 큐에 넣는다. 이벤트는 이미
+// 일어났으므로 실패해도 오류를 반환하지 않고 로그만 남긴다.
+func notifyWebhooks(ctx context.Context, config appConfig, event string, p store.Package) {
+	hooks, err := config.packageStore.Webhooks(ctx, p.OwnerId)
+	if err != nil {
+		config.logger.Printf("Failed to find webhooks for %s: %v\n", p.ObjectStoreId, err)
+		return
+	}
+	queued := false
+	for _, h := range hooks {
+		if !h.Matches(event, p) {
+			continue
+		}
+		payload, err := json.Marshal(webhookPayload{
+			Event:     event,
+			Timestamp: time.Now().UTC().Format(time.RFC3339),
+			Package:   p,
+		})
+		if err != nil {
+			config.logger.Printf("Failed to encode webhook payload: %v\n", err)
+			return
+		}
+		_, err = config.packageStore.AddDelivery(ctx, store.Delivery{
+			WebhookId:   h.Id,
+			Event:       event,
+			Payload:     string(payload),
+			Status:      store.DeliveryPending,
+			NextAttempt: time.Now().UTC().Format(store.TimeFormat),
+		})
+		if err != nil {
+			config.logger.Printf("Failed to queue webhook %d: %v\n", h.Id, err)
+			continue
+		}
+		queued = true
+	}
+	if queued {
+		config.webhooks.notify()
+	}
+}
+
+// deliverWebhooks는 보낼 때가 된 전송을 모두 한 번씩 보내고 보낸 수를 반환한다.
+func deliverWebhooks(ctx context.Context, config appConfig) (int, error) {
+	d := config.webhooks
+	sent := 0
+	for {
+		now := d.now().UTC()
+		due, err := config.packageStore.DueDeliveries(ctx, now.Format(store.TimeFormat), webhookBatchSize)
+		if err != nil {
+			return sent, err
+		}
+		if len(due) == 0 {
+			return sent, nil
+		}
+		for _, delivery := range due {
+			h, err := config.packageStore.Webhook(ctx, delivery.WebhookId)
+			// 그사이 웹훅이 지워졌으면 전송도 함께 지워졌다
+			if errors.Is(err, store.ErrNotFound) {
+				continue
+			}
+			if err != nil {
+				return sent, err
+			}
+			attempt := sendWebhook(ctx, d.client, h, delivery)
+			delivery.Attempts++
+			attempt.Attempt = delivery.Attempts
+			switch {
+			case attempt.StatusCode >= 200 && attempt.StatusCode < 300:
+				delivery.Status = store.DeliveryDelivered
+				delivery.NextAttempt = ""
+			case delivery.Attempts >= maxWebhookAttempts:
+				delivery.Status = store.DeliveryFailed
+				delivery.NextAttempt = ""
+				config.logger.Printf("Webhook delivery %d failed after %d attempts\n", delivery.Id, delivery.Attempts)
+			default:
+				delivery.NextAttempt = now.Add(d.retryDelay(delivery.Attempts)).Format(store.TimeFormat)
+			}
+			if err := config.packageStore.RecordAttempt(ctx, delivery, attempt); err != nil {
+				return sent, err
+			}
+			sent++
+		}
+	}
+}
+
+// sendWebhook은 전송을 한 번 보내고 결과를 기록할 시도로 돌려준다.
+func sendWebhook(ctx context.Context, client *http.Client, h store.Webhook, d store.Delivery) store.DeliveryAttempt {
+	a := store.DeliveryAttempt{DeliveryId: d.Id}
+	body := []byte(d.Payload)
+	req, err := http.NewRequestWithContext(ctx, "POST", h.URL, bytes.NewReader(body))
+	if err != nil {
+		a.Error = err.Error()
+		return a
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "pkg-server-webhook")
+	req.Header.Set(webhookEventHeader, d.Event)
+	req.Header.Set(webhookDeliveryHeader, strconv.Itoa(d.Id))
+	req.Header.Set(webhookSignatureHeader, signPayload(h.Secret, body))
+
+	start := time.Now()
+	resp, err := client.Do(req)
+	a.DurationMs = time.Since(start).Milliseconds()
+	if err != nil {
+		a.Error = err.Error()
+		return a
+	}
+	defer resp.Body.Close()
+	a.StatusCode = resp.StatusCode
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, maxWebhookResponse))
+	a.Response = string(bytes.ToValidUTF8(data, []byte("?")))
+	if a.StatusCode < 200 || a.StatusCode >= 300 {
+		a.Error = fmt.Sprintf("unexpected status %s", resp.Status)
+	}
+	return a
+}
+
+// runWebhooks는 interval마다, 또는 새 전송이 큐에 들어오면 바로 전송을 보낸다.
+func runWebhooks(ctx context.Context, config appConfig, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-config.webhooks.wake:
+		}
+		if _, err := deliverWebhooks(ctx, config); err != nil {
+			config.logger.Printf("Failed to deliver webhooks: %v\n", err)
+		}
+	}
+}
@@ -0,0 +1,314 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/PaulOh5/pkg-server-2/apitoken"
+	"github.com/PaulOh5/pkg-server-2/store"
+)
+
+type receivedWebhook struct {
+	event     string
+	delivery  string
+	signature string
+	payload   webhookPayload
+	body      []byte
+}
+
+// webhookReceiver는 받은 요청을 기록하고 status로 응답한다.
+type webhookReceiver struct {
+	mu       sync.Mutex
+	status   int
+	received []receivedWebhook
+}
+
+func (rcv *webhookReceiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	p := webhookPayload{}
+	json.Unmarshal(body, &p)
+	rcv.mu.Lock()
+	defer rcv.mu.Unlock()
+	rcv.received = append(rcv.received, receivedWebhook{
+		event:     r.Header.Get(webhookEventHeader),
+		delivery:  r.Header.Get(webhookDeliveryHeader),
+		signature: r.Header.Get(webhookSignatureHeader),
+		payload:   p,
+		body:      body,
+	})
+	w.WriteHeader(rcv.status)
+	io.WriteString(w, "status "+strconv.Itoa(rcv.status))
+}
+
+func (rcv *webhookReceiver) setStatus(status int) {
+	rcv.mu.Lock()
+	defer rcv.mu.Unlock()
+	rcv.status = status
+}
+
+func (rcv *webhookReceiver) take() []receivedWebhook {
+	rcv.mu.Lock()
+	defer rcv.mu.Unlock()
+	received := rcv.received
+	rcv.received = nil
+	return received
+}
+
+func TestRetryDelay(t *testing.T) {
+	d := newWebhookDispatcher(true)
+	expected := []time.Duration{30 * time.Second, time.Minute, 2 * time.Minute, 4 * time.Minute}
+	for i, delay := range expected {
+		if got := d.retryDelay(i + 1); got != delay {
+			t.Errorf("attempt %d: Expected %v, Got: %v", i+1, delay, got)
+		}
+	}
+	if got := d.retryDelay(maxWebhookAttempts); got != maxWebhookBackoff {
+		t.Errorf("Expected delay capped at %v, Got: %v", maxWebhookBackoff, got)
+	}
+}
+
+func TestWebhookPrivateTargets(t *testing.T) {
+	testConfigs := []struct {
+		address string
+		refused bool
+	}{
+		{address: "127.0.0.1:80", refused: true},
+		{address: "[::1]:80", refused: true},
+		{address: "10.1.2.3:80", refused: true},
+		{address: "192.168.0.1:443", refused: true},
+		{address: "169.254.169.254:80", refused: true},
+		{address: "100.100.100.200:80", refused: true},
+		{address: "0.0.0.0:80", refused: true},
+		{address: "[::ffff:127.0.0.1]:80", refused: true},
+		{address: "93.184.216.34:443", refused: false},
+		{address: "[2606:2800:220:1::]:443", refused: false},
+	}
+	for _, tc := range testConfigs {
+		err := refusePrivateAddr("tcp", tc.address, nil)
+		if refused := errors.Is(err, errPrivateWebhookTarget); refused != tc.refused {
+			t.Errorf("%s: Expected refused %v, Got: %v", tc.address, tc.refused, err)
+		}
+	}
+
+	receiver := &webhookReceiver{status: http.StatusOK}
+	rs := httptest.NewServer(receiver)
+	defer rs.Close()
+	h := store.Webhook{Id: 1, URL: rs.URL, Secret: "secret"}
+	d := store.Delivery{Id: 1, WebhookId: 1, Event: store.EventPublished, Payload: "{}"}
+	a := sendWebhook(context.Background(), newWebhookDispatcher(false).client, h, d)
+	if a.StatusCode != 0 || len(a.Response) != 0 || len(receiver.take()) != 0 {
+		t.Errorf("Expected loopback receiver to be refused, Got: %#v", a)
+	}
+	a = sendWebhook(context.Background(), newWebhookDispatcher(true).client, h, d)
+	if a.StatusCode != http.StatusOK || len(receiver.take()) != 1 {
+		t.Errorf("Expected delivery with private targets allowed, Got: %#v", a)
+	}
+}
+
+func TestWebhooks(t *testing.T) {
+	packageBucket, err := getTestBucket(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer packageBucket.Close()
+
+	receiver := &webhookReceiver{status: http.StatusOK}
+	rs := httptest.NewServer(receiver)
+	defer rs.Close()
+
+	now := time.Now()
+	dispatcher := newWebhookDispatcher(true)
+	dispatcher.now = func() time.Time { return now }
+	config := appConfig{
+		logger:        log.New(io.Discard, "", 0),
+		packageBucket: packageBucket,
+		packageStore:  store.NewMemoryStore(),
+		webhooks:      dispatcher,
+	}
+	ctx := context.Background()
+	tokens := map[string]int{"owner": 1, "other": 2}
+	for token, userId := range tokens {
+		_, err := config.packageStore.AddToken(
+			ctx,
+			store.Token{UserId: userId, Name: token, Scopes: []string{scopePublish, scopeRead}},
+			apitoken.Hash(token),
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	mux := http.NewServeMux()
+	setupHandlers(mux, config)
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	do := func(method, path, token string, body interface{}) *http.Response {
+		data, err := json.Marshal(body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req, err := http.NewRequest(method, ts.URL+path, bytes.NewReader(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+	deliver := func(expected int) {
+		sent, err := deliverWebhooks(ctx, config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if sent != expected {
+			t.Fatalf("Expected %d deliveries, Got: %d", expected, sent)
+		}
+	}
+
+	testConfigs := []struct {
+		name   string
+		token  string
+		req    webhookCreateRequest
+		status int
+	}{
+		{name: "invalid url", token: "owner", req: webhookCreateRequest{URL: "ftp://example.com"}, status: http.StatusBadRequest},
+		{name: "invalid event", token: "owner", req: webhookCreateRequest{URL: rs.URL, Events: []string{"package.renamed"}}, status: http.StatusBadRequest},
+		{name: "other owner", token: "other", req: webhookCreateRequest{OwnerId: 1, URL: rs.URL}, status: http.StatusForbidden},
+		{name: "other packages", token: "owner", req: webhookCreateRequest{Name: "other-pkg", URL: rs.URL}, status: http.StatusCreated},
+		{name: "other owner's packages", token: "other", req: webhookCreateRequest{URL: rs.URL}, status: http.StatusCreated},
+	}
+	for _, tc := range testConfigs {
+		resp := do("POST", "/api/webhooks", tc.token, tc.req)
+		resp.Body.Close()
+		if resp.StatusCode != tc.status {
+			t.Errorf("%s: Expected status %d, Got: %d", tc.name, tc.status, resp.StatusCode)
+		}
+	}
+
+	resp := do("POST", "/api/webhooks", "owner", webhookCreateRequest{Name: "pkg", URL: rs.URL})
+	created := webhookCreateResponse{}
+	err = json.NewDecoder(resp.Body).Decode(&created)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusCreated || len(created.Secret) != 64 || created.Id == 0 {
+		t.Fatalf("Unexpected webhook: %d %#v", resp.StatusCode, created)
+	}
+
+	resp = do("GET", "/api/webhooks", "owner", nil)
+	hooks := []map[string]interface{}{}
+	err = json.NewDecoder(resp.Body).Decode(&hooks)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hooks) != 2 {
+		t.Fatalf("Expected 2 webhooks, Got: %v", hooks)
+	}
+	if _, ok := hooks[1]["secret"]; ok {
+		t.Error("Expected secret not to be listed")
+	}
+
+	// 게시하면 서명된 published 이벤트를 보낸다
+	req, err := newUploadRequest(
+		ts.URL+"/api/packages", "owner",
+		map[string]string{"name": "pkg", "version": "1.0.0"},
+		"pkg.tar.gz", []byte("package-data"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected status 200, Got: %d", resp.StatusCode)
+	}
+	deliver(1)
+	received := receiver.take()
+	if len(received) != 1 {
+		t.Fatalf("Expected 1 webhook, Got: %d", len(received))
+	}
+	got := received[0]
+	if got.event != store.EventPublished || got.payload.Event != store.EventPublished ||
+		got.payload.Package.Name != "pkg" || got.payload.Package.Version != "1.0.0" || len(got.payload.Package.Sha256) == 0 {
+		t.Errorf("Unexpected webhook: %#v", got)
+	}
+	if !hmac.Equal([]byte(got.signature), []byte(signPayload(created.Secret, got.body))) {
+		t.Errorf("Invalid signature: %s", got.signature)
+	}
+
+	// 실패한 전송은 backoff 뒤에 다시 보낸다
+	receiver.setStatus(http.StatusInternalServerError)
+	resp = do("DELETE", "/api/packages?owner_id=1&name=pkg&version=1.0.0", "owner", nil)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("Expected status 204, Got: %d", resp.StatusCode)
+	}
+	deliver(1)
+	deliver(0)
+	receiver.setStatus(http.StatusOK)
+	now = now.Add(defaultWebhookBackoff)
+	deliver(1)
+	received = receiver.take()
+	if len(received) != 2 || received[0].delivery != received[1].delivery ||
+		received[1].event != store.EventYanked || len(received[1].payload.Package.Yanked) == 0 {
+		t.Fatalf("Expected the yanked event to be sent twice, Got: %#v", received)
+	}
+
+	resp = do("GET", "/api/webhooks/deliveries?webhook_id="+strconv.Itoa(created.Id), "owner", nil)
+	logs := []deliveryLog{}
+	err = json.NewDecoder(resp.Body).Decode(&logs)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(logs) != 2 || logs[0].Event != store.EventYanked || logs[0].Status != store.DeliveryDelivered ||
+		logs[0].Attempts != 2 || len(logs[0].AttemptLog) != 2 {
+		t.Fatalf("Unexpected delivery log: %#v", logs)
+	}
+	first := logs[0].AttemptLog[0]
+	if first.StatusCode != http.StatusInternalServerError || first.Response != "status 500" || len(first.Error) == 0 {
+		t.Errorf("Unexpected first attempt: %#v", first)
+	}
+	if logs[1].Event != store.EventPublished || logs[1].AttemptLog[0].StatusCode != http.StatusOK {
+		t.Errorf("Unexpected published delivery: %#v", logs[1])
+	}
+
+	for _, tc := range []struct {
+		method string
+		path   string
+		token  string
+		status int
+	}{
+		{method: "GET", path: "/api/webhooks/deliveries?webhook_id=" + strconv.Itoa(created.Id), token: "other", status: http.StatusNotFound},
+		{method: "GET", path: "/api/webhooks/deliveries", token: "owner", status: http.StatusBadRequest},
+		{method: "DELETE", path: "/api/webhooks?id=" + strconv.Itoa(created.Id), token: "other", status: http.StatusNotFound},
+		{method: "DELETE", path: "/api/webhooks?id=" + strconv.Itoa(created.Id), token: "owner", status: http.StatusNoContent},
+		{method: "GET", path: "/api/webhooks/deliveries?webhook_id=" + strconv.Itoa(created.Id), token: "owner", status: http.StatusNotFound},
+	} {
+		resp := do(tc.method, tc.path, tc.token, nil)
+		resp.Body.Close()
+		if resp.StatusCode != tc.status {
+			t.Errorf("%s %s: Expected status %d, Got: %d", tc.method, tc.path, tc.status, resp.StatusCode)
+		}
+	}
+}
@@ -0,0 +1,423 @@
+package cmd
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const deviceCodeGrantType = "urn:ietf:params:oauth:grant-type:device_code"
+
+// 만료 직전의 토큰을 사용하지 않도록 여유를 둔다
+const tokenExpiryDelta = 10 * time.Second
+
+// 토큰 엔드포인트에 보내는 요청 하나의 제한 시간. 디바이스 흐름 전체는 코드가 만료될 때까지 기다린다
+const tokenRequestTimeout = 30 * time.Second
+
+type authConfig struct {
+	basicAuth    string
+	bearer       string
+	tokenURL     string
+	deviceURL    string
+	clientID     string
+	clientSecret string
+	scopes       string
+	tokenCache   string
+	prompt       io.Writer
+	httpClient   *http.Client
+}
+
+type oauthToken struct {
+	AccessToken  string    `json:"access_token"`
+	TokenType    string    `json:"token_type,omitempty"`
+	RefreshToken string    `json:"refresh_token,omitempty"`
+	Expiry       time.Time `json:"expiry,omitempty"`
+}
+
+type tokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int64  `json:"expires_in"`
+	Error        string `json:"error"`
+	ErrorDesc    string `json:"error_description"`
+}
+
+type deviceAuthResponse struct {
+	DeviceCode              string `json:"device_code"`
+	UserCode                string `json:"user_code"`
+	VerificationURI         string `json:"verification_uri"`
+	VerificationURIComplete string `json:"verification_uri_complete"`
+	ExpiresIn               int64  `json:"expires_in"`
+	Interval                int64  `json:"interval"`
+}
+
+type tokenError struct {
+	code        string
+	description string
+}
+
+func (e tokenError) Error() string {
+	if e.description != "" {
+		return fmt.Sprintf("oauth2: %s: %s", e.code, e.description)
+	}
+	return "oauth2: " + e.code
+}
+
+func addAuthFlags(fs *flag.FlagSet, c *authConfig) {
+	fs.StringVar(&c.basicAuth, "basicauth", "", "Atuh value (user:password)")
+	fs.StringVar(&c.bearer, "bearer", "", "Bearer token")
+	fs.StringVar(&c.tokenURL, "oauth-token-url", "", "OAuth2 token endpoint")
+	fs.StringVar(&c.deviceURL, "oauth-device-url", "", "OAuth2 device authorization endpoint (enables device-code flow)")
+	fs.StringVar(&c.clientID, "oauth-client-id", "", "OAuth2 client ID")
+	fs.StringVar(&c.clientSecret, "oauth-client-secret", os.Getenv("MYNC_OAUTH_CLIENT_SECRET"), "OAuth2 client secret (env MYNC_OAUTH_CLIENT_SECRET)")
+	fs.StringVar(&c.scopes, "oauth-scopes", "", "OAuth2 scopes (comma separated)")
+	fs.StringVar(&c.tokenCache, "token-cache", defaultTokenCachePath(), "OAuth2 token cache file")
+}
+
+func defaultTokenCachePath() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "mync", "tokens.json")
+}
+
+func (c authConfig) validate() error {
+	n := 0
+	for _, v := range []string{c.basicAuth, c.bearer, c.tokenURL} {
+		if v != "" {
+			n++
+		}
+	}
+	if n > 1 {
+		return ErrorConflictingAuth
+	}
+	if c.basicAuth != "" && len(strings.SplitN(c.basicAuth, ":", 2)) != 2 {
+		return ErrorInvalidBasicAuth
+	}
+	if c.deviceURL != "" && c.tokenURL == "" {
+		return ErrorNoTokenURL
+	}
+	if c.tokenURL != "" && c.clientID == "" {
+		return ErrorNoClientID
+	}
+	return nil
+}
+
+func (c authConfig) scopeList() []string {
+	return strings.FieldsFunc(c.scopes, func(r rune) bool {
+		return r == ',' || r == ' '
+	})
+}
+
+func (c authConfig) client() *http.Client {
+	if c.httpClient != nil {
+		return c.httpClient
+	}
+	return &http.Client{Timeout: 30 * time.Second}
+}
+
+// authorization은 요청에 넣을 Authorization 헤더 값을 만든다.
+// 인증 옵션이 없으면 빈 문자열을 반환한다.
+func (c authConfig) authorization(ctx context.Context) (string, error) {
+	if err := c.validate(); err != nil {
+		return "", err
+	}
+	switch {
+	case c.basicAuth != "":
+		req := http.Request{Header: http.Header{}}
+		parts := strings.SplitN(c.basicAuth, ":", 2)
+		req.SetBasicAuth(parts[0], parts[1])
+		return req.Header.Get("Authorization"), nil
+	case c.bearer != "":
+		return "Bearer " + c.bearer, nil
+	case c.tokenURL != "":
+		t, err := c.token(ctx)
+		if err != nil {
+			return "", tokenRequestError{err}
+		}
+		return "Bearer " + t.AccessToken, nil
+	}
+	return "", nil
+}
+
+func (c authConfig) token(ctx context.Context) (oauthToken, error) {
+	key := c.cacheKey()
+	cache := readTokenCache(c.tokenCache)
+	if t, ok := cache[key]; ok {
+		if t.valid() {
+			return t, nil
+		}
+		if t.RefreshToken != "" {
+			nt, err := c.refresh(ctx, t.RefreshToken)
+			if err == nil {
+				c.cacheToken(key, nt)
+				return nt, nil
+			}
+		}
+	}
+
+	var t oauthToken
+	var err error
+	if c.deviceURL != "" {
+		t, err = c.deviceCode(ctx)
+	} else {
+		t, err = c.clientCredentials(ctx)
+	}
+	if err != nil {
+		return t, err
+	}
+	c.cacheToken(key, t)
+	return t, nil
+}
+
+func (c authConfig) cacheKey() string {
+	h := sha256.New()
+	for _, v := range []string{c.tokenURL, c.deviceURL, c.clientID, strings.Join(c.scopeList(), " ")} {
+		fmt.Fprintf(h, "%s\n", v)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// cacheToken은 받은 토큰을 캐시에 저장한다. 토큰은 이미 유효하므로 저장하지 못해도
+// 요청을 실패시키지 않고 경고만 남긴다.
+func (c authConfig) cacheToken(key string, t oauthToken) {
+	if err := c.storeToken(key, t); err != nil && c.prompt != nil {
+		fmt.Fprintf(c.prompt, "Warning: failed to cache the token in %s: %v\n", c.tokenCache, err)
+	}
+}
+
+func (c authConfig) storeToken(key string, t oauthToken) error {
+	if c.tokenCache == "" {
+		return nil
+	}
+	cache := readTokenCache(c.tokenCache)
+	cache[key] = t
+	return writeTokenCache(c.tokenCache, cache)
+}
+
+func (t oauthToken) valid() bool {
+	if t.AccessToken == "" {
+		return false
+	}
+	if t.Expiry.IsZero() {
+		return true
+	}
+	return time.Now().Add(tokenExpiryDelta).Before(t.Expiry)
+}
+
+func (c authConfig) clientCredentials(ctx context.Context) (oauthToken, error) {
+	v := url.Values{}
+	v.Set("grant_type", "client_credentials")
+	if scopes := c.scopeList(); len(scopes) > 0 {
+		v.Set("scope", strings.Join(scopes, " "))
+	}
+	return c.requestToken(ctx, v)
+}
+
+func (c authConfig) refresh(ctx context.Context, refreshToken string) (oauthToken, error) {
+	v := url.Values{}
+	v.Set("grant_type", "refresh_token")
+	v.Set("refresh_token", refreshToken)
+	t, err := c.requestToken(ctx, v)
+	if err == nil && t.RefreshToken == "" {
+		t.RefreshToken = refreshToken
+	}
+	return t, err
+}
+
+func (c authConfig) deviceCode(ctx context.Context) (oauthToken, error) {
+	v := url.Values{}
+	v.Set("client_id", c.clientID)
+	if scopes := c.scopeList(); len(scopes) > 0 {
+		v.Set("scope", strings.Join(scopes, " "))
+	}
+	data, err := c.postForm(ctx, c.deviceURL, v, false)
+	if err != nil {
+		return oauthToken{}, err
+	}
+	d := deviceAuthResponse{}
+	if err := json.Unmarshal(data, &d); err != nil {
+		return oauthToken{}, err
+	}
+	if d.DeviceCode == "" {
+		return oauthToken{}, errors.New("oauth2: device authorization response has no device_code")
+	}
+
+	if c.prompt != nil {
+		uri := d.VerificationURIComplete
+		if uri == "" {
+			uri = d.VerificationURI
+		}
+		fmt.Fprintf(c.prompt, "To authorize mync, visit %s and enter the code: %s\n", uri, d.UserCode)
+	}
+
+	interval := time.Duration(d.Interval) * time.Second
+	if interval <= 0 {
+		interval = 5 * time.Second
+	}
+	deadline := time.Now().Add(time.Duration(d.ExpiresIn) * time.Second)
+	if d.ExpiresIn <= 0 {
+		deadline = time.Now().Add(10 * time.Minute)
+	}
+
+	pv := url.Values{}
+	pv.Set("grant_type", deviceCodeGrantType)
+	pv.Set("device_code", d.DeviceCode)
+	for {
+		t, err := c.requestToken(ctx, pv)
+		var te tokenError
+		if !errors.As(err, &te) {
+			return t, err
+		}
+		switch te.code {
+		case "authorization_pending":
+		case "slow_down":
+			interval += 5 * time.Second
+		default:
+			return t, err
+		}
+		if time.Now().Add(interval).After(deadline) {
+			return t, errors.New("oauth2: device code expired")
+		}
+		select {
+		case <-ctx.Done():
+			return t, ctx.Err()
+		case <-time.After(interval):
+		}
+	}
+}
+
+func (c authConfig) requestToken(ctx context.Context, v url.Values) (oauthToken, error) {
+	data, err := c.postForm(ctx, c.tokenURL, v, true)
+	if err != nil {
+		return oauthToken{}, err
+	}
+	r := tokenResponse{}
+	if err := json.Unmarshal(data, &r); err != nil {
+		return oauthToken{}, err
+	}
+	if r.Error != "" {
+		return oauthToken{}, tokenError{code: r.Error, description: r.ErrorDesc}
+	}
+	if r.AccessToken == "" {
+		return oauthToken{}, errors.New("oauth2: token response has no access_token")
+	}
+	t := oauthToken{
+		AccessToken:  r.AccessToken,
+		TokenType:    r.TokenType,
+		RefreshToken: r.RefreshToken,
+	}
+	if r.ExpiresIn > 0 {
+		t.Expiry = time.Now().Add(time.Duration(r.ExpiresIn) * time.Second)
+	}
+	return t, nil
+}
+
+func (c authConfig) postForm(ctx context.Context, endpoint string, v url.Values, withSecret bool) ([]byte, error) {
+	// 시크릿이 있으면 client_secret_basic 방식으로 인증한다
+	useSecret := withSecret && c.clientSecret != ""
+	if !useSecret {
+		v.Set("client_id", c.clientID)
+	}
+	ctx, cancel := context.WithTimeout(ctx, tokenRequestTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, "POST", endpoint, strings.NewReader(v.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if useSecret {
+		req.SetBasicAuth(url.QueryEscape(c.clientID), url.QueryEscape(c.clientSecret))
+	}
+	r, err := c.client().Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(r.Body, 1<<20))
+	if err != nil {
+		return nil, err
+	}
+	// 오류 응답도 JSON 본문에 error 필드를 담아 오므로 400은 호출자에게 넘긴다
+	if r.StatusCode != http.StatusOK && r.StatusCode != http.StatusBadRequest &&
+		r.StatusCode != http.StatusUnauthorized {
+		return nil, fmt.Errorf("oauth2: %s: %s", r.Status, strings.TrimSpace(string(data)))
+	}
+	return data, nil
+}
+
+func readTokenCache(path string) map[string]oauthToken {
+	cache := map[string]oauthToken{}
+	if path == "" {
+		return cache
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return cache
+	}
+	if err := json.Unmarshal(data, &cache); err != nil {
+		return map[string]oauthToken{}
+	}
+	return cache
+}
+
+func writeTokenCache(path string, cache map[string]oauthToken) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(cache, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tokens-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(0o600); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// bearerCredentials는 gRPC 호출마다 Authorization 메타데이터를 붙인다.
+type bearerCredentials struct {
+	auth authConfig
+}
+
+func (b bearerCredentials) GetRequestMetadata(ctx context.Context, uri ...string) (map[string]string, error) {
+	v, err := b.auth.authorization(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if v == "" {
+		return nil, nil
+	}
+	return map[string]string{"authorization": v}, nil
+}
+
+func (b bearerCredentials) RequireTransportSecurity() bool {
+	return false
+}
@@ -0,0 +1,306 @@
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"golang.org/x/net/proxy"
+)
+
+var errProxyUnsupported = errors.New("proxy dialer does not support context")
+
+type networkConfig struct {
+	proxy     string
+	resolve   AddrOverrides
+	connectTo AddrOverrides
+	verbose   bool
+	log       io.Writer
+}
+
+// addrOverride는 -resolve(host:port:addr)와
+// -connect-to(host:port:connect-host:connect-port) 규칙 하나를 나타낸다.
+// 빈 값은 모든 호스트나 포트와 일치하거나 원래 값을 그대로 쓴다는 뜻이다.
+type addrOverride struct {
+	host        string
+	port        string
+	connectHost string
+	connectPort string
+}
+
+type AddrOverrides struct {
+	connectTo bool
+	rules     []addrOverride
+}
+
+func (o *AddrOverrides) Set(value string) error {
+	parts := splitOverride(value)
+	if o.connectTo {
+		if len(parts) != 4 {
+			return fmt.Errorf("invalid -connect-to %q. format must be host:port:connect-host:connect-port", value)
+		}
+		o.rules = append(o.rules, addrOverride{
+			host: parts[0], port: parts[1],
+			connectHost: parts[2], connectPort: parts[3],
+		})
+		return nil
+	}
+	if len(parts) != 3 || parts[0] == "" || parts[1] == "" || parts[2] == "" {
+		return fmt.Errorf("invalid -resolve %q. format must be host:port:addr", value)
+	}
+	o.rules = append(o.rules, addrOverride{
+		host: parts[0], port: parts[1], connectHost: parts[2],
+	})
+	return nil
+}
+
+func (o *AddrOverrides) String() string {
+	if o == nil {
+		return ""
+	}
+	return fmt.Sprint(o.rules)
+}
+
+// splitOverride는 ':'로 나누되 [::1]처럼 대괄호로 감싼 IPv6 주소는 나누지 않는다.
+func splitOverride(value string) []string {
+	parts := []string{}
+	depth := 0
+	start := 0
+	for i, r := range value {
+		switch r {
+		case '[':
+			depth++
+		case ']':
+			depth--
+		case ':':
+			if depth == 0 {
+				parts = append(parts, value[start:i])
+				start = i + 1
+			}
+		}
+	}
+	parts = append(parts, value[start:])
+	for i, p := range parts {
+		parts[i] = strings.TrimSuffix(strings.TrimPrefix(p, "["), "]")
+	}
+	return parts
+}
+
+func addNetworkFlags(fs *flag.FlagSet, c *networkConfig) {
+	c.connectTo.connectTo = true
+	fs.StringVar(&c.proxy, "proxy", "", "Proxy URL: http://[user:pass@]host:port (CONNECT) or socks5://[user:pass@]host:port")
+	fs.Var(&c.resolve, "resolve", "Resolve host:port to addr (host:port:addr)")
+	fs.Var(&c.connectTo, "connect-to", "Connect to connect-host:connect-port instead of host:port (host:port:connect-host:connect-port)")
+	fs.BoolVar(&c.verbose, "verbose", false, "Print the address actually dialed")
+}
+
+func (c networkConfig) enabled() bool {
+	return c.proxy != "" || len(c.resolve.rules) > 0 || len(c.connectTo.rules) > 0 || c.verbose
+}
+
+func (c networkConfig) validate() error {
+	if c.proxy == "" {
+		return nil
+	}
+	u, err := url.Parse(c.proxy)
+	if err != nil {
+		return err
+	}
+	switch u.Scheme {
+	case "http", "https", "socks5", "socks5h":
+	default:
+		return ErrorInvalidProxy
+	}
+	if u.Host == "" {
+		return ErrorInvalidProxy
+	}
+	return nil
+}
+
+func (c networkConfig) logf(format string, args ...interface{}) {
+	if c.verbose && c.log != nil {
+		fmt.Fprintf(c.log, format, args...)
+	}
+}
+
+// dialAddress는 -connect-to를 먼저 적용하고 그 결과에 -resolve를 적용한다.
+func (c networkConfig) dialAddress(addr string) (string, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return "", err
+	}
+	for _, r := range c.connectTo.rules {
+		if (r.host == "" || strings.EqualFold(r.host, host)) &&
+			(r.port == "" || r.port == port) {
+			if r.connectHost != "" {
+				host = r.connectHost
+			}
+			if r.connectPort != "" {
+				port = r.connectPort
+			}
+			break
+		}
+	}
+	for _, r := range c.resolve.rules {
+		if strings.EqualFold(r.host, host) && (r.port == "*" || r.port == port) {
+			host = r.connectHost
+			break
+		}
+	}
+	return net.JoinHostPort(host, port), nil
+}
+
+func (c networkConfig) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	target, err := c.dialAddress(addr)
+	if err != nil {
+		return nil, err
+	}
+	if target != addr {
+		c.logf("* Overriding %s with %s\n", addr, target)
+	}
+
+	d := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}
+	if c.proxy == "" {
+		conn, err := d.DialContext(ctx, network, target)
+		if err != nil {
+			return nil, err
+		}
+		c.logf("* Connected to %s (%s)\n", target, conn.RemoteAddr())
+		return conn, nil
+	}
+
+	u, err := url.Parse(c.proxy)
+	if err != nil {
+		return nil, err
+	}
+	var conn net.Conn
+	switch u.Scheme {
+	case "socks5", "socks5h":
+		conn, err = dialSOCKS5(ctx, d, u, network, target)
+	case "http", "https":
+		conn, err = dialConnect(ctx, d, u, target)
+	default:
+		err = ErrorInvalidProxy
+	}
+	if err != nil {
+		return nil, err
+	}
+	c.logf("* Connected to %s via %s proxy %s (%s)\n", target, u.Scheme, u.Host, conn.RemoteAddr())
+	return conn, nil
+}
+
+func (c networkConfig) transport() http.RoundTripper {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	if c.enabled() {
+		t.Proxy = nil
+		t.DialContext = c.DialContext
+	}
+	return t
+}
+
+func (c networkConfig) httpClient() *http.Client {
+	return &http.Client{Transport: c.transport()}
+}
+
+func dialSOCKS5(ctx context.Context, d *net.Dialer, u *url.URL, network, target string) (net.Conn, error) {
+	var auth *proxy.Auth
+	if u.User != nil {
+		password, _ := u.User.Password()
+		auth = &proxy.Auth{User: u.User.Username(), Password: password}
+	}
+	dialer, err := proxy.SOCKS5("tcp", proxyHostPort(u), auth, d)
+	if err != nil {
+		return nil, err
+	}
+	cd, ok := dialer.(proxy.ContextDialer)
+	if !ok {
+		return nil, errProxyUnsupported
+	}
+	return cd.DialContext(ctx, network, target)
+}
+
+func dialConnect(ctx context.Context, d *net.Dialer, u *url.URL, target string) (net.Conn, error) {
+	conn, err := d.DialContext(ctx, "tcp", proxyHostPort(u))
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme == "https" {
+		tlsConn := tls.Client(conn, &tls.Config{ServerName: u.Hostname()})
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		conn = tlsConn
+	}
+
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+		defer conn.SetDeadline(time.Time{})
+	}
+
+	req := &http.Request{
+		Method: "CONNECT",
+		URL:    &url.URL{Opaque: target},
+		Host:   target,
+		Header: http.Header{},
+	}
+	if u.User != nil {
+		password, _ := u.User.Password()
+		credentials := base64.StdEncoding.EncodeToString([]byte(u.User.Username() + ":" + password))
+		req.Header.Set("Proxy-Authorization", "Basic "+credentials)
+	}
+	if err := req.Write(conn); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, req)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		conn.Close()
+		return nil, fmt.Errorf("proxy CONNECT %s: %s", target, resp.Status)
+	}
+	if br.Buffered() > 0 {
+		return &bufferedConn{Conn: conn, r: br}, nil
+	}
+	return conn, nil
+}
+
+// bufferedConn은 CONNECT 응답을 읽으면서 미리 읽힌 바이트를 먼저 돌려준다.
+type bufferedConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func (b *bufferedConn) Read(p []byte) (int, error) {
+	return b.r.Read(p)
+}
+
+func proxyHostPort(u *url.URL) string {
+	if u.Port() != "" {
+		return u.Host
+	}
+	switch u.Scheme {
+	case "https":
+		return net.JoinHostPort(u.Hostname(), "443")
+	case "socks5", "socks5h":
+		return net.JoinHostPort(u.Hostname(), "1080")
+	default:
+		return net.JoinHostPort(u.Hostname(), "80")
+	}
+}
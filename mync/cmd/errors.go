@@ -7,3 +7,21 @@ var ErrorNoServerSpecified = errors.New("you have to specify the remote server")
 var ErrorInvalidHttpMethod = errors.New("invalid HTTP method")
 
 var ErrorInvalidHTTPPostOption = errors.New("invalid option for HTTP POST")
+
+var ErrorPluginNotFound = errors.New("no plugin found for sub-command")
+
+var ErrorInvalidPluginsCommand = errors.New("invalid plugins command")
+
+var ErrorInvalidBasicAuth = errors.New("invalid auth string. auth string must be a \"username:password\"")
+
+var ErrorConflictingAuth = errors.New("only one of -basicauth, -bearer and -oauth-token-url can be specified")
+
+var ErrorNoTokenURL = errors.New("-oauth-device-url requires -oauth-token-url")
+
+var ErrorNoClientID = errors.New("OAuth2 flows require -oauth-client-id")
+
+var ErrorInvalidStreamFormat = errors.New("invalid stream format. format must be one of auto, raw, ndjson, sse")
+
+var ErrorInvalidProxy = errors.New("invalid proxy. proxy must be http://, https:// or socks5:// URL")
+
+var ErrorInvalidGrpcService = errors.New("invalid grpc service")
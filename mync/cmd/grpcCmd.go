@@ -2,13 +2,16 @@ package cmd
 
 import (
 	"context"
-	"errors"
 	"flag"
 	"fmt"
 	"io"
+	"net"
+	"os"
+	"strings"
 
 	svc "github.com/PaulOh5/mync/cmd/grpc-service"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/credentials/insecure"
 	"google.golang.org/protobuf/encoding/protojson"
 )
@@ -18,6 +21,8 @@ type grpcConfig struct {
 	method  string
 	request string
 	url     string
+	auth    authConfig
+	network networkConfig
 }
 
 func HandleGrpc(w io.Writer, args []string) error {
@@ -27,6 +32,8 @@ func HandleGrpc(w io.Writer, args []string) error {
 	fs.StringVar(&c.service, "service", "", "Service of gRPC")
 	fs.StringVar(&c.method, "method", "", "Method to call")
 	fs.StringVar(&c.request, "request", "", "Request for gRPC")
+	addAuthFlags(fs, &c.auth)
+	addNetworkFlags(fs, &c.network)
 
 	fs.Usage = func() {
 		var usageString = `
@@ -43,25 +50,35 @@ grpc: <options> server`
 
 	err := fs.Parse(args)
 	if err != nil {
-		return err
+		return UsageError{err}
 	}
 
 	if fs.NArg() != 1 {
 		return ErrorNoServerSpecified
 	}
+	c.auth.prompt = os.Stderr
+	if err := c.auth.validate(); err != nil {
+		return err
+	}
+	c.network.log = os.Stderr
+	if err := c.network.validate(); err != nil {
+		return err
+	}
+	c.auth.httpClient = c.network.httpClient()
 
 	c.url = fs.Arg(0)
 	result, err := sendGRPCRequest(c)
 	if err != nil {
 		return err
 	}
+	recordGRPCStatus(w, codes.OK.String())
 	fmt.Fprintln(w, result)
 
 	return nil
 }
 
 func sendGRPCRequest(config grpcConfig) (string, error) {
-	conn, err := setupGrpcConnection(config.url)
+	conn, err := setupGrpcConnection(config)
 	if err != nil {
 		return "", err
 	}
@@ -91,15 +108,26 @@ func sendGRPCRequest(config grpcConfig) (string, error) {
 		}
 		return getRepoResponseJson(result)
 	default:
-		return "", errors.New("invalid grpc service")
+		return "", ErrorInvalidGrpcService
 	}
 }
 
-func setupGrpcConnection(addr string) (*grpc.ClientConn, error) {
-	return grpc.NewClient(
-		addr,
+func setupGrpcConnection(config grpcConfig) (*grpc.ClientConn, error) {
+	opts := []grpc.DialOption{
 		grpc.WithTransportCredentials(insecure.NewCredentials()),
-	)
+		grpc.WithPerRPCCredentials(bearerCredentials{auth: config.auth}),
+	}
+	target := config.url
+	if config.network.enabled() {
+		// dns 리졸버가 주소를 먼저 풀지 않도록 호스트 이름을 그대로 다이얼러에 넘긴다
+		if !strings.Contains(target, "://") {
+			target = "passthrough:///" + target
+		}
+		opts = append(opts, grpc.WithContextDialer(func(ctx context.Context, addr string) (net.Conn, error) {
+			return config.network.DialContext(ctx, "tcp", addr)
+		}))
+	}
+	return grpc.NewClient(target, opts...)
 }
 
 func getUserServiceClient(conn *grpc.ClientConn) svc.UsersClient {
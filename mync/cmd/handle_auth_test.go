@@ -0,0 +1,237 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func startAuthEchoServer(t *testing.T) (*httptest.Server, *string) {
+	t.Helper()
+	var gotAuth string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotAuth = r.Header.Get("Authorization")
+		w.Write([]byte("ok"))
+	}))
+	t.Cleanup(ts.Close)
+	return ts, &gotAuth
+}
+
+func TestGetMethodWithBearer(t *testing.T) {
+	ts, gotAuth := startAuthEchoServer(t)
+	byteBuf := new(bytes.Buffer)
+	err := HandleGetHttp(byteBuf, []string{"-bearer", "abc", ts.URL})
+	if err != nil {
+		t.Fatalf("Expected nil error, but got %v", err)
+	}
+	if *gotAuth != "Bearer abc" {
+		t.Errorf("Expected Authorization %q, but got %q", "Bearer abc", *gotAuth)
+	}
+}
+
+func TestAuthConfigValidate(t *testing.T) {
+	testConfigs := []struct {
+		auth authConfig
+		err  error
+	}{
+		{auth: authConfig{}, err: nil},
+		{auth: authConfig{basicAuth: "user"}, err: ErrorInvalidBasicAuth},
+		{auth: authConfig{basicAuth: "user:pw", bearer: "abc"}, err: ErrorConflictingAuth},
+		{auth: authConfig{deviceURL: "http://localhost/device"}, err: ErrorNoTokenURL},
+		{auth: authConfig{tokenURL: "http://localhost/token"}, err: ErrorNoClientID},
+	}
+	for _, tc := range testConfigs {
+		err := tc.auth.validate()
+		if err != tc.err {
+			t.Errorf("Expected error %v, but got %v", tc.err, err)
+		}
+	}
+}
+
+func TestClientCredentialsTokenCache(t *testing.T) {
+	tokenServer := StartTestTokenServer("mync", "secret")
+	defer tokenServer.Close()
+	ts, gotAuth := startAuthEchoServer(t)
+
+	cachePath := filepath.Join(t.TempDir(), "tokens.json")
+	args := []string{
+		"-oauth-token-url", tokenServer.URL + "/token",
+		"-oauth-client-id", "mync",
+		"-oauth-client-secret", "secret",
+		"-oauth-scopes", "read,write",
+		"-token-cache", cachePath,
+		ts.URL,
+	}
+	for i := 0; i < 2; i++ {
+		byteBuf := new(bytes.Buffer)
+		err := HandleGetHttp(byteBuf, args)
+		if err != nil {
+			t.Fatalf("Expected nil error, but got %v", err)
+		}
+		if *gotAuth != "Bearer token-1" {
+			t.Errorf("Expected Authorization %q, but got %q", "Bearer token-1", *gotAuth)
+		}
+	}
+	// 두 번째 요청은 캐시된 토큰을 사용해야 함
+	if grants := tokenServer.Grants(); len(grants) != 1 {
+		t.Fatalf("Expected 1 token request, but got %v", grants)
+	}
+
+	args[5] = "wrong"
+	args[9] = filepath.Join(t.TempDir(), "tokens.json")
+	err := HandleGetHttp(new(bytes.Buffer), args)
+	if err == nil || !strings.Contains(err.Error(), "invalid_client") {
+		t.Errorf("Expected invalid_client error, but got %v", err)
+	}
+}
+
+func TestTokenRefresh(t *testing.T) {
+	tokenServer := StartTestTokenServer("mync", "")
+	defer tokenServer.Close()
+
+	c := authConfig{
+		tokenURL:   tokenServer.URL + "/token",
+		clientID:   "mync",
+		tokenCache: filepath.Join(t.TempDir(), "tokens.json"),
+	}
+	expired := oauthToken{
+		AccessToken:  "old",
+		RefreshToken: "refresh-0",
+		Expiry:       time.Now().Add(-time.Minute),
+	}
+	if err := c.storeToken(c.cacheKey(), expired); err != nil {
+		t.Fatal(err)
+	}
+
+	v, err := c.authorization(context.Background())
+	if err != nil {
+		t.Fatalf("Expected nil error, but got %v", err)
+	}
+	if v != "Bearer token-1" {
+		t.Errorf("Expected refreshed token, but got %q", v)
+	}
+	if grants := tokenServer.Grants(); len(grants) != 1 || grants[0] != "refresh_token" {
+		t.Errorf("Expected a refresh_token grant, but got %v", grants)
+	}
+	cached := readTokenCache(c.tokenCache)[c.cacheKey()]
+	if cached.RefreshToken != "refresh-1" || !cached.valid() {
+		t.Errorf("Expected refreshed token in cache, but got %+v", cached)
+	}
+}
+
+func TestTokenCacheWriteFailure(t *testing.T) {
+	tokenServer := StartTestTokenServer("mync", "secret")
+	defer tokenServer.Close()
+
+	// 캐시 파일의 상위 경로가 파일이면 캐시를 쓸 수 없다
+	parent := filepath.Join(t.TempDir(), "file")
+	if err := os.WriteFile(parent, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	prompt := new(bytes.Buffer)
+	c := authConfig{
+		tokenURL:     tokenServer.URL + "/token",
+		clientID:     "mync",
+		clientSecret: "secret",
+		tokenCache:   filepath.Join(parent, "tokens.json"),
+		prompt:       prompt,
+	}
+	v, err := c.authorization(context.Background())
+	if err != nil {
+		t.Fatalf("Expected nil error, but got %v", err)
+	}
+	if v != "Bearer token-1" {
+		t.Errorf("Expected token, but got %q", v)
+	}
+	if !strings.Contains(prompt.String(), "Warning: failed to cache the token") {
+		t.Errorf("Expected a warning, but got %q", prompt.String())
+	}
+
+	// 요청 컨텍스트가 취소되면 토큰을 받지 않는다
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := c.authorization(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled, but got %v", err)
+	}
+}
+
+// 토큰은 GET 요청의 짧은 기한과 별개로 받아야 한다
+func TestHTTPGetTokenFlows(t *testing.T) {
+	ts, gotAuth := startAuthEchoServer(t)
+
+	testConfigs := []struct {
+		name   string
+		secret string
+		delay  time.Duration
+		args   []string
+		grants int
+	}{
+		{
+			name: "client credentials", secret: "secret", delay: 100 * time.Millisecond,
+			args:   []string{"-oauth-client-secret", "secret"},
+			grants: 1,
+		},
+		{
+			// 디바이스 흐름은 interval만큼 기다린 뒤 한 번 더 폴링한다
+			name: "device code", args: []string{"-oauth-device-url", "DEVICE_URL"},
+			grants: 2,
+		},
+	}
+	for _, tc := range testConfigs {
+		tokenServer := StartTestTokenServer("mync", tc.secret)
+		tokenServer.SetDelay(tc.delay)
+		args := []string{"get", "-oauth-token-url", tokenServer.URL + "/token", "-oauth-client-id", "mync"}
+		for _, arg := range tc.args {
+			args = append(args, strings.Replace(arg, "DEVICE_URL", tokenServer.URL+"/device", 1))
+		}
+		args = append(args, ts.URL)
+
+		*gotAuth = ""
+		err := HandleHttp(new(bytes.Buffer), args)
+		tokenServer.Close()
+		if err != nil {
+			t.Fatalf("%s: Expected nil error, but got %v", tc.name, err)
+		}
+		if *gotAuth != "Bearer token-1" {
+			t.Errorf("%s: Expected Authorization %q, but got %q", tc.name, "Bearer token-1", *gotAuth)
+		}
+		if grants := tokenServer.Grants(); len(grants) != tc.grants {
+			t.Errorf("%s: Expected %d token requests, but got %v", tc.name, tc.grants, grants)
+		}
+	}
+}
+
+func TestDeviceCodeFlow(t *testing.T) {
+	tokenServer := StartTestTokenServer("mync", "")
+	defer tokenServer.Close()
+
+	prompt := new(bytes.Buffer)
+	c := authConfig{
+		tokenURL:   tokenServer.URL + "/token",
+		deviceURL:  tokenServer.URL + "/device",
+		clientID:   "mync",
+		tokenCache: filepath.Join(t.TempDir(), "tokens.json"),
+		prompt:     prompt,
+	}
+	creds := bearerCredentials{auth: c}
+	md, err := creds.GetRequestMetadata(context.Background())
+	if err != nil {
+		t.Fatalf("Expected nil error, but got %v", err)
+	}
+	if md["authorization"] != "Bearer token-1" {
+		t.Errorf("Expected gRPC metadata with token, but got %v", md)
+	}
+	if !strings.Contains(prompt.String(), "ABCD-EFGH") {
+		t.Errorf("Expected user code in prompt, but got %q", prompt.String())
+	}
+	if grants := tokenServer.Grants(); len(grants) != 2 {
+		t.Errorf("Expected 2 device code polls, but got %v", grants)
+	}
+}
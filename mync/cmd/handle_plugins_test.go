@@ -0,0 +1,99 @@
+package cmd
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeTestPlugin(t *testing.T, dir, name, script string) {
+	t.Helper()
+	path := filepath.Join(dir, pluginPrefix+name)
+	err := os.WriteFile(path, []byte("#!/bin/sh\n"+script+"\n"), 0o755)
+	if err != nil {
+		t.Fatalf("Failed to write plugin: %v", err)
+	}
+}
+
+func TestFindPlugins(t *testing.T) {
+	dir1 := t.TempDir()
+	dir2 := t.TempDir()
+	writeTestPlugin(t, dir1, "hello", "echo hello")
+	writeTestPlugin(t, dir2, "hello", "echo shadowed")
+	writeTestPlugin(t, dir2, "deploy", "echo deploy")
+	// 실행 권한이 없는 파일은 플러그인이 아님
+	err := os.WriteFile(filepath.Join(dir2, pluginPrefix+"noexec"), []byte("x"), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir1+string(os.PathListSeparator)+dir2)
+
+	plugins := FindPlugins()
+	if len(plugins) != 2 {
+		t.Fatalf("Expected 2 plugins, but got %v", plugins)
+	}
+	if plugins[0].Name != "deploy" || plugins[1].Name != "hello" {
+		t.Fatalf("Expected plugins [deploy hello], but got %v", plugins)
+	}
+	if plugins[1].Path != filepath.Join(dir1, pluginPrefix+"hello") {
+		t.Errorf("Expected first plugin in PATH to win, but got %s", plugins[1].Path)
+	}
+}
+
+func TestRunPlugin(t *testing.T) {
+	dir := t.TempDir()
+	writeTestPlugin(t, dir, "env", `echo "$MYNC_PLUGIN_NAME $MYNC_PROFILE $@"`)
+	t.Setenv("PATH", dir)
+
+	p, err := LookupPlugin("env")
+	if err != nil {
+		t.Fatalf("Expected nil error, but got %v", err)
+	}
+	byteBuf := new(bytes.Buffer)
+	err = RunPlugin(byteBuf, p, []string{"a", "b"}, PluginConfig{Profile: "staging"})
+	if err != nil {
+		t.Fatalf("Expected nil error, but got %v", err)
+	}
+	expectedOutput := "env staging a b\n"
+	if byteBuf.String() != expectedOutput {
+		t.Errorf("Expected output %q, but got %q", expectedOutput, byteBuf.String())
+	}
+
+	_, err = LookupPlugin("missing")
+	if err != ErrorPluginNotFound {
+		t.Errorf("Expected error %v, but got %v", ErrorPluginNotFound, err)
+	}
+
+	// 시그널로 종료된 플러그인은 정의된 종료 코드를 사용한다
+	writeTestPlugin(t, dir, "killed", "kill -9 $$")
+	p, err = LookupPlugin("killed")
+	if err != nil {
+		t.Fatalf("Expected nil error, but got %v", err)
+	}
+	err = RunPlugin(new(bytes.Buffer), p, nil, PluginConfig{})
+	if e := ClassifyError(err); e == nil || e.Category != CategoryPlugin || e.ExitCode != ExitInternal {
+		t.Errorf("Expected plugin error with exit code %d, but got %+v", ExitInternal, e)
+	}
+}
+
+func TestHandlePlugins(t *testing.T) {
+	dir := t.TempDir()
+	writeTestPlugin(t, dir, "hello", "echo hello")
+	t.Setenv("PATH", dir)
+
+	byteBuf := new(bytes.Buffer)
+	err := HandlePlugins(byteBuf, []string{"list"})
+	if err != nil {
+		t.Fatalf("Expected nil error, but got %v", err)
+	}
+	if !strings.HasPrefix(byteBuf.String(), "hello\t") {
+		t.Errorf("Expected plugin listing, but got %q", byteBuf.String())
+	}
+
+	err = HandlePlugins(byteBuf, []string{})
+	if err != ErrorInvalidPluginsCommand {
+		t.Errorf("Expected error %v, but got %v", ErrorInvalidPluginsCommand, err)
+	}
+}
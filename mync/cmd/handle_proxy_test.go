@@ -0,0 +1,284 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	svc "github.com/PaulOh5/mync/cmd/grpc-service"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+func startConnectProxy(t *testing.T, wantAuth string) (*httptest.Server, *[]string) {
+	t.Helper()
+	targets := []string{}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "CONNECT" {
+			http.Error(w, "only CONNECT", http.StatusMethodNotAllowed)
+			return
+		}
+		if wantAuth != "" && r.Header.Get("Proxy-Authorization") != wantAuth {
+			http.Error(w, "proxy auth required", http.StatusProxyAuthRequired)
+			return
+		}
+		targets = append(targets, r.Host)
+		upstream, err := net.Dial("tcp", r.Host)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		conn, brw, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			upstream.Close()
+			return
+		}
+		conn.Write([]byte("HTTP/1.1 200 Connection established\r\n\r\n"))
+		go pipeConns(conn, brw, upstream)
+	}))
+	t.Cleanup(ts.Close)
+	return ts, &targets
+}
+
+func pipeConns(conn net.Conn, r io.Reader, upstream net.Conn) {
+	defer conn.Close()
+	defer upstream.Close()
+	go io.Copy(upstream, r)
+	io.Copy(conn, upstream)
+}
+
+// startSOCKS5Proxy는 사용자 이름/비밀번호 인증과 CONNECT만 지원하는 SOCKS5 서버다.
+func startSOCKS5Proxy(t *testing.T, user, password string) (net.Listener, *[]string) {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	targets := []string{}
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			target, err := socks5Handshake(conn, user, password)
+			if err != nil {
+				conn.Close()
+				continue
+			}
+			targets = append(targets, target)
+			upstream, err := net.Dial("tcp", target)
+			if err != nil {
+				conn.Write([]byte{5, 5, 0, 1, 0, 0, 0, 0, 0, 0})
+				conn.Close()
+				continue
+			}
+			conn.Write([]byte{5, 0, 0, 1, 0, 0, 0, 0, 0, 0})
+			go pipeConns(conn, conn, upstream)
+		}
+	}()
+	return l, &targets
+}
+
+func socks5Handshake(conn net.Conn, user, password string) (string, error) {
+	buf := make([]byte, 256)
+	if _, err := io.ReadFull(conn, buf[:2]); err != nil {
+		return "", err
+	}
+	if _, err := io.ReadFull(conn, buf[:buf[1]]); err != nil {
+		return "", err
+	}
+	conn.Write([]byte{5, 2})
+	if _, err := io.ReadFull(conn, buf[:2]); err != nil {
+		return "", err
+	}
+	u := make([]byte, buf[1])
+	io.ReadFull(conn, u)
+	io.ReadFull(conn, buf[:1])
+	p := make([]byte, buf[0])
+	io.ReadFull(conn, p)
+	if string(u) != user || string(p) != password {
+		conn.Write([]byte{1, 1})
+		return "", fmt.Errorf("invalid credentials")
+	}
+	conn.Write([]byte{1, 0})
+
+	if _, err := io.ReadFull(conn, buf[:4]); err != nil {
+		return "", err
+	}
+	var host string
+	switch buf[3] {
+	case 1:
+		io.ReadFull(conn, buf[:4])
+		host = net.IP(buf[:4]).String()
+	case 3:
+		io.ReadFull(conn, buf[:1])
+		name := make([]byte, buf[0])
+		io.ReadFull(conn, name)
+		host = string(name)
+	default:
+		return "", fmt.Errorf("unsupported address type %d", buf[3])
+	}
+	io.ReadFull(conn, buf[:2])
+	port := binary.BigEndian.Uint16(buf[:2])
+	return net.JoinHostPort(host, fmt.Sprint(port)), nil
+}
+
+func TestDialAddress(t *testing.T) {
+	c := networkConfig{}
+	c.connectTo.connectTo = true
+	for _, v := range []string{"api.example.com:443:backend-2.example.com:8443", "::lb.example.com:"} {
+		if err := c.connectTo.Set(v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, v := range []string{"backend-2.example.com:8443:10.0.0.2", "ipv6.example.com:443:[::1]"} {
+		if err := c.resolve.Set(v); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	testConfigs := []struct {
+		addr   string
+		target string
+	}{
+		{addr: "api.example.com:443", target: "10.0.0.2:8443"},
+		{addr: "other.example.com:80", target: "lb.example.com:80"},
+		{addr: "ipv6.example.com:443", target: "lb.example.com:443"},
+	}
+	for _, tc := range testConfigs {
+		got, err := c.dialAddress(tc.addr)
+		if err != nil {
+			t.Fatalf("Expected nil error, but got %v", err)
+		}
+		if got != tc.target {
+			t.Errorf("Expected %s to dial %s, but got %s", tc.addr, tc.target, got)
+		}
+	}
+
+	c = networkConfig{}
+	c.resolve.Set("ipv6.example.com:443:[::1]")
+	got, _ := c.dialAddress("ipv6.example.com:443")
+	if got != "[::1]:443" {
+		t.Errorf("Expected [::1]:443, but got %s", got)
+	}
+
+	err := c.resolve.Set("missing-port:127.0.0.1")
+	if err == nil {
+		t.Error("Expected error for invalid -resolve, but got nil")
+	}
+}
+
+func TestGetMethodWithResolve(t *testing.T) {
+	ts := StartTestPackageServer()
+	defer ts.Close()
+	_, port, _ := net.SplitHostPort(ts.Listener.Addr().String())
+
+	byteBuf := new(bytes.Buffer)
+	args := []string{
+		"-resolve", "packages.invalid:" + port + ":127.0.0.1",
+		"http://packages.invalid:" + port,
+	}
+	err := HandleGetHttp(byteBuf, args)
+	if err != nil {
+		t.Fatalf("Expected nil error, but got %v", err)
+	}
+	if byteBuf.String() != "package1-0.1" {
+		t.Errorf("Expected output %q, but got %q", "package1-0.1", byteBuf.String())
+	}
+}
+
+func TestHTTPConnectProxy(t *testing.T) {
+	ts := StartTestPackageServer()
+	defer ts.Close()
+	proxyServer, targets := startConnectProxy(t, "Basic dXNlcjpwYXNz")
+	_, port, _ := net.SplitHostPort(ts.Listener.Addr().String())
+
+	logBuf := new(bytes.Buffer)
+	c := networkConfig{
+		proxy:   strings.Replace(proxyServer.URL, "http://", "http://user:pass@", 1),
+		verbose: true,
+		log:     logBuf,
+	}
+	c.connectTo.connectTo = true
+	c.connectTo.Set("packages.invalid::127.0.0.1:")
+
+	resp, err := c.httpClient().Get("http://packages.invalid:" + port)
+	if err != nil {
+		t.Fatalf("Expected nil error, but got %v", err)
+	}
+	defer resp.Body.Close()
+	data, _ := io.ReadAll(resp.Body)
+	if string(data) != "package1-0.1" {
+		t.Errorf("Expected body %q, but got %q", "package1-0.1", data)
+	}
+	if len(*targets) != 1 || (*targets)[0] != "127.0.0.1:"+port {
+		t.Errorf("Expected proxy to connect to 127.0.0.1:%s, but got %v", port, *targets)
+	}
+	if !strings.Contains(logBuf.String(), "Connected to 127.0.0.1:"+port+" via http proxy") {
+		t.Errorf("Expected verbose output with dialed address, but got %q", logBuf.String())
+	}
+
+	c.proxy = proxyServer.URL
+	_, err = c.httpClient().Get("http://packages.invalid:" + port)
+	if err == nil || !strings.Contains(err.Error(), "407") {
+		t.Errorf("Expected proxy auth error, but got %v", err)
+	}
+}
+
+type testUsersServer struct {
+	svc.UnimplementedUsersServer
+}
+
+func (s testUsersServer) GetUser(ctx context.Context, in *svc.UserGetRequest) (*svc.UserGetReply, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	auth := strings.Join(md.Get("authorization"), "")
+	return &svc.UserGetReply{User: &svc.User{Id: in.Id, FirstName: auth}}, nil
+}
+
+func TestGrpcWithSOCKS5Proxy(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := grpc.NewServer()
+	svc.RegisterUsersServer(s, testUsersServer{})
+	go s.Serve(l)
+	defer s.Stop()
+	_, port, _ := net.SplitHostPort(l.Addr().String())
+
+	proxyListener, targets := startSOCKS5Proxy(t, "user", "pass")
+	byteBuf := new(bytes.Buffer)
+	args := []string{
+		"-service", "Users",
+		"-request", `{"id": "1"}`,
+		"-bearer", "abc",
+		"-proxy", "socks5://user:pass@" + proxyListener.Addr().String(),
+		"-resolve", "users.invalid:" + port + ":127.0.0.1",
+		"users.invalid:" + port,
+	}
+	err = HandleGrpc(byteBuf, args)
+	if err != nil {
+		t.Fatalf("Expected nil error, but got %v", err)
+	}
+	reply := svc.UserGetReply{}
+	err = protojson.Unmarshal(byteBuf.Bytes(), &reply)
+	if err != nil {
+		t.Fatalf("Expected JSON reply, but got %q", byteBuf.String())
+	}
+	if reply.User.Id != "1" || reply.User.FirstName != "Bearer abc" {
+		t.Errorf("Expected user 1 with bearer metadata, but got %v", reply.User)
+	}
+	if len(*targets) != 1 || (*targets)[0] != "127.0.0.1:"+port {
+		t.Errorf("Expected proxy to connect to 127.0.0.1:%s, but got %v", port, *targets)
+	}
+}
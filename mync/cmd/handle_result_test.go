@@ -0,0 +1,56 @@
+package cmd
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestClassifyError(t *testing.T) {
+	testConfigs := []struct {
+		err      error
+		category ErrorCategory
+		exitCode int
+	}{
+		{err: ErrorNoServerSpecified, category: CategoryUsage, exitCode: ExitUsage},
+		{err: UsageError{errors.New("flag provided but not defined: -x")}, category: CategoryUsage, exitCode: ExitUsage},
+		{err: &net.OpError{Op: "dial", Err: errors.New("connection refused")}, category: CategoryNetwork, exitCode: ExitNetwork},
+		{err: fmt.Errorf("get: %w", context.DeadlineExceeded), category: CategoryNetwork, exitCode: ExitNetwork},
+		{err: fmt.Errorf("get: %w", x509.UnknownAuthorityError{}), category: CategoryTLS, exitCode: ExitTLS},
+		{err: HTTPStatusError{StatusCode: 404, Status: "404 Not Found"}, category: CategoryHTTPStatus, exitCode: ExitHTTPStatus},
+		{err: status.Error(codes.NotFound, "no user"), category: CategoryGRPCStatus, exitCode: ExitGRPCStatus},
+		{err: status.Error(codes.Unavailable, "connection refused"), category: CategoryNetwork, exitCode: ExitNetwork},
+		{err: AssertionError{Expected: "status 200", Got: "status 500"}, category: CategoryAssertion, exitCode: ExitAssertion},
+		{err: errors.New("disk full"), category: CategoryInternal, exitCode: ExitInternal},
+		// *url.Error는 안쪽 오류로 분류한다
+		{err: &url.Error{Op: "Get", URL: "http://x", Err: &net.OpError{Op: "dial", Err: errors.New("connection refused")}}, category: CategoryNetwork, exitCode: ExitNetwork},
+		{err: &url.Error{Op: "Get", URL: "http://x", Err: &net.DNSError{Err: "no such host", Name: "x"}}, category: CategoryNetwork, exitCode: ExitNetwork},
+		{err: &url.Error{Op: "Get", URL: "http://x", Err: context.DeadlineExceeded}, category: CategoryNetwork, exitCode: ExitNetwork},
+		{err: &url.Error{Op: "Get", URL: "http://x", Err: io.EOF}, category: CategoryNetwork, exitCode: ExitNetwork},
+		{err: &url.Error{Op: "Get", URL: "http://x", Err: errors.New("stopped after 10 redirects")}, category: CategoryInternal, exitCode: ExitInternal},
+		{err: &url.Error{Op: "Get", URL: "ftp://x", Err: errors.New(`unsupported protocol scheme "ftp"`)}, category: CategoryUsage, exitCode: ExitUsage},
+		{err: &url.Error{Op: "parse", URL: ":x", Err: errors.New("missing protocol scheme")}, category: CategoryUsage, exitCode: ExitUsage},
+		// 토큰 엔드포인트 오류는 네트워크 오류가 아니다
+		{err: tokenRequestError{&url.Error{Op: "Post", URL: "http://x/token", Err: &net.OpError{Op: "dial", Err: errors.New("connection refused")}}}, category: CategoryInternal, exitCode: ExitInternal},
+		{err: tokenRequestError{tokenError{code: "invalid_client"}}, category: CategoryInternal, exitCode: ExitInternal},
+	}
+	for _, tc := range testConfigs {
+		e := ClassifyError(tc.err)
+		if e.Category != tc.category || e.ExitCode != tc.exitCode {
+			t.Errorf("%v: Expected %s (%d), but got %s (%d)", tc.err, tc.category, tc.exitCode, e.Category, e.ExitCode)
+		}
+	}
+
+	if ExitCode(nil) != ExitOK || ExitCode(UsageError{flag.ErrHelp}) != ExitOK {
+		t.Error("Expected exit code 0 for nil and help errors")
+	}
+}
@@ -0,0 +1,152 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func startNDJSONServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		f := w.(http.Flusher)
+		for i := 0; i < 5; i++ {
+			event := "click"
+			if i%2 == 1 {
+				event = "view"
+			}
+			fmt.Fprintf(w, `{"id": %d, "event": %q, "meta": {"n": %d}}`+"\n", i, event, i)
+			f.Flush()
+		}
+	}))
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+func TestStreamNDJSONFilter(t *testing.T) {
+	ts := startNDJSONServer(t)
+	testConfigs := []struct {
+		args   []string
+		output string
+	}{
+		{
+			args: []string{"-filter", "event=view", ts.URL},
+			output: `{"id": 1, "event": "view", "meta": {"n": 1}}` + "\n" +
+				`{"id": 3, "event": "view", "meta": {"n": 3}}` + "\n",
+		},
+		{
+			args:   []string{"-filter", "meta.n=4", ts.URL},
+			output: `{"id": 4, "event": "click", "meta": {"n": 4}}` + "\n",
+		},
+		{
+			args: []string{"-count", "2", ts.URL},
+			output: `{"id": 0, "event": "click", "meta": {"n": 0}}` + "\n" +
+				`{"id": 1, "event": "view", "meta": {"n": 1}}` + "\n",
+		},
+	}
+
+	byteBuf := new(bytes.Buffer)
+	for _, tc := range testConfigs {
+		err := HandleStream(byteBuf, tc.args)
+		if err != nil {
+			t.Fatalf("Expected nil error, but got %v", err)
+		}
+		if byteBuf.String() != tc.output {
+			t.Errorf("Expected output %q, but got %q", tc.output, byteBuf.String())
+		}
+		byteBuf.Reset()
+	}
+}
+
+func TestStreamRawCount(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		fmt.Fprint(w, "line1\nline2\nline3\n")
+	}))
+	defer ts.Close()
+
+	byteBuf := new(bytes.Buffer)
+	err := HandleStream(byteBuf, []string{"-count", "2", ts.URL})
+	if err != nil {
+		t.Fatalf("Expected nil error, but got %v", err)
+	}
+	if byteBuf.String() != "line1\nline2\n" {
+		t.Errorf("Expected output %q, but got %q", "line1\nline2\n", byteBuf.String())
+	}
+}
+
+func TestStreamIdleTimeout(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		fmt.Fprint(w, "hello\n")
+		w.(http.Flusher).Flush()
+		select {
+		case <-r.Context().Done():
+		case <-time.After(5 * time.Second):
+		}
+	}))
+	defer ts.Close()
+
+	byteBuf := new(bytes.Buffer)
+	start := time.Now()
+	err := HandleStream(byteBuf, []string{"-idle-timeout", "200", ts.URL})
+	if err != nil {
+		t.Fatalf("Expected nil error, but got %v", err)
+	}
+	if time.Since(start) > 2*time.Second {
+		t.Errorf("Expected stream to stop after idle timeout, took %v", time.Since(start))
+	}
+	if byteBuf.String() != "hello\n" {
+		t.Errorf("Expected output %q, but got %q", "hello\n", byteBuf.String())
+	}
+}
+
+func TestStreamSSEReconnect(t *testing.T) {
+	var mu sync.Mutex
+	lastEventIDs := []string{}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		lastEventIDs = append(lastEventIDs, r.Header.Get("Last-Event-ID"))
+		n := len(lastEventIDs)
+		mu.Unlock()
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		if n == 1 {
+			// 첫 연결: 재연결 간격을 줄이고 이벤트 두 개를 보낸 뒤 연결을 끊음
+			fmt.Fprint(w, "retry: 10\n: comment\n\nid: 1\ndata: first\n\n")
+			fmt.Fprint(w, "event: update\r\nid: 2\r\ndata: second\r\ndata: line\r\n\r\n")
+			return
+		}
+		fmt.Fprint(w, "id: 3\ndata: third\n\n")
+	}))
+	defer ts.Close()
+
+	byteBuf := new(bytes.Buffer)
+	err := HandleStream(byteBuf, []string{"-count", "3", ts.URL})
+	if err != nil {
+		t.Fatalf("Expected nil error, but got %v", err)
+	}
+	expectedOutput := "id: 1\ndata: first\n\n" +
+		"event: update\nid: 2\ndata: second\ndata: line\n\n" +
+		"id: 3\ndata: third\n\n"
+	if byteBuf.String() != expectedOutput {
+		t.Errorf("Expected output %q, but got %q", expectedOutput, byteBuf.String())
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(lastEventIDs) != 2 || lastEventIDs[0] != "" || lastEventIDs[1] != "2" {
+		t.Errorf("Expected Last-Event-ID [\"\" \"2\"], but got %q", lastEventIDs)
+	}
+}
+
+func TestStreamInvalidFormat(t *testing.T) {
+	err := HandleStream(new(bytes.Buffer), []string{"-format", "xml", "http://localhost"})
+	if err != ErrorInvalidStreamFormat {
+		t.Errorf("Expected error %v, but got %v", ErrorInvalidStreamFormat, err)
+	}
+}
@@ -2,8 +2,8 @@ package cmd
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
-	"errors"
 	"flag"
 	"fmt"
 	"io"
@@ -19,6 +19,8 @@ type postConfig struct {
 	bodyFilePath string
 	upload       string
 	formData     FormData
+	auth         authConfig
+	network      networkConfig
 }
 
 type pkgRegisterResult struct {
@@ -43,6 +45,8 @@ func HandlePostHttp(w io.Writer, args []string) error {
 	var bodyFilePath string
 	var upload string
 	var formData FormData
+	var auth authConfig
+	var network networkConfig
 
 	fs := flag.NewFlagSet("HTTP POST Method", flag.ContinueOnError)
 	fs.SetOutput(w)
@@ -50,6 +54,8 @@ func HandlePostHttp(w io.Writer, args []string) error {
 	fs.StringVar(&bodyFilePath, "body-file", "", "File path of body for reuqest (only json file)")
 	fs.StringVar(&upload, "upload", "", "Upload file path")
 	fs.Var(&formData, "formdata", "Form data (key=value)")
+	addAuthFlags(fs, &auth)
+	addNetworkFlags(fs, &network)
 
 	fs.Usage = func() {
 		var usageString = `
@@ -65,25 +71,36 @@ http post: <options> server`
 
 	err := fs.Parse(args)
 	if err != nil {
-		return err
+		return UsageError{err}
 	}
 
 	if fs.NArg() != 1 {
 		return ErrorNoServerSpecified
 	}
+	auth.prompt = os.Stderr
+	if err := auth.validate(); err != nil {
+		return err
+	}
+	network.log = os.Stderr
+	if err := network.validate(); err != nil {
+		return err
+	}
+	auth.httpClient = network.httpClient()
 
 	c := postConfig{
 		body:         body,
 		bodyFilePath: bodyFilePath,
 		upload:       upload,
 		formData:     formData,
+		auth:         auth,
+		network:      network,
 	}
 	c.url = fs.Arg(0)
 	requestBody, contentType, err := createBody(c)
 	if err != nil {
 		return err
 	}
-	result, err := registerPakcage(requestBody, contentType, c.url)
+	result, err := registerPakcage(w, requestBody, contentType, c.url, c.auth, c.network.httpClient())
 	if err != nil {
 		return err
 	}
@@ -148,19 +165,39 @@ func createMultiPartMessage(upload string, formData []string) (*bytes.Buffer, st
 	return &b, contentType, nil
 }
 
-func registerPakcage(body *bytes.Buffer, contentType string, url string) (pkgRegisterResult, error) {
+func registerPakcage(
+	w io.Writer, body *bytes.Buffer, contentType string, url string,
+	auth authConfig, client *http.Client,
+) (pkgRegisterResult, error) {
 	p := pkgRegisterResult{}
-	r, err := http.Post(url, contentType, body)
+	req, err := http.NewRequestWithContext(withHTTPTrace(context.Background(), w), "POST", url, body)
+	if err != nil {
+		return p, err
+	}
+	req.Header.Set("Content-Type", contentType)
+	authorization, err := auth.authorization(req.Context())
+	if err != nil {
+		return p, err
+	}
+	if authorization != "" {
+		req.Header.Set("Authorization", authorization)
+	}
+	r, err := client.Do(req)
 	if err != nil {
 		return p, err
 	}
 	defer r.Body.Close()
+	recordHTTPStatus(w, r.StatusCode)
 	responseData, err := io.ReadAll(r.Body)
 	if err != nil {
 		return p, err
 	}
 	if r.StatusCode != http.StatusOK {
-		return p, errors.New(string(responseData))
+		return p, HTTPStatusError{
+			StatusCode: r.StatusCode,
+			Status:     r.Status,
+			Body:       strings.TrimSpace(string(responseData)),
+		}
 	}
 	err = json.Unmarshal(responseData, &p)
 	return p, err
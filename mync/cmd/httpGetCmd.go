@@ -19,8 +19,10 @@ type getConfig struct {
 	disableRedirect bool
 	timeout         int
 	header          Header
-	auth            string
+	auth            authConfig
+	network         networkConfig
 	report          bool
+	expectStatus    int
 }
 
 type Header map[string]string
@@ -36,12 +38,17 @@ func (h *Header) String() string {
 }
 
 type ReportClient struct {
-	log *log.Logger
+	log       *log.Logger
+	transport http.RoundTripper
 }
 
 func (c ReportClient) RoundTrip(r *http.Request) (*http.Response, error) {
+	transport := c.transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
 	startTime := time.Now()
-	resp, err := http.DefaultTransport.RoundTrip(r)
+	resp, err := transport.RoundTrip(r)
 	elapsedTime := time.Since(startTime)
 	c.log.Printf("Execution time: %s\n", elapsedTime)
 	return resp, err
@@ -52,8 +59,10 @@ func HandleGetHttp(w io.Writer, args []string) error {
 	var disableRedirect bool
 	var timeout int
 	var header Header
-	var auth string
+	var auth authConfig
+	var network networkConfig
 	var report bool
+	var expectStatus int
 
 	fs := flag.NewFlagSet("HTTP GET Method", flag.ContinueOnError)
 	fs.SetOutput(w)
@@ -61,8 +70,10 @@ func HandleGetHttp(w io.Writer, args []string) error {
 	fs.BoolVar(&disableRedirect, "disable-redirect", false, "Disable redirection")
 	fs.IntVar(&timeout, "timeout", 1000, "Time out, unit is ms (default=1000ms)")
 	fs.Var(&header, "header", "Header value (key=value)")
-	fs.StringVar(&auth, "basicauth", "", "Atuh value (user:password)")
+	addAuthFlags(fs, &auth)
+	addNetworkFlags(fs, &network)
 	fs.BoolVar(&report, "report", false, "Latency report (default=false)")
+	fs.IntVar(&expectStatus, "expect-status", 0, "Fail with an assertion error unless the response has this status code")
 
 	fs.Usage = func() {
 		var usageString = `
@@ -78,12 +89,21 @@ http get: <options> server`
 
 	err := fs.Parse(args)
 	if err != nil {
-		return err
+		return UsageError{err}
 	}
 
 	if fs.NArg() != 1 {
 		return ErrorNoServerSpecified
 	}
+	auth.prompt = os.Stderr
+	if err := auth.validate(); err != nil {
+		return err
+	}
+	network.log = os.Stderr
+	if err := network.validate(); err != nil {
+		return err
+	}
+	auth.httpClient = network.httpClient()
 
 	c := getConfig{
 		output:          output,
@@ -91,13 +111,20 @@ http get: <options> server`
 		timeout:         timeout,
 		header:          header,
 		auth:            auth,
+		network:         network,
 		report:          report,
+		expectStatus:    expectStatus,
 	}
 	c.url = fs.Arg(0)
 	httpClient := createHTTPClient(c)
+	// 토큰은 요청의 짧은 기한과 별개로 받는다. 디바이스 흐름은 사용자가 승인할 때까지 기다린다
+	authorization, err := c.auth.authorization(context.Background())
+	if err != nil {
+		return err
+	}
 	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Millisecond)
 	defer cancel()
-	request, err := createHTTPGetRequest(ctx, c)
+	request, err := createHTTPGetRequest(withHTTPTrace(ctx, w), c, authorization)
 	if err != nil {
 		return err
 	}
@@ -120,8 +147,12 @@ func createHTTPClient(config getConfig) *http.Client {
 		client = &http.Client{}
 	}
 
+	if config.network.enabled() {
+		client.Transport = config.network.transport()
+	}
+
 	if config.report {
-		reportTransport := ReportClient{}
+		reportTransport := ReportClient{transport: client.Transport}
 		client.Transport = &reportTransport
 	}
 
@@ -141,6 +172,7 @@ func fetchRemoteResource(w io.Writer, client *http.Client, request *http.Request
 		return err
 	}
 	defer r.Body.Close()
+	recordHTTPStatus(w, r.StatusCode)
 
 	data, err := io.ReadAll(r.Body)
 	if err != nil {
@@ -153,6 +185,24 @@ func fetchRemoteResource(w io.Writer, client *http.Client, request *http.Request
 		if err != nil {
 			return err
 		}
+		recordBodyFile(w, config.output)
+	}
+	// -expect-status를 주면 오류 상태 코드도 기대한 값인지만 확인한다
+	if config.expectStatus != 0 {
+		if r.StatusCode != config.expectStatus {
+			return AssertionError{
+				Expected: fmt.Sprintf("status %d", config.expectStatus),
+				Got:      fmt.Sprintf("status %d", r.StatusCode),
+			}
+		}
+		return nil
+	}
+	if r.StatusCode >= http.StatusBadRequest {
+		return HTTPStatusError{
+			StatusCode: r.StatusCode,
+			Status:     r.Status,
+			Body:       strings.TrimSpace(string(data)),
+		}
 	}
 	return nil
 }
@@ -170,7 +220,7 @@ func createFile(data, path string) error {
 	return nil
 }
 
-func createHTTPGetRequest(ctx context.Context, config getConfig) (*http.Request, error) {
+func createHTTPGetRequest(ctx context.Context, config getConfig, authorization string) (*http.Request, error) {
 	req, err := http.NewRequestWithContext(ctx, "GET", config.url, nil)
 	if err != nil {
 		return nil, err
@@ -179,14 +229,9 @@ func createHTTPGetRequest(ctx context.Context, config getConfig) (*http.Request,
 		req.Header.Add(k, v)
 	}
 
-	authParts := strings.Split(config.auth, ":")
-	if len(authParts) == 2 {
-		username := authParts[0]
-		password := authParts[1]
-		req.SetBasicAuth(username, password)
-	} else {
-		return nil, errors.New("invalid auth string. auth string must be a \"username:password\"")
+	if authorization != "" {
+		req.Header.Set("Authorization", authorization)
 	}
 
-	return req, err
+	return req, nil
 }
@@ -0,0 +1,160 @@
+package cmd
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const pluginPrefix = "mync-"
+
+type Plugin struct {
+	Name string
+	Path string
+}
+
+type PluginConfig struct {
+	Profile string
+	Stdin   io.Reader
+	Stderr  io.Writer
+}
+
+// FindPlugins는 PATH에서 mync-* 실행 파일을 찾는다.
+// 같은 이름이 여러 번 나오면 PATH에서 먼저 나온 것을 사용한다.
+func FindPlugins() []Plugin {
+	seen := map[string]bool{}
+	plugins := []Plugin{}
+	for _, dir := range filepath.SplitList(os.Getenv("PATH")) {
+		if dir == "" {
+			dir = "."
+		}
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		for _, e := range entries {
+			name, ok := pluginName(e.Name())
+			if !ok || seen[name] {
+				continue
+			}
+			path := filepath.Join(dir, e.Name())
+			if !isExecutable(path) {
+				continue
+			}
+			seen[name] = true
+			plugins = append(plugins, Plugin{Name: name, Path: path})
+		}
+	}
+	sort.Slice(plugins, func(i, j int) bool {
+		return plugins[i].Name < plugins[j].Name
+	})
+	return plugins
+}
+
+func LookupPlugin(name string) (Plugin, error) {
+	if name == "" || strings.ContainsAny(name, `/\`) {
+		return Plugin{}, ErrorPluginNotFound
+	}
+	path, err := exec.LookPath(pluginPrefix + name)
+	if err != nil {
+		return Plugin{}, ErrorPluginNotFound
+	}
+	return Plugin{Name: name, Path: path}, nil
+}
+
+func RunPlugin(w io.Writer, p Plugin, args []string, config PluginConfig) error {
+	c := exec.Command(p.Path, args...)
+	c.Stdout = w
+	c.Stdin = config.Stdin
+	c.Stderr = config.Stderr
+	if c.Stderr == nil {
+		c.Stderr = w
+	}
+	c.Env = append(os.Environ(), pluginEnv(p, config)...)
+	err := c.Run()
+	if err != nil {
+		return fmt.Errorf("plugin %s: %w", p.Name, err)
+	}
+	return nil
+}
+
+func pluginEnv(p Plugin, config PluginConfig) []string {
+	env := []string{
+		"MYNC_PLUGIN_NAME=" + p.Name,
+		"MYNC_PROFILE=" + config.Profile,
+	}
+	if exe, err := os.Executable(); err == nil {
+		env = append(env, "MYNC_BIN="+exe)
+	}
+	return env
+}
+
+func pluginName(fileName string) (string, bool) {
+	if !strings.HasPrefix(fileName, pluginPrefix) {
+		return "", false
+	}
+	name := strings.TrimPrefix(fileName, pluginPrefix)
+	name = strings.TrimSuffix(name, filepath.Ext(name))
+	if name == "" {
+		return "", false
+	}
+	return name, true
+}
+
+func isExecutable(path string) bool {
+	info, err := os.Stat(path)
+	if err != nil || info.IsDir() {
+		return false
+	}
+	return info.Mode()&0o111 != 0
+}
+
+func PrintPluginUsage(w io.Writer) {
+	plugins := FindPlugins()
+	if len(plugins) == 0 {
+		return
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Plugins: ")
+	for _, p := range plugins {
+		fmt.Fprintf(w, "  %s\t%s\n", p.Name, p.Path)
+	}
+}
+
+func HandlePlugins(w io.Writer, args []string) error {
+	fs := flag.NewFlagSet("plugins", flag.ContinueOnError)
+	fs.SetOutput(w)
+	fs.Usage = func() {
+		var usageString = `
+plugins: Manage mync plugins (mync-* executables in PATH)
+plugins: list`
+
+		fmt.Fprint(w, usageString)
+		fmt.Fprintln(w)
+	}
+
+	err := fs.Parse(args)
+	if err != nil {
+		return UsageError{err}
+	}
+
+	if fs.NArg() != 1 || fs.Arg(0) != "list" {
+		fs.Usage()
+		return ErrorInvalidPluginsCommand
+	}
+
+	plugins := FindPlugins()
+	if len(plugins) == 0 {
+		fmt.Fprintln(w, "No plugins found in PATH")
+		return nil
+	}
+	for _, p := range plugins {
+		fmt.Fprintf(w, "%s\t%s\n", p.Name, p.Path)
+	}
+	return nil
+}
@@ -0,0 +1,401 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/http/httptrace"
+	"net/url"
+	"os/exec"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type ErrorCategory string
+
+const (
+	CategoryUsage      ErrorCategory = "usage"
+	CategoryNetwork    ErrorCategory = "network"
+	CategoryTLS        ErrorCategory = "tls"
+	CategoryHTTPStatus ErrorCategory = "http-status"
+	CategoryGRPCStatus ErrorCategory = "grpc-status"
+	CategoryAssertion  ErrorCategory = "assertion"
+	CategoryPlugin     ErrorCategory = "plugin"
+	CategoryInternal   ErrorCategory = "internal"
+)
+
+// 종료 코드는 래퍼 스크립트가 의존하므로 값을 바꾸지 않는다.
+//
+//	0  성공
+//	1  internal: 분류되지 않은 오류 (파일 입출력, OAuth 토큰 발급 실패 등)
+//	2  usage: 잘못된 서브 커맨드, 옵션, 인수
+//	3  network: 연결 실패, 타임아웃, 프록시 오류
+//	4  tls: 인증서 검증 실패, TLS 핸드셰이크 오류
+//	5  http-status: 서버가 오류 상태 코드로 응답
+//	6  grpc-status: gRPC 호출이 OK가 아닌 상태로 종료
+//	7  assertion: -expect-status 같은 기대값 불일치
+//	플러그인이 실패하면 플러그인의 종료 코드를 그대로 사용한다. 시그널로 종료되면 1을 사용한다.
+const (
+	ExitOK         = 0
+	ExitInternal   = 1
+	ExitUsage      = 2
+	ExitNetwork    = 3
+	ExitTLS        = 4
+	ExitHTTPStatus = 5
+	ExitGRPCStatus = 6
+	ExitAssertion  = 7
+)
+
+var exitCodes = map[ErrorCategory]int{
+	CategoryUsage:      ExitUsage,
+	CategoryNetwork:    ExitNetwork,
+	CategoryTLS:        ExitTLS,
+	CategoryHTTPStatus: ExitHTTPStatus,
+	CategoryGRPCStatus: ExitGRPCStatus,
+	CategoryAssertion:  ExitAssertion,
+	CategoryInternal:   ExitInternal,
+}
+
+func PrintExitCodes(w io.Writer) {
+	fmt.Fprintln(w, "Exit codes: ")
+	fmt.Fprintf(w, "  %d\tsuccess\n", ExitOK)
+	for _, c := range []ErrorCategory{
+		CategoryInternal, CategoryUsage, CategoryNetwork, CategoryTLS,
+		CategoryHTTPStatus, CategoryGRPCStatus, CategoryAssertion,
+	} {
+		fmt.Fprintf(w, "  %d\t%s\n", exitCodes[c], c)
+	}
+	fmt.Fprintln(w, "  *\tplugin (exit code of the plugin)")
+}
+
+type UsageError struct {
+	Err error
+}
+
+func (e UsageError) Error() string {
+	return e.Err.Error()
+}
+
+func (e UsageError) Unwrap() error {
+	return e.Err
+}
+
+type HTTPStatusError struct {
+	StatusCode int
+	Status     string
+	Body       string
+}
+
+func (e HTTPStatusError) Error() string {
+	if e.Body == "" {
+		return "unexpected response: " + e.Status
+	}
+	return fmt.Sprintf("unexpected response: %s: %s", e.Status, e.Body)
+}
+
+// tokenRequestError는 OAuth 토큰을 받지 못한 오류다. 토큰 엔드포인트에 닿지 못해도
+// 요청 대상 서버의 네트워크 오류와 구별하도록 internal로 분류한다.
+type tokenRequestError struct {
+	err error
+}
+
+func (e tokenRequestError) Error() string {
+	return e.err.Error()
+}
+
+func (e tokenRequestError) Unwrap() error {
+	return e.err
+}
+
+type AssertionError struct {
+	Expected string
+	Got      string
+}
+
+func (e AssertionError) Error() string {
+	return fmt.Sprintf("assertion failed: expected %s, got %s", e.Expected, e.Got)
+}
+
+type CommandError struct {
+	Category   ErrorCategory `json:"category"`
+	Message    string        `json:"message"`
+	ExitCode   int           `json:"exit_code"`
+	HTTPStatus int           `json:"http_status,omitempty"`
+	GRPCCode   string        `json:"grpc_code,omitempty"`
+}
+
+func (e *CommandError) Error() string {
+	return e.Message
+}
+
+var usageErrors = []error{
+	ErrorNoServerSpecified,
+	ErrorInvalidHttpMethod,
+	ErrorInvalidHTTPPostOption,
+	ErrorPluginNotFound,
+	ErrorInvalidPluginsCommand,
+	ErrorInvalidBasicAuth,
+	ErrorConflictingAuth,
+	ErrorNoTokenURL,
+	ErrorNoClientID,
+	ErrorInvalidStreamFormat,
+	ErrorInvalidProxy,
+	ErrorInvalidGrpcService,
+}
+
+// ClassifyError는 오류를 분류해 종료 코드와 함께 돌려준다. err가 nil이면 nil을 반환한다.
+func ClassifyError(err error) *CommandError {
+	if err == nil {
+		return nil
+	}
+	e := &CommandError{Message: err.Error(), Category: CategoryInternal}
+
+	var commandErr *CommandError
+	var usageErr UsageError
+	var httpErr HTTPStatusError
+	var assertErr AssertionError
+	var tokenErr tokenRequestError
+	var exitErr *exec.ExitError
+	var grpcErr interface{ GRPCStatus() *status.Status }
+	switch {
+	case errors.As(err, &commandErr):
+		return commandErr
+	case errors.As(err, &usageErr) || isOneOf(err, usageErrors) || isURLUsageError(err):
+		e.Category = CategoryUsage
+	case errors.As(err, &exitErr):
+		e.Category = CategoryPlugin
+		e.ExitCode = exitErr.ExitCode()
+		// 시그널로 종료된 플러그인은 -1을 돌려준다
+		if e.ExitCode < 0 {
+			e.ExitCode = ExitInternal
+		}
+		return e
+	case errors.As(err, &tokenErr):
+		e.Category = CategoryInternal
+	case errors.As(err, &assertErr):
+		e.Category = CategoryAssertion
+	case errors.As(err, &httpErr):
+		e.Category = CategoryHTTPStatus
+		e.HTTPStatus = httpErr.StatusCode
+	case isTLSError(err):
+		e.Category = CategoryTLS
+	case errors.As(err, &grpcErr):
+		code := grpcErr.GRPCStatus().Code()
+		e.GRPCCode = code.String()
+		e.Category = CategoryGRPCStatus
+		// 서버에 닿지 못한 호출은 네트워크 오류로 본다
+		if code == codes.Unavailable || code == codes.DeadlineExceeded {
+			e.Category = CategoryNetwork
+		}
+	case isNetworkError(err):
+		e.Category = CategoryNetwork
+	}
+	e.ExitCode = exitCodes[e.Category]
+	return e
+}
+
+func ExitCode(err error) int {
+	if err == nil || errors.Is(err, flag.ErrHelp) {
+		return ExitOK
+	}
+	return ClassifyError(err).ExitCode
+}
+
+func isOneOf(err error, targets []error) bool {
+	for _, t := range targets {
+		if errors.Is(err, t) {
+			return true
+		}
+	}
+	return false
+}
+
+func isTLSError(err error) bool {
+	var unknownAuthority x509.UnknownAuthorityError
+	var hostname x509.HostnameError
+	var invalid x509.CertificateInvalidError
+	var verification *tls.CertificateVerificationError
+	var record tls.RecordHeaderError
+	var alert tls.AlertError
+	return errors.As(err, &unknownAuthority) ||
+		errors.As(err, &hostname) ||
+		errors.As(err, &invalid) ||
+		errors.As(err, &verification) ||
+		errors.As(err, &record) ||
+		errors.As(err, &alert)
+}
+
+// isURLUsageError는 잘못된 URL로 요청을 만들지 못한 오류인지 확인한다.
+func isURLUsageError(err error) bool {
+	var urlErr *url.Error
+	if !errors.As(err, &urlErr) {
+		return false
+	}
+	// net/http는 지원하지 않는 스킴을 구별할 수 있는 오류로 돌려주지 않는다
+	return urlErr.Op == "parse" || strings.HasPrefix(urlErr.Err.Error(), "unsupported protocol scheme")
+}
+
+func isNetworkError(err error) bool {
+	// *url.Error는 모든 요청 오류를 감싸고 net.Error를 구현하므로 안쪽 오류로 판단한다
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		err = urlErr.Err
+		// 서버가 응답하기 전에 연결을 끊은 경우
+		if errors.Is(err, io.EOF) {
+			return true
+		}
+	}
+	var opErr *net.OpError
+	var dnsErr *net.DNSError
+	var netErr net.Error
+	return errors.As(err, &opErr) ||
+		errors.As(err, &dnsErr) ||
+		(errors.As(err, &netErr) && netErr.Timeout()) ||
+		errors.Is(err, context.DeadlineExceeded) ||
+		errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+type Timings struct {
+	Start       time.Time `json:"start"`
+	TotalMs     float64   `json:"total_ms"`
+	DNSMs       float64   `json:"dns_ms,omitempty"`
+	ConnectMs   float64   `json:"connect_ms,omitempty"`
+	TLSMs       float64   `json:"tls_ms,omitempty"`
+	FirstByteMs float64   `json:"first_byte_ms,omitempty"`
+}
+
+type Result struct {
+	Command    string        `json:"command"`
+	Status     string        `json:"status"`
+	ExitCode   int           `json:"exit_code"`
+	Timings    Timings       `json:"timings"`
+	HTTPStatus int           `json:"http_status,omitempty"`
+	GRPCStatus string        `json:"grpc_status,omitempty"`
+	Messages   int           `json:"messages,omitempty"`
+	Body       *string       `json:"body,omitempty"`
+	BodyBase64 string        `json:"body_base64,omitempty"`
+	BodyFile   string        `json:"body_file,omitempty"`
+	Error      *CommandError `json:"error,omitempty"`
+}
+
+// ResultWriter는 -o json 모드에서 명령의 출력을 모아 하나의 결과 객체로 만든다.
+// 명령은 w가 *ResultWriter일 때만 상태 코드나 시간 같은 정보를 기록한다.
+type ResultWriter struct {
+	buf    bytes.Buffer
+	result Result
+}
+
+func NewResultWriter(command string) *ResultWriter {
+	return &ResultWriter{
+		result: Result{
+			Command: command,
+			Timings: Timings{Start: time.Now()},
+		},
+	}
+}
+
+func (rw *ResultWriter) Write(p []byte) (int, error) {
+	return rw.buf.Write(p)
+}
+
+func (rw *ResultWriter) Result(err error) Result {
+	r := rw.result
+	r.Timings.TotalMs = msSince(r.Timings.Start)
+	r.Status = "ok"
+	if err != nil && !errors.Is(err, flag.ErrHelp) {
+		r.Status = "error"
+		r.Error = ClassifyError(err)
+		r.ExitCode = r.Error.ExitCode
+		if r.Error.HTTPStatus != 0 && r.HTTPStatus == 0 {
+			r.HTTPStatus = r.Error.HTTPStatus
+		}
+		if r.Error.GRPCCode != "" {
+			r.GRPCStatus = r.Error.GRPCCode
+		}
+	}
+	if rw.buf.Len() > 0 {
+		data := rw.buf.Bytes()
+		if utf8.Valid(data) {
+			body := string(data)
+			r.Body = &body
+		} else {
+			r.BodyBase64 = base64.StdEncoding.EncodeToString(data)
+		}
+	}
+	return r
+}
+
+func WriteResult(w io.Writer, r Result) error {
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	return enc.Encode(r)
+}
+
+func msSince(t time.Time) float64 {
+	return float64(time.Since(t).Microseconds()) / 1000
+}
+
+func recordHTTPStatus(w io.Writer, code int) {
+	if rw, ok := w.(*ResultWriter); ok {
+		rw.result.HTTPStatus = code
+	}
+}
+
+func recordGRPCStatus(w io.Writer, code string) {
+	if rw, ok := w.(*ResultWriter); ok {
+		rw.result.GRPCStatus = code
+	}
+}
+
+func recordBodyFile(w io.Writer, path string) {
+	if rw, ok := w.(*ResultWriter); ok {
+		rw.result.BodyFile = path
+	}
+}
+
+func recordMessages(w io.Writer, n int) {
+	if rw, ok := w.(*ResultWriter); ok {
+		rw.result.Messages = n
+	}
+}
+
+// withHTTPTrace는 JSON 모드에서 연결 단계별 시간을 기록한다.
+func withHTTPTrace(ctx context.Context, w io.Writer) context.Context {
+	rw, ok := w.(*ResultWriter)
+	if !ok {
+		return ctx
+	}
+	t := &rw.result.Timings
+	var dnsStart, connectStart, tlsStart time.Time
+	start := time.Now()
+	trace := &httptrace.ClientTrace{
+		DNSStart: func(httptrace.DNSStartInfo) { dnsStart = time.Now() },
+		DNSDone: func(httptrace.DNSDoneInfo) {
+			t.DNSMs = msSince(dnsStart)
+		},
+		ConnectStart: func(string, string) { connectStart = time.Now() },
+		ConnectDone: func(string, string, error) {
+			t.ConnectMs = msSince(connectStart)
+		},
+		TLSHandshakeStart: func() { tlsStart = time.Now() },
+		TLSHandshakeDone: func(tls.ConnectionState, error) {
+			t.TLSMs = msSince(tlsStart)
+		},
+		GotFirstResponseByte: func() {
+			t.FirstByteMs = msSince(start)
+		},
+	}
+	return httptrace.WithClientTrace(ctx, trace)
+}
@@ -0,0 +1,450 @@
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	streamFormatAuto   = "auto"
+	streamFormatRaw    = "raw"
+	streamFormatNDJSON = "ndjson"
+	streamFormatSSE    = "sse"
+)
+
+// 지정한 개수의 메시지를 받으면 스트림을 정상 종료한다
+var errStreamDone = errors.New("stream done")
+
+type streamConfig struct {
+	url           string
+	format        string
+	header        Header
+	auth          authConfig
+	network       networkConfig
+	filters       Filters
+	count         int
+	idleTimeout   time.Duration
+	reconnect     bool
+	maxReconnects int
+	retry         time.Duration
+}
+
+type streamState struct {
+	sse         bool
+	received    int
+	lastEventID string
+	retry       time.Duration
+	timer       *time.Timer
+	idleTimeout time.Duration
+}
+
+type sseEvent struct {
+	event string
+	data  []string
+}
+
+type streamFilter struct {
+	path  []string
+	value string
+	any   bool
+}
+
+type Filters []streamFilter
+
+func (f *Filters) Set(value string) error {
+	sf := streamFilter{any: true}
+	key := value
+	if k, v, ok := strings.Cut(value, "="); ok {
+		key = k
+		sf.value = v
+		sf.any = false
+	}
+	if key == "" {
+		return errors.New("filter must be field or field=value")
+	}
+	sf.path = strings.Split(key, ".")
+	*f = append(*f, sf)
+	return nil
+}
+
+func (f *Filters) String() string {
+	return fmt.Sprint(*f)
+}
+
+type idleReader struct {
+	r     io.Reader
+	state *streamState
+}
+
+func (ir idleReader) Read(p []byte) (int, error) {
+	n, err := ir.r.Read(p)
+	if n > 0 && ir.state.timer != nil {
+		ir.state.timer.Reset(ir.state.idleTimeout)
+	}
+	return n, err
+}
+
+func HandleStream(w io.Writer, args []string) error {
+	c := streamConfig{header: Header{}}
+	var idleTimeout int
+	var retry int
+
+	fs := flag.NewFlagSet("stream", flag.ContinueOnError)
+	fs.SetOutput(w)
+	fs.StringVar(&c.format, "format", streamFormatAuto, "Stream format: auto, raw, ndjson or sse")
+	fs.Var(&c.header, "header", "Header value (key=value)")
+	fs.Var(&c.filters, "filter", "Only print NDJSON lines with field or field=value (nested: a.b=value)")
+	fs.IntVar(&c.count, "count", 0, "Exit after receiving this many messages (0 = unlimited)")
+	fs.IntVar(&idleTimeout, "idle-timeout", 0, "Exit when no data arrives for this long, unit is ms (0 = disabled)")
+	fs.BoolVar(&c.reconnect, "reconnect", true, "Reconnect SSE streams with Last-Event-ID")
+	fs.IntVar(&c.maxReconnects, "max-reconnects", 0, "Maximum SSE reconnects (0 = unlimited)")
+	fs.IntVar(&retry, "retry", 3000, "Initial SSE reconnect delay, unit is ms")
+	addAuthFlags(fs, &c.auth)
+	addNetworkFlags(fs, &c.network)
+
+	fs.Usage = func() {
+		var usageString = `
+stream: Print an HTTP response stream (chunked, NDJSON or SSE) as it arrives
+stream: <options> server`
+
+		fmt.Fprint(w, usageString)
+		fmt.Fprintln(w)
+		fmt.Fprintln(w)
+		fmt.Fprintln(w, "Options: ")
+		fs.PrintDefaults()
+	}
+
+	err := fs.Parse(args)
+	if err != nil {
+		return UsageError{err}
+	}
+
+	if fs.NArg() != 1 {
+		return ErrorNoServerSpecified
+	}
+
+	switch c.format {
+	case streamFormatAuto, streamFormatRaw, streamFormatNDJSON, streamFormatSSE:
+	default:
+		return ErrorInvalidStreamFormat
+	}
+	c.auth.prompt = os.Stderr
+	if err := c.auth.validate(); err != nil {
+		return err
+	}
+	c.network.log = os.Stderr
+	if err := c.network.validate(); err != nil {
+		return err
+	}
+	c.auth.httpClient = c.network.httpClient()
+	c.url = fs.Arg(0)
+	c.idleTimeout = time.Duration(idleTimeout) * time.Millisecond
+	c.retry = time.Duration(retry) * time.Millisecond
+
+	return streamRemoteResource(w, c.network.httpClient(), c)
+}
+
+func streamRemoteResource(w io.Writer, client *http.Client, c streamConfig) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	st := &streamState{retry: c.retry, idleTimeout: c.idleTimeout}
+	defer func() { recordMessages(w, st.received) }()
+	var idle atomic.Bool
+	if c.idleTimeout > 0 {
+		st.timer = time.AfterFunc(c.idleTimeout, func() {
+			idle.Store(true)
+			cancel()
+		})
+		defer st.timer.Stop()
+	}
+
+	reconnects := 0
+	for {
+		sse, err := st.streamOnce(ctx, w, client, c)
+		if errors.Is(err, errStreamDone) || idle.Load() {
+			return nil
+		}
+		var statusErr HTTPStatusError
+		if !sse || !c.reconnect || errors.As(err, &statusErr) {
+			return err
+		}
+		if c.maxReconnects > 0 && reconnects >= c.maxReconnects {
+			return err
+		}
+		reconnects++
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(st.retry):
+		}
+	}
+}
+
+func (st *streamState) streamOnce(
+	ctx context.Context, w io.Writer, client *http.Client, c streamConfig,
+) (bool, error) {
+	req, err := http.NewRequestWithContext(withHTTPTrace(ctx, w), "GET", c.url, nil)
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Accept", "text/event-stream, application/x-ndjson, */*")
+	for k, v := range c.header {
+		req.Header.Add(k, v)
+	}
+	authorization, err := c.auth.authorization(ctx)
+	if err != nil {
+		return false, err
+	}
+	if authorization != "" {
+		req.Header.Set("Authorization", authorization)
+	}
+	if st.lastEventID != "" {
+		req.Header.Set("Last-Event-ID", st.lastEventID)
+	}
+
+	r, err := client.Do(req)
+	if err != nil {
+		// 연결 실패도 SSE라면 재연결 대상이다
+		return c.format == streamFormatSSE || st.sse, err
+	}
+	defer r.Body.Close()
+
+	format := streamFormat(c, r.Header.Get("Content-Type"))
+	sse := format == streamFormatSSE
+	st.sse = st.sse || sse
+	if sse && r.StatusCode == http.StatusNoContent {
+		// 서버가 204를 보내면 재연결하지 않는다
+		return sse, errStreamDone
+	}
+	recordHTTPStatus(w, r.StatusCode)
+	if r.StatusCode != http.StatusOK {
+		data, _ := io.ReadAll(io.LimitReader(r.Body, 512))
+		return sse, HTTPStatusError{
+			StatusCode: r.StatusCode,
+			Status:     r.Status,
+			Body:       strings.TrimSpace(string(data)),
+		}
+	}
+
+	body := idleReader{r: r.Body, state: st}
+	switch format {
+	case streamFormatSSE:
+		return sse, st.readEvents(w, body, c)
+	case streamFormatNDJSON:
+		return sse, st.readLines(w, body, c)
+	default:
+		return sse, st.copyChunks(w, body, c)
+	}
+}
+
+func streamFormat(c streamConfig, contentType string) string {
+	if c.format != streamFormatAuto {
+		return c.format
+	}
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	switch {
+	case mediaType == "text/event-stream":
+		return streamFormatSSE
+	case len(c.filters) > 0,
+		mediaType == "application/x-ndjson",
+		mediaType == "application/ndjson",
+		mediaType == "application/jsonl":
+		return streamFormatNDJSON
+	default:
+		return streamFormatRaw
+	}
+}
+
+// copyChunks는 받은 데이터를 그대로 출력하고 줄 단위로 메시지 수를 센다.
+func (st *streamState) copyChunks(w io.Writer, r io.Reader, c streamConfig) error {
+	buf := make([]byte, 4096)
+	for {
+		n, err := r.Read(buf)
+		chunk := buf[:n]
+		for c.count > 0 && len(chunk) > 0 {
+			i := bytes.IndexByte(chunk, '\n')
+			if i < 0 {
+				break
+			}
+			if _, werr := w.Write(chunk[:i+1]); werr != nil {
+				return werr
+			}
+			chunk = chunk[i+1:]
+			st.received++
+			if st.received >= c.count {
+				return errStreamDone
+			}
+		}
+		if len(chunk) > 0 {
+			if _, werr := w.Write(chunk); werr != nil {
+				return werr
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (st *streamState) readLines(w io.Writer, r io.Reader, c streamConfig) error {
+	reader := bufio.NewReader(r)
+	for {
+		line, err := reader.ReadBytes('\n')
+		trimmed := bytes.TrimSpace(line)
+		if len(trimmed) > 0 && c.filters.match(trimmed) {
+			fmt.Fprintf(w, "%s\n", trimmed)
+			st.received++
+			if c.count > 0 && st.received >= c.count {
+				return errStreamDone
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (f Filters) match(line []byte) bool {
+	if len(f) == 0 {
+		return true
+	}
+	var v interface{}
+	if err := json.Unmarshal(line, &v); err != nil {
+		return false
+	}
+	for _, sf := range f {
+		if !sf.match(v) {
+			return false
+		}
+	}
+	return true
+}
+
+func (sf streamFilter) match(v interface{}) bool {
+	for _, key := range sf.path {
+		obj, ok := v.(map[string]interface{})
+		if !ok {
+			return false
+		}
+		v, ok = obj[key]
+		if !ok {
+			return false
+		}
+	}
+	if sf.any {
+		return true
+	}
+	switch value := v.(type) {
+	case string:
+		return value == sf.value
+	case nil:
+		return sf.value == "null"
+	default:
+		data, err := json.Marshal(value)
+		return err == nil && string(data) == sf.value
+	}
+}
+
+// readEvents는 text/event-stream 형식을 해석한다.
+// https://html.spec.whatwg.org/multipage/server-sent-events.html
+func (st *streamState) readEvents(w io.Writer, r io.Reader, c streamConfig) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	scanner.Split(scanSSELines)
+	ev := sseEvent{}
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			if ev.data == nil {
+				ev = sseEvent{}
+				continue
+			}
+			writeEvent(w, ev, st.lastEventID)
+			ev = sseEvent{}
+			st.received++
+			if c.count > 0 && st.received >= c.count {
+				return errStreamDone
+			}
+			continue
+		}
+		if strings.HasPrefix(line, ":") {
+			continue
+		}
+		field, value, _ := strings.Cut(line, ":")
+		value = strings.TrimPrefix(value, " ")
+		switch field {
+		case "event":
+			ev.event = value
+		case "data":
+			ev.data = append(ev.data, value)
+		case "id":
+			if !strings.ContainsRune(value, 0) {
+				st.lastEventID = value
+			}
+		case "retry":
+			if ms, err := strconv.Atoi(value); err == nil && ms >= 0 {
+				st.retry = time.Duration(ms) * time.Millisecond
+			}
+		}
+	}
+	return scanner.Err()
+}
+
+func writeEvent(w io.Writer, ev sseEvent, lastEventID string) {
+	if ev.event != "" {
+		fmt.Fprintf(w, "event: %s\n", ev.event)
+	}
+	if lastEventID != "" {
+		fmt.Fprintf(w, "id: %s\n", lastEventID)
+	}
+	for _, d := range ev.data {
+		fmt.Fprintf(w, "data: %s\n", d)
+	}
+	fmt.Fprintln(w)
+}
+
+// scanSSELines는 CRLF, LF, CR 중 어느 것이든 줄 끝으로 인식한다.
+func scanSSELines(data []byte, atEOF bool) (int, []byte, error) {
+	if atEOF && len(data) == 0 {
+		return 0, nil, nil
+	}
+	if i := bytes.IndexAny(data, "\r\n"); i >= 0 {
+		if data[i] == '\r' {
+			if i+1 < len(data) {
+				if data[i+1] == '\n' {
+					return i + 2, data[:i], nil
+				}
+				return i + 1, data[:i], nil
+			}
+			if !atEOF {
+				// \r 다음에 \n이 올 수 있으니 더 읽는다
+				return 0, nil, nil
+			}
+		}
+		return i + 1, data[:i], nil
+	}
+	if atEOF {
+		return len(data), data, nil
+	}
+	return 0, nil, nil
+}
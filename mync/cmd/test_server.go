@@ -7,6 +7,8 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"strings"
+	"sync"
+	"time"
 )
 
 func packageHTTPHandler(w http.ResponseWriter, r *http.Request) {
@@ -71,3 +73,98 @@ func StartTestPackageServer() *httptest.Server {
 	ts := httptest.NewServer(http.HandlerFunc(packageHTTPHandler))
 	return ts
 }
+
+type TestTokenServer struct {
+	*httptest.Server
+	mu       sync.Mutex
+	issued   int
+	grants   []string
+	polls    int
+	clientID string
+	secret   string
+	// delay만큼 기다린 뒤 토큰 요청에 응답한다
+	delay time.Duration
+}
+
+func (ts *TestTokenServer) SetDelay(d time.Duration) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	ts.delay = d
+}
+
+func (ts *TestTokenServer) Grants() []string {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	return append([]string{}, ts.grants...)
+}
+
+func (ts *TestTokenServer) writeToken(w http.ResponseWriter, refresh bool) {
+	ts.issued++
+	resp := map[string]interface{}{
+		"access_token": fmt.Sprintf("token-%d", ts.issued),
+		"token_type":   "Bearer",
+		"expires_in":   3600,
+	}
+	if refresh {
+		resp["refresh_token"] = fmt.Sprintf("refresh-%d", ts.issued)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+func writeTokenError(w http.ResponseWriter, code string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	fmt.Fprintf(w, `{"error":%q}`, code)
+}
+
+func (ts *TestTokenServer) tokenHandler(w http.ResponseWriter, r *http.Request) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	time.Sleep(ts.delay)
+	if err := r.ParseForm(); err != nil {
+		writeTokenError(w, "invalid_request")
+		return
+	}
+	grant := r.PostForm.Get("grant_type")
+	ts.grants = append(ts.grants, grant)
+	switch grant {
+	case "client_credentials":
+		id, secret, ok := r.BasicAuth()
+		if !ok || id != ts.clientID || secret != ts.secret {
+			writeTokenError(w, "invalid_client")
+			return
+		}
+		ts.writeToken(w, false)
+	case "refresh_token":
+		if !strings.HasPrefix(r.PostForm.Get("refresh_token"), "refresh-") {
+			writeTokenError(w, "invalid_grant")
+			return
+		}
+		ts.writeToken(w, true)
+	case deviceCodeGrantType:
+		ts.polls++
+		if ts.polls == 1 {
+			writeTokenError(w, "authorization_pending")
+			return
+		}
+		ts.writeToken(w, true)
+	default:
+		writeTokenError(w, "unsupported_grant_type")
+	}
+}
+
+func (ts *TestTokenServer) deviceHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	fmt.Fprint(w, `{"device_code":"dev-code","user_code":"ABCD-EFGH",`+
+		`"verification_uri":"http://localhost/device","expires_in":60,"interval":1}`)
+}
+
+func StartTestTokenServer(clientID, secret string) *TestTokenServer {
+	ts := &TestTokenServer{clientID: clientID, secret: secret}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/token", ts.tokenHandler)
+	mux.HandleFunc("/device", ts.deviceHandler)
+	ts.Server = httptest.NewServer(mux)
+	return ts
+}
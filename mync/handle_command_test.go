@@ -0,0 +1,138 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/PaulOh5/mync/cmd"
+)
+
+func TestRunJSONOutput(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "POST" {
+			http.Error(w, "package exists", http.StatusConflict)
+			return
+		}
+		if r.URL.Path == "/missing" {
+			http.Error(w, "no package", http.StatusNotFound)
+			return
+		}
+		fmt.Fprint(w, "package1-0.1")
+	}))
+	defer ts.Close()
+
+	testConfigs := []struct {
+		args       []string
+		exitCode   int
+		status     string
+		httpStatus int
+		category   cmd.ErrorCategory
+		body       string
+	}{
+		// 정상 응답
+		{
+			args:       []string{"-o", "json", "http", "get", ts.URL},
+			exitCode:   cmd.ExitOK,
+			status:     "ok",
+			httpStatus: 200,
+			body:       "package1-0.1",
+		},
+		// 기대한 상태 코드와 다른 경우
+		{
+			args:       []string{"-o", "json", "http", "get", "-expect-status", "201", ts.URL},
+			exitCode:   cmd.ExitAssertion,
+			status:     "error",
+			httpStatus: 200,
+			category:   cmd.CategoryAssertion,
+			body:       "package1-0.1",
+		},
+		// 서버가 오류 상태 코드로 응답한 경우
+		{
+			args:       []string{"-o", "json", "http", "post", "-body", "{}", ts.URL},
+			exitCode:   cmd.ExitHTTPStatus,
+			status:     "error",
+			httpStatus: 409,
+			category:   cmd.CategoryHTTPStatus,
+		},
+		// GET에 서버가 오류 상태 코드로 응답한 경우
+		{
+			args:       []string{"-o", "json", "http", "get", ts.URL + "/missing"},
+			exitCode:   cmd.ExitHTTPStatus,
+			status:     "error",
+			httpStatus: 404,
+			category:   cmd.CategoryHTTPStatus,
+		},
+		// 오류 상태 코드를 기대한 경우
+		{
+			args:       []string{"-o", "json", "http", "get", "-expect-status", "404", ts.URL + "/missing"},
+			exitCode:   cmd.ExitOK,
+			status:     "ok",
+			httpStatus: 404,
+			body:       "no package\n",
+		},
+		// 서버에 연결할 수 없는 경우
+		{
+			args:     []string{"-o", "json", "http", "get", "http://127.0.0.1:1"},
+			exitCode: cmd.ExitNetwork,
+			status:   "error",
+			category: cmd.CategoryNetwork,
+		},
+		// 서브 커맨드가 잘못 지정된 경우
+		{
+			args:     []string{"-o", "json", "no-such-command"},
+			exitCode: cmd.ExitUsage,
+			status:   "error",
+			category: cmd.CategoryUsage,
+		},
+	}
+
+	for _, tc := range testConfigs {
+		stdout := new(bytes.Buffer)
+		stderr := new(bytes.Buffer)
+		exitCode := run(stdout, stderr, tc.args)
+		if exitCode != tc.exitCode {
+			t.Errorf("%v: Expected exit code %d, but got %d", tc.args, tc.exitCode, exitCode)
+		}
+		if strings.Count(stdout.String(), "\n") != 1 {
+			t.Fatalf("%v: Expected one JSON object, but got %q", tc.args, stdout.String())
+		}
+		r := cmd.Result{}
+		if err := json.Unmarshal(stdout.Bytes(), &r); err != nil {
+			t.Fatalf("%v: Expected JSON output, but got %q", tc.args, stdout.String())
+		}
+		if r.Status != tc.status || r.ExitCode != tc.exitCode || r.HTTPStatus != tc.httpStatus {
+			t.Errorf("%v: Unexpected result %+v", tc.args, r)
+		}
+		if tc.category != "" && (r.Error == nil || r.Error.Category != tc.category) {
+			t.Errorf("%v: Expected error category %s, but got %+v", tc.args, tc.category, r.Error)
+		}
+		if tc.body != "" && (r.Body == nil || *r.Body != tc.body) {
+			t.Errorf("%v: Expected body %q, but got %v", tc.args, tc.body, r.Body)
+		}
+	}
+}
+
+func TestRunTextErrors(t *testing.T) {
+	stdout := new(bytes.Buffer)
+	stderr := new(bytes.Buffer)
+	exitCode := run(stdout, stderr, []string{"http", "get", "http://127.0.0.1:1"})
+	if exitCode != cmd.ExitNetwork {
+		t.Errorf("Expected exit code %d, but got %d", cmd.ExitNetwork, exitCode)
+	}
+	if stdout.Len() != 0 {
+		t.Errorf("Expected empty stdout, but got %q", stdout.String())
+	}
+	if !strings.HasPrefix(stderr.String(), "Error: ") {
+		t.Errorf("Expected error on stderr, but got %q", stderr.String())
+	}
+
+	exitCode = run(stdout, stderr, []string{"-o", "yaml", "http"})
+	if exitCode != cmd.ExitUsage {
+		t.Errorf("Expected exit code %d, but got %d", cmd.ExitUsage, exitCode)
+	}
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"errors"
+	"flag"
 	"fmt"
 	"io"
 	"os"
@@ -9,15 +10,46 @@ import (
 	"github.com/PaulOh5/mync/cmd"
 )
 
-var errInvalidSubCommand = errors.New("invalid sub-command specified")
+var errInvalidSubCommand error = cmd.UsageError{Err: errors.New("invalid sub-command specified")}
+
+var errInvalidOutputFormat error = cmd.UsageError{Err: errors.New("invalid output format. format must be text or json")}
+
+type globalConfig struct {
+	profile string
+	output  string
+}
 
 func printUsage(w io.Writer) {
-	fmt.Fprintln(w, "Usage: mync [http|grpc] -h")
+	fmt.Fprintln(w, "Usage: mync [-profile name] [-o text|json] [http|grpc|stream|plugins|<plugin>] -h")
 	cmd.HandleHttp(w, []string{"-h"})
 	cmd.HandleGrpc(w, []string{"-h"})
+	cmd.HandleStream(w, []string{"-h"})
+	cmd.PrintPluginUsage(w)
+	fmt.Fprintln(w)
+	cmd.PrintExitCodes(w)
 }
 
-func handleCommand(w io.Writer, args []string) error {
+func parseGlobalOptions(w io.Writer, args []string) (globalConfig, []string, error) {
+	c := globalConfig{}
+	fs := flag.NewFlagSet("mync", flag.ContinueOnError)
+	fs.SetOutput(w)
+	fs.StringVar(&c.profile, "profile", os.Getenv("MYNC_PROFILE"), "Profile name passed to plugins (env MYNC_PROFILE)")
+	fs.StringVar(&c.output, "o", "text", "Output format: text or json")
+	fs.Usage = func() {}
+	err := fs.Parse(args)
+	if err != nil {
+		return c, nil, cmd.UsageError{Err: err}
+	}
+	if c.profile == "" {
+		c.profile = "default"
+	}
+	if c.output != "text" && c.output != "json" {
+		return c, nil, errInvalidOutputFormat
+	}
+	return c, fs.Args(), nil
+}
+
+func handleCommand(w io.Writer, global globalConfig, args []string) error {
 	var err error
 	if len(args) < 1 {
 		err = errInvalidSubCommand
@@ -27,12 +59,16 @@ func handleCommand(w io.Writer, args []string) error {
 			err = cmd.HandleHttp(w, args[1:])
 		case "grpc":
 			err = cmd.HandleGrpc(w, args[1:])
+		case "stream":
+			err = cmd.HandleStream(w, args[1:])
+		case "plugins":
+			err = cmd.HandlePlugins(w, args[1:])
 		case "-h":
 			printUsage(w)
 		case "--help":
 			printUsage(w)
 		default:
-			err = errInvalidSubCommand
+			err = runPlugin(w, global, args)
 		}
 	}
 
@@ -45,9 +81,67 @@ func handleCommand(w io.Writer, args []string) error {
 	return err
 }
 
-func main() {
-	err := handleCommand(os.Stdout, os.Args[1:])
+func runPlugin(w io.Writer, global globalConfig, args []string) error {
+	p, err := cmd.LookupPlugin(args[0])
+	if err != nil {
+		return errInvalidSubCommand
+	}
+	return cmd.RunPlugin(w, p, args[1:], cmd.PluginConfig{
+		Profile: global.profile,
+		Stdin:   os.Stdin,
+		Stderr:  os.Stderr,
+	})
+}
+
+func commandName(args []string) string {
+	if len(args) == 0 {
+		return ""
+	}
+	if args[0] == "http" && len(args) > 1 {
+		return "http " + args[1]
+	}
+	return args[0]
+}
+
+// reported는 사용법이나 플러그인 출력으로 이미 사용자에게 보여준 오류인지 확인한다.
+func reported(err error) bool {
+	var usageErr cmd.UsageError
+	return errors.As(err, &usageErr) ||
+		errors.Is(err, cmd.ErrorNoServerSpecified) ||
+		errors.Is(err, cmd.ErrorInvalidHttpMethod) ||
+		errors.Is(err, cmd.ErrorInvalidHTTPPostOption) ||
+		cmd.ClassifyError(err).Category == cmd.CategoryPlugin
+}
+
+func run(stdout, stderr io.Writer, args []string) int {
+	global, args, err := parseGlobalOptions(stderr, args)
+	if errors.Is(err, flag.ErrHelp) {
+		printUsage(stdout)
+		return cmd.ExitOK
+	}
+
+	if global.output == "json" {
+		rw := cmd.NewResultWriter(commandName(args))
+		if err == nil {
+			err = handleCommand(rw, global, args)
+		}
+		cmd.WriteResult(stdout, rw.Result(err))
+		return cmd.ExitCode(err)
+	}
+
 	if err != nil {
-		os.Exit(1)
+		if errors.Is(err, errInvalidOutputFormat) {
+			fmt.Fprintln(stderr, err)
+		}
+		return cmd.ExitCode(err)
+	}
+	err = handleCommand(stdout, global, args)
+	if err != nil && !reported(err) {
+		fmt.Fprintf(stderr, "Error: %v\n", err)
 	}
+	return cmd.ExitCode(err)
+}
+
+func main() {
+	os.Exit(run(os.Stdout, os.Stderr, os.Args[1:]))
 }